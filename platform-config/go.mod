@@ -0,0 +1,8 @@
+module github.com/hawful70/platform-config
+
+go 1.25.0
+
+require (
+	github.com/joho/godotenv v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,340 @@
+// Package config loads a service's configuration into a struct described
+// by field tags:
+//
+//	type Config struct {
+//		HTTPPort     string        `env:"HTTP_PORT" default:"8081"`
+//		JWTSecret    string        `env:"JWT_SECRET" secret:"true" validate:"required"`
+//		JWTExpiresIn time.Duration `env:"JWT_EXPIRES_IN" default:"15m" validate:"min=1s"`
+//	}
+//
+// Each field is read from these sources, later ones winning:
+//
+//  1. the default tag
+//  2. the YAML file named by CONFIG_FILE or --config, keyed by the
+//     lower-cased variable name (http_port: "8081")
+//  3. the .env file given to WithDotEnv
+//  4. the environment, or the file named by <NAME>_FILE, such as a mounted
+//     secret
+//  5. command-line flags named after the variable (--http-port=8081),
+//     except for secrets, since other processes can read command lines
+//
+// An empty value counts as unset, except for lists, where it means no
+// elements. The validate tag lists rules, separated by commas: required,
+// oneof=a b c, and min=N and max=N, which bound numbers and durations by
+// value and strings and lists by length. Rules other than required pass
+// empty strings and lists. Fields may be strings, booleans, integers,
+// time.Duration and comma-separated []string; fields without an env tag are
+// left alone.
+//
+// Load reports every invalid value at once, then calls the struct's
+// Validate method, if it has one, for rules spanning several fields.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Source names where a value came from.
+type Source string
+
+const (
+	SourceDefault    Source = "default"
+	SourceFile       Source = "file"
+	SourceDotEnv     Source = ".env"
+	SourceEnv        Source = "env"
+	SourceSecretFile Source = "secret file"
+	SourceFlag       Source = "flag"
+)
+
+// Sources maps variable names to the source of their value. Variables left
+// at their zero value are missing.
+type Sources map[string]Source
+
+const (
+	// FileEnv and FileFlag name the YAML file to read.
+	FileEnv  = "CONFIG_FILE"
+	FileFlag = "config"
+	// fileSuffix marks a variable holding the path of its value.
+	fileSuffix = "_FILE"
+)
+
+// Validator is implemented by configs with rules spanning several fields.
+// Validate runs only when every field holds a valid value, and may return
+// several errors joined with errors.Join.
+type Validator interface {
+	Validate() error
+}
+
+type Option func(*loader)
+
+// WithArgs parses args as flags. Flags other than --config are named after
+// the variables, lower-cased with dashes: --jwt-expires-in=1h. Fields
+// tagged secret:"true" have no flag.
+func WithArgs(args []string) Option {
+	return func(l *loader) { l.args = args }
+}
+
+// WithDotEnv reads variables from the .env file at path, below the
+// environment. A missing file is ignored.
+func WithDotEnv(path string) Option {
+	return func(l *loader) { l.dotEnv = path }
+}
+
+// WithFlagOutput sets where flag usage and parse errors are written;
+// os.Stderr by default.
+func WithFlagOutput(w io.Writer) Option {
+	return func(l *loader) { l.flagOutput = w }
+}
+
+type loader struct {
+	args       []string
+	dotEnv     string
+	flagOutput io.Writer
+	lookupEnv  func(string) (string, bool)
+}
+
+type setting struct {
+	value  string
+	source Source
+}
+
+// Load fills dst, a pointer to a struct, and returns where each value came
+// from. On error dst still holds every value that could be read, so that it
+// can be printed, and the error joins one error per invalid variable. A
+// malformed command line returns the flag package's error, flag.ErrHelp
+// for -h.
+func Load(dst any, opts ...Option) (Sources, error) {
+	l := &loader{flagOutput: os.Stderr, lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	fields, err := schema(v.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	flags, file, err := l.parseFlags(fields)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		file, _ = l.lookupEnv(FileEnv)
+	}
+
+	settings := map[string]setting{}
+	put := func(f field, value string, source Source) {
+		if value == "" && f.typ.Kind() != reflect.Slice {
+			return
+		}
+		settings[f.name] = setting{value: value, source: source}
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if f.hasDefault {
+			put(f, f.def, SourceDefault)
+		}
+	}
+	if file != "" {
+		values, err := readYAML(file, fields)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, f := range fields {
+			if value, ok := values[f.name]; ok {
+				put(f, value, SourceFile)
+			}
+		}
+	}
+	if l.dotEnv != "" {
+		vars, err := godotenv.Read(l.dotEnv)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%s: %w", l.dotEnv, err))
+		}
+		errs = append(errs, readVars(fields, mapLookup(vars), SourceDotEnv, put)...)
+	}
+	errs = append(errs, readVars(fields, l.lookupEnv, SourceEnv, put)...)
+	for _, f := range fields {
+		if value, ok := flags[f.name]; ok {
+			put(f, value, SourceFlag)
+		}
+	}
+
+	sources := Sources{}
+	valid := true
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if s, ok := settings[f.name]; ok {
+			sources[f.name] = s.source
+			if err := parse(fv, s.value); err != nil {
+				valid = false
+				errs = append(errs, f.errorf(s, "%v", err))
+				continue
+			}
+		}
+		if err := f.check(fv); err != nil {
+			valid = false
+			errs = append(errs, err)
+		}
+	}
+	if valid {
+		if val, ok := dst.(Validator); ok {
+			if err := val.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return sources, errors.Join(errs...)
+}
+
+// readVars reads each field, or the file named by its _FILE variable, with
+// lookup.
+func readVars(fields []field, lookup func(string) (string, bool), source Source, put func(field, string, Source)) []error {
+	var errs []error
+	for _, f := range fields {
+		value, ok := lookup(f.name)
+		path, _ := lookup(f.name + fileSuffix)
+		switch {
+		case path != "" && value != "":
+			errs = append(errs, fmt.Errorf("%s: set %s or %s%s, not both", f.name, f.name, f.name, fileSuffix))
+		case path != "":
+			b, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", f.name, fileSuffix, err))
+				continue
+			}
+			put(f, strings.TrimRight(string(b), "\r\n"), SourceSecretFile)
+		case ok:
+			put(f, value, source)
+		}
+	}
+	return errs
+}
+
+func mapLookup(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+// readYAML reads a flat mapping of lower-cased variable names to scalars or
+// lists.
+func readYAML(path string, fields []field) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	known := map[string]string{}
+	for _, f := range fields {
+		known[strings.ToLower(f.name)] = f.name
+	}
+	values := map[string]string{}
+	var errs []error
+	for key, raw := range doc {
+		name, ok := known[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown key %q", path, key))
+			continue
+		}
+		if raw == nil {
+			continue
+		}
+		value, err := yamlString(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+			continue
+		}
+		values[name] = value
+	}
+	return values, errors.Join(errs...)
+}
+
+func yamlString(raw any) (string, error) {
+	switch v := raw.(type) {
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := yamlString(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", errors.New("nested mappings are not supported")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// parseFlags returns the values of the flags in args, keyed by variable
+// name, and the --config path.
+func (l *loader) parseFlags(fields []field) (map[string]string, string, error) {
+	values := map[string]string{}
+	if len(l.args) == 0 {
+		return values, "", nil
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(l.flagOutput)
+	var file string
+	fs.StringVar(&file, FileFlag, "", "YAML file to read, also "+FileEnv)
+	for _, f := range fields {
+		if f.secret {
+			continue
+		}
+		fs.Var(&flagValue{name: f.name, values: values, isBool: f.typ.Kind() == reflect.Bool}, FlagName(f.name), "sets "+f.name)
+	}
+	if err := fs.Parse(l.args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, file, nil
+}
+
+// FlagName returns the flag that sets the variable name.
+func FlagName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+// flagValue records a flag's value for parsing along with the other
+// sources, so that its errors are reported the same way.
+type flagValue struct {
+	name   string
+	values map[string]string
+	isBool bool
+}
+
+func (v *flagValue) String() string { return "" }
+
+func (v *flagValue) Set(s string) error {
+	v.values[v.name] = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
@@ -0,0 +1,363 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Port    string        `env:"PORT" default:"8080"`
+	Name    string        `env:"NAME" validate:"required"`
+	Mode    string        `env:"MODE" default:"dev" validate:"oneof=dev prod"`
+	Workers int           `env:"WORKERS" default:"4" validate:"min=1,max=16"`
+	Timeout time.Duration `env:"TIMEOUT" default:"5s" validate:"min=1s"`
+	Hosts   []string      `env:"HOSTS" default:"a,b"`
+	Debug   bool          `env:"DEBUG"`
+	Token   string        `env:"TOKEN" secret:"true" validate:"min=8"`
+	Ignored string
+}
+
+// withEnv replaces the process environment with env.
+func withEnv(env map[string]string) Option {
+	return func(l *loader) { l.lookupEnv = mapLookup(env) }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", "port: \"9000\"\nname: from-file\nhosts: [x, y]\n")
+	dotEnv := writeFile(t, ".env", "PORT=9001\nNAME=from-dotenv\n")
+	secret := writeFile(t, "token", "file-secret-value\n")
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		dotEnv  string
+		args    []string
+		port    string
+		source  Source
+		hosts   []string
+		nameVal string
+	}{
+		{
+			name:    "default",
+			env:     map[string]string{"NAME": "n"},
+			port:    "8080",
+			source:  SourceDefault,
+			hosts:   []string{"a", "b"},
+			nameVal: "n",
+		},
+		{
+			name:    "file over default",
+			env:     map[string]string{FileEnv: yamlFile},
+			port:    "9000",
+			source:  SourceFile,
+			hosts:   []string{"x", "y"},
+			nameVal: "from-file",
+		},
+		{
+			name:    "dotenv over file",
+			env:     map[string]string{FileEnv: yamlFile},
+			dotEnv:  dotEnv,
+			port:    "9001",
+			source:  SourceDotEnv,
+			hosts:   []string{"x", "y"},
+			nameVal: "from-dotenv",
+		},
+		{
+			name:    "env over dotenv",
+			env:     map[string]string{FileEnv: yamlFile, "PORT": "9002", "HOSTS": "z"},
+			dotEnv:  dotEnv,
+			port:    "9002",
+			source:  SourceEnv,
+			hosts:   []string{"z"},
+			nameVal: "from-dotenv",
+		},
+		{
+			name:    "flag over env",
+			env:     map[string]string{"PORT": "9002", "NAME": "n"},
+			args:    []string{"--config", yamlFile, "--port=9003"},
+			port:    "9003",
+			source:  SourceFlag,
+			hosts:   []string{"x", "y"},
+			nameVal: "n",
+		},
+		{
+			name:    "empty env value is unset",
+			env:     map[string]string{"PORT": "", "NAME": "n"},
+			port:    "8080",
+			source:  SourceDefault,
+			hosts:   []string{"a", "b"},
+			nameVal: "n",
+		},
+		{
+			name:    "empty list is no elements",
+			env:     map[string]string{"HOSTS": "", "NAME": "n"},
+			port:    "8080",
+			source:  SourceDefault,
+			hosts:   nil,
+			nameVal: "n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg testConfig
+			opts := []Option{withEnv(tc.env), WithArgs(tc.args), WithFlagOutput(io.Discard)}
+			if tc.dotEnv != "" {
+				opts = append(opts, WithDotEnv(tc.dotEnv))
+			}
+			sources, err := Load(&cfg, opts...)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Port != tc.port || sources["PORT"] != tc.source {
+				t.Errorf("PORT = %q from %q, want %q from %q", cfg.Port, sources["PORT"], tc.port, tc.source)
+			}
+			if !slices.Equal(cfg.Hosts, tc.hosts) {
+				t.Errorf("HOSTS = %q, want %q", cfg.Hosts, tc.hosts)
+			}
+			if cfg.Name != tc.nameVal {
+				t.Errorf("NAME = %q, want %q", cfg.Name, tc.nameVal)
+			}
+		})
+	}
+
+	t.Run("secret file", func(t *testing.T) {
+		var cfg testConfig
+		sources, err := Load(&cfg, withEnv(map[string]string{"NAME": "n", "TOKEN_FILE": secret}))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if cfg.Token != "file-secret-value" || sources["TOKEN"] != SourceSecretFile {
+			t.Errorf("TOKEN = %q from %q, want the file's contents", cfg.Token, sources["TOKEN"])
+		}
+	})
+}
+
+func TestLoadValueAndFileBothSet(t *testing.T) {
+	secret := writeFile(t, "token", "file-secret-value")
+	var cfg testConfig
+	_, err := Load(&cfg, withEnv(map[string]string{"NAME": "n", "TOKEN": "env-secret-value", "TOKEN_FILE": secret}))
+	if err == nil || !strings.Contains(err.Error(), "set TOKEN or TOKEN_FILE, not both") {
+		t.Fatalf("Load error = %v, want TOKEN and TOKEN_FILE rejected", err)
+	}
+}
+
+func TestLoadLists(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"one", []string{"one"}},
+		{"one,two", []string{"one", "two"}},
+		{" one , two ,, three ", []string{"one", "two", "three"}},
+		{",", nil},
+	}
+	for _, tc := range tests {
+		var cfg testConfig
+		if _, err := Load(&cfg, withEnv(map[string]string{"NAME": "n", "HOSTS": tc.value})); err != nil {
+			t.Fatalf("HOSTS=%q: %v", tc.value, err)
+		}
+		if !slices.Equal(cfg.Hosts, tc.want) {
+			t.Errorf("HOSTS=%q parsed as %q, want %q", tc.value, cfg.Hosts, tc.want)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"valid", map[string]string{"WORKERS": "16", "MODE": "prod", "TIMEOUT": "1s"}, ""},
+		{"required", map[string]string{"NAME": ""}, "NAME: is required"},
+		{"oneof", map[string]string{"MODE": "test"}, `MODE: "test" is not one of dev, prod`},
+		{"min int", map[string]string{"WORKERS": "0"}, "WORKERS: must be at least 1"},
+		{"max int", map[string]string{"WORKERS": "17"}, "WORKERS: must be at most 16"},
+		{"min duration", map[string]string{"TIMEOUT": "10ms"}, "TIMEOUT: must be at least 1s"},
+		{"min length", map[string]string{"TOKEN": "short"}, "TOKEN: must be at least 8 characters long"},
+		{"min passes empty", map[string]string{"TOKEN": ""}, ""},
+		{"not an integer", map[string]string{"WORKERS": "four"}, `WORKERS="four" (env): not an integer`},
+		{"not a duration", map[string]string{"TIMEOUT": "5"}, `TIMEOUT="5" (env): not a duration`},
+		{"not a boolean", map[string]string{"DEBUG": "maybe"}, `DEBUG="maybe" (env): not a boolean`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := map[string]string{"NAME": "n"}
+			for k, v := range tc.env {
+				env[k] = v
+			}
+			var cfg testConfig
+			_, err := Load(&cfg, withEnv(env))
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("Load: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("Load error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadAggregatesErrors(t *testing.T) {
+	var cfg testConfig
+	_, err := Load(&cfg, withEnv(map[string]string{"WORKERS": "x", "TIMEOUT": "y", "MODE": "z"}))
+	if err == nil {
+		t.Fatal("Load succeeded, want errors")
+	}
+	for _, want := range []string{"WORKERS=", "TIMEOUT=", "MODE:", "NAME: is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("PORT = %q, want valid values filled in despite errors", cfg.Port)
+	}
+}
+
+type validatedConfig struct {
+	Min int `env:"MIN" default:"1"`
+	Max int `env:"MAX" default:"2"`
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.Max < c.Min {
+		return errors.New("MAX: must not be below MIN")
+	}
+	return nil
+}
+
+func TestLoadValidator(t *testing.T) {
+	var cfg validatedConfig
+	_, err := Load(&cfg, withEnv(map[string]string{"MIN": "3"}))
+	if err == nil || !strings.Contains(err.Error(), "MAX: must not be below MIN") {
+		t.Fatalf("Load error = %v, want Validate's error", err)
+	}
+
+	// Validate is skipped while a field is invalid.
+	_, err = Load(&cfg, withEnv(map[string]string{"MIN": "3", "MAX": "x"}))
+	if err == nil || strings.Contains(err.Error(), "below MIN") {
+		t.Fatalf("Load error = %v, want only the field error", err)
+	}
+}
+
+func TestLoadFlags(t *testing.T) {
+	var cfg testConfig
+	_, err := Load(&cfg, withEnv(map[string]string{"NAME": "n"}), WithArgs([]string{"--token=s3cret-value"}), WithFlagOutput(io.Discard))
+	if err == nil || !strings.Contains(err.Error(), "flag provided but not defined: -token") {
+		t.Errorf("Load error = %v, want secrets to have no flag", err)
+	}
+
+	_, err = Load(&cfg, WithArgs([]string{"-h"}), WithFlagOutput(io.Discard))
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load error = %v, want flag.ErrHelp", err)
+	}
+
+	_, err = Load(&cfg, withEnv(map[string]string{"NAME": "n"}), WithArgs([]string{"--debug", "extra"}), WithFlagOutput(io.Discard))
+	if err == nil || !strings.Contains(err.Error(), `unexpected argument "extra"`) {
+		t.Errorf("Load error = %v, want the argument rejected", err)
+	}
+}
+
+func TestLoadUnknownYAMLKey(t *testing.T) {
+	path := writeFile(t, "config.yaml", "name: n\nprot: \"80\"\n")
+	var cfg testConfig
+	_, err := Load(&cfg, withEnv(map[string]string{FileEnv: path}))
+	if err == nil || !strings.Contains(err.Error(), `unknown key "prot"`) {
+		t.Fatalf("Load error = %v, want the unknown key reported", err)
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	var cfg testConfig
+	_, err := Load(&cfg, withEnv(map[string]string{"NAME": "n", "TOKEN": "short"}))
+	if err == nil || strings.Contains(err.Error(), "short\"") {
+		t.Fatalf("Load error = %v, want the secret's value left out", err)
+	}
+
+	// A parse error quotes the value, except for secrets.
+	type secretInt struct {
+		PIN int `env:"PIN" secret:"true"`
+	}
+	var s secretInt
+	_, err = Load(&s, withEnv(map[string]string{"PIN": "12ab"}))
+	if err == nil || strings.Contains(err.Error(), "12ab") || !strings.Contains(err.Error(), "PIN="+Redacted) {
+		t.Fatalf("Load error = %v, want PIN=%s", err, Redacted)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := testConfig{Port: "8080", Name: "two words", Hosts: []string{"a", "b"}, Token: "s3cret-value", Timeout: time.Second}
+	sources := Sources{"PORT": SourceDefault, "NAME": SourceEnv, "TOKEN": SourceSecretFile}
+
+	tests := []struct {
+		redact bool
+		want   []string
+		absent string
+	}{
+		{true, []string{"TOKEN=" + Redacted, "# secret file", `NAME="two words"`, "HOSTS=a,b", "TIMEOUT=1s", "DEBUG=false"}, "s3cret-value"},
+		{false, []string{"TOKEN=s3cret-value", "PORT=8080"}, Redacted},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		if err := Print(&buf, cfg, sources, tc.redact); err != nil {
+			t.Fatalf("Print: %v", err)
+		}
+		out := buf.String()
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("Print(redact=%v) = %q, want %q in it", tc.redact, out, want)
+			}
+		}
+		if strings.Contains(out, tc.absent) {
+			t.Errorf("Print(redact=%v) = %q, want no %q", tc.redact, out, tc.absent)
+		}
+		if strings.Contains(out, "Ignored") {
+			t.Errorf("Print printed a field without an env tag: %q", out)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  any
+		want string
+	}{
+		{"not a pointer", testConfig{}, "needs a pointer to a struct"},
+		{"unsupported type", &struct {
+			F float64 `env:"F"`
+		}{}, "unsupported type float64"},
+		{"bad default", &struct {
+			D time.Duration `env:"D" default:"soon"`
+		}{}, "bad default"},
+		{"unknown rule", &struct {
+			S string `env:"S" validate:"email"`
+		}{}, `unknown rule "email"`},
+		{"oneof on a number", &struct {
+			N int `env:"N" validate:"oneof=1 2"`
+		}{}, "oneof needs a string or a list"},
+	}
+	for _, tc := range tests {
+		_, err := Load(tc.dst, withEnv(nil))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Load error = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
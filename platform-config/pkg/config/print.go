@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Redacted replaces secret values in Print output and error messages.
+const Redacted = "[REDACTED]"
+
+// Print writes src, a config struct or a pointer to one, as .env lines,
+// each followed by the source of its value. With redact, the values of
+// fields tagged secret:"true" are replaced by Redacted.
+func Print(w io.Writer, src any, sources Sources, redact bool) error {
+	v := reflect.Indirect(reflect.ValueOf(src))
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("config: Print needs a struct, got %T", src)
+	}
+	fields, err := schema(v.Type())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, f := range fields {
+		value := format(v.FieldByIndex(f.index))
+		if redact && f.secret && value != "" {
+			value = Redacted
+		}
+		if strings.ContainsAny(value, " \t#\"'\\") {
+			value = strconv.Quote(value)
+		}
+		source, ok := sources[f.name]
+		if !ok {
+			source = "unset"
+		}
+		fmt.Fprintf(tw, "%s=%s\t# %s\n", f.name, value, source)
+	}
+	return tw.Flush()
+}
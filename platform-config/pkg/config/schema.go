@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// field is a struct field read from the variable name.
+type field struct {
+	name       string
+	index      []int
+	typ        reflect.Type
+	def        string
+	hasDefault bool
+	secret     bool
+	rules      []rule
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+// schema lists the fields of t with an env tag, and checks that their types
+// and tags are supported.
+func schema(t reflect.Type) ([]field, error) {
+	var fields []field
+	for _, sf := range reflect.VisibleFields(t) {
+		name, ok := sf.Tag.Lookup("env")
+		if !ok || name == "-" || !sf.IsExported() {
+			continue
+		}
+		f := field{name: name, index: sf.Index, typ: sf.Type, secret: sf.Tag.Get("secret") == "true"}
+		f.def, f.hasDefault = sf.Tag.Lookup("default")
+
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("config: %s: unsupported type %s", sf.Name, sf.Type)
+		}
+		if f.hasDefault {
+			if err := parse(reflect.New(sf.Type).Elem(), f.def); err != nil {
+				return nil, fmt.Errorf("config: %s: bad default: %w", sf.Name, err)
+			}
+		}
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			for _, r := range strings.Split(tag, ",") {
+				name, arg, _ := strings.Cut(r, "=")
+				if err := checkRule(sf.Type, name, arg); err != nil {
+					return nil, fmt.Errorf("config: %s: %w", sf.Name, err)
+				}
+				f.rules = append(f.rules, rule{name: name, arg: arg})
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func checkRule(t reflect.Type, name, arg string) error {
+	switch name {
+	case "required":
+		return nil
+	case "oneof":
+		if t.Kind() != reflect.String && t.Kind() != reflect.Slice {
+			return errors.New("oneof needs a string or a list")
+		}
+		return nil
+	case "min", "max":
+		_, err := bound(t, arg)
+		return err
+	}
+	return fmt.Errorf("unknown rule %q", name)
+}
+
+// bound parses the argument of min or max: a value of t for numbers and
+// durations, a length for strings and lists.
+func bound(t reflect.Type, arg string) (int64, error) {
+	if t == durationType {
+		d, err := time.ParseDuration(arg)
+		return int64(d), err
+	}
+	return strconv.ParseInt(arg, 10, 64)
+}
+
+// parse sets v from s.
+func parse(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("not a duration, such as 30s or 15m")
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+// format is the inverse of parse.
+func format(v reflect.Value) string {
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// check applies the field's rules to v. Rules other than required pass
+// empty strings and lists, which are optional unless required.
+func (f field) check(v reflect.Value) error {
+	empty := (v.Kind() == reflect.String || v.Kind() == reflect.Slice) && v.Len() == 0
+	for _, r := range f.rules {
+		if empty && r.name != "required" {
+			continue
+		}
+		if err := r.apply(v); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (r rule) apply(v reflect.Value) error {
+	switch r.name {
+	case "required":
+		if v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+			return errors.New("is required")
+		}
+	case "oneof":
+		allowed := strings.Fields(r.arg)
+		values := []string{v.String()}
+		if v.Kind() == reflect.Slice {
+			values = v.Interface().([]string)
+		}
+		for _, s := range values {
+			if !slices.Contains(allowed, s) {
+				return fmt.Errorf("%q is not one of %s", s, strings.Join(allowed, ", "))
+			}
+		}
+	case "min", "max":
+		limit, _ := bound(v.Type(), r.arg)
+		n := int64(0)
+		switch v.Kind() {
+		case reflect.String, reflect.Slice:
+			n = int64(v.Len())
+		default:
+			n = v.Int()
+		}
+		if r.name == "min" && n < limit {
+			return fmt.Errorf("must be at least %s", describe(v, r.arg))
+		}
+		if r.name == "max" && n > limit {
+			return fmt.Errorf("must be at most %s", describe(v, r.arg))
+		}
+	}
+	return nil
+}
+
+func describe(v reflect.Value, arg string) string {
+	switch v.Kind() {
+	case reflect.String:
+		return arg + " characters long"
+	case reflect.Slice:
+		return arg + " items"
+	}
+	return arg
+}
+
+// errorf reports an invalid value of f, quoting it unless f is a secret.
+func (f field) errorf(s setting, msg string, args ...any) error {
+	value := strconv.Quote(s.value)
+	if f.secret {
+		value = Redacted
+	}
+	return fmt.Errorf("%s=%s (%s): %s", f.name, value, s.source, fmt.Sprintf(msg, args...))
+}
@@ -0,0 +1,5 @@
+package events
+
+// RequestIDHeader is the Kafka message header carrying the ID of the request
+// that produced the event, so consumers can log under the same ID.
+const RequestIDHeader = "x-request-id"
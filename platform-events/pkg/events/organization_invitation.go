@@ -0,0 +1,31 @@
+package events
+
+import "time"
+
+const OrganizationInvitationCreatedType = "organization_invitation_created"
+
+type OrganizationInvitationCreated struct {
+	Type       string            `json:"type"`
+	Invitation InvitationPayload `json:"invitation"`
+}
+
+// InvitationPayload carries the plain invitation token so the email can
+// link to the accept page; the identity service only stores its hash.
+type InvitationPayload struct {
+	ID               string    `json:"id"`
+	TenantID         string    `json:"tenant_id,omitempty"`
+	OrganizationID   string    `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	InvitedByName    string    `json:"invited_by_name"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+func NewOrganizationInvitationCreated(payload InvitationPayload) OrganizationInvitationCreated {
+	return OrganizationInvitationCreated{
+		Type:       OrganizationInvitationCreatedType,
+		Invitation: payload,
+	}
+}
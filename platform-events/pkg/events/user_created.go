@@ -11,6 +11,8 @@ type UserPayload struct {
 	ID       string `json:"id"`
 	Email    string `json:"email"`
 	Username string `json:"username"`
+	// TenantID is the storefront the user registered with.
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 func NewUserCreated(id, email, username string) UserCreated {
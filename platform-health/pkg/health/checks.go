@@ -0,0 +1,31 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DatabaseCheck pings db.
+func DatabaseCheck(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// KafkaCheck passes when any of brokers accepts a connection; the client
+// finds the rest of the cluster through it.
+func KafkaCheck(brokers []string) CheckFunc {
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, broker := range brokers {
+			conn, err := kafka.DialContext(ctx, "tcp", broker)
+			if err == nil {
+				return conn.Close()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+		}
+		return errors.Join(errs...)
+	}
+}
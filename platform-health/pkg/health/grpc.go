@@ -0,0 +1,21 @@
+package health
+
+import (
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// UpdateGRPC keeps the overall status of s, and that of services, in step
+// with the checker's readiness.
+func (c *Checker) UpdateGRPC(s *health.Server, services ...string) {
+	c.OnChange(func(ready bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		s.SetServingStatus("", status)
+		for _, name := range services {
+			s.SetServingStatus(name, status)
+		}
+	})
+}
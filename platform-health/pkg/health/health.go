@@ -0,0 +1,212 @@
+// Package health answers liveness and readiness probes. Liveness only says
+// the process is serving. Readiness runs the registered dependency checks
+// on an interval, each with its own timeout, and turns false for good once
+// the service starts draining during shutdown.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness statuses.
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusDraining = "draining"
+)
+
+// Check statuses.
+const (
+	CheckOK      = "ok"
+	CheckFailing = "failing"
+)
+
+const (
+	// DefaultTimeout bounds a check registered without a timeout.
+	DefaultTimeout = 2 * time.Second
+	// DefaultInterval is how often Run repeats the checks.
+	DefaultInterval = 5 * time.Second
+)
+
+// CheckFunc returns nil when the dependency is usable. It must return once
+// ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	fn      CheckFunc
+	timeout time.Duration
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the readiness of the service and the results it is based on.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	interval time.Duration
+	checks   []check
+
+	mu        sync.Mutex
+	report    Report
+	listeners []func(ready bool)
+	draining  atomic.Bool
+}
+
+type Option func(*Checker)
+
+// WithInterval sets how often Run repeats the checks.
+func WithInterval(d time.Duration) Option {
+	return func(c *Checker) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// New returns a checker that is not ready until Run has completed the
+// first round of checks.
+func New(opts ...Option) *Checker {
+	c := &Checker{
+		interval: DefaultInterval,
+		report:   Report{Status: StatusNotReady},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Register adds a readiness check. A zero timeout uses DefaultTimeout.
+// Checks must be registered before Run.
+func (c *Checker) Register(name string, fn CheckFunc, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.checks = append(c.checks, check{name: name, fn: fn, timeout: timeout})
+}
+
+// OnChange calls fn with the current readiness, and again whenever it
+// changes.
+func (c *Checker) OnChange(fn func(ready bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+	fn(c.readyLocked())
+}
+
+// Run checks now and then every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.update(c.Check(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs every check concurrently and reports the outcome. It does not
+// change the state that Report and Ready return.
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, ch)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]Result, len(c.checks))}
+	for i, ch := range c.checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status != CheckOK {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+func run(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.fn(ctx)
+	r := Result{Status: CheckOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("timed out after " + ch.timeout.String())
+		}
+		r.Status = CheckFailing
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func (c *Checker) update(report Report) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	was := c.readyLocked()
+	c.report = report
+	c.notifyLocked(was)
+}
+
+// Report returns the outcome of the latest round of checks.
+func (c *Checker) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.report
+	if c.draining.Load() {
+		r.Status = StatusDraining
+	}
+	return r
+}
+
+// Ready reports whether the latest checks passed and the service is not
+// draining.
+func (c *Checker) Ready() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readyLocked()
+}
+
+// Drain marks the service not ready for the rest of its life, so balancers
+// stop routing to it while in-flight work finishes.
+func (c *Checker) Drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	was := c.readyLocked()
+	c.draining.Store(true)
+	c.notifyLocked(was)
+}
+
+func (c *Checker) readyLocked() bool {
+	return !c.draining.Load() && c.report.Status == StatusReady
+}
+
+func (c *Checker) notifyLocked(was bool) {
+	if now := c.readyLocked(); now != was {
+		for _, fn := range c.listeners {
+			fn(now)
+		}
+	}
+}
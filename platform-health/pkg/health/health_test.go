@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// switchable is a check whose outcome the test controls.
+type switchable struct{ err atomic.Pointer[error] }
+
+func (s *switchable) set(err error) { s.err.Store(&err) }
+
+func (s *switchable) check(context.Context) error {
+	if err := s.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func TestReadinessTransitions(t *testing.T) {
+	ctx := context.Background()
+	db := &switchable{}
+	c := New()
+	c.Register("db", db.check, time.Second)
+
+	var changes []bool
+	c.OnChange(func(ready bool) { changes = append(changes, ready) })
+
+	if c.Ready() || c.Report().Status != StatusNotReady {
+		t.Fatalf("before the first round: ready = %v, status %q", c.Ready(), c.Report().Status)
+	}
+
+	steps := []struct {
+		name   string
+		err    error
+		ready  bool
+		status string
+	}{
+		{"passing", nil, true, StatusReady},
+		{"still passing", nil, true, StatusReady},
+		{"failing", errors.New("connection refused"), false, StatusNotReady},
+		{"recovered", nil, true, StatusReady},
+	}
+	for _, step := range steps {
+		db.set(step.err)
+		c.update(c.Check(ctx))
+		if c.Ready() != step.ready || c.Report().Status != step.status {
+			t.Fatalf("%s: ready = %v, status %q; want %v, %q", step.name, c.Ready(), c.Report().Status, step.ready, step.status)
+		}
+	}
+
+	if want := []bool{false, true, false, true}; !equal(changes, want) {
+		t.Fatalf("OnChange calls = %v, want %v", changes, want)
+	}
+
+	r := c.Report().Checks["db"]
+	if r.Status != CheckOK || r.Error != "" {
+		t.Fatalf("db result = %+v", r)
+	}
+}
+
+func TestCheckReportsFailures(t *testing.T) {
+	c := New()
+	c.Register("ok", func(context.Context) error { return nil }, 0)
+	c.Register("broken", func(context.Context) error { return errors.New("boom") }, 0)
+
+	report := c.Check(context.Background())
+	if report.Status != StatusNotReady {
+		t.Fatalf("status = %q, want %q", report.Status, StatusNotReady)
+	}
+	if got := report.Checks["ok"]; got.Status != CheckOK {
+		t.Fatalf("ok = %+v", got)
+	}
+	if got := report.Checks["broken"]; got.Status != CheckFailing || got.Error != "boom" {
+		t.Fatalf("broken = %+v", got)
+	}
+	// Check alone does not change readiness.
+	if c.Ready() {
+		t.Fatal("Check made the checker ready")
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := New()
+	c.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 20*time.Millisecond)
+
+	start := time.Now()
+	report := c.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Check took %v, want about the 20ms timeout", elapsed)
+	}
+	got := report.Checks["slow"]
+	if got.Status != CheckFailing || got.Error != "timed out after 20ms" {
+		t.Fatalf("slow = %+v", got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c := New()
+	c.Register("db", func(context.Context) error { return nil }, 0)
+	c.update(c.Check(context.Background()))
+
+	var changes []bool
+	c.OnChange(func(ready bool) { changes = append(changes, ready) })
+
+	c.Drain()
+	if c.Ready() || c.Report().Status != StatusDraining {
+		t.Fatalf("after Drain: ready = %v, status %q", c.Ready(), c.Report().Status)
+	}
+
+	// Passing checks do not bring a draining service back.
+	c.update(c.Check(context.Background()))
+	c.Drain()
+	if c.Ready() || c.Report().Status != StatusDraining {
+		t.Fatalf("checks after Drain: ready = %v, status %q", c.Ready(), c.Report().Status)
+	}
+	if want := []bool{true, false}; !equal(changes, want) {
+		t.Fatalf("OnChange calls = %v, want %v", changes, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	db := &switchable{}
+	db.set(errors.New("down"))
+	c := New(WithInterval(5 * time.Millisecond))
+	c.Register("db", db.check, 0)
+
+	ready := make(chan bool, 10)
+	c.OnChange(func(r bool) { ready <- r })
+	<-ready
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	db.set(nil)
+	select {
+	case r := <-ready:
+		if !r {
+			t.Fatal("Run reported not ready after the check passed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not pick up the passing check")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	c := New()
+	c.Register("db", func(context.Context) error { return errors.New("down") }, 0)
+	c.update(c.Check(context.Background()))
+
+	serve := func(h http.Handler) (*httptest.ResponseRecorder, Report) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report Report
+		if err := json.NewDecoder(strings.NewReader(rec.Body.String())).Decode(&report); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return rec, report
+	}
+
+	if rec, _ := serve(LiveHandler()); rec.Code != http.StatusOK {
+		t.Fatalf("live status = %d, want 200", rec.Code)
+	}
+
+	rec, report := serve(c.ReadyHandler())
+	if rec.Code != http.StatusServiceUnavailable || report.Status != StatusNotReady || report.Checks["db"].Error != "down" {
+		t.Fatalf("ready while failing = %d %+v", rec.Code, report)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("Cache-Control = %q, want no-store", got)
+	}
+
+	c = New()
+	c.update(c.Check(context.Background()))
+	if rec, report := serve(c.ReadyHandler()); rec.Code != http.StatusOK || report.Status != StatusReady {
+		t.Fatalf("ready = %d %+v", rec.Code, report)
+	}
+	c.Drain()
+	if rec, report := serve(c.ReadyHandler()); rec.Code != http.StatusServiceUnavailable || report.Status != StatusDraining {
+		t.Fatalf("ready while draining = %d %+v", rec.Code, report)
+	}
+}
+
+func equal(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
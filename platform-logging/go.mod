@@ -0,0 +1,7 @@
+module github.com/hawful70/platform-logging
+
+go 1.25.0
+
+require go.opentelemetry.io/otel/trace v1.38.0
+
+require go.opentelemetry.io/otel v1.38.0 // indirect
@@ -0,0 +1,143 @@
+// Package logging configures log/slog for the shop services. Records carry
+// the request ID and trace of their context, and attributes whose keys name
+// secrets or personal data are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched against lower-cased attribute keys, also inside
+// groups, as substrings: "new_password" and "invitation_token" are
+// redacted too.
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"authorization",
+	"cookie",
+	"email",
+	"recipient",
+	"dsn",
+	"api_key",
+}
+
+// Values and messages are scrubbed too, so addresses and tokens quoted in
+// them or in errors, such as SMTP rejections, do not reach the log.
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns ctx carrying the ID of the request being
+// served, or of the request that produced the event being handled.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID in ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// New returns a logger writing to w in format, json or text, at level
+// debug, info, warn or error.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+
+	var h slog.Handler
+	switch format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// Sensitive reports whether an attribute named key is redacted. Keys ending
+// in _id, such as scim_token_id, name records rather than secrets.
+func Sensitive(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "_id") {
+		return false
+	}
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	kind := a.Value.Kind()
+	if kind == slog.KindGroup {
+		return a
+	}
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if kind != slog.KindString && kind != slog.KindAny {
+		return a
+	}
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, Scrub(v))
+	case error:
+		return slog.String(a.Key, Scrub(v.Error()))
+	case fmt.Stringer:
+		return slog.String(a.Key, Scrub(v.String()))
+	}
+	return a
+}
+
+// Scrub replaces email addresses and JWTs in s.
+func Scrub(s string) string {
+	s = emailPattern.ReplaceAllString(s, Redacted)
+	return jwtPattern.ReplaceAllString(s, Redacted)
+}
+
+// contextHandler adds the request ID and trace of the record's context. It
+// also scrubs the message, which ReplaceAttr never sees.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = Scrub(r.Message)
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	platformconfig "github.com/hawful70/platform-config/pkg/config"
+
+	"github.com/hawful70/shop-email-service/internal/config"
+)
+
+// runConfig handles "email-service config print [--redacted] [--config
+// file]", printing the configuration the service would start with and the
+// source of each value. It prints even when the configuration is invalid,
+// then returns the errors.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: email-service config print [--redacted] [--config file]")
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redacted := fs.Bool("redacted", false, "replace secrets such as SMTP_PASSWORD with "+platformconfig.Redacted)
+	file := fs.String("config", "", "YAML file to read instead of "+platformconfig.FileEnv)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	var loadArgs []string
+	if *file != "" {
+		loadArgs = []string{"--" + platformconfig.FileFlag, *file}
+	}
+	cfg, sources, loadErr := config.Load(loadArgs)
+	if err := platformconfig.Print(os.Stdout, cfg, sources, *redacted); err != nil {
+		return err
+	}
+	if loadErr != nil {
+		return fmt.Errorf("invalid configuration:\n%w", loadErr)
+	}
+	return nil
+}
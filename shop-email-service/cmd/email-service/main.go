@@ -2,26 +2,58 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
+	events "github.com/hawful70/platform-events/pkg/events"
+	"github.com/hawful70/platform-health/pkg/health"
+	"github.com/hawful70/platform-logging/pkg/logging"
 	"github.com/hawful70/shop-email-service/internal/config"
 	"github.com/hawful70/shop-email-service/internal/email"
 	kafkamq "github.com/hawful70/shop-email-service/internal/messaging/kafka"
+	"github.com/hawful70/shop-email-service/internal/metrics"
+	"github.com/hawful70/shop-email-service/internal/tracing"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	cfg := config.MustLoad()
-	logger := log.New(os.Stdout, "email-service ", log.LstdFlags)
+	logger, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		slog.Error("failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
 
-	if cfg.SMTPHost == "" {
-		logger.Fatal("SMTP_HOST is required")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracesExporter, "shop-email-service")
+	if err != nil {
+		fatal("failed to set up tracing", err)
 	}
-	logger.Printf("using SMTP mailer via %s:%d (TLS=%t)", cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUseTLS)
-	mailer := email.NewSMTPMailer(logger, email.SMTPConfig{
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	logger.Info("using SMTP mailer", "host", cfg.SMTPHost, "port", cfg.SMTPPort, "tls", cfg.SMTPUseTLS)
+	appMetrics := metrics.New()
+	smtpMailer := email.NewSMTPMailer(logger, email.SMTPConfig{
 		Host:     cfg.SMTPHost,
 		Port:     cfg.SMTPPort,
 		Username: cfg.SMTPUsername,
@@ -30,32 +62,54 @@ func main() {
 		FromName: cfg.MailFromName,
 		UseTLS:   cfg.SMTPUseTLS,
 	})
-	handler := email.NewUserCreatedHandler(mailer)
-	if len(cfg.KafkaBrokers) == 0 {
-		logger.Fatal("no KAFKA_BROKERS configured")
-	}
-	consumer := kafkamq.NewConsumer(cfg.KafkaBrokers, cfg.KafkaUserCreatedTopic, cfg.KafkaGroupID)
+	mailer := appMetrics.InstrumentMailer(smtpMailer)
+	handler := email.NewDispatcher()
+	handler.Register(events.UserCreatedType, email.NewUserCreatedHandler(mailer))
+	handler.Register(events.OrganizationInvitationCreatedType, email.NewInvitationHandler(mailer, cfg.InvitationAcceptURL))
+	consumer := kafkamq.NewConsumer(cfg.KafkaBrokers, []string{cfg.KafkaUserCreatedTopic, cfg.KafkaOrgInvitationsTopic}, cfg.KafkaGroupID)
 	defer consumer.Close()
 
+	checker := health.New(health.WithInterval(cfg.HealthCheckInterval))
+	checker.Register("kafka", health.KafkaCheck(cfg.KafkaBrokers), cfg.HealthCheckTimeout)
+	checker.Register("smtp", smtpMailer.Ping, cfg.HealthCheckTimeout)
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	logger.Printf("starting email consumer with %d workers\n", cfg.WorkerCount)
-	msgCh, errCh := consumer.Stream(ctx)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", appMetrics.Handler())
+	mux.Handle("GET /livez", health.LiveHandler())
+	mux.Handle("GET /readyz", checker.ReadyHandler())
+	srv := &http.Server{
+		Addr:              ":" + cfg.HTTPPort,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info("HTTP server listening", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", err)
+		}
+	}()
+
+	go checker.Run(ctx)
+
+	// Fetching stops on shutdown; handling and commits get their own context
+	// so that messages already fetched are finished and committed.
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	workCtx, stopWork := context.WithCancel(context.Background())
+	defer stopWork()
+
+	logger.Info("starting email consumer", "workers", cfg.WorkerCount)
+	msgCh, errCh := consumer.Stream(streamCtx)
 
 	var wg sync.WaitGroup
 	for i := 0; i < cfg.WorkerCount; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			for msg := range msgCh {
-				if err := handler.Handle(ctx, msg.Value); err != nil {
-					logger.Printf("worker %d failed to handle message: %v", id, err)
-				}
-				if err := consumer.Commit(ctx, msg); err != nil {
-					logger.Printf("worker %d failed to commit: %v", id, err)
-				}
-			}
+			work(workCtx, logger.With("worker", id), msgCh, consumer, handler, appMetrics)
 		}(i + 1)
 	}
 
@@ -65,11 +119,38 @@ func main() {
 	case streamErr = <-errCh:
 	}
 
-	wg.Wait()
+	// /readyz reports draining before fetching stops; workers then finish
+	// the messages they hold, until the drain timeout cancels them.
+	checker.Drain()
+	stopStream()
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(cfg.ShutdownDrainTimeout):
+		logger.Warn("drain timeout reached, cancelling in-flight messages", "timeout", cfg.ShutdownDrainTimeout)
+		stopWork()
+		<-drained
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to shut down HTTP server", "error", err)
+	}
 
 	if streamErr != nil {
-		logger.Fatalf("consumer error: %v", streamErr)
+		fatal("consumer failed", streamErr)
 	}
 
-	logger.Println("email service stopped gracefully")
+	logger.Info("email service stopped gracefully")
+}
+
+// fatal logs msg with err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
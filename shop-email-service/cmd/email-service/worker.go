@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/hawful70/shop-email-service/internal/metrics"
+)
+
+// messageSource is the part of the Kafka consumer that workers use.
+type messageSource interface {
+	StartProcess(ctx context.Context, msg kafka.Message) (context.Context, func(error))
+	Commit(ctx context.Context, msg kafka.Message) error
+}
+
+type messageHandler interface {
+	Handle(ctx context.Context, value []byte) error
+}
+
+// work handles the messages of msgs until the channel is closed. Messages
+// whose handler fails are logged and committed anyway, so one bad message
+// does not block its partition.
+func work(ctx context.Context, logger *slog.Logger, msgs <-chan kafka.Message, source messageSource, handler messageHandler, m *metrics.Metrics) {
+	for msg := range msgs {
+		m.Consumed(msg.Topic)
+		start := time.Now()
+		msgCtx, endSpan := source.StartProcess(ctx, msg)
+		err := handler.Handle(msgCtx, msg.Value)
+		endSpan(err)
+		m.Handled(msg.Topic, start, err)
+		msgAttrs := []any{"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset}
+		if err != nil {
+			logger.ErrorContext(msgCtx, "failed to handle message", append(msgAttrs, "error", err)...)
+		} else {
+			logger.DebugContext(msgCtx, "handled message", msgAttrs...)
+		}
+		if err := source.Commit(ctx, msg); err != nil {
+			logger.ErrorContext(msgCtx, "failed to commit", append(msgAttrs, "error", err)...)
+			continue
+		}
+		m.Committed(msg.Topic)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/hawful70/shop-email-service/internal/metrics"
+)
+
+// fakeSource fails to commit the offsets in failCommit.
+type fakeSource struct {
+	failCommit map[int64]bool
+	committed  []int64
+}
+
+func (s *fakeSource) StartProcess(ctx context.Context, msg kafka.Message) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+func (s *fakeSource) Commit(ctx context.Context, msg kafka.Message) error {
+	if s.failCommit[msg.Offset] {
+		return errors.New("rebalance in progress")
+	}
+	s.committed = append(s.committed, msg.Offset)
+	return nil
+}
+
+// handlerFunc adapts a function to messageHandler.
+type handlerFunc func(ctx context.Context, value []byte) error
+
+func (f handlerFunc) Handle(ctx context.Context, value []byte) error {
+	return f(ctx, value)
+}
+
+func TestWorkCounts(t *testing.T) {
+	msgs := make(chan kafka.Message, 5)
+	for i, m := range []struct{ topic, value string }{
+		{"user.created", "ok"},
+		{"user.created", "bad"},
+		{"user.created", "ok"},
+		{"org.invitations", "ok"},
+		{"org.invitations", "bad"},
+	} {
+		msgs <- kafka.Message{Topic: m.topic, Offset: int64(i), Value: []byte(m.value)}
+	}
+	close(msgs)
+
+	m := metrics.New()
+	source := &fakeSource{failCommit: map[int64]bool{2: true}}
+	handler := handlerFunc(func(ctx context.Context, value []byte) error {
+		if string(value) == "bad" {
+			return errors.New("template failed")
+		}
+		return nil
+	})
+	work(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), msgs, source, handler, m)
+
+	// Failed messages are committed too; offset 2 failed to commit.
+	if got := len(source.committed); got != 4 {
+		t.Fatalf("committed offsets %v, want all but 2", source.committed)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scraped := rec.Body.String()
+	for _, want := range []string{
+		`email_messages_consumed_total{topic="user.created"} 3`,
+		`email_messages_consumed_total{topic="org.invitations"} 2`,
+		`email_messages_handled_total{topic="user.created"} 2`,
+		`email_messages_handled_total{topic="org.invitations"} 1`,
+		`email_messages_failed_total{topic="user.created"} 1`,
+		`email_messages_failed_total{topic="org.invitations"} 1`,
+		`email_messages_committed_total{topic="user.created"} 2`,
+		`email_messages_committed_total{topic="org.invitations"} 2`,
+		`email_handler_duration_seconds_count{topic="user.created"} 3`,
+	} {
+		if !strings.Contains(scraped, want+"\n") {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
@@ -1,93 +1,82 @@
+// Package config describes the email service's settings. Values are read
+// by platform-config from defaults, a YAML file, .env, the environment (or
+// <NAME>_FILE secret files) and flags; see Load.
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/hawful70/platform-config/pkg/config"
 )
 
 type Config struct {
-	KafkaBrokers          []string
-	KafkaGroupID          string
-	KafkaUserCreatedTopic string
-	MailFrom              string
-	MailFromName          string
-	WorkerCount           int
-	SMTPHost              string
-	SMTPPort              int
-	SMTPUsername          string
-	SMTPPassword          string
-	SMTPUseTLS            bool
+	// HTTPPort serves /metrics, /livez and /readyz.
+	HTTPPort              string   `env:"HTTP_PORT" default:"8084" validate:"required"`
+	KafkaBrokers          []string `env:"KAFKA_BROKERS" default:"localhost:19092" validate:"required"`
+	KafkaGroupID          string   `env:"KAFKA_GROUP_ID" default:"email-service" validate:"required"`
+	KafkaUserCreatedTopic string   `env:"KAFKA_TOPIC_USER_CREATED" default:"user_created" validate:"required"`
+	// KafkaOrgInvitationsTopic carries organization invitations from
+	// shop-identity-service.
+	KafkaOrgInvitationsTopic string `env:"KAFKA_TOPIC_ORG_INVITATIONS" default:"organization_invitations" validate:"required"`
+	// InvitationAcceptURL is the storefront page that accepts invitations;
+	// the token is appended as the "token" query parameter.
+	InvitationAcceptURL string `env:"INVITATION_ACCEPT_URL" default:"http://localhost:3000/invitations/accept" validate:"required"`
+	MailFrom            string `env:"MAIL_FROM" default:"welcome@example.com" validate:"required"`
+	MailFromName        string `env:"MAIL_FROM_NAME" default:"Shop Team"`
+	WorkerCount         int    `env:"EMAIL_WORKERS" default:"4" validate:"min=1"`
+	SMTPHost            string `env:"SMTP_HOST" validate:"required"`
+	SMTPPort            int    `env:"SMTP_PORT" default:"587" validate:"min=1,max=65535"`
+	SMTPUsername        string `env:"SMTP_USERNAME"`
+	SMTPPassword        string `env:"SMTP_PASSWORD" secret:"true"`
+	SMTPUseTLS          bool   `env:"SMTP_USE_TLS" default:"true"`
+	// TracesExporter is otlp, stdout or none. OTLP is configured with the
+	// standard OTEL_EXPORTER_OTLP_* variables.
+	TracesExporter string `env:"TRACES_EXPORTER" default:"none" validate:"oneof=otlp stdout none"`
+	// LogLevel is debug, info, warn or error; LogFormat is json or text.
+	LogLevel  string `env:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	LogFormat string `env:"LOG_FORMAT" default:"json" validate:"oneof=json text"`
+	// HealthCheckInterval is how often readiness checks run, each bounded
+	// by HealthCheckTimeout.
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" default:"5s" validate:"min=1ms"`
+	HealthCheckTimeout  time.Duration `env:"HEALTH_CHECK_TIMEOUT" default:"2s" validate:"min=1ms"`
+	// ShutdownDrainTimeout is how long workers may spend finishing and
+	// committing the messages they hold after a shutdown signal. Handling
+	// still in progress after it is cancelled.
+	ShutdownDrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT" default:"30s" validate:"min=1ms"`
 }
 
-func Load() Config {
-	_ = godotenv.Load()
-
-	brokersEnv := env("KAFKA_BROKERS", "localhost:19092")
-	var brokers []string
-	for _, b := range strings.Split(brokersEnv, ",") {
-		b = strings.TrimSpace(b)
-		if b != "" {
-			brokers = append(brokers, b)
-		}
-	}
-
-	groupID := env("KAFKA_GROUP_ID", "email-service")
-	topic := env("KAFKA_TOPIC_USER_CREATED", "user_created")
-	mailFrom := env("MAIL_FROM", "welcome@example.com")
-	mailFromName := env("MAIL_FROM_NAME", "Shop Team")
-	workers := envInt("EMAIL_WORKERS", 4)
-	smtpHost := env("SMTP_HOST", "")
-	smtpPort := envInt("SMTP_PORT", 587)
-	smtpUser := env("SMTP_USERNAME", "")
-	smtpPass := env("SMTP_PASSWORD", "")
-	smtpTLS := envBool("SMTP_USE_TLS", true)
-
-	return Config{
-		KafkaBrokers:          brokers,
-		KafkaGroupID:          groupID,
-		KafkaUserCreatedTopic: topic,
-		MailFrom:              mailFrom,
-		MailFromName:          mailFromName,
-		WorkerCount:           workers,
-		SMTPHost:              smtpHost,
-		SMTPPort:              smtpPort,
-		SMTPUsername:          smtpUser,
-		SMTPPassword:          smtpPass,
-		SMTPUseTLS:            smtpTLS,
+// Validate checks rules spanning several fields.
+func (c *Config) Validate() error {
+	if c.SMTPPassword != "" && c.SMTPUsername == "" {
+		return errors.New("SMTP_PASSWORD: needs SMTP_USERNAME")
 	}
+	return nil
 }
 
-func env(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return fallback
+// Load reads the configuration, with args parsed as flags, and returns
+// where each value came from. On error the returned Config still holds
+// every value that could be read.
+func Load(args []string) (Config, config.Sources, error) {
+	var cfg Config
+	sources, err := config.Load(&cfg, config.WithDotEnv(".env"), config.WithArgs(args))
+	return cfg, sources, err
 }
 
-func envInt(key string, fallback int) int {
-	if v := os.Getenv(key); v != "" {
-		if i, err := strconv.Atoi(v); err == nil && i > 0 {
-			return i
-		}
+// MustLoad loads the configuration with the process's arguments as flags,
+// and exits listing every problem when it is invalid.
+func MustLoad() Config {
+	cfg, _, err := Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	return fallback
-}
-
-func envBool(key string, fallback bool) bool {
-	if v := os.Getenv(key); v != "" {
-		switch strings.ToLower(v) {
-		case "true", "1", "yes", "y":
-			return true
-		case "false", "0", "no", "n":
-			return false
-		}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		os.Exit(2)
 	}
-	return fallback
-}
-
-func MustLoad() Config {
-	return Load()
+	return cfg
 }
@@ -0,0 +1,45 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type Handler interface {
+	Handle(ctx context.Context, value []byte) error
+}
+
+// Dispatcher routes an event to the handler registered for its "type" field.
+// Events without a handler are ignored.
+type Dispatcher struct {
+	handlers map[string]Handler
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: make(map[string]Handler)}
+}
+
+func (d *Dispatcher) Register(eventType string, h Handler) {
+	d.handlers[eventType] = h
+}
+
+func (d *Dispatcher) Handle(ctx context.Context, value []byte) error {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return err
+	}
+
+	h, ok := d.handlers[envelope.Type]
+	if !ok {
+		return nil
+	}
+	return h.Handle(ctx, value)
+}
+
+var (
+	_ Handler = (*Dispatcher)(nil)
+	_ Handler = (*UserCreatedHandler)(nil)
+	_ Handler = (*InvitationHandler)(nil)
+)
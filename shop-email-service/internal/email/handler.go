@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
 	events "github.com/hawful70/platform-events/pkg/events"
 )
 
+var tracer = otel.Tracer("github.com/hawful70/shop-email-service/internal/email")
+
 type UserCreatedHandler struct {
 	mailer Mailer
 }
@@ -15,7 +20,12 @@ func NewUserCreatedHandler(mailer Mailer) *UserCreatedHandler {
 	return &UserCreatedHandler{mailer: mailer}
 }
 
+// Handle runs in the trace of the registration that published the event,
+// when the consumer found one in the message headers.
 func (h *UserCreatedHandler) Handle(ctx context.Context, value []byte) error {
+	ctx, span := tracer.Start(ctx, "UserCreatedHandler.Handle")
+	defer span.End()
+
 	var evt events.UserCreated
 	if err := json.Unmarshal(value, &evt); err != nil {
 		return err
@@ -23,5 +33,9 @@ func (h *UserCreatedHandler) Handle(ctx context.Context, value []byte) error {
 	if evt.Type != events.UserCreatedType {
 		return nil
 	}
+	span.SetAttributes(
+		attribute.String("identity.user_id", evt.User.ID),
+		attribute.String("identity.tenant_id", evt.User.TenantID),
+	)
 	return h.mailer.SendWelcome(ctx, evt.User.Email, evt.User.Username)
 }
@@ -0,0 +1,64 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	events "github.com/hawful70/platform-events/pkg/events"
+)
+
+type InvitationHandler struct {
+	mailer    Mailer
+	acceptURL string
+}
+
+// NewInvitationHandler sends invitation emails linking to acceptURL with the
+// invitation token as the "token" query parameter.
+func NewInvitationHandler(mailer Mailer, acceptURL string) *InvitationHandler {
+	return &InvitationHandler{mailer: mailer, acceptURL: acceptURL}
+}
+
+func (h *InvitationHandler) Handle(ctx context.Context, value []byte) error {
+	ctx, span := tracer.Start(ctx, "InvitationHandler.Handle")
+	defer span.End()
+
+	var evt events.OrganizationInvitationCreated
+	if err := json.Unmarshal(value, &evt); err != nil {
+		return err
+	}
+	if evt.Type != events.OrganizationInvitationCreatedType {
+		return nil
+	}
+	span.SetAttributes(
+		attribute.String("identity.organization_id", evt.Invitation.OrganizationID),
+		attribute.String("identity.tenant_id", evt.Invitation.TenantID),
+	)
+
+	link, err := h.link(evt.Invitation.Token)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.SendInvitation(ctx, Invitation{
+		To:               evt.Invitation.Email,
+		OrganizationName: evt.Invitation.OrganizationName,
+		InvitedBy:        evt.Invitation.InvitedByName,
+		Role:             evt.Invitation.Role,
+		AcceptURL:        link,
+		ExpiresAt:        evt.Invitation.ExpiresAt,
+	})
+}
+
+func (h *InvitationHandler) link(token string) (string, error) {
+	u, err := url.Parse(h.acceptURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
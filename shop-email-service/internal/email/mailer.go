@@ -5,12 +5,30 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/smtp"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Mailer interface {
 	SendWelcome(ctx context.Context, to, name string) error
+	SendInvitation(ctx context.Context, inv Invitation) error
+}
+
+// Invitation is an email asking To to join an organization.
+type Invitation struct {
+	To               string
+	OrganizationName string
+	InvitedBy        string
+	Role             string
+	AcceptURL        string
+	ExpiresAt        time.Time
 }
 
 type SMTPConfig struct {
@@ -24,20 +42,86 @@ type SMTPConfig struct {
 }
 
 type SMTPMailer struct {
-	logger *log.Logger
+	logger *slog.Logger
 	cfg    SMTPConfig
 }
 
-func NewSMTPMailer(logger *log.Logger, cfg SMTPConfig) *SMTPMailer {
+func NewSMTPMailer(logger *slog.Logger, cfg SMTPConfig) *SMTPMailer {
 	return &SMTPMailer{logger: logger, cfg: cfg}
 }
 
 func (m *SMTPMailer) SendWelcome(ctx context.Context, to, name string) error {
+	msg := buildWelcomeMessage(m.cfg.FromName, m.cfg.From, to, name)
+	if err := m.send(ctx, to, msg); err != nil {
+		return err
+	}
+
+	m.logger.InfoContext(ctx, "dispatched welcome email", "username", name)
+	return nil
+}
+
+func (m *SMTPMailer) SendInvitation(ctx context.Context, inv Invitation) error {
+	msg := buildInvitationMessage(m.cfg.FromName, m.cfg.From, inv)
+	if err := m.send(ctx, inv.To, msg); err != nil {
+		return err
+	}
+
+	m.logger.InfoContext(ctx, "dispatched invitation email", "organization", inv.OrganizationName)
+	return nil
+}
+
+// Ping connects to the SMTP server and waits for its greeting, without
+// authenticating or sending anything.
+func (m *SMTPMailer) Ping(ctx context.Context) error {
 	if m.cfg.Host == "" {
 		return fmt.Errorf("smtp host is not configured")
 	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	var conn net.Conn
+	var err error
+	if m.cfg.UseTLS {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: m.cfg.Host}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) send(ctx context.Context, to string, msg []byte) (err error) {
+	if m.cfg.Host == "" {
+		return fmt.Errorf("smtp host is not configured")
+	}
+
+	_, span := tracer.Start(ctx, "smtp send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.ServerAddress(m.cfg.Host),
+			semconv.ServerPort(m.cfg.Port),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
-	msg := buildWelcomeMessage(m.cfg.FromName, m.cfg.From, to, name)
 	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
 
 	var auth smtp.Auth
@@ -54,8 +138,6 @@ func (m *SMTPMailer) SendWelcome(ctx context.Context, to, name string) error {
 			return err
 		}
 	}
-
-	m.logger.Printf("[mailer] dispatched SMTP welcome email to %s (%s)", name, to)
 	return nil
 }
 
@@ -116,4 +198,22 @@ func buildWelcomeMessage(fromName, fromEmail, toEmail, toName string) []byte {
 	return buf.Bytes()
 }
 
+func buildInvitationMessage(fromName, fromEmail string, inv Invitation) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("From: %s <%s>\r\n", fromName, fromEmail))
+	buf.WriteString(fmt.Sprintf("To: <%s>\r\n", inv.To))
+	buf.WriteString(fmt.Sprintf("Subject: You're invited to join %s\r\n", inv.OrganizationName))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString("Hi,\r\n\r\n")
+	buf.WriteString(fmt.Sprintf("%s invited you to join %s on the Shop as %s.\r\n", inv.InvitedBy, inv.OrganizationName, inv.Role))
+	buf.WriteString("Sign in or create an account with this email address, then accept the invitation here:\r\n\r\n")
+	buf.WriteString(inv.AcceptURL + "\r\n\r\n")
+	buf.WriteString(fmt.Sprintf("The invitation expires on %s.\r\n", inv.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST")))
+	buf.WriteString("If you weren't expecting it, you can ignore this email.\r\n\r\n")
+	buf.WriteString("Cheers,\r\nThe Shop Team\r\n")
+	return buf.Bytes()
+}
+
 var _ Mailer = (*SMTPMailer)(nil)
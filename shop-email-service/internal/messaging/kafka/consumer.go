@@ -2,23 +2,36 @@ package kafka
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hawful70/platform-events/pkg/events"
+	"github.com/hawful70/platform-logging/pkg/logging"
 )
 
+var tracer = otel.Tracer("github.com/hawful70/shop-email-service/internal/messaging/kafka")
+
 type Consumer struct {
-	reader *kafka.Reader
+	reader  *kafka.Reader
+	groupID string
 }
 
-func NewConsumer(brokers []string, topic, groupID string) *Consumer {
+// NewConsumer joins groupID and reads from all topics.
+func NewConsumer(brokers []string, topics []string, groupID string) *Consumer {
 	return &Consumer{
 		reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:  brokers,
-			GroupID:  groupID,
-			Topic:    topic,
-			MinBytes: 1,
-			MaxBytes: 10e6,
+			Brokers:     brokers,
+			GroupID:     groupID,
+			GroupTopics: topics,
+			MinBytes:    1,
+			MaxBytes:    10e6,
 		}),
+		groupID: groupID,
 	}
 }
 
@@ -50,6 +63,37 @@ func (c *Consumer) Stream(ctx context.Context) (<-chan kafka.Message, <-chan err
 	return msgCh, errCh
 }
 
+// StartProcess starts a consumer span for handling msg. It continues the
+// producer's trace when msg carries one in its headers, so a signup and
+// its welcome email are one trace, and carries the producer's request ID for
+// logging. Pass the handler's error to the returned function to end the
+// span.
+func (c *Consumer) StartProcess(ctx context.Context, msg kafka.Message) (context.Context, func(error)) {
+	headers := headerCarrier(msg.Headers)
+	if id := headers.Get(events.RequestIDHeader); id != "" {
+		ctx = logging.ContextWithRequestID(ctx, id)
+	}
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headers)
+	ctx, span := tracer.Start(ctx, "process "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingConsumerGroupName(c.groupID),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaOffset(int(msg.Offset)),
+		),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
 func (c *Consumer) Commit(ctx context.Context, msg kafka.Message) error {
 	return c.reader.CommitMessages(ctx, msg)
 }
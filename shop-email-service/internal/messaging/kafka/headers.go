@@ -0,0 +1,27 @@
+package kafka
+
+import "github.com/segmentio/kafka-go"
+
+// headerCarrier reads and writes propagation fields, such as the trace
+// context, in a message's headers.
+type headerCarrier []kafka.Header
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set is not used by the consumer; headers are only read.
+func (c headerCarrier) Set(key, value string) {}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
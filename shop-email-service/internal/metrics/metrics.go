@@ -0,0 +1,121 @@
+// Package metrics defines the email service's Prometheus metrics: messages
+// through the consumer and SMTP sends.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/hawful70/shop-email-service/internal/email"
+)
+
+type Metrics struct {
+	reg *prometheus.Registry
+
+	consumed        *prometheus.CounterVec
+	handled         *prometheus.CounterVec
+	failed          *prometheus.CounterVec
+	committed       *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	smtpSends       *prometheus.CounterVec
+}
+
+// New registers the metrics with a new registry, together with the Go
+// runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_messages_consumed_total",
+			Help: "Kafka messages fetched, by topic.",
+		}, []string{"topic"}),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_messages_handled_total",
+			Help: "Messages handled without error, by topic.",
+		}, []string{"topic"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_messages_failed_total",
+			Help: "Messages whose handler failed, by topic. They are committed anyway.",
+		}, []string{"topic"}),
+		committed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_messages_committed_total",
+			Help: "Message offsets committed, by topic.",
+		}, []string{"topic"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "email_handler_duration_seconds",
+			Help:    "Time to handle a message, including the SMTP send, by topic.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"topic"}),
+		smtpSends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "email_smtp_sends_total",
+			Help: "Emails sent over SMTP, by kind (welcome, invitation) and result.",
+		}, []string{"kind", "result"}),
+	}
+	m.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.consumed, m.handled, m.failed, m.committed, m.handlerDuration, m.smtpSends,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{Registry: m.reg})
+}
+
+// Consumed counts a message fetched from topic.
+func (m *Metrics) Consumed(topic string) {
+	m.consumed.WithLabelValues(topic).Inc()
+}
+
+// Handled records the outcome and duration of handling a message from
+// topic that started at start.
+func (m *Metrics) Handled(topic string, start time.Time, err error) {
+	m.handlerDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.failed.WithLabelValues(topic).Inc()
+		return
+	}
+	m.handled.WithLabelValues(topic).Inc()
+}
+
+// Committed counts a message from topic whose offset was committed.
+func (m *Metrics) Committed(topic string) {
+	m.committed.WithLabelValues(topic).Inc()
+}
+
+type instrumentedMailer struct {
+	email.Mailer
+	m *Metrics
+}
+
+// InstrumentMailer counts the results of the emails mailer sends.
+func (m *Metrics) InstrumentMailer(mailer email.Mailer) email.Mailer {
+	return instrumentedMailer{Mailer: mailer, m: m}
+}
+
+func (i instrumentedMailer) SendWelcome(ctx context.Context, to, name string) error {
+	err := i.Mailer.SendWelcome(ctx, to, name)
+	i.m.sent("welcome", err)
+	return err
+}
+
+func (i instrumentedMailer) SendInvitation(ctx context.Context, inv email.Invitation) error {
+	err := i.Mailer.SendInvitation(ctx, inv)
+	i.m.sent("invitation", err)
+	return err
+}
+
+func (m *Metrics) sent(kind string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.smtpSends.WithLabelValues(kind, result).Inc()
+}
@@ -0,0 +1,108 @@
+// Package openapi serves the OpenAPI 3 description of the identity HTTP API.
+// gateway.yaml is generated from identity.proto together with the gateway
+// and covers the routes it serves; auth.yaml is written by hand for the
+// /auth routes. Document merges the two.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	//go:embed gateway.yaml
+	gatewayYAML []byte
+	//go:embed auth.yaml
+	authYAML []byte
+)
+
+type document = map[string]any
+
+// Document returns the merged description as JSON. Gateway routes are
+// marked as requiring an admin bearer token, which the server enforces, and
+// every operation gets the problem document as its default response.
+func Document() ([]byte, error) {
+	var gateway, auth document
+	if err := yaml.Unmarshal(gatewayYAML, &gateway); err != nil {
+		return nil, fmt.Errorf("gateway.yaml: %w", err)
+	}
+	if err := yaml.Unmarshal(authYAML, &auth); err != nil {
+		return nil, fmt.Errorf("auth.yaml: %w", err)
+	}
+
+	adminOnly := []any{document{"bearerAuth": []any{}}}
+	for _, op := range operations(gateway) {
+		op["security"] = adminOnly
+	}
+	// Every route answers errors with a problem document.
+	problem := document{"$ref": "#/components/responses/Error"}
+	for _, op := range append(operations(auth), operations(gateway)...) {
+		responses := section(op, "responses")
+		if _, ok := responses["default"]; !ok {
+			responses["default"] = problem
+		}
+		op["responses"] = responses
+	}
+
+	merged := document{
+		"openapi": auth["openapi"],
+		"info": document{
+			"title":       "Identity API",
+			"version":     auth["info"].(document)["version"],
+			"description": "Authentication routes and the identity gRPC API over HTTP/JSON.\n\n" + gateway["info"].(document)["description"].(string),
+		},
+		"tags":  append(list(auth, "tags"), list(gateway, "tags")...),
+		"paths": merge(section(auth, "paths"), section(gateway, "paths")),
+	}
+	components := document{}
+	for _, doc := range []document{auth, gateway} {
+		for name, c := range section(doc, "components") {
+			components[name] = merge(asDocument(components[name]), c.(document))
+		}
+	}
+	merged["components"] = components
+	return json.Marshal(merged)
+}
+
+func operations(doc document) []document {
+	var ops []document
+	for _, item := range section(doc, "paths") {
+		for _, op := range asDocument(item) {
+			if op, ok := op.(document); ok {
+				ops = append(ops, op)
+			}
+		}
+	}
+	return ops
+}
+
+func section(doc document, key string) document {
+	return asDocument(doc[key])
+}
+
+func asDocument(v any) document {
+	if d, ok := v.(document); ok {
+		return d
+	}
+	return document{}
+}
+
+func list(doc document, key string) []any {
+	l, _ := doc[key].([]any)
+	return l
+}
+
+// merge copies b's entries into a copy of a. The files do not share keys,
+// so nothing is overwritten.
+func merge(a, b document) document {
+	out := maps.Clone(a)
+	if out == nil {
+		out = document{}
+	}
+	maps.Copy(out, b)
+	return out
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+const canonicalizePageSize = 500
+
+func runCanonicalizeEmails(ctx context.Context, args []string) error {
+	fs := newFlagSet("canonicalize-emails", "Recomputes each user's canonical email with the current EMAIL_CANONICALIZE\nand EMAIL_PLUS_TAG_DOMAINS, filling in rows stored without one. Users whose\nnew canonical email belongs to another user are reported and left as they\nare.\n")
+	tenant := fs.String("tenant", "", "only this tenant (default: all tenants)")
+	dryRun := fs.Bool("dry-run", false, "list the changes without saving them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+
+	var changed, conflicts int
+	err = eachUser(ctx, e, *tenant, func(u domain.User) error {
+		canonical := e.emails.Canonical(u.Email)
+		if canonical == u.EmailCanonical {
+			return nil
+		}
+		if *dryRun {
+			fmt.Printf("%s  %s  %q -> %q\n", u.TenantID, u.ID, u.EmailCanonical, canonical)
+			changed++
+			return nil
+		}
+		u.EmailCanonical = canonical
+		err := e.repo.UpdateUser(ctx, u)
+		switch {
+		case errors.Is(err, repository.ErrEmailTaken):
+			fmt.Fprintf(os.Stderr, "%s  %s: %s is already another user's canonical email\n", u.TenantID, u.ID, canonical)
+			conflicts++
+		case err != nil:
+			return fmt.Errorf("update %s after %d changes: %w", u.ID, changed, err)
+		default:
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportChanges(changed, *dryRun)
+	if conflicts > 0 {
+		return fmt.Errorf("%d users share a canonical email with another user", conflicts)
+	}
+	return nil
+}
+
+func runCanonicalizeUsernames(ctx context.Context, args []string) error {
+	fs := newFlagSet("canonicalize-usernames", "Recomputes each user's canonical username and skeleton, filling in rows\nstored without them. Users whose username reads the same as another user's,\nor is no longer valid, are reported and left as they are.\n")
+	tenant := fs.String("tenant", "", "only this tenant (default: all tenants)")
+	dryRun := fs.Bool("dry-run", false, "list the changes without saving them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+
+	var changed, conflicts, invalid int
+	err = eachUser(ctx, e, *tenant, func(u domain.User) error {
+		name, err := domain.ParseUsername(u.Username)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s  %s: username %q: %v\n", u.TenantID, u.ID, u.Username, err)
+			invalid++
+			return nil
+		}
+		if name.Canonical == u.UsernameCanonical && name.Skeleton == u.UsernameSkeleton {
+			return nil
+		}
+		clash := func() {
+			fmt.Fprintf(os.Stderr, "%s  %s: %q reads the same as another user's username\n", u.TenantID, u.ID, u.Username)
+			conflicts++
+		}
+		if *dryRun {
+			taken, err := e.repo.UsernameExists(ctx, u.TenantID, name, u.ID)
+			switch {
+			case err != nil:
+				return err
+			case taken:
+				clash()
+			default:
+				fmt.Printf("%s  %s  %q: %q, %q -> %q, %q\n", u.TenantID, u.ID, u.Username,
+					u.UsernameCanonical, u.UsernameSkeleton, name.Canonical, name.Skeleton)
+				changed++
+			}
+			return nil
+		}
+		u.UsernameCanonical, u.UsernameSkeleton = name.Canonical, name.Skeleton
+		err = e.repo.UpdateUser(ctx, u)
+		switch {
+		case errors.Is(err, repository.ErrUsernameTaken):
+			clash()
+		case err != nil:
+			return fmt.Errorf("update %s after %d changes: %w", u.ID, changed, err)
+		default:
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportChanges(changed, *dryRun)
+	if conflicts > 0 || invalid > 0 {
+		return fmt.Errorf("%d users share a username with another user, %d have an invalid username", conflicts, invalid)
+	}
+	return nil
+}
+
+// eachUser calls fn for every user of tenant, or of all tenants when tenant
+// is empty. Pages are ordered by creation, which fn's updates leave alone.
+func eachUser(ctx context.Context, e *env, tenant string, fn func(domain.User) error) error {
+	tenantIDs := []domain.TenantID{domain.TenantID(tenant)}
+	if tenant == "" {
+		tenants, err := repository.NewPostgresTenantRepository(e.db).ListTenants(ctx)
+		if err != nil {
+			return err
+		}
+		// The default tenant has no row until identity-service first starts.
+		tenantIDs = tenantIDs[:0]
+		tenantIDs = append(tenantIDs, domain.DefaultTenantID)
+		for _, t := range tenants {
+			if t.ID != domain.DefaultTenantID {
+				tenantIDs = append(tenantIDs, t.ID)
+			}
+		}
+	}
+
+	for _, tenantID := range tenantIDs {
+		for offset := 0; ; offset += canonicalizePageSize {
+			users, _, err := e.repo.ListUsers(ctx, tenantID, repository.UserFilter{}, offset, canonicalizePageSize)
+			if err != nil {
+				return err
+			}
+			for _, u := range users {
+				if err := fn(u); err != nil {
+					return err
+				}
+			}
+			if len(users) < canonicalizePageSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func reportChanges(changed int, dryRun bool) {
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "%d users would change\n", changed)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d users updated\n", changed)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	platformconfig "github.com/hawful70/platform-config/pkg/config"
+
+	"github.com/hawful70/shop-identity-service/internal/config"
+)
+
+const configUsage = `Prints the configuration identity-service would start with, as .env lines
+with the source of each value: default, file, .env, env, secret file or flag.
+
+  print   print every setting, then any validation errors
+
+The configuration is printed even when it is invalid, so that the errors
+can be traced to their source.
+`
+
+func runConfig(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		newFlagSet("config print", configUsage).Usage()
+		return errors.New("missing config command")
+	}
+
+	fs := newFlagSet("config print", configUsage)
+	redacted := fs.Bool("redacted", false, "replace secrets such as JWT_SECRET and DB_DSN with "+platformconfig.Redacted)
+	file := fs.String("config", "", "YAML file to read instead of "+platformconfig.FileEnv)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var loadArgs []string
+	if *file != "" {
+		loadArgs = []string{"--" + platformconfig.FileFlag, *file}
+	}
+	cfg, sources, loadErr := config.Load(loadArgs)
+	if err := platformconfig.Print(os.Stdout, cfg, sources, *redacted); err != nil {
+		return err
+	}
+	if loadErr != nil {
+		return fmt.Errorf("invalid configuration:\n%w", loadErr)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/config"
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// env wires the identity service the way identity-service does, minus the
+// transports, for commands that act on users or tokens.
+type env struct {
+	cfg     config.Config
+	db      *gorm.DB
+	repo    repository.Repository
+	tenants *identity.TenantRegistry
+	keys    repository.SigningKeyRepository
+	ring    *identity.SigningKeyRing
+	jwt     *identity.JWTManager
+	emails  identity.EmailPolicy
+	svc     identity.Service
+}
+
+func openEnv(ctx context.Context, notifier identity.UserNotifier) (*env, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	tenantRepo := repository.NewPostgresTenantRepository(db)
+	defaultTenant := domain.Tenant{ID: domain.DefaultTenantID, Name: "Default", JWTIssuer: cfg.JWTIssuer}
+	tenants := identity.NewTenantRegistry(tenantRepo, defaultTenant)
+	if err := tenants.Reload(ctx); err != nil {
+		return nil, fmt.Errorf("load tenants: %w", err)
+	}
+
+	keys := repository.NewPostgresSigningKeyRepository(db)
+	ring := identity.NewSigningKeyRing(keys, cfg.KeyEncryptionKey(), max(cfg.JWTExpiresIn, cfg.ImpersonationTTL))
+	if err := ring.Reload(ctx); err != nil {
+		return nil, fmt.Errorf("load signing keys: %w", err)
+	}
+	jwtManager := identity.NewJWTManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTExpiresIn)
+	jwtManager.UseTenants(tenants)
+	jwtManager.UseSigningKeys(ring)
+
+	policies := identity.PasswordPolicies{}
+	for role, p := range cfg.PasswordPolicies() {
+		policies[identity.Role(role)] = identity.PasswordPolicy{HistorySize: p.HistorySize, MaxAge: p.MaxAge}
+	}
+	emailPolicy := identity.EmailPolicy{
+		Canonicalize:   cfg.EmailCanonicalize,
+		PlusTagDomains: identity.DomainSet(cfg.EmailPlusTagDomains),
+	}
+	if cfg.EmailBlocklistFile != "" {
+		emailPolicy.BlockedDomains, err = identity.LoadDomainBlocklist(cfg.EmailBlocklistFile)
+		if err != nil {
+			return nil, fmt.Errorf("load email blocklist: %w", err)
+		}
+	}
+
+	repo := userRepository(cfg, db)
+	if cfg.UserCache == "redis" {
+		// Go through the shared cache so that running services see suspended
+		// users and revoked sessions at once. A memory cache is private to
+		// each service process; those pick changes up within USER_CACHE_TTL.
+		redisOpts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+		}
+		cache := repository.NewRedisUserCache(redis.NewClient(redisOpts), repository.RedisUserCachePrefix)
+		repo = repository.NewCachedRepository(repo, cache,
+			repository.WithCacheTTL(cfg.UserCacheTTL),
+			repository.WithNegativeCacheTTL(cfg.UserCacheNegativeTTL))
+	}
+	svc := identity.NewService(repo, jwtManager, notifier,
+		identity.WithPasswordPolicies(policies),
+		identity.WithEmailPolicy(emailPolicy),
+		identity.WithImpersonation(repository.NewPostgresImpersonationRepository(db), cfg.ImpersonationTTL),
+		identity.WithRefreshTokens(repository.NewPostgresRefreshTokenRepository(db)),
+		identity.WithTenants(tenants),
+	)
+
+	return &env{
+		cfg:     cfg,
+		db:      db,
+		repo:    repo,
+		tenants: tenants,
+		keys:    keys,
+		ring:    ring,
+		jwt:     jwtManager,
+		emails:  emailPolicy,
+		svc:     svc,
+	}, nil
+}
+
+// tenantContext scopes ctx to a tenant for service calls.
+func (e *env) tenantContext(ctx context.Context, id domain.TenantID) (context.Context, error) {
+	tenant, ok := e.tenants.Tenant(id)
+	if !ok {
+		return nil, fmt.Errorf("tenant %q does not exist", id)
+	}
+	return identity.ContextWithTenant(ctx, tenant), nil
+}
+
+// userFlags selects a user by ID, or by email within a tenant.
+type userFlags struct {
+	id     string
+	email  string
+	tenant string
+}
+
+func (f *userFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.id, "id", "", "user ID")
+	fs.StringVar(&f.email, "email", "", "user email, looked up in -tenant")
+	fs.StringVar(&f.tenant, "tenant", string(domain.DefaultTenantID), "tenant of -email")
+}
+
+// find returns the selected user and a context scoped to their tenant.
+func (f *userFlags) find(ctx context.Context, e *env) (domain.User, context.Context, error) {
+	var (
+		user domain.User
+		err  error
+	)
+	switch {
+	case f.id != "" && f.email != "":
+		return domain.User{}, nil, errors.New("set either -id or -email, not both")
+	case f.id != "":
+		user, err = e.repo.GetUserByID(ctx, domain.UserID(f.id))
+	case f.email != "":
+		user, err = e.repo.GetUserByEmail(ctx, domain.TenantID(f.tenant), strings.ToLower(strings.TrimSpace(f.email)))
+	default:
+		return domain.User{}, nil, errors.New("-id or -email is required")
+	}
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+
+	ctx, err = e.tenantContext(ctx, user.TenantID)
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+	return user, ctx, nil
+}
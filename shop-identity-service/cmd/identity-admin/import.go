@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/events"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+const importUsage = `usage: identity-admin import [flags] <file>
+
+Loads users from a CSV file with a header row or from JSONL, one object per
+line. Use "-" to read stdin. Columns: email, username, password or
+password_hash (bcrypt), and optionally id, tenant_id, role, external_id,
+suspended and created_at (RFC 3339). Plain passwords are hashed here, which
+is slow for large files.
+
+Flags:
+`
+
+type importOptions struct {
+	format     string
+	tenant     string
+	batchSize  int
+	dryRun     bool
+	emitEvents bool
+}
+
+func runImport(ctx context.Context, args []string) error {
+	var opts importOptions
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), importUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.format, "format", "", "csv or jsonl (default: from the file extension)")
+	fs.StringVar(&opts.tenant, "tenant", string(domain.DefaultTenantID), "tenant for rows without tenant_id")
+	fs.IntVar(&opts.batchSize, "batch-size", 1000, "users inserted per transaction")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "validate the file without touching the database")
+	fs.BoolVar(&opts.emitEvents, "emit-events", false, "publish a user_created event for every imported user")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one input file is required")
+	}
+	if opts.batchSize <= 0 {
+		return errors.New("-batch-size must be positive")
+	}
+	path := fs.Arg(0)
+
+	format, err := detectFormat(opts.format, path)
+	if err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	records, err := newRecordReader(format, in)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	imp := &importer{
+		opts: opts,
+		emails: identity.EmailPolicy{
+			Canonicalize:   cfg.EmailCanonicalize,
+			PlusTagDomains: identity.DomainSet(cfg.EmailPlusTagDomains),
+		},
+		notify:  identity.NoopNotifier(),
+		seen:    make(map[string]int),
+		tenants: make(map[domain.TenantID]error),
+		now:     time.Now().UTC(),
+	}
+
+	if !opts.dryRun {
+		db, err := openDB(cfg)
+		if err != nil {
+			return fmt.Errorf("connect to database: %w", err)
+		}
+		imp.repo = userRepository(cfg, db)
+		imp.tenantRepo = repository.NewPostgresTenantRepository(db)
+
+		if opts.emitEvents {
+			if len(cfg.KafkaBrokers) == 0 {
+				return errors.New("-emit-events needs KAFKA_BROKERS")
+			}
+			notifier := events.NewKafkaNotifier(cfg.KafkaBrokers, cfg.KafkaUserCreatedTopic)
+			defer notifier.Close()
+			imp.notify = notifier
+		}
+	}
+
+	if err := imp.run(ctx, records); err != nil {
+		return err
+	}
+
+	verb := "imported"
+	if opts.dryRun {
+		verb = "valid"
+	}
+	fmt.Fprintf(os.Stderr, "%d rows read, %d %s, %d failed\n", imp.read, imp.created, verb, imp.failed)
+	if imp.failed > 0 {
+		return fmt.Errorf("%d rows failed", imp.failed)
+	}
+	return nil
+}
+
+type pendingUser struct {
+	line int
+	user domain.User
+}
+
+type importer struct {
+	opts       importOptions
+	repo       repository.Repository
+	tenantRepo repository.TenantRepository
+	emails     identity.EmailPolicy
+	notify     identity.UserNotifier
+	now        time.Time
+
+	// seen maps the unique keys of rows read so far to their line, to catch
+	// duplicates inside the file before they reach the database.
+	seen    map[string]int
+	tenants map[domain.TenantID]error
+	batch   []pendingUser
+
+	read, created, failed int
+}
+
+func (imp *importer) run(ctx context.Context, records recordReader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rec, line, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		imp.read++
+		if err != nil {
+			imp.reject(line, rec.Email, err)
+			continue
+		}
+
+		user, err := imp.buildUser(ctx, rec)
+		if err != nil {
+			imp.reject(line, rec.Email, err)
+			continue
+		}
+		if err := imp.checkDuplicate(line, user); err != nil {
+			imp.reject(line, rec.Email, err)
+			continue
+		}
+
+		if imp.opts.dryRun {
+			imp.created++
+			continue
+		}
+		imp.batch = append(imp.batch, pendingUser{line: line, user: user})
+		if len(imp.batch) >= imp.opts.batchSize {
+			if err := imp.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return imp.flush(ctx)
+}
+
+// buildUser validates a record through domain.NewUser, keeping an existing
+// bcrypt hash as is.
+func (imp *importer) buildUser(ctx context.Context, rec userRecord) (domain.User, error) {
+	var hash string
+	switch {
+	case rec.PasswordHash != "":
+		if !identity.IsPasswordHash(rec.PasswordHash) {
+			return domain.User{}, errors.New("password_hash is not a bcrypt hash")
+		}
+		hash = rec.PasswordHash
+	case rec.Password != "":
+		if len(rec.Password) < 8 {
+			return domain.User{}, identity.ErrPasswordTooWeak
+		}
+		var err error
+		if hash, err = identity.HashPassword(rec.Password); err != nil {
+			return domain.User{}, err
+		}
+	default:
+		return domain.User{}, errors.New("password or password_hash is required")
+	}
+
+	user, err := domain.NewUser(rec.Email, rec.Username, hash)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user.TenantID = domain.TenantID(imp.opts.tenant)
+	if rec.TenantID != "" {
+		user.TenantID = domain.TenantID(rec.TenantID)
+	}
+	if err := imp.checkTenant(ctx, user.TenantID); err != nil {
+		return domain.User{}, err
+	}
+
+	if rec.ID != "" {
+		user.ID = domain.UserID(rec.ID)
+	}
+	if rec.Role != "" {
+		role := domain.Role(strings.ToLower(rec.Role))
+		switch role {
+		case domain.RoleCustomer, domain.RoleSeller, domain.RoleAdmin:
+			user.Role = role
+		default:
+			return domain.User{}, fmt.Errorf("unknown role %q", rec.Role)
+		}
+	}
+	user.EmailCanonical = imp.emails.Canonical(user.Email)
+	user.ExternalID = rec.ExternalID
+	if rec.CreatedAt != nil {
+		user.CreatedAt = rec.CreatedAt.UTC()
+	}
+	// The password rotation clock starts at import time.
+	user.PasswordChangedAt = imp.now
+	user.UpdatedAt = imp.now
+	if rec.Suspended {
+		suspendedAt := imp.now
+		user.SuspendedAt = &suspendedAt
+	}
+	return user, nil
+}
+
+// checkTenant looks each tenant up once. Dry runs do not check tenants.
+func (imp *importer) checkTenant(ctx context.Context, id domain.TenantID) error {
+	if imp.tenantRepo == nil {
+		return nil
+	}
+	err, ok := imp.tenants[id]
+	if !ok {
+		_, err = imp.tenantRepo.GetTenant(ctx, id)
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			err = fmt.Errorf("tenant %q does not exist", id)
+		}
+		imp.tenants[id] = err
+	}
+	return err
+}
+
+func (imp *importer) checkDuplicate(line int, u domain.User) error {
+	keys := []struct{ kind, key string }{
+		{"id", "id|" + string(u.ID)},
+		{"email", "email|" + string(u.TenantID) + "|" + u.EmailCanonical},
+		{"username", "username|" + string(u.TenantID) + "|" + u.UsernameSkeleton},
+	}
+	for _, k := range keys {
+		if first, ok := imp.seen[k.key]; ok {
+			return fmt.Errorf("duplicate %s, first seen on line %d", k.kind, first)
+		}
+	}
+	for _, k := range keys {
+		imp.seen[k.key] = line
+	}
+	return nil
+}
+
+// flush inserts the pending batch in one transaction. When that fails the
+// rows are retried one by one so that each failure is reported on its row.
+func (imp *importer) flush(ctx context.Context) error {
+	batch := imp.batch
+	imp.batch = imp.batch[:0]
+	if len(batch) == 0 {
+		return nil
+	}
+
+	users := make([]domain.User, 0, len(batch))
+	for _, p := range batch {
+		users = append(users, p.user)
+	}
+	err := imp.repo.CreateUsers(ctx, users)
+	if err == nil {
+		for _, p := range batch {
+			imp.inserted(ctx, p)
+		}
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, p := range batch {
+		if err := imp.repo.CreateUser(ctx, p.user); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			imp.reject(p.line, p.user.Email, err)
+			continue
+		}
+		imp.inserted(ctx, p)
+	}
+	return nil
+}
+
+func (imp *importer) inserted(ctx context.Context, p pendingUser) {
+	imp.created++
+	if err := imp.notify.UserCreated(ctx, p.user); err != nil {
+		fmt.Fprintf(os.Stderr, "line %d (%s): imported, but user_created event failed: %v\n", p.line, p.user.Email, err)
+	}
+}
+
+func (imp *importer) reject(line int, email string, err error) {
+	imp.failed++
+	if email == "" {
+		email = "-"
+	}
+	fmt.Fprintf(os.Stderr, "line %d (%s): %v\n", line, email, err)
+}
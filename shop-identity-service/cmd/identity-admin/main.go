@@ -0,0 +1,118 @@
+// Command identity-admin runs operator tasks against the identity database,
+// using the same configuration as identity-service.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/hawful70/shop-identity-service/internal/config"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+const usage = `usage: identity-admin <command> [flags]
+
+Commands:
+  migrate              apply, revert or list schema migrations
+  create-user          create a user or admin
+  reset-password       set a new password for a user
+  suspend-user         block a user from signing in
+  revoke-sessions      invalidate all tokens of a user
+  rotate-signing-key   start signing tokens with a new key
+  decode-token         print and check the claims of a token
+  replay-user-created  publish user_created again for a time range
+  import               load users from a CSV or JSONL file
+  export               write a tenant's users to a CSV or JSONL file
+  canonicalize-emails  recompute the canonical emails used for uniqueness
+  canonicalize-usernames
+                       recompute the canonical usernames and skeletons
+  config print         print the configuration and where each value came from
+
+Run "identity-admin <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "migrate":
+		err = runMigrate(ctx, args)
+	case "create-user":
+		err = runCreateUser(ctx, args)
+	case "reset-password":
+		err = runResetPassword(ctx, args)
+	case "suspend-user":
+		err = runSuspendUser(ctx, args)
+	case "revoke-sessions":
+		err = runRevokeSessions(ctx, args)
+	case "rotate-signing-key":
+		err = runRotateSigningKey(ctx, args)
+	case "decode-token":
+		err = runDecodeToken(ctx, args)
+	case "replay-user-created":
+		err = runReplayUserCreated(ctx, args)
+	case "import":
+		err = runImport(ctx, args)
+	case "export":
+		err = runExport(ctx, args)
+	case "canonicalize-emails":
+		err = runCanonicalizeEmails(ctx, args)
+	case "canonicalize-usernames":
+		err = runCanonicalizeUsernames(ctx, args)
+	case "config":
+		err = runConfig(ctx, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "identity-admin %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig reads the configuration identity-service would use, without
+// flags.
+func loadConfig() (config.Config, error) {
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// openDB connects without applying migrations; use the migrate command.
+// SQLite databases get their schema when opened.
+func openDB(cfg config.Config) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)}
+	if cfg.DBDriver == "sqlite" {
+		return repository.OpenSQLite(cfg.DBDSN, gormConfig)
+	}
+	return gorm.Open(postgres.Open(cfg.DBDSN), gormConfig)
+}
+
+// userRepository returns the user repository for the configured driver.
+func userRepository(cfg config.Config, db *gorm.DB) repository.Repository {
+	if cfg.DBDriver == "sqlite" {
+		return repository.NewSQLiteRepository(db)
+	}
+	return repository.NewPostgresRepository(db)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/migrate"
+	"github.com/hawful70/shop-identity-service/migrations"
+)
+
+const migrateUsage = `Applies or reverts the schema migrations embedded in this binary:
+
+  up      apply every pending migration
+  down    revert the most recent migrations (-steps, default 1)
+  status  list migrations and when they were applied
+
+Replicas take a database lock while migrating, so running this during a
+rollout is safe.
+`
+
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		newFlagSet("migrate up|down|status", migrateUsage).Usage()
+		return errors.New("missing migrate command")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := newFlagSet("migrate "+sub, migrateUsage)
+	steps := 1
+	if sub == "down" {
+		fs.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.DBDriver != "postgres" {
+		return fmt.Errorf("migrations are for postgres; %s databases get their schema when opened", cfg.DBDriver)
+	}
+	db, err := openDB(cfg)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	migrator, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		if steps <= 0 {
+			return errors.New("-steps must be positive")
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down or status", sub)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userRecord is one user in an import or export file. Imports need a
+// password or a bcrypt password_hash; every other column is optional.
+type userRecord struct {
+	ID           string     `json:"id,omitempty"`
+	TenantID     string     `json:"tenant_id,omitempty"`
+	Email        string     `json:"email"`
+	Username     string     `json:"username"`
+	Password     string     `json:"password,omitempty"`
+	PasswordHash string     `json:"password_hash,omitempty"`
+	Role         string     `json:"role,omitempty"`
+	ExternalID   string     `json:"external_id,omitempty"`
+	Suspended    bool       `json:"suspended,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+var csvColumns = []string{
+	"id", "tenant_id", "email", "username", "password", "password_hash",
+	"role", "external_id", "suspended", "created_at",
+}
+
+// detectFormat returns format, or guesses it from the file extension.
+func detectFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".jsonl", ".ndjson":
+			format = "jsonl"
+		default:
+			return "", errors.New("cannot guess the file format, set -format")
+		}
+	}
+	if format != "csv" && format != "jsonl" {
+		return "", fmt.Errorf("unsupported format %q, use csv or jsonl", format)
+	}
+	return format, nil
+}
+
+// recordReader returns io.EOF after the last record. Other errors concern a
+// single record and reading can continue.
+type recordReader interface {
+	Read() (rec userRecord, line int, err error)
+}
+
+func newRecordReader(format string, r io.Reader) (recordReader, error) {
+	if format == "csv" {
+		return newCSVReader(r)
+	}
+	return newJSONLReader(r), nil
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if !slices.Contains(csvColumns, h) {
+			return nil, fmt.Errorf("unknown csv column %q", h)
+		}
+		columns[i] = h
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (userRecord, int, error) {
+	fields, err := c.r.Read()
+	line, _ := c.r.FieldPos(0)
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return userRecord{}, perr.Line, perr.Err
+		}
+		return userRecord{}, line, err
+	}
+
+	var rec userRecord
+	for i, value := range fields {
+		if err := rec.set(c.columns[i], strings.TrimSpace(value)); err != nil {
+			return userRecord{}, line, err
+		}
+	}
+	return rec, line, nil
+}
+
+func (rec *userRecord) set(column, value string) error {
+	switch column {
+	case "id":
+		rec.ID = value
+	case "tenant_id":
+		rec.TenantID = value
+	case "email":
+		rec.Email = value
+	case "username":
+		rec.Username = value
+	case "password":
+		rec.Password = value
+	case "password_hash":
+		rec.PasswordHash = value
+	case "role":
+		rec.Role = value
+	case "external_id":
+		rec.ExternalID = value
+	case "suspended":
+		if value == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("suspended: %w", err)
+		}
+		rec.Suspended = b
+	case "created_at":
+		if value == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("created_at: %w", err)
+		}
+		rec.CreatedAt = &t
+	}
+	return nil
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &jsonlReader{s: s}
+}
+
+func (j *jsonlReader) Read() (userRecord, int, error) {
+	for j.s.Scan() {
+		j.line++
+		b := j.s.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var rec userRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return userRecord{}, j.line, err
+		}
+		return rec, j.line, nil
+	}
+	if err := j.s.Err(); err != nil {
+		return userRecord{}, j.line, fmt.Errorf("read jsonl: %w", err)
+	}
+	return userRecord{}, j.line, io.EOF
+}
+
+type recordWriter interface {
+	Write(rec userRecord) error
+	Flush() error
+}
+
+func newRecordWriter(format string, w io.Writer, withHashes bool) (recordWriter, error) {
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		columns := make([]string, 0, len(csvColumns))
+		for _, c := range csvColumns {
+			if c == "password" || (c == "password_hash" && !withHashes) {
+				continue
+			}
+			columns = append(columns, c)
+		}
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw, columns: columns}, nil
+	}
+	bw := bufio.NewWriter(w)
+	return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvWriter) Write(rec userRecord) error {
+	row := make([]string, 0, len(c.columns))
+	for _, col := range c.columns {
+		row = append(row, rec.get(col))
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (rec userRecord) get(column string) string {
+	switch column {
+	case "id":
+		return rec.ID
+	case "tenant_id":
+		return rec.TenantID
+	case "email":
+		return rec.Email
+	case "username":
+		return rec.Username
+	case "password_hash":
+		return rec.PasswordHash
+	case "role":
+		return rec.Role
+	case "external_id":
+		return rec.ExternalID
+	case "suspended":
+		return strconv.FormatBool(rec.Suspended)
+	case "created_at":
+		if rec.CreatedAt == nil {
+			return ""
+		}
+		return rec.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(rec userRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/events"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+const replayPageSize = 500
+
+func runReplayUserCreated(ctx context.Context, args []string) error {
+	fs := newFlagSet("replay-user-created", "Publishes user_created again for the users created in [-from, -to), for\nexample after consumers lost events. Consumers see duplicates of events\nthey already handled.\n")
+	from := fs.String("from", "", "start of the range, RFC 3339, inclusive (required)")
+	to := fs.String("to", "", "end of the range, RFC 3339, exclusive (default: now)")
+	tenant := fs.String("tenant", "", "only replay this tenant (default: all tenants)")
+	dryRun := fs.Bool("dry-run", false, "list the users without publishing")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		fs.Usage()
+		return errors.New("-from is required")
+	}
+	filter := repository.UserFilter{CreatedBefore: time.Now().UTC()}
+	var err error
+	if filter.CreatedFrom, err = time.Parse(time.RFC3339, *from); err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	if *to != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+	if !filter.CreatedFrom.Before(filter.CreatedBefore) {
+		return errors.New("-from must be before -to")
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+
+	var notifier identity.UserNotifier = identity.NoopNotifier()
+	if !*dryRun {
+		if len(e.cfg.KafkaBrokers) == 0 {
+			return errors.New("KAFKA_BROKERS is not set")
+		}
+		kafkaNotifier := events.NewKafkaNotifier(e.cfg.KafkaBrokers, e.cfg.KafkaUserCreatedTopic)
+		defer kafkaNotifier.Close()
+		notifier = kafkaNotifier
+	}
+
+	tenantIDs := []domain.TenantID{domain.TenantID(*tenant)}
+	if *tenant == "" {
+		tenants, err := repository.NewPostgresTenantRepository(e.db).ListTenants(ctx)
+		if err != nil {
+			return err
+		}
+		tenantIDs = tenantIDs[:0]
+		for _, t := range tenants {
+			tenantIDs = append(tenantIDs, t.ID)
+		}
+	}
+
+	var published int
+	for _, tenantID := range tenantIDs {
+		for offset := 0; ; offset += replayPageSize {
+			users, _, err := e.repo.ListUsers(ctx, tenantID, filter, offset, replayPageSize)
+			if err != nil {
+				return err
+			}
+			for _, u := range users {
+				if *dryRun {
+					fmt.Printf("%s  %s  %s  %s\n", u.CreatedAt.Format(time.RFC3339), u.TenantID, u.ID, u.Email)
+				} else if err := notifier.UserCreated(ctx, u); err != nil {
+					return fmt.Errorf("publish user_created for %s after %d events: %w", u.ID, published, err)
+				}
+				published++
+			}
+			if len(users) < replayPageSize {
+				break
+			}
+		}
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%d users would be replayed\n", published)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d user_created events published\n", published)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// defaultKeyActivationDelay leaves every identity-service instance time to
+// reload a new key, which they do every minute, before tokens use it.
+const defaultKeyActivationDelay = 2 * time.Minute
+
+func runRotateSigningKey(ctx context.Context, args []string) error {
+	fs := newFlagSet("rotate-signing-key", "Adds a new token signing key and retires the current ones once it\nactivates. Retired keys keep verifying tokens until those expire.\n")
+	activateIn := fs.Duration("activate-in", defaultKeyActivationDelay, "delay before the new key starts signing tokens")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *activateIn < time.Minute {
+		fmt.Fprintln(os.Stderr, "warning: instances reload keys every minute; tokens may be rejected until they do")
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+
+	key, err := e.ring.Rotate(ctx, time.Now().Add(*activateIn))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("signing key %s activates at %s\n", key.ID, key.ActivatesAt.Format(time.RFC3339))
+
+	keys, err := e.keys.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		status := "active"
+		if k.RetiredAt != nil {
+			status = "retires at " + k.RetiredAt.Format(time.RFC3339)
+		} else if time.Now().Before(k.ActivatesAt) {
+			status = "pending"
+		}
+		fmt.Printf("  %s  created %s  %s\n", k.ID, k.CreatedAt.Format(time.RFC3339), status)
+	}
+	return nil
+}
+
+func runDecodeToken(ctx context.Context, args []string) error {
+	fs := newFlagSet("decode-token", "Prints the header and claims of a token, then checks its signature and\nsession against the database. Pass the token as -token or on stdin.\n")
+	raw := fs.String("token", "", "token to decode (default: read from stdin)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	tokenStr := strings.TrimSpace(*raw)
+	if tokenStr == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read token from stdin: %w", err)
+		}
+		tokenStr = strings.TrimSpace(line)
+	}
+	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+
+	var claims identity.Claims
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, &claims)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(map[string]any{"header": token.Header, "claims": claims}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if exp := claims.ExpiresAt; exp != nil {
+		fmt.Printf("expires:   %s (%s)\n", exp.Time.UTC().Format(time.RFC3339), relative(exp.Time))
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		fmt.Printf("signature: not checked (%v)\n", err)
+		return nil
+	}
+	verified, err := e.jwt.VerifyPurposeToken(tokenStr, claims.Purpose)
+	if err != nil {
+		fmt.Printf("signature: invalid (%v)\n", err)
+		return nil
+	}
+	fmt.Println("signature: valid")
+
+	err = e.svc.CheckSession(ctx, verified)
+	switch {
+	case err == nil:
+		fmt.Println("session:   active")
+	case errors.Is(err, identity.ErrInvalidToken):
+		fmt.Println("session:   revoked, or the user is suspended or deleted")
+	default:
+		return err
+	}
+	return nil
+}
+
+func relative(t time.Time) string {
+	d := time.Until(t).Round(time.Second)
+	if d < 0 {
+		return "expired " + (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
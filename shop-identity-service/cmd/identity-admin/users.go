@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: identity-admin %s [flags]\n\n%s\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args and rejects positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("unexpected arguments")
+	}
+	return nil
+}
+
+// readPassword reads the first line of stdin when fromStdin is set, and
+// otherwise generates a random password.
+func readPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("read password from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), false, nil
+}
+
+func runCreateUser(ctx context.Context, args []string) error {
+	fs := newFlagSet("create-user", "Creates a user with any role, including admin. Without -password-stdin a\nrandom password is generated and printed once.\n")
+	email := fs.String("email", "", "email address (required)")
+	username := fs.String("username", "", "username (required)")
+	role := fs.String("role", string(domain.RoleCustomer), "customer, seller or admin")
+	tenant := fs.String("tenant", string(domain.DefaultTenantID), "tenant to create the user in")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" || *username == "" {
+		fs.Usage()
+		return errors.New("-email and -username are required")
+	}
+
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	// Operators create accounts silently; no welcome email is sent.
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+	ctx, err = e.tenantContext(ctx, domain.TenantID(*tenant))
+	if err != nil {
+		return err
+	}
+
+	user, err := e.svc.CreateAccount(ctx, *email, *username, password, domain.Role(strings.ToLower(*role)))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created %s %s (%s) in tenant %s\n", user.Role, user.ID, user.Email, user.TenantID)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+	return nil
+}
+
+func runResetPassword(ctx context.Context, args []string) error {
+	fs := newFlagSet("reset-password", "Sets a new password and revokes the user's sessions. Without\n-password-stdin a random password is generated and printed once.\n")
+	var who userFlags
+	who.register(fs)
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	keepSessions := fs.Bool("keep-sessions", false, "do not revoke existing sessions")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+	user, ctx, err := who.find(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	if err := e.svc.ResetPassword(ctx, user.ID, password); err != nil {
+		return err
+	}
+	if !*keepSessions {
+		if err := e.svc.RevokeSessions(ctx, user.ID); err != nil {
+			return fmt.Errorf("password reset, but revoking sessions failed: %w", err)
+		}
+	}
+
+	fmt.Printf("password reset for %s (%s)\n", user.ID, user.Email)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+	return nil
+}
+
+func runSuspendUser(ctx context.Context, args []string) error {
+	fs := newFlagSet("suspend-user", "Blocks sign-in and revokes every session of a user.\n")
+	var who userFlags
+	who.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+	user, ctx, err := who.find(ctx, e)
+	if err != nil {
+		return err
+	}
+	if user.Suspended() {
+		fmt.Printf("%s (%s) is already suspended\n", user.ID, user.Email)
+		return nil
+	}
+
+	if err := e.svc.SuspendUser(ctx, user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("suspended %s (%s)\n", user.ID, user.Email)
+	return nil
+}
+
+func runRevokeSessions(ctx context.Context, args []string) error {
+	fs := newFlagSet("revoke-sessions", "Invalidates every token issued to a user so far.\n")
+	var who userFlags
+	who.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	e, err := openEnv(ctx, identity.NoopNotifier())
+	if err != nil {
+		return err
+	}
+	user, ctx, err := who.find(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	if err := e.svc.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("revoked sessions of %s (%s)\n", user.ID, user.Email)
+	return nil
+}
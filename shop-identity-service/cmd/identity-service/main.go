@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -11,85 +12,351 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/hawful70/platform-health/pkg/health"
+	"github.com/hawful70/platform-logging/pkg/logging"
+	"github.com/hawful70/shop-identity-service/api/openapi"
 	"github.com/hawful70/shop-identity-service/internal/config"
 	"github.com/hawful70/shop-identity-service/internal/httpserver"
 	"github.com/hawful70/shop-identity-service/internal/identity"
 	"github.com/hawful70/shop-identity-service/internal/identity/domain"
 	"github.com/hawful70/shop-identity-service/internal/identity/events"
 	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/gateway"
 	identitygrpc "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc"
 	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
 	identityhttp "github.com/hawful70/shop-identity-service/internal/identity/transport/http"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/scim"
+	"github.com/hawful70/shop-identity-service/internal/metrics"
+	"github.com/hawful70/shop-identity-service/internal/migrate"
+	"github.com/hawful70/shop-identity-service/internal/tracing"
+	"github.com/hawful70/shop-identity-service/migrations"
 )
 
+// refreshInterval is how often tenants and signing keys are reloaded.
+const refreshInterval = time.Minute
+
 func main() {
 	cfg := config.MustLoad()
 
-	db, err := gorm.Open(postgres.Open(cfg.DBDSN), &gorm.Config{})
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+	if cfg.JWTSecret == config.DevJWTSecret {
+		slog.Warn("JWT_SECRET is not set; using the insecure development secret, which is refused outside APP_ENV=development")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracesExporter, "shop-identity-service")
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		fatal("failed to set up tracing", err)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
 
-	if err := db.AutoMigrate(&domain.UserModel{}); err != nil {
-		log.Fatalf("failed to migrate database: %v", err)
+	var (
+		db       *gorm.DB
+		repo     repository.Repository
+		dbSystem = "postgresql"
+	)
+	switch cfg.DBDriver {
+	case "sqlite":
+		// The schema is created when opening, so there is nothing to migrate.
+		db, err = repository.OpenSQLite(cfg.DBDSN, &gorm.Config{})
+		if err != nil {
+			fatal("failed to open sqlite database", err)
+		}
+		slog.Warn("using sqlite database; for local development only", "path", cfg.DBDSN)
+		dbSystem = "sqlite"
+		repo = repository.NewSQLiteRepository(db)
+	default:
+		db, err = gorm.Open(postgres.Open(cfg.DBDSN), &gorm.Config{})
+		if err != nil {
+			fatal("failed to connect to database", err)
+		}
+		if err := migrateSchema(context.Background(), db, cfg.DBAutoMigrate); err != nil {
+			fatal("failed to migrate database", err)
+		}
+		repo = repository.NewPostgresRepository(db)
+	}
+	if err := db.Use(tracing.GormPlugin(dbSystem)); err != nil {
+		fatal("failed to trace database queries", err)
 	}
 
+	// Readiness follows the database and, when events are enabled, Kafka.
+	// The user cache is left out: lookups fall back to the database.
+	checker := health.New(health.WithInterval(cfg.HealthCheckInterval))
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("failed to get database handle", err)
+	}
+	checker.Register("database", health.DatabaseCheck(sqlDB), cfg.HealthCheckTimeout)
+	if len(cfg.KafkaBrokers) > 0 {
+		checker.Register("kafka", health.KafkaCheck(cfg.KafkaBrokers), cfg.HealthCheckTimeout)
+	}
+
+	tenantRepo := repository.NewPostgresTenantRepository(db)
+	defaultTenant := domain.Tenant{ID: domain.DefaultTenantID, Name: "Default", JWTIssuer: cfg.JWTIssuer}
+	if err := tenantRepo.CreateTenantIfMissing(context.Background(), defaultTenant); err != nil {
+		fatal("failed to create default tenant", err)
+	}
+	tenants := identity.NewTenantRegistry(tenantRepo, defaultTenant)
+	if err := tenants.Reload(context.Background()); err != nil {
+		fatal("failed to load tenants", err)
+	}
+
+	registry := metrics.NewRegistry()
+	appMetrics := metrics.New(registry)
+
 	jwtManager := identity.NewJWTManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTExpiresIn)
-	repo := repository.NewPostgresRepository(db)
+	jwtManager.UseTenants(tenants)
+
+	// Retired signing keys must outlive every token they signed.
+	signingKeys := identity.NewSigningKeyRing(repository.NewPostgresSigningKeyRepository(db), cfg.KeyEncryptionKey(), max(cfg.JWTExpiresIn, cfg.ImpersonationTTL))
+	if err := signingKeys.Reload(context.Background()); err != nil {
+		fatal("failed to load signing keys", err)
+	}
+	jwtManager.UseSigningKeys(signingKeys)
+
+	if cfg.UserCache != "off" {
+		cached, closeCache, err := newCachedRepository(cfg, repo)
+		if err != nil {
+			fatal("failed to set up user cache", err)
+		}
+		defer closeCache()
+		repo = cached
+		metrics.RegisterUserCache(registry, cached.Stats)
+		slog.Info("user cache enabled", "cache", cfg.UserCache, "ttl", cfg.UserCacheTTL)
+	}
+
 	var notifier identity.UserNotifier = identity.NoopNotifier()
+	var invitationNotifier identity.InvitationNotifier = identity.NoopInvitationNotifier()
 	if len(cfg.KafkaBrokers) > 0 {
 		kafkaNotifier := events.NewKafkaNotifier(cfg.KafkaBrokers, cfg.KafkaUserCreatedTopic)
-		notifier = kafkaNotifier
+		notifier = appMetrics.InstrumentNotifier(kafkaNotifier)
 		defer func() {
 			if err := kafkaNotifier.Close(); err != nil {
-				log.Printf("failed to close kafka notifier: %v", err)
+				slog.Error("failed to close kafka notifier", "error", err)
+			}
+		}()
+
+		kafkaInvitationNotifier := events.NewKafkaInvitationNotifier(cfg.KafkaBrokers, cfg.KafkaOrgInvitationsTopic)
+		invitationNotifier = appMetrics.InstrumentInvitationNotifier(kafkaInvitationNotifier)
+		defer func() {
+			if err := kafkaInvitationNotifier.Close(); err != nil {
+				slog.Error("failed to close kafka invitation notifier", "error", err)
 			}
 		}()
 	} else {
-		log.Println("kafka brokers not configured; user_created events disabled")
+		slog.Warn("kafka brokers not configured; user_created and invitation events disabled")
+	}
+
+	policies := identity.PasswordPolicies{}
+	for role, p := range cfg.PasswordPolicies() {
+		policies[identity.Role(role)] = identity.PasswordPolicy{HistorySize: p.HistorySize, MaxAge: p.MaxAge}
 	}
 
-	svc := identity.NewService(repo, jwtManager, notifier)
-	h := identityhttp.NewHandler(svc, jwtManager)
+	emailPolicy := identity.EmailPolicy{
+		Canonicalize:   cfg.EmailCanonicalize,
+		PlusTagDomains: identity.DomainSet(cfg.EmailPlusTagDomains),
+	}
+	if cfg.EmailBlocklistFile != "" {
+		emailPolicy.BlockedDomains, err = identity.LoadDomainBlocklist(cfg.EmailBlocklistFile)
+		if err != nil {
+			fatal("failed to load email blocklist", err)
+		}
+		slog.Info("loaded blocked email domains", "count", len(emailPolicy.BlockedDomains), "file", cfg.EmailBlocklistFile)
+	}
+
+	serviceOpts := []identity.ServiceOption{
+		identity.WithPasswordPolicies(policies),
+		identity.WithEmailPolicy(emailPolicy),
+		identity.WithImpersonation(repository.NewPostgresImpersonationRepository(db), cfg.ImpersonationTTL),
+		identity.WithRefreshTokens(repository.NewPostgresRefreshTokenRepository(db)),
+		identity.WithTenants(tenants),
+	}
+	svc := appMetrics.InstrumentService(tracing.InstrumentService(identity.NewService(repo, jwtManager, notifier, serviceOpts...)))
+	provisioning := identity.NewProvisioningService(repo, repository.NewPostgresSCIMTokenRepository(db), notifier, serviceOpts...)
+	orgs := identity.NewOrganizationService(repo, repository.NewPostgresOrganizationRepository(db), jwtManager, invitationNotifier, cfg.OrgInvitationTTL)
+	grpcCreds := insecure.NewCredentials()
+	gatewayCreds := insecure.NewCredentials()
+	if cfg.GRPCTLSCertFile != "" {
+		tlsConfig, err := identitygrpc.ServerTLSConfig(cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile, cfg.GRPCClientCAFile)
+		if err != nil {
+			fatal("failed to load gRPC TLS config", err)
+		}
+		grpcCreds = credentials.NewTLS(tlsConfig)
+		gatewayCreds = identitygrpc.LoopbackCredentials(tlsConfig)
+	} else {
+		slog.Warn("gRPC TLS is not configured; services cannot authenticate with certificates")
+	}
+
+	// The gateway dials the gRPC server below; the connection is made lazily.
+	gatewayCtx, stopGateway := context.WithCancel(context.Background())
+	defer stopGateway()
+	gw, err := gateway.New(gatewayCtx, "localhost:"+cfg.GRPCPort, gatewayCreds)
+	if err != nil {
+		fatal("failed to create gateway", err)
+	}
+	spec, err := openapi.Document()
+	if err != nil {
+		fatal("failed to load OpenAPI document", err)
+	}
+	handlerOpts := []identityhttp.HandlerOption{
+		identityhttp.WithIdempotency(repository.NewPostgresIdempotencyRepository(db), cfg.IdempotencyTTL, []byte(cfg.JWTSecret)),
+		identityhttp.WithTenants(tenants),
+		identityhttp.WithOrganizations(orgs),
+		identityhttp.WithProvisioning(provisioning),
+		identityhttp.WithGateway(gw),
+	}
+	if cfg.SessionCookies {
+		handlerOpts = append(handlerOpts, identityhttp.WithCookieSessions(identityhttp.CookieConfig{
+			Domain:     cfg.SessionCookieDomain,
+			Secure:     cfg.SessionCookieSecure,
+			SameSite:   sameSiteMode(cfg.SessionCookieSameSite),
+			AccessTTL:  cfg.JWTExpiresIn,
+			RefreshTTL: cfg.SessionRefreshTTL,
+			Secret:     []byte(cfg.JWTSecret),
+		}))
+	}
+	h := identityhttp.NewHandler(svc, jwtManager, handlerOpts...)
 
 	r := chi.NewRouter()
+	// Every response carries X-Request-ID, which error responses repeat.
+	r.Use(apierror.RequestID)
+	r.Use(tracing.Middleware)
+	r.Use(httpserver.LogRequests)
+	r.Use(appMetrics.Middleware)
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		r.Use(identityhttp.CORS(identityhttp.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		}))
+	}
+	r.NotFound(apierror.NotFound)
+	r.MethodNotAllowed(apierror.MethodNotAllowed)
 
-	// Basic healthcheck
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		_, _ = w.Write([]byte(`{"status":"ok"}`))
-	})
+	// Probes. /health is the old liveness path, kept for existing probes.
+	r.Method(http.MethodGet, "/livez", health.LiveHandler())
+	r.Method(http.MethodGet, "/health", health.LiveHandler())
+	r.Method(http.MethodGet, "/readyz", checker.ReadyHandler())
 
-	// Auth routes
+	// Prometheus metrics for HTTP and gRPC requests and sign-ins.
+	r.Handle("/metrics", metrics.Handler(registry))
+
+	// API reference for the auth and gateway routes.
+	identityhttp.RegisterDocsRoutes(r, spec)
+
+	// Auth routes; the tenant comes from the Host header or the path prefix.
 	r.Route("/api/v1", func(r chi.Router) {
 		h.RegisterRoutes(r)
 	})
+	r.Route("/t/{"+identityhttp.TenantURLParam+"}/api/v1", func(r chi.Router) {
+		h.RegisterRoutes(r)
+	})
+
+	// SCIM provisioning; the tenant comes from the SCIM token.
+	r.Route("/scim/v2", func(r chi.Router) {
+		scim.NewHandler(provisioning).RegisterRoutes(r)
+	})
 
 	srv := httpserver.New(":"+cfg.HTTPPort, r)
 
-	grpcServer := grpc.NewServer()
+	grpcMetrics := identitygrpc.NewMetrics(registry)
+	auth := identitygrpc.NewAuthenticator(jwtManager, svc, cfg.GRPCAllowedClients)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(grpcCreds),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			apierror.UnaryServerInterceptor(),
+			identitygrpc.LoggingUnaryInterceptor(),
+			identitygrpc.MetricsUnaryInterceptor(grpcMetrics),
+			identitygrpc.RecoveryUnaryInterceptor(),
+			identitygrpc.TenantUnaryInterceptor(tenants),
+			identitygrpc.AuthUnaryInterceptor(auth),
+			identitygrpc.ValidationUnaryInterceptor(),
+			identitygrpc.DeadlineUnaryInterceptor(cfg.GRPCDefaultTimeout, cfg.GRPCMaxTimeout),
+		),
+		grpc.ChainStreamInterceptor(
+			apierror.StreamServerInterceptor(),
+			identitygrpc.LoggingStreamInterceptor(),
+			identitygrpc.MetricsStreamInterceptor(grpcMetrics),
+			identitygrpc.RecoveryStreamInterceptor(),
+			identitygrpc.TenantStreamInterceptor(tenants),
+			identitygrpc.AuthStreamInterceptor(auth),
+			identitygrpc.ValidationStreamInterceptor(),
+		),
+		grpc.MaxRecvMsgSize(cfg.GRPCMaxMsgSize),
+		grpc.MaxSendMsgSize(cfg.GRPCMaxMsgSize),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.GRPCKeepaliveTime,
+			Timeout: cfg.GRPCKeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: cfg.GRPCKeepaliveMinTime,
+			// WatchUsers clients may ping between changes.
+			PermitWithoutStream: true,
+		}),
+	)
 	pb.RegisterIdentityServiceServer(grpcServer, identitygrpc.NewServer(svc))
+	healthServer := grpchealth.NewServer()
+	checker.UpdateGRPC(healthServer, pb.IdentityService_ServiceDesc.ServiceName)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
 
 	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
 	if err != nil {
-		log.Fatalf("failed to listen on gRPC port %s: %v", cfg.GRPCPort, err)
+		fatal("failed to listen on gRPC port "+cfg.GRPCPort, err)
 	}
 	defer grpcListener.Close()
 
 	go func() {
 		if err := srv.Start(); err != nil && err.Error() != "http: Server closed" {
-			log.Fatalf("server error: %v", err)
+			fatal("HTTP server failed", err)
 		}
 	}()
 
 	go func() {
-		log.Printf("gRPC server listening on :%s\n", cfg.GRPCPort)
+		slog.Info("gRPC server listening", "addr", ":"+cfg.GRPCPort)
 		if err := grpcServer.Serve(grpcListener); err != nil {
-			log.Fatalf("grpc server error: %v", err)
+			fatal("gRPC server failed", err)
+		}
+	}()
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go checker.Run(healthCtx)
+
+	// Pick up tenants and signing keys added or changed in the database.
+	refreshTicker := time.NewTicker(refreshInterval)
+	defer refreshTicker.Stop()
+	go func() {
+		for range refreshTicker.C {
+			if err := tenants.Reload(context.Background()); err != nil {
+				slog.Error("failed to reload tenants", "error", err)
+			}
+			if err := signingKeys.Reload(context.Background()); err != nil {
+				slog.Error("failed to reload signing keys", "error", err)
+			}
 		}
 	}()
 
@@ -98,12 +365,99 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
+	// Report not ready on /readyz and NOT_SERVING over gRPC, and keep
+	// serving until balancers have noticed.
+	checker.Drain()
+	stopHealth()
+	slog.Info("draining", "delay", cfg.ShutdownDrainDelay)
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("failed to shutdown server: %v", err)
+		slog.Error("failed to shut down HTTP server", "error", err)
+	}
+	// WatchUsers streams only end when their clients leave, so stop waiting
+	// for them with the HTTP server's deadline.
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+	slog.Info("identity service stopped gracefully")
+}
+
+// fatal logs err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// migrateSchema applies pending migrations when auto is set, and fails if
+// the schema is still behind this binary.
+func migrateSchema(ctx context.Context, db *gorm.DB, auto bool) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	migrator, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	if auto {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return fmt.Errorf("%w; run \"identity-admin migrate up\"", err)
+	}
+	return nil
+}
+
+// sameSiteMode maps SESSION_COOKIE_SAMESITE to a cookie attribute.
+func sameSiteMode(mode string) http.SameSite {
+	switch mode {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// newCachedRepository puts the configured user cache in front of repo. The
+// returned function releases the cache's connections.
+func newCachedRepository(cfg config.Config, repo repository.Repository) (*repository.CachedRepository, func(), error) {
+	opts := []repository.CacheOption{
+		repository.WithCacheTTL(cfg.UserCacheTTL),
+		repository.WithNegativeCacheTTL(cfg.UserCacheNegativeTTL),
+	}
+	if cfg.UserCache != "redis" {
+		return repository.NewCachedRepository(repo, repository.NewLRUUserCache(cfg.UserCacheSize), opts...), func() {}, nil
+	}
+
+	redisOpts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(redisOpts)
+	closeClient := func() {
+		if err := client.Close(); err != nil {
+			slog.Error("failed to close redis client", "error", err)
+		}
 	}
-	grpcServer.GracefulStop()
-	log.Println("identity service stopped gracefully")
+	cache := repository.NewRedisUserCache(client, repository.RedisUserCachePrefix)
+	return repository.NewCachedRepository(repo, cache, opts...), closeClient, nil
 }
@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// quietPaths are polled by probes and scrapers; they are logged at debug
+// while they succeed.
+var quietPaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// LogRequests logs every request once it is answered. It must come after
+// apierror.RequestID so lines carry the request ID.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		level := slog.LevelInfo
+		switch {
+		case quietPaths[r.URL.Path] && status < http.StatusBadRequest:
+			level = slog.LevelDebug
+		case quietPaths[r.URL.Path]:
+			// A failing readiness probe is a symptom; its checks say why.
+			level = slog.LevelWarn
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
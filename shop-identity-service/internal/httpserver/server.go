@@ -2,7 +2,7 @@ package httpserver
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -24,11 +24,11 @@ func New(addr string, handler http.Handler) *Server {
 }
 
 func (s *Server) Start() error {
-	log.Printf("HTTP server listening on %s\n", s.httpServer.Addr)
+	slog.Info("HTTP server listening", "addr", s.httpServer.Addr)
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	log.Println("Shutting down HTTP server...")
+	slog.Info("shutting down HTTP server")
 	return s.httpServer.Shutdown(ctx)
 }
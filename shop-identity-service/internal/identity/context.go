@@ -1,6 +1,10 @@
 package identity
 
-import "context"
+import (
+	"context"
+
+	"github.com/hawful70/platform-logging/pkg/logging"
+)
 
 type contextKey string
 
@@ -14,3 +18,14 @@ func ClaimsFromContext(ctx context.Context) (Claims, bool) {
 	claims, ok := ctx.Value(claimsContextKey).(Claims)
 	return claims, ok
 }
+
+// ContextWithRequestID tags ctx with the ID that error responses and logs
+// of the request carry. It is stored where the shared logging package and
+// identityclient look for it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return logging.ContextWithRequestID(ctx, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	return logging.RequestIDFromContext(ctx)
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var ErrEmailInvalid = errors.New("email address is invalid")
+
+// ParseEmail checks raw against RFC 5322 addr-spec syntax and returns it
+// trimmed and lower-cased. Display names ("Bob <bob@example.com>") and
+// domains without a dot are rejected.
+func ParseEmail(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmailRequired
+	}
+
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Name != "" || addr.Address != raw {
+		return "", ErrEmailInvalid
+	}
+
+	at := strings.LastIndexByte(addr.Address, '@')
+	domain := addr.Address[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", ErrEmailInvalid
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
+
+// EmailDomain returns the part after the last '@'.
+func EmailDomain(email string) string {
+	return email[strings.LastIndexByte(email, '@')+1:]
+}
+
+// CanonicalEmail folds provider aliases of a parsed address into one form.
+// Gmail ignores dots and treats googlemail.com as gmail.com. "+tag"
+// suffixes are dropped only on plusTagDomains: elsewhere "a+b" may be a
+// mailbox of its own.
+func CanonicalEmail(email string, plusTagDomains map[string]struct{}) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if _, ok := plusTagDomains[domain]; ok {
+		if i := strings.IndexByte(local, '+'); i > 0 {
+			local = local[:i]
+		}
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	return local + "@" + domain
+}
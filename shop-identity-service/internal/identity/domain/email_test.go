@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseEmail(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{"alice@example.com", "alice@example.com", nil},
+		{"  Alice@Example.COM ", "alice@example.com", nil},
+		{"first.last+tag@sub.example.co.uk", "first.last+tag@sub.example.co.uk", nil},
+		{"o'brien@example.ie", "o'brien@example.ie", nil},
+		{`"quoted"@example.com`, "", ErrEmailInvalid},
+
+		{"", "", ErrEmailRequired},
+		{"   ", "", ErrEmailRequired},
+		{"alice", "", ErrEmailInvalid},
+		{"alice@", "", ErrEmailInvalid},
+		{"@example.com", "", ErrEmailInvalid},
+		{"alice@localhost", "", ErrEmailInvalid},
+		{"alice@.example.com", "", ErrEmailInvalid},
+		{"alice@example.com.", "", ErrEmailInvalid},
+		{"alice@@example.com", "", ErrEmailInvalid},
+		{"al ice@example.com", "", ErrEmailInvalid},
+		{"Alice <alice@example.com>", "", ErrEmailInvalid},
+		{"<alice@example.com>", "", ErrEmailInvalid},
+		{"alice@example.com, bob@example.com", "", ErrEmailInvalid},
+	}
+	for _, tc := range tests {
+		got, err := ParseEmail(tc.raw)
+		if !errors.Is(err, tc.wantErr) || got != tc.want {
+			t.Errorf("ParseEmail(%q) = %q, %v; want %q, %v", tc.raw, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	plusTags := map[string]struct{}{"gmail.com": {}, "outlook.com": {}}
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"alice@example.com", "alice@example.com"},
+
+		// Gmail ignores dots and plus-tags, and googlemail.com is gmail.com.
+		{"jane.doe@gmail.com", "janedoe@gmail.com"},
+		{"jane.doe+promo@gmail.com", "janedoe@gmail.com"},
+		{"janedoe@googlemail.com", "janedoe@gmail.com"},
+		{"j.a.n.e.d.o.e+a+b@googlemail.com", "janedoe@gmail.com"},
+
+		// Plus-tags fold on listed providers only, and dots stay.
+		{"jane.doe+news@outlook.com", "jane.doe@outlook.com"},
+		{"jane.doe+news@example.com", "jane.doe+news@example.com"},
+		{"sales+eu@corp.example", "sales+eu@corp.example"},
+		{"jane+x@sub.gmail.com", "jane+x@sub.gmail.com"},
+
+		// A leading "+" is the whole local part, not a tag.
+		{"+tag@gmail.com", "+tag@gmail.com"},
+		{"not-an-address", "not-an-address"},
+	}
+	for _, tc := range tests {
+		if got := CanonicalEmail(tc.email, plusTags); got != tc.want {
+			t.Errorf("CanonicalEmail(%q) = %q, want %q", tc.email, got, tc.want)
+		}
+	}
+
+	if got := CanonicalEmail("jane.doe+x@gmail.com", nil); got != "janedoe+x@gmail.com" {
+		t.Errorf("CanonicalEmail without plus-tag domains = %q, want the tag kept", got)
+	}
+}
@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request made with an
+// Idempotency-Key so retries can be answered with the original response.
+// StatusCode is zero while the first request is still in flight.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+func (r IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+type IdempotencyModel struct {
+	Key         string `gorm:"column:idempotency_key;primaryKey;type:text"`
+	Fingerprint string `gorm:"type:text;not null"`
+	StatusCode  int    `gorm:"not null;default:0"`
+	ContentType string `gorm:"type:text;not null;default:''"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+func (IdempotencyModel) TableName() string {
+	return "idempotency_keys"
+}
+
+func ToIdempotencyModel(r IdempotencyRecord) IdempotencyModel {
+	return IdempotencyModel{
+		Key:         r.Key,
+		Fingerprint: r.Fingerprint,
+		StatusCode:  r.StatusCode,
+		ContentType: r.ContentType,
+		Body:        r.Body,
+		CreatedAt:   r.CreatedAt,
+	}
+}
+
+func (m IdempotencyModel) ToDomain() IdempotencyRecord {
+	return IdempotencyRecord{
+		Key:         m.Key,
+		Fingerprint: m.Fingerprint,
+		StatusCode:  m.StatusCode,
+		ContentType: m.ContentType,
+		Body:        m.Body,
+		CreatedAt:   m.CreatedAt,
+	}
+}
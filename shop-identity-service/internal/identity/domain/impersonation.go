@@ -0,0 +1,101 @@
+package domain
+
+import "time"
+
+// ImpersonationSession is a support agent (Actor) acting as another user
+// (Target) for a limited time.
+type ImpersonationSession struct {
+	ID        string
+	ActorID   UserID
+	TargetID  UserID
+	Reason    string
+	StartedAt time.Time
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+func (s ImpersonationSession) Active(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type ImpersonationEventType string
+
+const (
+	ImpersonationStarted ImpersonationEventType = "start"
+	ImpersonationUsed    ImpersonationEventType = "use"
+	ImpersonationEnded   ImpersonationEventType = "end"
+)
+
+// ImpersonationEvent is one entry of the impersonation audit trail.
+type ImpersonationEvent struct {
+	SessionID string
+	ActorID   UserID
+	TargetID  UserID
+	Type      ImpersonationEventType
+	// Action describes what was done, e.g. "GET /api/v1/auth/me".
+	Action    string
+	CreatedAt time.Time
+}
+
+type ImpersonationSessionModel struct {
+	ID        string `gorm:"primaryKey;type:text"`
+	ActorID   string `gorm:"index;type:text;not null"`
+	TargetID  string `gorm:"index;type:text;not null"`
+	Reason    string `gorm:"type:text;not null"`
+	StartedAt time.Time
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+func (ImpersonationSessionModel) TableName() string {
+	return "impersonation_sessions"
+}
+
+func ToImpersonationSessionModel(s ImpersonationSession) ImpersonationSessionModel {
+	return ImpersonationSessionModel{
+		ID:        s.ID,
+		ActorID:   string(s.ActorID),
+		TargetID:  string(s.TargetID),
+		Reason:    s.Reason,
+		StartedAt: s.StartedAt,
+		ExpiresAt: s.ExpiresAt,
+		EndedAt:   s.EndedAt,
+	}
+}
+
+func (m ImpersonationSessionModel) ToDomain() ImpersonationSession {
+	return ImpersonationSession{
+		ID:        m.ID,
+		ActorID:   UserID(m.ActorID),
+		TargetID:  UserID(m.TargetID),
+		Reason:    m.Reason,
+		StartedAt: m.StartedAt,
+		ExpiresAt: m.ExpiresAt,
+		EndedAt:   m.EndedAt,
+	}
+}
+
+type ImpersonationEventModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID string `gorm:"index;type:text;not null"`
+	ActorID   string `gorm:"type:text;not null"`
+	TargetID  string `gorm:"type:text;not null"`
+	Type      string `gorm:"type:text;not null"`
+	Action    string `gorm:"type:text;not null;default:''"`
+	CreatedAt time.Time
+}
+
+func (ImpersonationEventModel) TableName() string {
+	return "impersonation_events"
+}
+
+func ToImpersonationEventModel(e ImpersonationEvent) ImpersonationEventModel {
+	return ImpersonationEventModel{
+		SessionID: e.SessionID,
+		ActorID:   string(e.ActorID),
+		TargetID:  string(e.TargetID),
+		Type:      string(e.Type),
+		Action:    e.Action,
+		CreatedAt: e.CreatedAt,
+	}
+}
@@ -0,0 +1,166 @@
+package domain
+
+import "time"
+
+type OrganizationID string
+
+// OrgRole is a member's role inside an organization, independent of the
+// user's platform Role.
+type OrgRole string
+
+const (
+	OrgRoleOwner    OrgRole = "owner"
+	OrgRoleBuyer    OrgRole = "buyer"
+	OrgRoleApprover OrgRole = "approver"
+)
+
+func (r OrgRole) Valid() bool {
+	switch r {
+	case OrgRoleOwner, OrgRoleBuyer, OrgRoleApprover:
+		return true
+	}
+	return false
+}
+
+// Organization is a corporate customer account shared by its members.
+type Organization struct {
+	ID        OrganizationID
+	TenantID  TenantID
+	Name      string
+	CreatedBy UserID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Membership struct {
+	OrganizationID OrganizationID
+	UserID         UserID
+	Role           OrgRole
+	CreatedAt      time.Time
+}
+
+// Invitation asks an email address to join an organization. Only a hash of
+// the invitation token is stored.
+type Invitation struct {
+	ID             string
+	OrganizationID OrganizationID
+	Email          string
+	Role           OrgRole
+	TokenHash      string
+	InvitedBy      UserID
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	CreatedAt      time.Time
+}
+
+func (i Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
+
+type OrganizationModel struct {
+	ID        string `gorm:"primaryKey;type:text"`
+	TenantID  string `gorm:"index;type:text;not null"`
+	Name      string `gorm:"type:text;not null"`
+	CreatedBy string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (OrganizationModel) TableName() string {
+	return "organizations"
+}
+
+func ToOrganizationModel(o Organization) OrganizationModel {
+	return OrganizationModel{
+		ID:        string(o.ID),
+		TenantID:  string(o.TenantID),
+		Name:      o.Name,
+		CreatedBy: string(o.CreatedBy),
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+func (m OrganizationModel) ToDomain() Organization {
+	return Organization{
+		ID:        OrganizationID(m.ID),
+		TenantID:  TenantID(m.TenantID),
+		Name:      m.Name,
+		CreatedBy: UserID(m.CreatedBy),
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+type MembershipModel struct {
+	OrganizationID string `gorm:"primaryKey;type:text"`
+	UserID         string `gorm:"primaryKey;type:text;index"`
+	Role           string `gorm:"type:text;not null"`
+	CreatedAt      time.Time
+}
+
+func (MembershipModel) TableName() string {
+	return "organization_memberships"
+}
+
+func ToMembershipModel(m Membership) MembershipModel {
+	return MembershipModel{
+		OrganizationID: string(m.OrganizationID),
+		UserID:         string(m.UserID),
+		Role:           string(m.Role),
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+func (m MembershipModel) ToDomain() Membership {
+	return Membership{
+		OrganizationID: OrganizationID(m.OrganizationID),
+		UserID:         UserID(m.UserID),
+		Role:           OrgRole(m.Role),
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+type InvitationModel struct {
+	ID             string `gorm:"primaryKey;type:text"`
+	OrganizationID string `gorm:"index;type:text;not null"`
+	Email          string `gorm:"type:text;not null"`
+	Role           string `gorm:"type:text;not null"`
+	TokenHash      string `gorm:"uniqueIndex;type:text;not null"`
+	InvitedBy      string `gorm:"type:text;not null"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	CreatedAt      time.Time
+}
+
+func (InvitationModel) TableName() string {
+	return "organization_invitations"
+}
+
+func ToInvitationModel(i Invitation) InvitationModel {
+	return InvitationModel{
+		ID:             i.ID,
+		OrganizationID: string(i.OrganizationID),
+		Email:          i.Email,
+		Role:           string(i.Role),
+		TokenHash:      i.TokenHash,
+		InvitedBy:      string(i.InvitedBy),
+		ExpiresAt:      i.ExpiresAt,
+		AcceptedAt:     i.AcceptedAt,
+		CreatedAt:      i.CreatedAt,
+	}
+}
+
+func (m InvitationModel) ToDomain() Invitation {
+	return Invitation{
+		ID:             m.ID,
+		OrganizationID: OrganizationID(m.OrganizationID),
+		Email:          m.Email,
+		Role:           OrgRole(m.Role),
+		TokenHash:      m.TokenHash,
+		InvitedBy:      UserID(m.InvitedBy),
+		ExpiresAt:      m.ExpiresAt,
+		AcceptedAt:     m.AcceptedAt,
+		CreatedAt:      m.CreatedAt,
+	}
+}
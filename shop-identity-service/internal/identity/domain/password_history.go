@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// PasswordHistoryModel keeps a previous password hash so it cannot be reused.
+type PasswordHistoryModel struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       string `gorm:"index;type:text;not null"`
+	PasswordHash string `gorm:"type:text;not null"`
+	CreatedAt    time.Time
+}
+
+func (PasswordHistoryModel) TableName() string {
+	return "password_history"
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// PasswordPolicy controls reuse and expiry of passwords for a role.
+type PasswordPolicy struct {
+	// HistorySize is how many previous passwords are remembered and rejected
+	// on change, in addition to the current one.
+	HistorySize int `json:"history_size"`
+	// MaxAge forces a password change once exceeded. Zero disables expiry.
+	MaxAge time.Duration `json:"max_age"`
+}
+
+func (p PasswordPolicy) Expired(changedAt, now time.Time) bool {
+	if p.MaxAge <= 0 {
+		return false
+	}
+	return now.Sub(changedAt) > p.MaxAge
+}
+
+// PasswordPolicies maps a role to its policy. Roles without an entry get the
+// zero policy: no history and no expiry.
+type PasswordPolicies map[Role]PasswordPolicy
+
+func (p PasswordPolicies) For(role Role) PasswordPolicy {
+	return p[role]
+}
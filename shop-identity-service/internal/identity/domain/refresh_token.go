@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// RevokedRefreshTokenModel records a refresh token that was rotated or
+// signed out, by its jti, until the token would have expired anyway.
+type RevokedRefreshTokenModel struct {
+	ID        string    `gorm:"primaryKey;type:text"`
+	UserID    UserID    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (RevokedRefreshTokenModel) TableName() string {
+	return "revoked_refresh_tokens"
+}
@@ -0,0 +1,61 @@
+package domain
+
+import "time"
+
+// SCIMToken authenticates a tenant's directory against the SCIM API. Only a
+// hash of the bearer token is stored.
+type SCIMToken struct {
+	ID         string
+	TenantID   TenantID
+	Name       string
+	TokenHash  string
+	CreatedBy  UserID
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (t SCIMToken) Active() bool {
+	return t.RevokedAt == nil
+}
+
+type SCIMTokenModel struct {
+	ID         string `gorm:"primaryKey;type:text"`
+	TenantID   string `gorm:"index;type:text;not null"`
+	Name       string `gorm:"type:text;not null"`
+	TokenHash  string `gorm:"uniqueIndex;type:text;not null"`
+	CreatedBy  string `gorm:"type:text;not null"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (SCIMTokenModel) TableName() string {
+	return "scim_tokens"
+}
+
+func ToSCIMTokenModel(t SCIMToken) SCIMTokenModel {
+	return SCIMTokenModel{
+		ID:         t.ID,
+		TenantID:   string(t.TenantID),
+		Name:       t.Name,
+		TokenHash:  t.TokenHash,
+		CreatedBy:  string(t.CreatedBy),
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+func (m SCIMTokenModel) ToDomain() SCIMToken {
+	return SCIMToken{
+		ID:         m.ID,
+		TenantID:   TenantID(m.TenantID),
+		Name:       m.Name,
+		TokenHash:  m.TokenHash,
+		CreatedBy:  UserID(m.CreatedBy),
+		CreatedAt:  m.CreatedAt,
+		LastUsedAt: m.LastUsedAt,
+		RevokedAt:  m.RevokedAt,
+	}
+}
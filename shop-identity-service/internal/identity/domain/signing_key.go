@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+// SigningKey is an HMAC secret for access tokens, named in the token's kid
+// header. A key signs new tokens from ActivatesAt until it is retired, and
+// keeps verifying tokens for a while after that. Secret is stored encrypted;
+// see identity.SigningKeyRing.
+type SigningKey struct {
+	ID          string
+	Secret      string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
+}
+
+// Signs reports whether the key may sign tokens at now.
+func (k SigningKey) Signs(now time.Time) bool {
+	return !now.Before(k.ActivatesAt) && (k.RetiredAt == nil || now.Before(*k.RetiredAt))
+}
+
+type SigningKeyModel struct {
+	ID          string    `gorm:"primaryKey;type:text"`
+	Secret      string    `gorm:"type:text;not null"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ActivatesAt time.Time `gorm:"not null"`
+	RetiredAt   *time.Time
+}
+
+func (SigningKeyModel) TableName() string {
+	return "signing_keys"
+}
+
+func ToSigningKeyModel(k SigningKey) SigningKeyModel {
+	return SigningKeyModel{
+		ID:          k.ID,
+		Secret:      k.Secret,
+		CreatedAt:   k.CreatedAt,
+		ActivatesAt: k.ActivatesAt,
+		RetiredAt:   k.RetiredAt,
+	}
+}
+
+func (m SigningKeyModel) ToDomain() SigningKey {
+	return SigningKey{
+		ID:          m.ID,
+		Secret:      m.Secret,
+		CreatedAt:   m.CreatedAt,
+		ActivatesAt: m.ActivatesAt,
+		RetiredAt:   m.RetiredAt,
+	}
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+type TenantID string
+
+// DefaultTenantID owns every user created before multi-tenancy and serves
+// requests that do not name a tenant.
+const DefaultTenantID TenantID = "default"
+
+// Tenant is a storefront with its own users and token settings.
+type Tenant struct {
+	ID   TenantID
+	Name string
+	// Hosts are the storefront host names that resolve to this tenant.
+	Hosts []string
+	// JWTIssuer and JWTAudience are stamped on the tenant's tokens. An empty
+	// issuer falls back to the service-wide issuer.
+	JWTIssuer   string
+	JWTAudience string
+	Settings    TenantSettings
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TenantSettings override service-wide behaviour for one tenant.
+type TenantSettings struct {
+	// PasswordPolicies override the service-wide policy per role.
+	PasswordPolicies PasswordPolicies `json:"password_policies,omitempty"`
+	// EnabledProviders limits how users can sign in. Empty allows all.
+	EnabledProviders []AuthProvider `json:"enabled_providers,omitempty"`
+}
+
+func (t Tenant) ProviderEnabled(p AuthProvider) bool {
+	return len(t.Settings.EnabledProviders) == 0 || slices.Contains(t.Settings.EnabledProviders, p)
+}
+
+type TenantModel struct {
+	ID          string         `gorm:"primaryKey;type:text"`
+	Name        string         `gorm:"type:text;not null"`
+	Hosts       []string       `gorm:"serializer:json;type:text"`
+	JWTIssuer   string         `gorm:"column:jwt_issuer;type:text;not null;default:''"`
+	JWTAudience string         `gorm:"column:jwt_audience;type:text;not null;default:''"`
+	Settings    TenantSettings `gorm:"serializer:json;type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (TenantModel) TableName() string {
+	return "tenants"
+}
+
+func ToTenantModel(t Tenant) TenantModel {
+	return TenantModel{
+		ID:          string(t.ID),
+		Name:        t.Name,
+		Hosts:       t.Hosts,
+		JWTIssuer:   t.JWTIssuer,
+		JWTAudience: t.JWTAudience,
+		Settings:    t.Settings,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+}
+
+func (m TenantModel) ToDomain() Tenant {
+	return Tenant{
+		ID:          TenantID(m.ID),
+		Name:        m.Name,
+		Hosts:       m.Hosts,
+		JWTIssuer:   m.JWTIssuer,
+		JWTAudience: m.JWTAudience,
+		Settings:    m.Settings,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
@@ -17,15 +17,48 @@ const (
 	ProviderGoogle   AuthProvider = "google"
 )
 
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleSeller   Role = "seller"
+	RoleAdmin    Role = "admin"
+)
+
 type User struct {
-	ID         UserID
-	Email      string
-	Username   string
-	Password   string
-	Provider   AuthProvider
-	ProviderID string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ID       UserID
+	TenantID TenantID
+	Email    string
+	// EmailCanonical folds aliases of the same inbox and must be unique.
+	EmailCanonical string
+	Username       string
+	// UsernameCanonical is the case-folded form used for login lookups and
+	// UsernameSkeleton the confusable-free form that must be unique.
+	UsernameCanonical string
+	UsernameSkeleton  string
+	Password          string
+	Provider          AuthProvider
+	ProviderID        string
+	Role              Role
+	// PasswordChangedAt drives password expiry for roles with a rotation policy.
+	PasswordChangedAt time.Time
+	// ExternalID is the user's identifier in a customer directory (SCIM).
+	ExternalID string
+	// SCIMUserName is the userName a directory provisioned the user with,
+	// kept as sent so that the directory finds it again. Directories often
+	// send an email address, from which Username is derived.
+	SCIMUserName string
+	// SuspendedAt is set while the user is deprovisioned and cannot sign in.
+	SuspendedAt *time.Time
+	// SessionVersion is embedded in tokens; bumping it revokes every token
+	// issued before.
+	SessionVersion int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (u User) Suspended() bool {
+	return u.SuspendedAt != nil
 }
 
 var (
@@ -34,36 +67,64 @@ var (
 	ErrPasswordShort = errors.New("password too short")
 )
 
+// NewUser builds a local user in the default tenant; callers set TenantID
+// for other storefronts.
 func NewUser(email, username, hashedPassword string) (User, error) {
-	if email == "" {
-		return User{}, ErrEmailRequired
+	email, err := ParseEmail(email)
+	if err != nil {
+		return User{}, err
 	}
 	if len(hashedPassword) == 0 {
 		return User{}, ErrInvalidUser
 	}
+	name, err := ParseUsername(username)
+	if err != nil {
+		return User{}, err
+	}
 
 	now := time.Now().UTC()
 	return User{
-		ID:         UserID(uuid.NewString()),
-		Email:      email,
-		Username:   username,
-		Password:   hashedPassword,
-		Provider:   ProviderLocal,
-		ProviderID: email,
-		CreatedAt:  now,
-		UpdatedAt:  now,
+		ID:                UserID(uuid.NewString()),
+		TenantID:          DefaultTenantID,
+		Email:             email,
+		EmailCanonical:    email,
+		Username:          name.Display,
+		UsernameCanonical: name.Canonical,
+		UsernameSkeleton:  name.Skeleton,
+		Password:          hashedPassword,
+		Provider:          ProviderLocal,
+		ProviderID:        email,
+		Role:              RoleCustomer,
+		PasswordChangedAt: now,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}, nil
 }
 
+// UserModel keeps email and username unique per tenant, not globally.
 type UserModel struct {
-	ID         string `gorm:"primaryKey;type:text"`
-	Email      string `gorm:"uniqueIndex;type:text"`
-	Username   string `gorm:"type:text"`
-	Password   string `gorm:"type:text"`
-	Provider   string `gorm:"type:text"`
-	ProviderID string `gorm:"type:text"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ID       string `gorm:"primaryKey;type:text"`
+	TenantID string `gorm:"type:text;not null;default:default;uniqueIndex:idx_users_tenant_email,priority:1;uniqueIndex:idx_users_tenant_email_canonical,priority:1;uniqueIndex:idx_users_tenant_username_skeleton,priority:1;uniqueIndex:idx_users_tenant_username_canonical,priority:1;index:idx_users_tenant_external_id,priority:1;index:idx_users_tenant_updated_at,priority:1"`
+	Email    string `gorm:"type:text;uniqueIndex:idx_users_tenant_email,priority:2"`
+	// Legacy rows keep an empty canonical email and are excluded from the unique index.
+	EmailCanonical string `gorm:"type:text;not null;default:'';uniqueIndex:idx_users_tenant_email_canonical,priority:2,where:email_canonical <> ''"`
+	Username       string `gorm:"type:text"`
+	// Legacy rows keep an empty canonical username and skeleton and are
+	// excluded from the unique indexes.
+	UsernameCanonical string `gorm:"type:text;not null;default:'';uniqueIndex:idx_users_tenant_username_canonical,priority:2,where:username_canonical <> ''"`
+	UsernameSkeleton  string `gorm:"type:text;not null;default:'';uniqueIndex:idx_users_tenant_username_skeleton,priority:2,where:username_skeleton <> ''"`
+	Password          string `gorm:"type:text"`
+	Provider          string `gorm:"type:text"`
+	ProviderID        string `gorm:"type:text"`
+	Role              string `gorm:"type:text;not null;default:customer"`
+	// Existing rows get the migration time, which starts their rotation clock.
+	PasswordChangedAt time.Time `gorm:"not null;default:now()"`
+	ExternalID        string    `gorm:"type:text;not null;default:'';index:idx_users_tenant_external_id,priority:2"`
+	SCIMUserName      string    `gorm:"column:scim_user_name;type:text;not null;default:''"`
+	SuspendedAt       *time.Time
+	SessionVersion    int `gorm:"not null;default:0"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time `gorm:"index:idx_users_tenant_updated_at,priority:2"`
 }
 
 func (UserModel) TableName() string {
@@ -72,26 +133,46 @@ func (UserModel) TableName() string {
 
 func ToUserModel(u User) UserModel {
 	return UserModel{
-		ID:         string(u.ID),
-		Email:      u.Email,
-		Username:   u.Username,
-		Password:   u.Password,
-		Provider:   string(u.Provider),
-		ProviderID: u.ProviderID,
-		CreatedAt:  u.CreatedAt,
-		UpdatedAt:  u.UpdatedAt,
+		ID:                string(u.ID),
+		TenantID:          string(u.TenantID),
+		Email:             u.Email,
+		EmailCanonical:    u.EmailCanonical,
+		Username:          u.Username,
+		UsernameCanonical: u.UsernameCanonical,
+		UsernameSkeleton:  u.UsernameSkeleton,
+		Password:          u.Password,
+		Provider:          string(u.Provider),
+		ProviderID:        u.ProviderID,
+		Role:              string(u.Role),
+		PasswordChangedAt: u.PasswordChangedAt,
+		ExternalID:        u.ExternalID,
+		SCIMUserName:      u.SCIMUserName,
+		SuspendedAt:       u.SuspendedAt,
+		SessionVersion:    u.SessionVersion,
+		CreatedAt:         u.CreatedAt,
+		UpdatedAt:         u.UpdatedAt,
 	}
 }
 
 func (m UserModel) ToDomain() User {
 	return User{
-		ID:         UserID(m.ID),
-		Email:      m.Email,
-		Username:   m.Username,
-		Password:   m.Password,
-		Provider:   AuthProvider(m.Provider),
-		ProviderID: m.ProviderID,
-		CreatedAt:  m.CreatedAt,
-		UpdatedAt:  m.UpdatedAt,
+		ID:                UserID(m.ID),
+		TenantID:          TenantID(m.TenantID),
+		Email:             m.Email,
+		EmailCanonical:    m.EmailCanonical,
+		Username:          m.Username,
+		UsernameCanonical: m.UsernameCanonical,
+		UsernameSkeleton:  m.UsernameSkeleton,
+		Password:          m.Password,
+		Provider:          AuthProvider(m.Provider),
+		ProviderID:        m.ProviderID,
+		Role:              Role(m.Role),
+		PasswordChangedAt: m.PasswordChangedAt,
+		ExternalID:        m.ExternalID,
+		SCIMUserName:      m.SCIMUserName,
+		SuspendedAt:       m.SuspendedAt,
+		SessionVersion:    m.SessionVersion,
+		CreatedAt:         m.CreatedAt,
+		UpdatedAt:         m.UpdatedAt,
 	}
 }
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 30
+)
+
+var (
+	ErrUsernameRequired = errors.New("username is required")
+	ErrUsernameLength   = errors.New("username must be between 3 and 30 characters")
+	ErrUsernameInvalid  = errors.New("username may only contain letters, digits, '.', '_' and '-', and must start and end with a letter or digit")
+	ErrUsernameReserved = errors.New("username is reserved")
+)
+
+// Username holds the forms of a username: Display is what the user typed
+// (NFKC normalized), Canonical is case folded and used for lookups, and
+// Skeleton collapses look-alike characters. Canonical and Skeleton must
+// both be unique in a tenant.
+type Username struct {
+	Display   string
+	Canonical string
+	Skeleton  string
+}
+
+var usernameFolder = cases.Fold()
+
+// reservedUsernames are compared by skeleton, so look-alikes such as
+// "supp0rt", "ѕupport" (Cyrillic ѕ) or "HeIp" (capital I) are rejected too.
+var reservedUsernames = []string{
+	"admin", "administrator", "root", "system", "sysadmin",
+	"support", "help", "helpdesk", "staff", "moderator", "mod",
+	"security", "abuse", "postmaster", "webmaster", "hostmaster",
+	"official", "shop", "store", "billing", "payments", "sales",
+	"api", "www", "mail", "email", "noreply", "no-reply",
+	"me", "login", "logout", "register", "signup", "account",
+	"null", "undefined", "anonymous", "guest",
+}
+
+var reservedSkeletons = func() map[string]struct{} {
+	m := make(map[string]struct{}, len(reservedUsernames))
+	for _, name := range reservedUsernames {
+		m[reservedKey(usernameSkeleton(name))] = struct{}{}
+	}
+	return m
+}()
+
+// ParseUsername normalizes raw and enforces the length, character and
+// reserved-name rules.
+func ParseUsername(raw string) (Username, error) {
+	display := norm.NFKC.String(strings.TrimSpace(raw))
+	if display == "" {
+		return Username{}, ErrUsernameRequired
+	}
+
+	n := utf8.RuneCountInString(display)
+	if n < UsernameMinLength || n > UsernameMaxLength {
+		return Username{}, ErrUsernameLength
+	}
+
+	canonical := CanonicalUsername(display)
+	if !validUsernameChars(canonical) {
+		return Username{}, ErrUsernameInvalid
+	}
+
+	skeleton := usernameSkeleton(display)
+	if _, ok := reservedSkeletons[reservedKey(skeleton)]; ok {
+		return Username{}, ErrUsernameReserved
+	}
+
+	return Username{Display: display, Canonical: canonical, Skeleton: skeleton}, nil
+}
+
+// CanonicalUsername returns the case-folded lookup key for a username
+// without validating it.
+func CanonicalUsername(raw string) string {
+	return usernameFolder.String(norm.NFKC.String(strings.TrimSpace(raw)))
+}
+
+func isUsernameSeparator(r rune) bool {
+	return r == '.' || r == '_' || r == '-'
+}
+
+func validUsernameChars(s string) bool {
+	var prev rune
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		case isUsernameSeparator(r):
+			if i == 0 || isUsernameSeparator(prev) {
+				return false
+			}
+		default:
+			return false
+		}
+		prev = r
+	}
+	return !isUsernameSeparator(prev)
+}
+
+// reservedKey loosens a skeleton for the reserved-name check: separators
+// are dropped and "i" is read as "l", since a capital I can stand for either
+// ("IogIn", "ADMIN").
+func reservedKey(skeleton string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case isUsernameSeparator(r):
+			return -1
+		case r == 'i':
+			return 'l'
+		}
+		return r
+	}, skeleton)
+}
+
+// usernameSkeleton is a reduced form of the Unicode TR39 skeleton: accents
+// are dropped and common Cyrillic, Greek and digit look-alikes are mapped to
+// their Latin counterparts. It starts from the display form, because case
+// folding turns "I", which reads as "l", into "i".
+func usernameSkeleton(display string) string {
+	upper := strings.Map(func(r rune) rune {
+		if c, ok := upperConfusables[r]; ok {
+			return c
+		}
+		return r
+	}, display)
+	skeleton := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+		return r
+	}, norm.NFD.String(usernameFolder.String(upper)))
+	return multiConfusables.Replace(skeleton)
+}
+
+var multiConfusables = strings.NewReplacer("rn", "m", "vv", "w")
+
+// upperConfusables are capitals that read as another lower case letter and
+// are mapped before case folding.
+var upperConfusables = map[rune]rune{
+	'I': 'l', 'І': 'l', 'Ι': 'l', 'Ӏ': 'l',
+}
+
+var confusables = map[rune]rune{
+	// digits
+	'0': 'o', '1': 'l',
+	// Latin
+	'ı': 'i', 'ȷ': 'j', 'ɡ': 'g',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'і': 'i', 'ј': 'j', 'ԁ': 'd', 'ӏ': 'l', 'һ': 'h', 'ԛ': 'q',
+	'ԝ': 'w', 'ь': 'b',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+}
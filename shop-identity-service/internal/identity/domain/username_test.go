@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseUsername(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Username
+		wantErr error
+	}{
+		{"plain", "alice", Username{"alice", "alice", "alice"}, nil},
+		{"trimmed", "  alice  ", Username{"alice", "alice", "alice"}, nil},
+		{"case folded", "Alice.Smith", Username{"Alice.Smith", "alice.smith", "alice.smith"}, nil},
+		{"digits", "bob2000", Username{"bob2000", "bob2000", "bob2ooo"}, nil},
+		{"unicode letters", "José", Username{"José", "josé", "jose"}, nil},
+
+		// NFKC folds compatibility forms before anything else.
+		{"fullwidth", "ａｌｉｃｅ", Username{"alice", "alice", "alice"}, nil},
+		{"ligature", "ﬁona", Username{"fiona", "fiona", "fiona"}, nil},
+		{"circled letters", "ⓐⓑⓒ", Username{"abc", "abc", "abc"}, nil},
+		{"superscript digit", "carl²", Username{"carl2", "carl2", "carl2"}, nil},
+
+		// Multi-character look-alikes share a skeleton.
+		{"rn reads as m", "kirn", Username{"kirn", "kirn", "kim"}, nil},
+		{"vv reads as w", "vvalter", Username{"vvalter", "vvalter", "walter"}, nil},
+		{"0 and 1", "h0l1y", Username{"h0l1y", "h0l1y", "holly"}, nil},
+		{"cyrillic", "аlice", Username{"аlice", "аlice", "alice"}, nil},
+		// The skeleton is taken before case folding: capital I reads as l.
+		{"capital I", "aIice", Username{"aIice", "aiice", "alice"}, nil},
+		{"capital I is not i", "Isabel", Username{"Isabel", "isabel", "lsabel"}, nil},
+		{"cyrillic capital I", "Іvan", Username{"Іvan", "іvan", "lvan"}, nil},
+
+		// Separators join letters and digits: never first, last or doubled.
+		{"separators", "a.b_c-d", Username{"a.b_c-d", "a.b_c-d", "a.b_c-d"}, nil},
+		{"leading separator", ".alice", Username{}, ErrUsernameInvalid},
+		{"trailing separator", "alice_", Username{}, ErrUsernameInvalid},
+		{"doubled separator", "al..ice", Username{}, ErrUsernameInvalid},
+		{"mixed doubled separator", "al-_ice", Username{}, ErrUsernameInvalid},
+		{"space", "al ice", Username{}, ErrUsernameInvalid},
+		{"other punctuation", "al+ice", Username{}, ErrUsernameInvalid},
+		{"emoji", "ali🙂", Username{}, ErrUsernameInvalid},
+
+		{"empty", "", Username{}, ErrUsernameRequired},
+		{"blank", "   ", Username{}, ErrUsernameRequired},
+		{"too short", "ab", Username{}, ErrUsernameLength},
+		{"too long", "abcdefghijklmnopqrstuvwxyz12345", Username{}, ErrUsernameLength},
+		{"length counts runes", "ééé", Username{"ééé", "ééé", "eee"}, nil},
+
+		// Reserved names are matched by skeleton, without separators.
+		{"reserved", "admin", Username{}, ErrUsernameReserved},
+		{"reserved upper case", "ADMIN", Username{}, ErrUsernameReserved},
+		{"reserved with separators", "no.reply", Username{}, ErrUsernameReserved},
+		{"reserved digit homoglyph", "supp0rt", Username{}, ErrUsernameReserved},
+		{"reserved cyrillic homoglyph", "ѕupport", Username{}, ErrUsernameReserved},
+		{"reserved greek homoglyph", "rοοt", Username{}, ErrUsernameReserved},
+		{"reserved rn homoglyph", "adrnin", Username{}, ErrUsernameReserved},
+		{"reserved capital I homoglyph", "HeIp", Username{}, ErrUsernameReserved},
+		{"reserved capital I homoglyphs", "IogIn", Username{}, ErrUsernameReserved},
+		{"reserved digit one", "he1p", Username{}, ErrUsernameReserved},
+		{"reserved accented", "ådmin", Username{}, ErrUsernameReserved},
+		{"reserved fullwidth", "ｒｏｏｔ", Username{}, ErrUsernameReserved},
+		{"reserved prefix is allowed", "adminton", Username{"adminton", "adminton", "adminton"}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseUsername(tc.raw)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ParseUsername(%q) error = %v, want %v", tc.raw, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Fatalf("ParseUsername(%q) = %+v, want %+v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUsernameSkeletonsCollide(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"modern", "rnodern"},
+		{"wendy", "vvendy"},
+		{"paypal", "раураl"},
+		{"olly", "0lly"},
+		{"lily", "1i1y"},
+		{"Zoe", "zoë"},
+		{"alice", "aIice"},
+		{"bill", "biII"},
+	}
+	for _, tc := range tests {
+		a, errA := ParseUsername(tc.a)
+		b, errB := ParseUsername(tc.b)
+		if errA != nil || errB != nil {
+			t.Fatalf("ParseUsername(%q, %q): %v, %v", tc.a, tc.b, errA, errB)
+		}
+		if a.Skeleton != b.Skeleton {
+			t.Errorf("skeletons of %q and %q differ: %q, %q", tc.a, tc.b, a.Skeleton, b.Skeleton)
+		}
+	}
+}
+
+func TestCanonicalUsername(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"Alice", "alice"},
+		{" ALICE ", "alice"},
+		{"ａｌｉｃｅ", "alice"},
+		{"Straße", "strasse"},
+		// Not validated: lookups of invalid names simply find nothing.
+		{"al ice!", "al ice!"},
+	}
+	for _, tc := range tests {
+		if got := CanonicalUsername(tc.raw); got != tc.want {
+			t.Errorf("CanonicalUsername(%q) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
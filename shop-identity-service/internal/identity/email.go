@@ -0,0 +1,77 @@
+package identity
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// EmailPolicy controls how registration treats email addresses.
+type EmailPolicy struct {
+	// Canonicalize stores plus-tag and Gmail dot aliases under one canonical
+	// address so the same inbox cannot register twice.
+	Canonicalize bool
+	// PlusTagDomains are the providers whose "+tag" suffixes are folded.
+	PlusTagDomains map[string]struct{}
+	// BlockedDomains rejects addresses on these domains and their subdomains.
+	BlockedDomains map[string]struct{}
+}
+
+// Canonical returns the form of email that must be unique within a tenant.
+func (p EmailPolicy) Canonical(email string) string {
+	if !p.Canonicalize {
+		return email
+	}
+	return domain.CanonicalEmail(email, p.PlusTagDomains)
+}
+
+// DomainSet lower-cases and trims domains into a set.
+func DomainSet(domains []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (p EmailPolicy) blocked(email string) bool {
+	host := domain.EmailDomain(email)
+	for {
+		if _, ok := p.BlockedDomains[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+// LoadDomainBlocklist reads one domain per line. Blank lines and lines
+// starting with '#' are ignored.
+func LoadDomainBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
@@ -0,0 +1,156 @@
+package identity
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// Kind is the class of an error. Transports map it to an HTTP status and a
+// gRPC code; clients branch on the more specific Code.
+type Kind string
+
+const (
+	KindInvalidArgument    Kind = "invalid_argument"
+	KindFailedPrecondition Kind = "failed_precondition"
+	KindUnauthenticated    Kind = "unauthenticated"
+	KindPermissionDenied   Kind = "permission_denied"
+	KindNotFound           Kind = "not_found"
+	KindAlreadyExists      Kind = "already_exists"
+	KindConflict           Kind = "conflict"
+	KindUnimplemented      Kind = "unimplemented"
+	KindCanceled           Kind = "canceled"
+	KindDeadlineExceeded   Kind = "deadline_exceeded"
+	KindInternal           Kind = "internal"
+)
+
+// Code names an error for clients. Codes are part of the API: add new ones
+// rather than changing what an existing one means.
+type Code string
+
+// FieldError points an invalid argument at the request field it came from.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error as clients see it. Message is safe to show; the wrapped
+// cause is not sent.
+type Error struct {
+	Kind    Kind
+	Code    Code
+	Message string
+	Fields  []FieldError
+	cause   error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// NewError returns an error for a failure that has no sentinel, such as a
+// malformed request.
+func NewError(kind Kind, code Code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Fields: fields}
+}
+
+// InvalidField reports a bad or missing request field.
+func InvalidField(field, message string) *Error {
+	return NewError(KindInvalidArgument, "invalid_field", message, FieldError{Field: field, Message: message})
+}
+
+var (
+	// ErrAuthenticationRequired is returned when a request carries no usable
+	// credentials.
+	ErrAuthenticationRequired = errors.New("missing or invalid authorization header")
+	errInternal               = errors.New("internal error")
+)
+
+type catalogEntry struct {
+	err   error
+	kind  Kind
+	code  Code
+	field string
+}
+
+// catalog gives every error the service returns its kind and code, and the
+// request field it is about if any. Entries are matched with errors.Is in
+// order, so wrapped errors are recognized.
+var catalog = []catalogEntry{
+	{ErrEmailRequired, KindInvalidArgument, "email_required", "email"},
+	{ErrEmailInvalid, KindInvalidArgument, "email_invalid", "email"},
+	{ErrEmailBlocked, KindInvalidArgument, "email_blocked", "email"},
+	{ErrUsernameRequired, KindInvalidArgument, "username_required", "username"},
+	{ErrUsernameLength, KindInvalidArgument, "username_length", "username"},
+	{ErrUsernameInvalid, KindInvalidArgument, "username_invalid", "username"},
+	{ErrUsernameReserved, KindInvalidArgument, "username_reserved", "username"},
+	{ErrPasswordTooWeak, KindInvalidArgument, "password_too_weak", "password"},
+	{ErrPasswordShort, KindInvalidArgument, "password_too_weak", "password"},
+	{ErrPasswordReused, KindInvalidArgument, "password_reused", "new_password"},
+	{ErrInvalidRole, KindInvalidArgument, "role_invalid", "role"},
+	{ErrRoleNotProvisionable, KindInvalidArgument, "role_not_provisionable", "role"},
+	{ErrReasonRequired, KindInvalidArgument, "reason_required", "reason"},
+	{ErrOrgNameRequired, KindInvalidArgument, "organization_name_required", "name"},
+	{ErrInvalidOrgRole, KindInvalidArgument, "organization_role_invalid", "role"},
+	{ErrSCIMTokenNameRequired, KindInvalidArgument, "scim_token_name_required", "name"},
+	{ErrInvitationInvalid, KindInvalidArgument, "invitation_invalid", "token"},
+	{ErrInvalidUser, KindInvalidArgument, "user_invalid", ""},
+
+	{ErrImpersonationNotActive, KindFailedPrecondition, "impersonation_not_active", ""},
+
+	{ErrAuthenticationRequired, KindUnauthenticated, "authentication_required", ""},
+	{ErrInvalidLogin, KindUnauthenticated, "invalid_credentials", ""},
+	{ErrInvalidToken, KindUnauthenticated, "invalid_token", ""},
+	{ErrSCIMTokenInvalid, KindUnauthenticated, "invalid_token", ""},
+
+	{ErrForbidden, KindPermissionDenied, "forbidden", ""},
+	{ErrUserSuspended, KindPermissionDenied, "user_suspended", ""},
+	{ErrPasswordChangeRequired, KindPermissionDenied, "password_change_required", ""},
+	{ErrImpersonationNotAllowed, KindPermissionDenied, "impersonation_not_allowed", ""},
+	{ErrInvitationEmail, KindPermissionDenied, "invitation_email_mismatch", ""},
+	{ErrProviderDisabled, KindPermissionDenied, "provider_disabled", ""},
+
+	{repository.ErrUserNotFound, KindNotFound, "user_not_found", ""},
+	{repository.ErrTenantNotFound, KindNotFound, "tenant_not_found", ""},
+	{repository.ErrOrganizationNotFound, KindNotFound, "organization_not_found", ""},
+	{repository.ErrMembershipNotFound, KindNotFound, "membership_not_found", ""},
+	{repository.ErrInvitationNotFound, KindNotFound, "invitation_not_found", ""},
+	{repository.ErrSCIMTokenNotFound, KindNotFound, "scim_token_not_found", ""},
+	{repository.ErrImpersonationNotFound, KindNotFound, "impersonation_not_found", ""},
+
+	{ErrEmailTaken, KindAlreadyExists, "email_taken", "email"},
+	{ErrUsernameTaken, KindAlreadyExists, "username_taken", "username"},
+	{ErrAlreadyMember, KindAlreadyExists, "already_member", ""},
+
+	{ErrLastOwner, KindConflict, "last_owner", ""},
+	{repository.ErrPasswordChanged, KindConflict, "password_changed", ""},
+
+	{ErrImpersonationDisabled, KindUnimplemented, "impersonation_disabled", ""},
+
+	{context.Canceled, KindCanceled, "canceled", ""},
+	{context.DeadlineExceeded, KindDeadlineExceeded, "deadline_exceeded", ""},
+}
+
+// AsError describes err for clients. Errors outside the catalog become an
+// internal error that keeps err as its cause, for logging.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	for _, entry := range catalog {
+		if errors.Is(err, entry.err) {
+			e := &Error{Kind: entry.kind, Code: entry.code, Message: entry.err.Error(), cause: err}
+			if entry.field != "" {
+				e.Fields = []FieldError{{Field: entry.field, Message: e.Message}}
+			}
+			return e
+		}
+	}
+	return &Error{Kind: KindInternal, Code: "internal", Message: errInternal.Error(), cause: err}
+}
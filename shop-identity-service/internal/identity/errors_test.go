@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCatalogEntries(t *testing.T) {
+	seen := map[error]bool{}
+	for i, entry := range catalog {
+		if seen[entry.err] {
+			t.Errorf("%v is listed twice", entry.err)
+		}
+		seen[entry.err] = true
+
+		// An earlier entry that entry.err wraps would always win.
+		for _, earlier := range catalog[:i] {
+			if errors.Is(entry.err, earlier.err) {
+				t.Errorf("%v is shadowed by the earlier entry for %v", entry.err, earlier.err)
+			}
+		}
+		if entry.kind == KindInternal || entry.code == "" || entry.code == "internal" {
+			t.Errorf("%v: kind %s, code %q; catalog entries must not look internal", entry.err, entry.kind, entry.code)
+		}
+	}
+}
+
+func TestAsErrorCatalog(t *testing.T) {
+	for _, entry := range catalog {
+		for _, err := range []error{
+			entry.err,
+			fmt.Errorf("create user: %w", entry.err),
+			fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", entry.err)),
+			errors.Join(errors.New("cleanup failed"), entry.err),
+		} {
+			e := AsError(err)
+			if e.Kind != entry.kind || e.Code != entry.code {
+				t.Errorf("AsError(%q) = %s/%s, want %s/%s", err, e.Kind, e.Code, entry.kind, entry.code)
+			}
+			// Only the sentinel's text is shown, not the wrapping context.
+			if e.Message != entry.err.Error() {
+				t.Errorf("AsError(%q).Message = %q, want %q", err, e.Message, entry.err.Error())
+			}
+			if !errors.Is(e, entry.err) || errors.Unwrap(e) != err {
+				t.Errorf("AsError(%q) does not keep the error as its cause", err)
+			}
+			switch {
+			case entry.field == "" && len(e.Fields) != 0:
+				t.Errorf("AsError(%q).Fields = %+v, want none", err, e.Fields)
+			case entry.field != "" && (len(e.Fields) != 1 || e.Fields[0] != FieldError{Field: entry.field, Message: e.Message}):
+				t.Errorf("AsError(%q).Fields = %+v, want one for %s", err, e.Fields, entry.field)
+			}
+		}
+	}
+}
+
+func TestAsErrorSpecificCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind Kind
+		code Code
+	}{
+		{ErrPasswordShort, KindInvalidArgument, "password_too_weak"},
+		{ErrSCIMTokenInvalid, KindUnauthenticated, "invalid_token"},
+		{ErrLastOwner, KindConflict, "last_owner"},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), KindDeadlineExceeded, "deadline_exceeded"},
+		{fmt.Errorf("query: %w", context.Canceled), KindCanceled, "canceled"},
+	}
+	for _, tc := range tests {
+		if e := AsError(tc.err); e.Kind != tc.kind || e.Code != tc.code {
+			t.Errorf("AsError(%q) = %s/%s, want %s/%s", tc.err, e.Kind, e.Code, tc.kind, tc.code)
+		}
+	}
+}
+
+func TestAsErrorPassesErrorsThrough(t *testing.T) {
+	field := InvalidField("page_token", "page_token is malformed")
+	if got := AsError(fmt.Errorf("list users: %w", field)); got != field {
+		t.Fatalf("AsError of a wrapped *Error = %+v, want the same error", got)
+	}
+	made := NewError(KindNotFound, "widget_not_found", "widget not found")
+	if got := AsError(made); got != made || errors.Unwrap(got) != nil {
+		t.Fatalf("AsError(NewError) = %+v, want it unchanged and without a cause", got)
+	}
+}
+
+func TestAsErrorInternal(t *testing.T) {
+	cause := errors.New(`pq: password authentication failed for user "shop" at 10.0.0.5`)
+	for _, err := range []error{cause, fmt.Errorf("get user: %w", cause)} {
+		e := AsError(err)
+		if e.Kind != KindInternal || e.Code != "internal" || e.Message != "internal error" || len(e.Fields) != 0 {
+			t.Errorf("AsError(%v) = %+v, want a bare internal error", err, e)
+		}
+		if strings.Contains(e.Error(), "pq") {
+			t.Errorf("AsError(%v).Error() = %q exposes the cause", err, e.Error())
+		}
+		if errors.Unwrap(e) != err {
+			t.Errorf("AsError(%v) does not keep the cause for logging", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/hawful70/platform-events/pkg/events"
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/tracing"
+)
+
+// KafkaInvitationNotifier publishes organization invitations for
+// shop-email-service to deliver.
+type KafkaInvitationNotifier struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaInvitationNotifier(brokers []string, topic string) *KafkaInvitationNotifier {
+	return &KafkaInvitationNotifier{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			RequiredAcks: kafka.RequireAll,
+			Balancer:     &kafka.Hash{},
+		},
+	}
+}
+
+func (n *KafkaInvitationNotifier) Close() error {
+	if n == nil || n.writer == nil {
+		return nil
+	}
+	return n.writer.Close()
+}
+
+func (n *KafkaInvitationNotifier) InvitationCreated(ctx context.Context, inv identity.Invitation, org identity.Organization, inviter identity.User, token string) error {
+	invitedBy := inviter.Username
+	if invitedBy == "" {
+		invitedBy = inviter.Email
+	}
+
+	evt := events.NewOrganizationInvitationCreated(events.InvitationPayload{
+		ID:               inv.ID,
+		TenantID:         string(org.TenantID),
+		OrganizationID:   string(org.ID),
+		OrganizationName: org.Name,
+		Email:            inv.Email,
+		Role:             string(inv.Role),
+		InvitedByName:    invitedBy,
+		Token:            token,
+		ExpiresAt:        inv.ExpiresAt,
+	})
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(strings.ToLower(inv.Email)),
+		Value: payload,
+		Time:  time.Now().UTC(),
+	}
+	if id := identity.RequestIDFromContext(ctx); id != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: events.RequestIDHeader, Value: []byte(id)})
+	}
+
+	// The email service continues the trace from the message headers.
+	end := tracing.StartPublish(ctx, n.writer.Topic, &msg)
+	err = n.writer.WriteMessages(ctx, msg)
+	end(err)
+	return err
+}
+
+var _ identity.InvitationNotifier = (*KafkaInvitationNotifier)(nil)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/hawful70/platform-events/pkg/events"
 	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/tracing"
 )
 
 type KafkaNotifier struct {
@@ -36,6 +37,7 @@ func (n *KafkaNotifier) Close() error {
 
 func (n *KafkaNotifier) UserCreated(ctx context.Context, user identity.User) error {
 	evt := events.NewUserCreated(string(user.ID), user.Email, user.Username)
+	evt.User.TenantID = string(user.TenantID)
 	payload, err := json.Marshal(evt)
 	if err != nil {
 		return err
@@ -46,8 +48,15 @@ func (n *KafkaNotifier) UserCreated(ctx context.Context, user identity.User) err
 		Value: payload,
 		Time:  time.Now().UTC(),
 	}
+	if id := identity.RequestIDFromContext(ctx); id != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: events.RequestIDHeader, Value: []byte(id)})
+	}
 
-	return n.writer.WriteMessages(ctx, msg)
+	// The email service continues the trace from the message headers.
+	end := tracing.StartPublish(ctx, n.writer.Topic, &msg)
+	err = n.writer.WriteMessages(ctx, msg)
+	end(err)
+	return err
 }
 
 var _ identity.UserNotifier = (*KafkaNotifier)(nil)
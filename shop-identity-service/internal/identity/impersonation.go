@@ -0,0 +1,151 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+type ImpersonationSession = domain.ImpersonationSession
+
+var (
+	ErrForbidden               = errors.New("forbidden")
+	ErrReasonRequired          = errors.New("reason is required")
+	ErrImpersonationDisabled   = errors.New("impersonation is not enabled")
+	ErrImpersonationNotActive  = errors.New("impersonation session is not active")
+	ErrImpersonationNotAllowed = errors.New("action is not allowed while impersonating")
+)
+
+func (s *service) StartImpersonation(ctx context.Context, actor Claims, targetID UserID, reason string) (string, ImpersonationSession, error) {
+	if s.impersonation == nil {
+		return "", ImpersonationSession{}, ErrImpersonationDisabled
+	}
+	if actor.Impersonated() {
+		return "", ImpersonationSession{}, fmt.Errorf("%w: cannot impersonate from an impersonated session", ErrForbidden)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", ImpersonationSession{}, ErrReasonRequired
+	}
+
+	// Re-read the actor so a demoted admin cannot use an old token.
+	agent, err := s.repo.GetUserByID(ctx, UserID(actor.UserID))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return "", ImpersonationSession{}, ErrForbidden
+		}
+		return "", ImpersonationSession{}, err
+	}
+	if agent.Role != RoleAdmin {
+		return "", ImpersonationSession{}, ErrForbidden
+	}
+	if agent.ID == targetID {
+		return "", ImpersonationSession{}, fmt.Errorf("%w: cannot impersonate yourself", ErrForbidden)
+	}
+
+	target, err := s.repo.GetUserByID(ctx, targetID)
+	if err != nil {
+		return "", ImpersonationSession{}, err
+	}
+	if target.TenantID != agent.TenantID {
+		return "", ImpersonationSession{}, fmt.Errorf("%w: user belongs to another shop", ErrForbidden)
+	}
+	if target.Role == RoleAdmin {
+		return "", ImpersonationSession{}, fmt.Errorf("%w: cannot impersonate an admin", ErrForbidden)
+	}
+
+	now := s.now()
+	session := ImpersonationSession{
+		ID:        uuid.NewString(),
+		ActorID:   agent.ID,
+		TargetID:  target.ID,
+		Reason:    reason,
+		StartedAt: now,
+		ExpiresAt: now.Add(s.impersonationTTL),
+	}
+	if err := s.impersonation.CreateImpersonationSession(ctx, session); err != nil {
+		return "", ImpersonationSession{}, err
+	}
+	if err := s.recordImpersonation(ctx, session, domain.ImpersonationStarted, reason); err != nil {
+		return "", ImpersonationSession{}, err
+	}
+
+	token, err := s.jwtManager.GenerateImpersonationToken(target, agent, session.ID, session.ExpiresAt)
+	if err != nil {
+		return "", ImpersonationSession{}, err
+	}
+	return token, session, nil
+}
+
+func (s *service) EndImpersonation(ctx context.Context, claims Claims) error {
+	session, err := s.activeImpersonation(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	if err := s.impersonation.EndImpersonationSession(ctx, session.ID, s.now()); err != nil {
+		if errors.Is(err, repository.ErrImpersonationNotFound) {
+			return ErrImpersonationNotActive
+		}
+		return err
+	}
+	return s.recordImpersonation(ctx, session, domain.ImpersonationEnded, "")
+}
+
+func (s *service) TrackImpersonation(ctx context.Context, claims Claims, action string) error {
+	if !claims.Impersonated() {
+		return nil
+	}
+
+	session, err := s.activeImpersonation(ctx, claims)
+	if err != nil {
+		return err
+	}
+	return s.recordImpersonation(ctx, session, domain.ImpersonationUsed, action)
+}
+
+// activeImpersonation loads the session behind an impersonation token and
+// checks that it still belongs to the token's actor and has not ended.
+func (s *service) activeImpersonation(ctx context.Context, claims Claims) (ImpersonationSession, error) {
+	if !claims.Impersonated() {
+		return ImpersonationSession{}, ErrImpersonationNotActive
+	}
+	if s.impersonation == nil {
+		return ImpersonationSession{}, ErrImpersonationDisabled
+	}
+
+	session, err := s.impersonation.GetImpersonationSession(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationNotFound) {
+			return ImpersonationSession{}, ErrImpersonationNotActive
+		}
+		return ImpersonationSession{}, err
+	}
+	if string(session.ActorID) != claims.Actor.UserID || string(session.TargetID) != claims.UserID || !session.Active(s.now()) {
+		return ImpersonationSession{}, ErrImpersonationNotActive
+	}
+	return session, nil
+}
+
+func (s *service) recordImpersonation(ctx context.Context, session ImpersonationSession, typ domain.ImpersonationEventType, action string) error {
+	event := domain.ImpersonationEvent{
+		SessionID: session.ID,
+		ActorID:   session.ActorID,
+		TargetID:  session.TargetID,
+		Type:      typ,
+		Action:    action,
+		CreatedAt: s.now(),
+	}
+	if err := s.impersonation.RecordImpersonationEvent(ctx, event); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "impersonation "+string(typ), "session_id", session.ID, "actor_id", session.ActorID, "target_id", session.TargetID, "action", action)
+	return nil
+}
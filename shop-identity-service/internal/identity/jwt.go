@@ -1,25 +1,70 @@
 package identity
 
 import (
+	"crypto/rand"
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// PurposePasswordChange marks a challenge token that only allows the holder
+// to change an expired password.
+const PurposePasswordChange = "password_change"
+
+// PurposeRefresh marks a refresh token, which is only exchanged for a new
+// access token by Service.Refresh.
+const PurposeRefresh = "refresh"
+
+const challengeTokenTTL = 5 * time.Minute
+
 type JWTManager struct {
 	secret    []byte
 	issuer    string
 	expiresIn time.Duration
+	tenants   *TenantRegistry
+	keys      *SigningKeyRing
 }
 
 type Claims struct {
 	UserID   string `json:"uid"`
 	Email    string `json:"email"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	// TenantID is empty on tokens issued before multi-tenancy.
+	TenantID string `json:"tid,omitempty"`
+	// OrgID and OrgRole name the active organization chosen via org switch.
+	OrgID   string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// SessionVersion must match the user's current version; see
+	// Service.RevokeSessions.
+	SessionVersion int `json:"sv,omitempty"`
+	// Purpose is empty for access tokens and set for restricted challenge tokens.
+	Purpose string `json:"purpose,omitempty"`
+	// Actor is set when a support agent is impersonating the subject. The
+	// token ID (jti) is then the impersonation session ID.
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the RFC 8693 "act" claim naming who is really behind the token.
+type Actor struct {
+	UserID string `json:"sub"`
+	Email  string `json:"email,omitempty"`
+}
+
+func (c Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+func (c Claims) Tenant() TenantID {
+	if c.TenantID == "" {
+		return DefaultTenantID
+	}
+	return TenantID(c.TenantID)
+}
+
 func NewJWTManager(secret, issuer string, expiresIn time.Duration) *JWTManager {
 	return &JWTManager{
 		secret:    []byte(secret),
@@ -28,37 +73,161 @@ func NewJWTManager(secret, issuer string, expiresIn time.Duration) *JWTManager {
 	}
 }
 
+// UseTenants makes tokens carry each tenant's issuer and audience.
+func (m *JWTManager) UseTenants(tenants *TenantRegistry) {
+	m.tenants = tenants
+}
+
+// UseSigningKeys signs tokens with the ring's current key instead of the
+// configured secret.
+func (m *JWTManager) UseSigningKeys(keys *SigningKeyRing) {
+	m.keys = keys
+}
+
+// audienceFor returns the issuer and audience expected for a tenant.
+func (m *JWTManager) audienceFor(id TenantID) (string, string) {
+	if m.tenants == nil {
+		return m.issuer, ""
+	}
+	tenant, ok := m.tenants.Tenant(id)
+	if !ok || tenant.JWTIssuer == "" {
+		return m.issuer, tenant.JWTAudience
+	}
+	return tenant.JWTIssuer, tenant.JWTAudience
+}
+
 func (m *JWTManager) GenerateToken(u User) (string, error) {
+	return m.generate(u, "", m.expiresIn)
+}
+
+// GenerateOrgToken issues an access token acting within organization org.
+func (m *JWTManager) GenerateOrgToken(u User, org OrganizationID, role OrgRole) (string, error) {
+	claims := m.claims(u, "", time.Now().UTC().Add(m.expiresIn))
+	claims.OrgID = string(org)
+	claims.OrgRole = string(role)
+	return m.sign(claims)
+}
+
+// GeneratePasswordChangeToken issues a short-lived token that is only
+// accepted by the password change endpoint.
+func (m *JWTManager) GeneratePasswordChangeToken(u User) (string, error) {
+	return m.generate(u, PurposePasswordChange, challengeTokenTTL)
+}
+
+// GenerateRefreshToken issues a refresh token valid for ttl for the subject
+// of access, an access token's claims. The organization is not carried
+// over: refreshed tokens act for the personal account. Each token gets its
+// own jti, by which Service.Refresh and Service.Logout revoke it.
+func (m *JWTManager) GenerateRefreshToken(access Claims, ttl time.Duration) (string, error) {
+	if access.Impersonated() || access.Purpose != "" {
+		return "", errors.New("refresh tokens are only issued for access tokens")
+	}
+	now := time.Now().UTC()
+	claims := access
+	claims.OrgID, claims.OrgRole = "", ""
+	claims.Purpose = PurposeRefresh
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.ID = rand.Text()
+	return m.sign(claims)
+}
+
+// GenerateImpersonationToken issues an access token for target that names
+// actor in the "act" claim and carries sessionID as its jti.
+func (m *JWTManager) GenerateImpersonationToken(target, actor User, sessionID string, expiresAt time.Time) (string, error) {
+	claims := m.claims(target, "", expiresAt)
+	claims.Actor = &Actor{UserID: string(actor.ID), Email: actor.Email}
+	claims.ID = sessionID
+	return m.sign(claims)
+}
+
+func (m *JWTManager) generate(u User, purpose string, ttl time.Duration) (string, error) {
+	return m.sign(m.claims(u, purpose, time.Now().UTC().Add(ttl)))
+}
+
+func (m *JWTManager) sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if m.keys != nil {
+		if key, ok := m.keys.signingKey(); ok {
+			token.Header["kid"] = key.ID
+			return token.SignedString([]byte(key.Secret))
+		}
+	}
+	return token.SignedString(m.secret)
+}
+
+// verificationSecret picks the secret named by the token's kid header.
+// Tokens without a kid were signed with the configured secret.
+func (m *JWTManager) verificationSecret(token *jwt.Token) ([]byte, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if m.keys != nil && !m.keys.legacyAccepted() {
+			return nil, errors.New("token signed with a retired secret")
+		}
+		return m.secret, nil
+	}
+	if m.keys != nil {
+		if key, ok := m.keys.verificationKey(kid); ok {
+			return []byte(key.Secret), nil
+		}
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+func (m *JWTManager) claims(u User, purpose string, expiresAt time.Time) Claims {
 	now := time.Now().UTC()
+	issuer, audience := m.audienceFor(u.TenantID)
 	claims := Claims{
-		UserID:   string(u.ID),
-		Email:    u.Email,
-		Username: u.Username,
+		UserID:         string(u.ID),
+		Email:          u.Email,
+		Username:       u.Username,
+		Role:           string(u.Role),
+		TenantID:       string(u.TenantID),
+		SessionVersion: u.SessionVersion,
+		Purpose:        purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    m.issuer,
+			Issuer:    issuer,
 			Subject:   string(u.ID),
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiresIn)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.secret)
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	return claims
 }
 
+// VerifyToken accepts access tokens only; challenge tokens are rejected.
 func (m *JWTManager) VerifyToken(tokenStr string) (Claims, error) {
+	return m.VerifyPurposeToken(tokenStr, "")
+}
+
+func (m *JWTManager) VerifyPurposeToken(tokenStr, purpose string) (Claims, error) {
 	var claims Claims
 	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return m.secret, nil
-	}, jwt.WithIssuer(m.issuer))
+		return m.verificationSecret(token)
+	})
 	if err != nil {
 		return Claims{}, err
 	}
 	if !token.Valid {
 		return Claims{}, errors.New("invalid token")
 	}
+
+	// Issuer and audience depend on the tenant named in the token.
+	issuer, audience := m.audienceFor(claims.Tenant())
+	if claims.Issuer != issuer {
+		return Claims{}, errors.New("unexpected token issuer")
+	}
+	if audience != "" && !slices.Contains(claims.Audience, audience) {
+		return Claims{}, errors.New("unexpected token audience")
+	}
+	if claims.Purpose != purpose {
+		return Claims{}, errors.New("token purpose mismatch")
+	}
 	return claims, nil
 }
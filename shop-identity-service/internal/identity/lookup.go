@@ -0,0 +1,52 @@
+package identity
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// ChangeCursor is where a client of UserChanges left off.
+type ChangeCursor = repository.ChangeCursor
+
+// changeSettleTime holds back the newest changes from UserChanges. A write
+// stamps updated_at before it commits, so a later poll could otherwise skip
+// a row that committed after a newer one was already returned.
+const changeSettleTime = 2 * time.Second
+
+// GetUsersByIDs returns the users of the caller's tenant among ids. Unknown
+// IDs and users of other tenants are skipped alike.
+func (s *service) GetUsersByIDs(ctx context.Context, ids []UserID) ([]User, error) {
+	users, err := s.repo.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	tenant := s.tenant(ctx).ID
+	visible := users[:0]
+	for _, u := range users {
+		if u.TenantID == tenant {
+			visible = append(visible, u)
+		}
+	}
+	return visible, nil
+}
+
+// GetUserByEmail looks up a user of the caller's tenant the way Login does.
+func (s *service) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	return s.repo.GetUserByEmail(ctx, s.tenant(ctx).ID, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// SearchUsers lists the caller's tenant's users of every role, for internal
+// callers. The provisioning ListUsers leaves admins out.
+func (s *service) SearchUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]User, int64, error) {
+	return s.repo.ListUsers(ctx, s.tenant(ctx).ID, filter, offset, limit)
+}
+
+// UserChanges returns up to limit users of the caller's tenant changed after
+// the cursor, oldest change first. A user appears once per poll however
+// often it changed; the last one returned is the next cursor.
+func (s *service) UserChanges(ctx context.Context, after ChangeCursor, limit int) ([]User, error) {
+	return s.repo.ListUsersChanged(ctx, s.tenant(ctx).ID, after, s.now().Add(-changeSettleTime), limit)
+}
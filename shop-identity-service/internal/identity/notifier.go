@@ -6,12 +6,26 @@ type UserNotifier interface {
 	UserCreated(ctx context.Context, user User) error
 }
 
+// InvitationNotifier delivers organization invitations. token is the plain
+// invitation token to put in the accept link.
+type InvitationNotifier interface {
+	InvitationCreated(ctx context.Context, inv Invitation, org Organization, inviter User, token string) error
+}
+
 type noopNotifier struct{}
 
 func (noopNotifier) UserCreated(ctx context.Context, user User) error {
 	return nil
 }
 
+func (noopNotifier) InvitationCreated(ctx context.Context, inv Invitation, org Organization, inviter User, token string) error {
+	return nil
+}
+
 func NoopNotifier() UserNotifier {
 	return noopNotifier{}
 }
+
+func NoopInvitationNotifier() InvitationNotifier {
+	return noopNotifier{}
+}
@@ -0,0 +1,334 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+var (
+	ErrOrgNameRequired      = errors.New("organization name is required")
+	ErrInvalidOrgRole       = errors.New("role must be owner, buyer or approver")
+	ErrOrganizationNotFound = repository.ErrOrganizationNotFound
+	ErrAlreadyMember        = repository.ErrAlreadyMember
+	ErrInvitationInvalid    = errors.New("invitation is invalid or has expired")
+	ErrInvitationEmail      = errors.New("invitation was sent to a different email address")
+	ErrLastOwner            = errors.New("organization must keep at least one owner")
+)
+
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+// OrganizationMembership is an organization seen from one member.
+type OrganizationMembership struct {
+	Organization Organization
+	Role         OrgRole
+}
+
+// Member is a user together with their role in an organization.
+type Member struct {
+	User     User
+	Role     OrgRole
+	JoinedAt time.Time
+}
+
+// OrganizationService manages B2B organizations, their members and
+// invitations. All calls act on behalf of the holder of claims.
+type OrganizationService interface {
+	CreateOrganization(ctx context.Context, claims Claims, name string) (Organization, error)
+	ListOrganizations(ctx context.Context, claims Claims) ([]OrganizationMembership, error)
+	ListMembers(ctx context.Context, claims Claims, orgID OrganizationID) ([]Member, error)
+	// RemoveMember lets owners remove anyone and members remove themselves.
+	RemoveMember(ctx context.Context, claims Claims, orgID OrganizationID, userID UserID) error
+	// Invite is owner-only and sends the invitation through the notifier.
+	Invite(ctx context.Context, claims Claims, orgID OrganizationID, email string, role OrgRole) (Invitation, error)
+	AcceptInvitation(ctx context.Context, claims Claims, token string) (Membership, error)
+	// SwitchOrganization returns a token with orgID as the active
+	// organization. An empty orgID returns a personal token.
+	SwitchOrganization(ctx context.Context, claims Claims, orgID OrganizationID) (string, error)
+}
+
+type organizationService struct {
+	users         repository.Repository
+	orgs          repository.OrganizationRepository
+	jwtManager    *JWTManager
+	notifier      InvitationNotifier
+	invitationTTL time.Duration
+	now           func() time.Time
+}
+
+func NewOrganizationService(users repository.Repository, orgs repository.OrganizationRepository, jwtManager *JWTManager, notifier InvitationNotifier, invitationTTL time.Duration) OrganizationService {
+	if notifier == nil {
+		notifier = NoopInvitationNotifier()
+	}
+	if invitationTTL <= 0 {
+		invitationTTL = defaultInvitationTTL
+	}
+	return &organizationService{
+		users:         users,
+		orgs:          orgs,
+		jwtManager:    jwtManager,
+		notifier:      notifier,
+		invitationTTL: invitationTTL,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *organizationService) CreateOrganization(ctx context.Context, claims Claims, name string) (Organization, error) {
+	if claims.Impersonated() {
+		return Organization{}, ErrImpersonationNotAllowed
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Organization{}, ErrOrgNameRequired
+	}
+
+	now := s.now()
+	org := Organization{
+		ID:        OrganizationID(uuid.NewString()),
+		TenantID:  claims.Tenant(),
+		Name:      name,
+		CreatedBy: UserID(claims.UserID),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	owner := Membership{
+		OrganizationID: org.ID,
+		UserID:         UserID(claims.UserID),
+		Role:           OrgRoleOwner,
+		CreatedAt:      now,
+	}
+	if err := s.orgs.CreateOrganization(ctx, org, owner); err != nil {
+		return Organization{}, err
+	}
+	return org, nil
+}
+
+func (s *organizationService) ListOrganizations(ctx context.Context, claims Claims) ([]OrganizationMembership, error) {
+	orgs, members, err := s.orgs.ListUserOrganizations(ctx, UserID(claims.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]OrganizationMembership, 0, len(orgs))
+	for i, org := range orgs {
+		if org.TenantID != claims.Tenant() {
+			continue
+		}
+		out = append(out, OrganizationMembership{Organization: org, Role: members[i].Role})
+	}
+	return out, nil
+}
+
+func (s *organizationService) ListMembers(ctx context.Context, claims Claims, orgID OrganizationID) ([]Member, error) {
+	if _, _, err := s.access(ctx, claims, orgID); err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.orgs.ListMemberships(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]Member, 0, len(memberships))
+	for _, m := range memberships {
+		user, err := s.users.GetUserByID(ctx, m.UserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		members = append(members, Member{User: user, Role: m.Role, JoinedAt: m.CreatedAt})
+	}
+	return members, nil
+}
+
+func (s *organizationService) RemoveMember(ctx context.Context, claims Claims, orgID OrganizationID, userID UserID) error {
+	if claims.Impersonated() {
+		return ErrImpersonationNotAllowed
+	}
+	_, self, err := s.access(ctx, claims, orgID)
+	if err != nil {
+		return err
+	}
+	if self.Role != OrgRoleOwner && self.UserID != userID {
+		return ErrForbidden
+	}
+
+	target, err := s.orgs.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if target.Role == OrgRoleOwner {
+		members, err := s.orgs.ListMemberships(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		owners := 0
+		for _, m := range members {
+			if m.Role == OrgRoleOwner {
+				owners++
+			}
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	return s.orgs.DeleteMembership(ctx, orgID, userID)
+}
+
+func (s *organizationService) Invite(ctx context.Context, claims Claims, orgID OrganizationID, email string, role OrgRole) (Invitation, error) {
+	if claims.Impersonated() {
+		return Invitation{}, ErrImpersonationNotAllowed
+	}
+	if !role.Valid() {
+		return Invitation{}, ErrInvalidOrgRole
+	}
+	email, err := domain.ParseEmail(email)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	org, self, err := s.access(ctx, claims, orgID)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if self.Role != OrgRoleOwner {
+		return Invitation{}, ErrForbidden
+	}
+	inviter, err := s.users.GetUserByID(ctx, self.UserID)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	token, hash, err := newSecretToken("")
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	now := s.now()
+	inv := Invitation{
+		ID:             uuid.NewString(),
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      hash,
+		InvitedBy:      inviter.ID,
+		ExpiresAt:      now.Add(s.invitationTTL),
+		CreatedAt:      now,
+	}
+	if err := s.orgs.CreateInvitation(ctx, inv); err != nil {
+		return Invitation{}, err
+	}
+
+	if err := s.notifier.InvitationCreated(ctx, inv, org, inviter, token); err != nil {
+		// Nobody received the token, so the invitation could never be
+		// accepted; remove it rather than leave it pending.
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if delErr := s.orgs.DeleteInvitation(cleanupCtx, inv.ID); delErr != nil {
+			slog.WarnContext(ctx, "failed to delete unsent invitation", "invitation_id", inv.ID, "error", delErr)
+		}
+		return Invitation{}, err
+	}
+	return inv, nil
+}
+
+func (s *organizationService) AcceptInvitation(ctx context.Context, claims Claims, token string) (Membership, error) {
+	if claims.Impersonated() {
+		return Membership{}, ErrImpersonationNotAllowed
+	}
+
+	inv, err := s.orgs.GetInvitationByTokenHash(ctx, hashSecretToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return Membership{}, ErrInvitationInvalid
+		}
+		return Membership{}, err
+	}
+	now := s.now()
+	if !inv.Pending(now) {
+		return Membership{}, ErrInvitationInvalid
+	}
+
+	org, err := s.orgs.GetOrganization(ctx, inv.OrganizationID)
+	if err != nil {
+		return Membership{}, err
+	}
+	if org.TenantID != claims.Tenant() {
+		return Membership{}, ErrInvitationInvalid
+	}
+
+	user, err := s.users.GetUserByID(ctx, UserID(claims.UserID))
+	if err != nil {
+		return Membership{}, err
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		return Membership{}, ErrInvitationEmail
+	}
+
+	member := Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           inv.Role,
+		CreatedAt:      now,
+	}
+	if err := s.orgs.AcceptInvitation(ctx, inv, member, now); err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return Membership{}, ErrInvitationInvalid
+		}
+		return Membership{}, err
+	}
+	return member, nil
+}
+
+func (s *organizationService) SwitchOrganization(ctx context.Context, claims Claims, orgID OrganizationID) (string, error) {
+	// An impersonation token would lose its act claim if reissued here.
+	if claims.Impersonated() {
+		return "", ErrImpersonationNotAllowed
+	}
+
+	user, err := s.users.GetUserByID(ctx, UserID(claims.UserID))
+	if err != nil {
+		return "", err
+	}
+	if orgID == "" {
+		return s.jwtManager.GenerateToken(user)
+	}
+
+	_, member, err := s.access(ctx, claims, orgID)
+	if err != nil {
+		return "", err
+	}
+	return s.jwtManager.GenerateOrgToken(user, orgID, member.Role)
+}
+
+// access loads an organization of the caller's tenant that the caller is a
+// member of. Non-members get ErrOrganizationNotFound so that organization IDs
+// cannot be probed.
+func (s *organizationService) access(ctx context.Context, claims Claims, orgID OrganizationID) (Organization, Membership, error) {
+	org, err := s.orgs.GetOrganization(ctx, orgID)
+	if err != nil {
+		return Organization{}, Membership{}, err
+	}
+	if org.TenantID != claims.Tenant() {
+		return Organization{}, Membership{}, ErrOrganizationNotFound
+	}
+
+	member, err := s.orgs.GetMembership(ctx, orgID, UserID(claims.UserID))
+	if err != nil {
+		if errors.Is(err, repository.ErrMembershipNotFound) {
+			return Organization{}, Membership{}, ErrOrganizationNotFound
+		}
+		return Organization{}, Membership{}, err
+	}
+	return org, member, nil
+}
@@ -0,0 +1,87 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// memoryInvitations is an organization repository holding one organization
+// owned by its owner; only invitations are stored.
+type memoryInvitations struct {
+	repository.OrganizationRepository
+	org         domain.Organization
+	owner       domain.Membership
+	invitations map[string]domain.Invitation
+}
+
+func (m *memoryInvitations) GetOrganization(_ context.Context, id domain.OrganizationID) (domain.Organization, error) {
+	if id != m.org.ID {
+		return domain.Organization{}, repository.ErrOrganizationNotFound
+	}
+	return m.org, nil
+}
+
+func (m *memoryInvitations) GetMembership(_ context.Context, orgID domain.OrganizationID, userID domain.UserID) (domain.Membership, error) {
+	if orgID != m.owner.OrganizationID || userID != m.owner.UserID {
+		return domain.Membership{}, repository.ErrMembershipNotFound
+	}
+	return m.owner, nil
+}
+
+func (m *memoryInvitations) CreateInvitation(_ context.Context, inv domain.Invitation) error {
+	m.invitations[inv.ID] = inv
+	return nil
+}
+
+func (m *memoryInvitations) DeleteInvitation(_ context.Context, id string) error {
+	delete(m.invitations, id)
+	return nil
+}
+
+type failingInvitationNotifier struct{ err error }
+
+func (n failingInvitationNotifier) InvitationCreated(context.Context, Invitation, Organization, User, string) error {
+	return n.err
+}
+
+func TestInviteRemovesUnsentInvitation(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryRepository()
+	owner, err := domain.NewUser("owner@example.com", "owner", "hash")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	owner.ID, owner.TenantID = "owner-1", DefaultTenantID
+	if err := users.CreateUser(ctx, owner); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	orgs := &memoryInvitations{
+		org:         domain.Organization{ID: "org-1", TenantID: DefaultTenantID, Name: "Acme"},
+		owner:       domain.Membership{OrganizationID: "org-1", UserID: owner.ID, Role: OrgRoleOwner},
+		invitations: map[string]domain.Invitation{},
+	}
+	claims := Claims{UserID: string(owner.ID)}
+
+	publishErr := errors.New("broker unavailable")
+	s := NewOrganizationService(users, orgs, nil, failingInvitationNotifier{publishErr}, 0)
+	if _, err := s.Invite(ctx, claims, "org-1", "buyer@example.com", OrgRoleBuyer); !errors.Is(err, publishErr) {
+		t.Fatalf("Invite: err = %v, want %v", err, publishErr)
+	}
+	if len(orgs.invitations) != 0 {
+		t.Fatalf("invitations after a failed publish = %v, want none", orgs.invitations)
+	}
+
+	s = NewOrganizationService(users, orgs, nil, nil, 0)
+	inv, err := s.Invite(ctx, claims, "org-1", "buyer@example.com", OrgRoleBuyer)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if _, ok := orgs.invitations[inv.ID]; !ok {
+		t.Fatalf("invitation %s was not stored", inv.ID)
+	}
+}
@@ -17,3 +17,10 @@ func CheckPassword(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
+
+// IsPasswordHash reports whether hash is a bcrypt hash, as produced by
+// HashPassword or imported from another system.
+func IsPasswordHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
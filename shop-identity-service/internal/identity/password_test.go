@@ -0,0 +1,111 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+func newPasswordTestUser(t *testing.T, repo repository.Repository, password string) User {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	u, err := domain.NewUser("alice@example.com", "alice", hash)
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	if err := repo.CreateUser(context.Background(), u); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return u
+}
+
+func TestResetPasswordRejectsReuse(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	s := newService(repo, nil, nil, WithPasswordPolicies(PasswordPolicies{RoleCustomer: {HistorySize: 2}}))
+	u := newPasswordTestUser(t, repo, "first-passphrase")
+
+	steps := []struct {
+		password string
+		want     error
+	}{
+		{"first-passphrase", ErrPasswordReused},
+		{"second-passphrase", nil},
+		{"second-passphrase", ErrPasswordReused},
+		{"first-passphrase", ErrPasswordReused},
+		{"third-passphrase", nil},
+		{"fourth-passphrase", nil},
+		// Only the two passwords before the current one are remembered.
+		{"first-passphrase", nil},
+		{"short", ErrPasswordTooWeak},
+	}
+	for _, step := range steps {
+		if err := s.ResetPassword(ctx, u.ID, step.password); !errors.Is(err, step.want) {
+			t.Fatalf("ResetPassword(%q): err = %v, want %v", step.password, err, step.want)
+		}
+	}
+}
+
+func TestConcurrentPasswordChangesCannotReuse(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	s := newService(repo, nil, nil, WithPasswordPolicies(PasswordPolicies{RoleCustomer: {HistorySize: 3}}))
+	u := newPasswordTestUser(t, repo, "first-passphrase")
+
+	// Every call starts from the same user, as concurrent requests do. The
+	// first update wins; the others find the password changed, check again
+	// and are rejected as reuse.
+	const calls = 4
+	errs := make([]error, calls)
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.setPassword(ctx, u, "second-passphrase")
+		}()
+	}
+	wg.Wait()
+
+	var ok, reused int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrPasswordReused):
+			reused++
+		default:
+			t.Fatalf("setPassword: %v", err)
+		}
+	}
+	if ok != 1 || reused != calls-1 {
+		t.Fatalf("%d changes succeeded and %d were rejected, want 1 and %d", ok, reused, calls-1)
+	}
+}
+
+func TestSetPasswordRetriesAfterAConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	s := newService(repo, nil, nil, WithPasswordPolicies(PasswordPolicies{RoleCustomer: {HistorySize: 3}}))
+	stale := newPasswordTestUser(t, repo, "first-passphrase")
+
+	if err := s.ResetPassword(ctx, stale.ID, "second-passphrase"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	// The stale copy still has the first hash: the update conflicts, the
+	// user is read again and the check runs against the new history.
+	if _, err := s.setPassword(ctx, stale, "second-passphrase"); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("setPassword from a stale user to the new password: err = %v, want ErrPasswordReused", err)
+	}
+	got, err := s.setPassword(ctx, stale, "third-passphrase")
+	if err != nil || !CheckPassword(got.Password, "third-passphrase") {
+		t.Fatalf("setPassword from a stale user = %v; want the password changed", err)
+	}
+}
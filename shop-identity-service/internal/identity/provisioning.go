@@ -0,0 +1,444 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+var (
+	ErrSCIMTokenInvalid      = errors.New("invalid scim token")
+	ErrSCIMTokenNotFound     = repository.ErrSCIMTokenNotFound
+	ErrSCIMTokenNameRequired = errors.New("token name is required")
+	ErrRoleNotProvisionable  = errors.New("role must be customer or seller")
+)
+
+// scimTokenPrefix makes leaked SCIM tokens easy to recognize in scanners.
+const scimTokenPrefix = "scim_"
+
+// provisionableRoles are the roles a customer directory may assign. Admins
+// are platform staff and are invisible to provisioning.
+var provisionableRoles = []Role{RoleCustomer, RoleSeller}
+
+type UserFilter = repository.UserFilter
+
+type SCIMToken = domain.SCIMToken
+
+// ProvisionedUser is the part of a user managed by a customer directory.
+type ProvisionedUser struct {
+	Email    string
+	Username string
+	// DeriveUsername treats Username as a suggestion, such as the local part
+	// of an email address: when it is invalid or taken, a numbered variant
+	// is used instead.
+	DeriveUsername bool
+	// SCIMUserName is the directory's userName, stored as sent.
+	SCIMUserName string
+	ExternalID   string
+	Role         Role
+	Active       bool
+	// Password is optional. Users created without one sign in after a
+	// password reset or through another provider.
+	Password string
+}
+
+// ProvisioningService backs directory sync (SCIM). Calls act on the tenant
+// in the context, which AuthenticateSCIMToken resolves from the token.
+type ProvisioningService interface {
+	AuthenticateSCIMToken(ctx context.Context, token string) (Tenant, error)
+	// CreateSCIMToken issues a token for the admin's tenant. The plain token
+	// is only returned here.
+	CreateSCIMToken(ctx context.Context, admin Claims, name string) (string, SCIMToken, error)
+	ListSCIMTokens(ctx context.Context, admin Claims) ([]SCIMToken, error)
+	RevokeSCIMToken(ctx context.Context, admin Claims, id string) error
+
+	ListUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]User, int64, error)
+	GetUser(ctx context.Context, id UserID) (User, error)
+	CreateUser(ctx context.Context, u ProvisionedUser) (User, error)
+	// UpdateUser replaces the directory-managed fields. Deactivating a user
+	// suspends them and revokes their sessions.
+	UpdateUser(ctx context.Context, id UserID, u ProvisionedUser) (User, error)
+	SuspendUser(ctx context.Context, id UserID) error
+}
+
+// NewProvisioningService takes the same options as NewService so that both
+// apply the same email, password and tenant rules.
+func NewProvisioningService(repo repository.Repository, tokens repository.SCIMTokenRepository, notifier UserNotifier, opts ...ServiceOption) ProvisioningService {
+	s := newService(repo, nil, notifier, opts...)
+	s.scimTokens = tokens
+	return s
+}
+
+func (s *service) AuthenticateSCIMToken(ctx context.Context, token string) (Tenant, error) {
+	if !strings.HasPrefix(token, scimTokenPrefix) {
+		return Tenant{}, ErrSCIMTokenInvalid
+	}
+
+	t, err := s.scimTokens.GetSCIMTokenByHash(ctx, hashSecretToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrSCIMTokenNotFound) {
+			return Tenant{}, ErrSCIMTokenInvalid
+		}
+		return Tenant{}, err
+	}
+	if !t.Active() {
+		return Tenant{}, ErrSCIMTokenInvalid
+	}
+
+	tenant := Tenant{ID: t.TenantID}
+	if s.tenants != nil {
+		var ok bool
+		if tenant, ok = s.tenants.Tenant(t.TenantID); !ok {
+			return Tenant{}, ErrSCIMTokenInvalid
+		}
+	}
+
+	if err := s.scimTokens.TouchSCIMToken(ctx, t.ID, s.now()); err != nil {
+		slog.WarnContext(ctx, "failed to record use of scim token", "scim_token_id", t.ID, "error", err)
+	}
+	return tenant, nil
+}
+
+func (s *service) CreateSCIMToken(ctx context.Context, admin Claims, name string) (string, SCIMToken, error) {
+	if admin.Impersonated() {
+		return "", SCIMToken{}, ErrImpersonationNotAllowed
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", SCIMToken{}, ErrSCIMTokenNameRequired
+	}
+
+	token, hash, err := newSecretToken(scimTokenPrefix)
+	if err != nil {
+		return "", SCIMToken{}, err
+	}
+
+	t := SCIMToken{
+		ID:        uuid.NewString(),
+		TenantID:  admin.Tenant(),
+		Name:      name,
+		TokenHash: hash,
+		CreatedBy: UserID(admin.UserID),
+		CreatedAt: s.now(),
+	}
+	if err := s.scimTokens.CreateSCIMToken(ctx, t); err != nil {
+		return "", SCIMToken{}, err
+	}
+	return token, t, nil
+}
+
+func (s *service) ListSCIMTokens(ctx context.Context, admin Claims) ([]SCIMToken, error) {
+	return s.scimTokens.ListSCIMTokens(ctx, admin.Tenant())
+}
+
+func (s *service) RevokeSCIMToken(ctx context.Context, admin Claims, id string) error {
+	if admin.Impersonated() {
+		return ErrImpersonationNotAllowed
+	}
+	return s.scimTokens.RevokeSCIMToken(ctx, admin.Tenant(), id, s.now())
+}
+
+func (s *service) ListUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]User, int64, error) {
+	if len(filter.Roles) == 0 {
+		filter.Roles = provisionableRoles
+	} else {
+		filter.Roles = slices.DeleteFunc(slices.Clone(filter.Roles), func(r Role) bool {
+			return !slices.Contains(provisionableRoles, r)
+		})
+		if len(filter.Roles) == 0 {
+			return nil, 0, nil
+		}
+	}
+	return s.repo.ListUsers(ctx, s.tenant(ctx).ID, filter, offset, limit)
+}
+
+// GetUser is GetUserByID without admins.
+func (s *service) GetUser(ctx context.Context, id UserID) (User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if !slices.Contains(provisionableRoles, user.Role) {
+		return User{}, repository.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *service) CreateUser(ctx context.Context, p ProvisionedUser) (User, error) {
+	tenant := s.tenant(ctx)
+
+	role, err := provisionedRole(p.Role)
+	if err != nil {
+		return User{}, err
+	}
+
+	email, err := domain.ParseEmail(p.Email)
+	if err != nil {
+		return User{}, err
+	}
+	if s.emails.blocked(email) {
+		return User{}, ErrEmailBlocked
+	}
+	if err := s.checkSCIMUserName(ctx, "", p.SCIMUserName); err != nil {
+		return User{}, err
+	}
+	username := p.Username
+	if p.DeriveUsername {
+		if username, err = s.derivedUsername(ctx, tenant.ID, p.Username, ""); err != nil {
+			return User{}, err
+		}
+	} else if err := s.CheckUsername(ctx, p.Username); err != nil {
+		return User{}, err
+	}
+	canonical, err := s.checkEmail(ctx, tenant.ID, email)
+	if err != nil {
+		return User{}, err
+	}
+
+	password := p.Password
+	if password == "" {
+		// Nobody knows this password; the user has to reset it.
+		if password, _, err = newSecretToken(""); err != nil {
+			return User{}, err
+		}
+	}
+	if len(password) < 8 {
+		return User{}, ErrPasswordTooWeak
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, err := NewUser(email, username, hashed)
+	if err != nil {
+		return User{}, err
+	}
+	user.TenantID = tenant.ID
+	user.EmailCanonical = canonical
+	user.ExternalID = p.ExternalID
+	user.SCIMUserName = p.SCIMUserName
+	user.Role = role
+	if !p.Active {
+		suspendedAt := user.CreatedAt
+		user.SuspendedAt = &suspendedAt
+	}
+
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return User{}, err
+	}
+
+	if err := s.notifier.UserCreated(ctx, user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (s *service) UpdateUser(ctx context.Context, id UserID, p ProvisionedUser) (User, error) {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	role, err := provisionedRole(p.Role)
+	if err != nil {
+		return User{}, err
+	}
+	user.Role = role
+	user.ExternalID = p.ExternalID
+
+	email, err := domain.ParseEmail(p.Email)
+	if err != nil {
+		return User{}, err
+	}
+	if email != user.Email {
+		if s.emails.blocked(email) {
+			return User{}, ErrEmailBlocked
+		}
+		if err := s.checkEmailChange(ctx, user, email); err != nil {
+			return User{}, err
+		}
+		if user.Provider == domain.ProviderLocal {
+			user.ProviderID = email
+		}
+		user.Email = email
+		user.EmailCanonical = s.emails.Canonical(email)
+	}
+
+	if !strings.EqualFold(p.SCIMUserName, user.SCIMUserName) {
+		if err := s.checkSCIMUserName(ctx, user.ID, p.SCIMUserName); err != nil {
+			return User{}, err
+		}
+	}
+	username := p.Username
+	switch {
+	case p.DeriveUsername && p.SCIMUserName != "" && strings.EqualFold(p.SCIMUserName, user.SCIMUserName):
+		// The directory resent the same userName; keep what was derived.
+		username = user.Username
+	case p.DeriveUsername:
+		if username, err = s.derivedUsername(ctx, user.TenantID, p.Username, user.ID); err != nil {
+			return User{}, err
+		}
+	}
+	user.SCIMUserName = p.SCIMUserName
+
+	name, err := domain.ParseUsername(username)
+	if err != nil {
+		return User{}, err
+	}
+	if name.Skeleton != user.UsernameSkeleton || name.Canonical != user.UsernameCanonical {
+		taken, err := s.repo.UsernameExists(ctx, user.TenantID, name, user.ID)
+		if err != nil {
+			return User{}, err
+		}
+		if taken {
+			return User{}, ErrUsernameTaken
+		}
+	}
+	user.Username = name.Display
+	user.UsernameCanonical = name.Canonical
+	user.UsernameSkeleton = name.Skeleton
+
+	now := s.now()
+	deprovisioned := !p.Active && !user.Suspended()
+	switch {
+	case deprovisioned:
+		user.SuspendedAt = &now
+		user.SessionVersion++
+	case p.Active && user.Suspended():
+		user.SuspendedAt = nil
+	}
+	user.UpdatedAt = now
+
+	// Directories resend the password on every PUT; the one already set is
+	// not a reuse. A new one is checked before anything is written, and is
+	// saved with the other changes or not at all.
+	if p.Password == "" || CheckPassword(user.Password, p.Password) {
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			return User{}, err
+		}
+	} else {
+		change, err := s.passwordChange(ctx, user, p.Password)
+		if err != nil {
+			return User{}, err
+		}
+		if err := s.repo.UpdateUserAndPassword(ctx, user, change); err != nil {
+			return User{}, err
+		}
+		user.Password = change.Hash
+		user.PasswordChangedAt = change.ChangedAt
+		user.UpdatedAt = change.ChangedAt
+	}
+
+	if deprovisioned {
+		slog.InfoContext(ctx, "user deprovisioned", "user_id", user.ID, "tenant_id", user.TenantID)
+	}
+	return user, nil
+}
+
+// checkSCIMUserName fails with ErrUsernameTaken when another user than self
+// was provisioned with userName.
+func (s *service) checkSCIMUserName(ctx context.Context, self UserID, userName string) error {
+	if userName == "" {
+		return nil
+	}
+	users, _, err := s.repo.ListUsers(ctx, s.tenant(ctx).ID, UserFilter{SCIMUserName: userName}, 0, 2)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.ID != self {
+			return ErrUsernameTaken
+		}
+	}
+	return nil
+}
+
+// maxDerivedUsernameAttempts bounds the numbered variants tried before a
+// random suffix is used.
+const maxDerivedUsernameAttempts = 20
+
+// derivedUsername returns base, or base with a numeric suffix such as
+// "jo.2", that is a valid username not taken in the tenant by another user
+// than self.
+func (s *service) derivedUsername(ctx context.Context, tenant TenantID, base string, self UserID) (string, error) {
+	base = truncateUsername(base, domain.UsernameMaxLength-4)
+	if base == "" {
+		base = "user"
+	}
+	for n := 1; n <= maxDerivedUsernameAttempts+1; n++ {
+		candidate := base
+		switch {
+		case n > maxDerivedUsernameAttempts:
+			suffix := strings.ToLower(rand.Text()[:8])
+			candidate = truncateUsername(base, domain.UsernameMaxLength-9) + "." + suffix
+		case n > 1:
+			candidate = base + "." + strconv.Itoa(n)
+		}
+		name, err := domain.ParseUsername(candidate)
+		if err != nil {
+			// Too short, reserved or odd characters: a suffix may fix it.
+			continue
+		}
+		taken, err := s.repo.UsernameExists(ctx, tenant, name, self)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name.Display, nil
+		}
+	}
+	return "", ErrUsernameTaken
+}
+
+// truncateUsername cuts s to at most n runes without leaving a trailing
+// separator.
+func truncateUsername(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		s = string(r[:n])
+	}
+	return strings.TrimRight(s, "._-")
+}
+
+// checkEmailChange is checkEmail that ignores the user's own record.
+func (s *service) checkEmailChange(ctx context.Context, user User, email string) error {
+	other, err := s.repo.GetUserByEmail(ctx, user.TenantID, email)
+	if err == nil && other.ID != user.ID {
+		return ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+
+	canonical := s.emails.Canonical(email)
+	if canonical == user.EmailCanonical {
+		return nil
+	}
+	taken, err := s.repo.EmailCanonicalExists(ctx, user.TenantID, canonical)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+func provisionedRole(role Role) (Role, error) {
+	if role == "" {
+		return RoleCustomer, nil
+	}
+	if !slices.Contains(provisionableRoles, role) {
+		return "", ErrRoleNotProvisionable
+	}
+	return role, nil
+}
@@ -0,0 +1,163 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+func TestCreateUserDerivesFreeUsernames(t *testing.T) {
+	ctx := context.Background()
+	s := newService(repository.NewMemoryRepository(), nil, nil)
+
+	create := func(userName, username string) User {
+		t.Helper()
+		u, err := s.CreateUser(ctx, ProvisionedUser{
+			Email:          userName,
+			Username:       username,
+			DeriveUsername: true,
+			SCIMUserName:   userName,
+			Active:         true,
+		})
+		if err != nil {
+			t.Fatalf("CreateUser(%q): %v", userName, err)
+		}
+		if u.SCIMUserName != userName {
+			t.Fatalf("SCIMUserName = %q, want %q", u.SCIMUserName, userName)
+		}
+		return u
+	}
+
+	tests := []struct {
+		userName, derived, want string
+	}{
+		{"jo.smith@example.com", "jo.smith", "jo.smith"},
+		{"Jo.Smith@example.org", "Jo.Smith", "Jo.Smith.2"},
+		{"jo.smith@example.net", "jo.smith", "jo.smith.3"},
+		{"admin@example.com", "admin", "admin.2"},
+		{"x@example.com", "x", "x.2"},
+		{"__@example.com", "", "user"},
+		{"averyveryveryverylongname.with.parts@example.com", "averyveryveryverylongname.with.parts", "averyveryveryverylongname"},
+	}
+	for _, tc := range tests {
+		if got := create(tc.userName, tc.derived); got.Username != tc.want {
+			t.Errorf("username for %q = %q, want %q", tc.userName, got.Username, tc.want)
+		}
+	}
+
+	_, err := s.CreateUser(ctx, ProvisionedUser{Email: "other@example.com", Username: "other", SCIMUserName: "JO.SMITH@example.com", Active: true})
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("CreateUser with a taken SCIM userName: err = %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestUpdateUserKeepsDerivedUsername(t *testing.T) {
+	ctx := context.Background()
+	s := newService(repository.NewMemoryRepository(), nil, nil)
+
+	for _, userName := range []string{"sam@example.com", "sam@example.org"} {
+		if _, err := s.CreateUser(ctx, ProvisionedUser{Email: userName, Username: "sam", DeriveUsername: true, SCIMUserName: userName, Active: true}); err != nil {
+			t.Fatalf("CreateUser(%q): %v", userName, err)
+		}
+	}
+	users, _, err := s.repo.ListUsers(ctx, DefaultTenantID, UserFilter{SCIMUserName: "sam@example.org"}, 0, 1)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("ListUsers = %v, %v", users, err)
+	}
+	second := users[0]
+
+	p := ProvisionedUser{Email: "sam@example.org", Username: "sam", DeriveUsername: true, SCIMUserName: "SAM@example.org", Active: true}
+	got, err := s.UpdateUser(ctx, second.ID, p)
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if got.Username != second.Username || got.SCIMUserName != "SAM@example.org" {
+		t.Fatalf("UpdateUser with the same userName = %q (%q), want %q", got.Username, got.SCIMUserName, second.Username)
+	}
+
+	p.SCIMUserName, p.Username = "samuel@example.org", "samuel"
+	if got, err = s.UpdateUser(ctx, second.ID, p); err != nil || got.Username != "samuel" {
+		t.Fatalf("UpdateUser with a new userName = %q, %v; want samuel", got.Username, err)
+	}
+
+	p.SCIMUserName = "sam@example.com"
+	if _, err := s.UpdateUser(ctx, second.ID, p); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("UpdateUser to another user's userName: err = %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	s := newService(repo, nil, nil, WithPasswordPolicies(PasswordPolicies{RoleCustomer: {HistorySize: 2}}))
+	p := ProvisionedUser{Email: "pat@example.com", Username: "pat", SCIMUserName: "pat@example.com", Password: "first-passphrase", Active: true}
+	created, err := s.CreateUser(ctx, p)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	// The directory resends the password it set with every PUT.
+	p.ExternalID = "ext-pat"
+	got, err := s.UpdateUser(ctx, created.ID, p)
+	if err != nil {
+		t.Fatalf("UpdateUser with the current password: %v", err)
+	}
+	if got.Password != created.Password || got.ExternalID != "ext-pat" {
+		t.Fatalf("UpdateUser with the current password changed it or dropped the update: %+v", got)
+	}
+
+	p.Password = "second-passphrase"
+	if _, err := s.UpdateUser(ctx, created.ID, p); err != nil {
+		t.Fatalf("UpdateUser with a new password: %v", err)
+	}
+
+	// A rejected password leaves the other changes unsaved.
+	p.ExternalID, p.Active = "ext-other", false
+	for _, tc := range []struct {
+		password string
+		want     error
+	}{
+		{"short", ErrPasswordTooWeak},
+		{"first-passphrase", ErrPasswordReused},
+	} {
+		p.Password = tc.password
+		if _, err := s.UpdateUser(ctx, created.ID, p); !errors.Is(err, tc.want) {
+			t.Fatalf("UpdateUser with password %q: err = %v, want %v", tc.password, err, tc.want)
+		}
+	}
+	stored, err := repo.GetUserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if stored.Suspended() || stored.ExternalID != "ext-pat" || !CheckPassword(stored.Password, "second-passphrase") {
+		t.Fatalf("a rejected password saved other changes: %+v", stored)
+	}
+}
+
+func TestUsernamesDifferingOnlyInCase(t *testing.T) {
+	ctx := context.Background()
+	s := newService(repository.NewMemoryRepository(), nil, nil)
+
+	// "Isabel" and "isabel" have different skeletons (capital I reads as l)
+	// but are the same login.
+	p := ProvisionedUser{Email: "isabel@example.com", Username: "Isabel", Active: true}
+	first, err := s.CreateUser(ctx, p)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := s.CheckUsername(ctx, "isabel"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("CheckUsername(isabel): err = %v, want ErrUsernameTaken", err)
+	}
+	second, err := s.CreateUser(ctx, ProvisionedUser{Email: "isabel@example.org", Username: "isabel", DeriveUsername: true, Active: true})
+	if err != nil || second.Username != "isabel.2" {
+		t.Fatalf("CreateUser deriving from isabel = %q, %v; want isabel.2", second.Username, err)
+	}
+
+	// Renaming oneself to another case is not a clash.
+	p.Username = "ISABEL"
+	if got, err := s.UpdateUser(ctx, first.ID, p); err != nil || got.Username != "ISABEL" {
+		t.Fatalf("UpdateUser to ISABEL = %q, %v", got.Username, err)
+	}
+}
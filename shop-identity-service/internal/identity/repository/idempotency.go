@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// IdempotencyRepository persists Idempotency-Key outcomes so that a retried
+// request can be answered from any replica.
+type IdempotencyRepository interface {
+	// Reserve claims key for a new request. When the key is already known and
+	// younger than ttl, the existing record is returned with reserved=false.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (rec domain.IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response for a reserved key.
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	// Release forgets a reserved key so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
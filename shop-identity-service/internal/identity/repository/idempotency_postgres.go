@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresIdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &postgresIdempotencyRepository{db: db}
+}
+
+func (r *postgresIdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (domain.IdempotencyRecord, bool, error) {
+	now := time.Now().UTC()
+	db := r.db.WithContext(ctx)
+
+	if err := db.Where("idempotency_key = ? AND created_at < ?", key, now.Add(-ttl)).
+		Delete(&domain.IdempotencyModel{}).Error; err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+
+	model := domain.IdempotencyModel{Key: key, Fingerprint: fingerprint, CreatedAt: now}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	if res.Error != nil {
+		return domain.IdempotencyRecord{}, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return model.ToDomain(), true, nil
+	}
+
+	var existing domain.IdempotencyModel
+	if err := db.Where("idempotency_key = ?", key).First(&existing).Error; err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	return existing.ToDomain(), false, nil
+}
+
+func (r *postgresIdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.IdempotencyModel{}).
+		Where("idempotency_key = ?", key).
+		Updates(map[string]any{
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+		}).Error
+}
+
+func (r *postgresIdempotencyRepository) Release(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).
+		Where("idempotency_key = ?", key).
+		Delete(&domain.IdempotencyModel{}).Error
+}
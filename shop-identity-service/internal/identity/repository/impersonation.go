@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+var ErrImpersonationNotFound = errors.New("impersonation session not found")
+
+// ImpersonationRepository stores impersonation sessions and their audit trail.
+type ImpersonationRepository interface {
+	CreateImpersonationSession(ctx context.Context, s domain.ImpersonationSession) error
+	GetImpersonationSession(ctx context.Context, id string) (domain.ImpersonationSession, error)
+	EndImpersonationSession(ctx context.Context, id string, endedAt time.Time) error
+	RecordImpersonationEvent(ctx context.Context, e domain.ImpersonationEvent) error
+}
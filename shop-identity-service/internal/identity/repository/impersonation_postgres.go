@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresImpersonationRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresImpersonationRepository(db *gorm.DB) ImpersonationRepository {
+	return &postgresImpersonationRepository{db: db}
+}
+
+func (r *postgresImpersonationRepository) CreateImpersonationSession(ctx context.Context, s domain.ImpersonationSession) error {
+	model := domain.ToImpersonationSessionModel(s)
+	return r.db.WithContext(ctx).Create(&model).Error
+}
+
+func (r *postgresImpersonationRepository) GetImpersonationSession(ctx context.Context, id string) (domain.ImpersonationSession, error) {
+	var model domain.ImpersonationSessionModel
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ImpersonationSession{}, ErrImpersonationNotFound
+		}
+		return domain.ImpersonationSession{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresImpersonationRepository) EndImpersonationSession(ctx context.Context, id string, endedAt time.Time) error {
+	res := r.db.WithContext(ctx).
+		Model(&domain.ImpersonationSessionModel{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", endedAt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrImpersonationNotFound
+	}
+	return nil
+}
+
+func (r *postgresImpersonationRepository) RecordImpersonationEvent(ctx context.Context, e domain.ImpersonationEvent) error {
+	model := domain.ToImpersonationEventModel(e)
+	return r.db.WithContext(ctx).Create(&model).Error
+}
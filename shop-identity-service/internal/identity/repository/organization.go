@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMembershipNotFound   = errors.New("membership not found")
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrAlreadyMember        = errors.New("user is already a member")
+)
+
+type OrganizationRepository interface {
+	// CreateOrganization stores org together with its first (owner) membership.
+	CreateOrganization(ctx context.Context, org domain.Organization, owner domain.Membership) error
+	GetOrganization(ctx context.Context, id domain.OrganizationID) (domain.Organization, error)
+	ListUserOrganizations(ctx context.Context, userID domain.UserID) ([]domain.Organization, []domain.Membership, error)
+
+	GetMembership(ctx context.Context, orgID domain.OrganizationID, userID domain.UserID) (domain.Membership, error)
+	ListMemberships(ctx context.Context, orgID domain.OrganizationID) ([]domain.Membership, error)
+	DeleteMembership(ctx context.Context, orgID domain.OrganizationID, userID domain.UserID) error
+
+	CreateInvitation(ctx context.Context, inv domain.Invitation) error
+	// DeleteInvitation removes an invitation that was never sent.
+	DeleteInvitation(ctx context.Context, id string) error
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (domain.Invitation, error)
+	// AcceptInvitation marks inv accepted and adds the membership atomically.
+	AcceptInvitation(ctx context.Context, inv domain.Invitation, member domain.Membership, acceptedAt time.Time) error
+}
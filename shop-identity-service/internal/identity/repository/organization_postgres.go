@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &postgresOrganizationRepository{db: db}
+}
+
+func (r *postgresOrganizationRepository) CreateOrganization(ctx context.Context, org domain.Organization, owner domain.Membership) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		orgModel := domain.ToOrganizationModel(org)
+		if err := tx.Create(&orgModel).Error; err != nil {
+			return err
+		}
+		memberModel := domain.ToMembershipModel(owner)
+		return tx.Create(&memberModel).Error
+	})
+}
+
+func (r *postgresOrganizationRepository) GetOrganization(ctx context.Context, id domain.OrganizationID) (domain.Organization, error) {
+	var model domain.OrganizationModel
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Organization{}, ErrOrganizationNotFound
+		}
+		return domain.Organization{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresOrganizationRepository) ListUserOrganizations(ctx context.Context, userID domain.UserID) ([]domain.Organization, []domain.Membership, error) {
+	var members []domain.MembershipModel
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&members).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.OrganizationID)
+	}
+	var orgs []domain.OrganizationModel
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&orgs).Error; err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]domain.OrganizationModel, len(orgs))
+	for _, o := range orgs {
+		byID[o.ID] = o
+	}
+
+	outOrgs := make([]domain.Organization, 0, len(members))
+	outMembers := make([]domain.Membership, 0, len(members))
+	for _, m := range members {
+		o, ok := byID[m.OrganizationID]
+		if !ok {
+			continue
+		}
+		outOrgs = append(outOrgs, o.ToDomain())
+		outMembers = append(outMembers, m.ToDomain())
+	}
+	return outOrgs, outMembers, nil
+}
+
+func (r *postgresOrganizationRepository) GetMembership(ctx context.Context, orgID domain.OrganizationID, userID domain.UserID) (domain.Membership, error) {
+	var model domain.MembershipModel
+	err := r.db.WithContext(ctx).Where("organization_id = ? AND user_id = ?", orgID, userID).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Membership{}, ErrMembershipNotFound
+		}
+		return domain.Membership{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresOrganizationRepository) ListMemberships(ctx context.Context, orgID domain.OrganizationID) ([]domain.Membership, error) {
+	var models []domain.MembershipModel
+	if err := r.db.WithContext(ctx).Where("organization_id = ?", orgID).Order("created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	members := make([]domain.Membership, 0, len(models))
+	for _, m := range models {
+		members = append(members, m.ToDomain())
+	}
+	return members, nil
+}
+
+func (r *postgresOrganizationRepository) DeleteMembership(ctx context.Context, orgID domain.OrganizationID, userID domain.UserID) error {
+	res := r.db.WithContext(ctx).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Delete(&domain.MembershipModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMembershipNotFound
+	}
+	return nil
+}
+
+func (r *postgresOrganizationRepository) CreateInvitation(ctx context.Context, inv domain.Invitation) error {
+	model := domain.ToInvitationModel(inv)
+	return r.db.WithContext(ctx).Create(&model).Error
+}
+
+func (r *postgresOrganizationRepository) DeleteInvitation(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&domain.InvitationModel{}).Error
+}
+
+func (r *postgresOrganizationRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (domain.Invitation, error) {
+	var model domain.InvitationModel
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Invitation{}, ErrInvitationNotFound
+		}
+		return domain.Invitation{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresOrganizationRepository) AcceptInvitation(ctx context.Context, inv domain.Invitation, member domain.Membership, acceptedAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.InvitationModel{}).
+			Where("id = ? AND accepted_at IS NULL", inv.ID).
+			Update("accepted_at", acceptedAt)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvitationNotFound
+		}
+
+		var count int64
+		if err := tx.Model(&domain.MembershipModel{}).
+			Where("organization_id = ? AND user_id = ?", member.OrganizationID, member.UserID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyMember
+		}
+
+		model := domain.ToMembershipModel(member)
+		return tx.Create(&model).Error
+	})
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// RefreshTokenRepository remembers refresh tokens that may no longer be
+// used, so that each is exchanged at most once.
+type RefreshTokenRepository interface {
+	// RevokeRefreshToken marks the token id as used until expiresAt. It
+	// returns false when the token had already been revoked.
+	RevokeRefreshToken(ctx context.Context, id string, userID domain.UserID, expiresAt time.Time) (bool, error)
+}
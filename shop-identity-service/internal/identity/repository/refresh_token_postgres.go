@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresRefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &postgresRefreshTokenRepository{db: db}
+}
+
+func (r *postgresRefreshTokenRepository) RevokeRefreshToken(ctx context.Context, id string, userID domain.UserID, expiresAt time.Time) (bool, error) {
+	db := r.db.WithContext(ctx)
+
+	// Tokens past their expiry are rejected anyway.
+	if err := db.Where("expires_at < ?", time.Now().UTC()).
+		Delete(&domain.RevokedRefreshTokenModel{}).Error; err != nil {
+		return false, err
+	}
+
+	model := domain.RevokedRefreshTokenModel{ID: id, UserID: userID, ExpiresAt: expiresAt.UTC()}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -2,12 +2,82 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/hawful70/shop-identity-service/internal/identity/domain"
 )
 
+// UserFilter narrows ListUsers. Zero fields match every user.
+type UserFilter struct {
+	Email             string
+	UsernameCanonical string
+	ExternalID        string
+	// SCIMUserName matches the userName users were provisioned with,
+	// ignoring case. Users without one match on their username or, for
+	// values that are email addresses, their email.
+	SCIMUserName string
+	// Roles matches users with any of the roles.
+	Roles     []domain.Role
+	Suspended *bool
+	// CreatedFrom and CreatedBefore bound created_at when set; the range
+	// includes CreatedFrom and excludes CreatedBefore.
+	CreatedFrom   time.Time
+	CreatedBefore time.Time
+}
+
+// PasswordChange replaces a user's password hash. It only applies while the
+// stored hash is still Previous, so a caller that checked the new password
+// against the current one and the history does not overwrite a change made
+// in between. When HistorySize is positive Previous is kept and history is
+// trimmed to that size.
+type PasswordChange struct {
+	Previous    string
+	Hash        string
+	ChangedAt   time.Time
+	HistorySize int
+}
+
+// ChangeCursor is a position in a tenant's users ordered by update time and
+// ID. The zero cursor is before every user.
+type ChangeCursor struct {
+	UpdatedAt time.Time
+	ID        domain.UserID
+}
+
 type Repository interface {
 	CreateUser(ctx context.Context, u domain.User) error
-	GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+	// CreateUsers inserts all users in one transaction, or none of them.
+	CreateUsers(ctx context.Context, users []domain.User) error
+	// Email and username lookups are scoped to a tenant; IDs are global.
+	GetUserByEmail(ctx context.Context, tenantID domain.TenantID, email string) (domain.User, error)
 	GetUserByID(ctx context.Context, id domain.UserID) (domain.User, error)
+	// GetUsersByIDs returns the users among ids that exist, in no particular
+	// order. Unknown IDs are skipped.
+	GetUsersByIDs(ctx context.Context, ids []domain.UserID) ([]domain.User, error)
+	// GetUserByUsername looks a user up by canonical (case-folded) username.
+	GetUserByUsername(ctx context.Context, tenantID domain.TenantID, canonical string) (domain.User, error)
+	// UsernameExists reports whether a user of the tenant other than except
+	// has name's canonical form or skeleton.
+	UsernameExists(ctx context.Context, tenantID domain.TenantID, name domain.Username, except domain.UserID) (bool, error)
+	EmailCanonicalExists(ctx context.Context, tenantID domain.TenantID, canonical string) (bool, error)
+	// UpdatePassword applies a password change, or fails with
+	// ErrPasswordChanged when the hash is no longer change.Previous.
+	UpdatePassword(ctx context.Context, id domain.UserID, change PasswordChange) error
+	// PasswordHistory returns up to limit previous hashes, newest first.
+	PasswordHistory(ctx context.Context, id domain.UserID, limit int) ([]string, error)
+	// ListUsers returns a page of a tenant's users ordered by creation and
+	// the total number of matches.
+	ListUsers(ctx context.Context, tenantID domain.TenantID, filter UserFilter, offset, limit int) ([]domain.User, int64, error)
+	// ListUsersChanged returns up to limit of a tenant's users updated after
+	// the cursor and before until, ordered by update time and ID.
+	ListUsersChanged(ctx context.Context, tenantID domain.TenantID, after ChangeCursor, until time.Time, limit int) ([]domain.User, error)
+	// UpdateUser saves profile, role and suspension changes. Passwords are
+	// changed with UpdatePassword.
+	UpdateUser(ctx context.Context, u domain.User) error
+	// UpdateUserAndPassword is UpdateUser and UpdatePassword in one
+	// transaction: either both apply or neither does.
+	UpdateUserAndPassword(ctx context.Context, u domain.User, change PasswordChange) error
+	// RevokeSessions bumps the user's session version so that every token
+	// issued before is rejected.
+	RevokeSessions(ctx context.Context, id domain.UserID) error
 }
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+var errDuplicateUserID = errors.New("duplicate user id")
+
+// memoryRepository keeps users in maps guarded by a mutex. It enforces the
+// same unique indexes as the Postgres schema and is meant for tests and
+// local development.
+type memoryRepository struct {
+	mu    sync.RWMutex
+	users map[domain.UserID]domain.User
+	// history holds previous password hashes per user, newest first.
+	history map[domain.UserID][]string
+	now     func() time.Time
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		users:   map[domain.UserID]domain.User{},
+		history: map[domain.UserID][]string{},
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// conflict reports which unique index u would violate, ignoring the user
+// with u's ID when updating. Callers hold the lock.
+func (r *memoryRepository) conflict(u domain.User, updating bool) error {
+	if _, ok := r.users[u.ID]; ok && !updating {
+		return errDuplicateUserID
+	}
+	for _, other := range r.users {
+		if other.ID == u.ID || other.TenantID != u.TenantID {
+			continue
+		}
+		switch {
+		case other.Email == u.Email,
+			u.EmailCanonical != "" && other.EmailCanonical == u.EmailCanonical:
+			return ErrEmailTaken
+		case u.UsernameSkeleton != "" && other.UsernameSkeleton == u.UsernameSkeleton,
+			u.UsernameCanonical != "" && other.UsernameCanonical == u.UsernameCanonical:
+			return ErrUsernameTaken
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, u domain.User) error {
+	return r.CreateUsers(ctx, []domain.User{u})
+}
+
+func (r *memoryRepository) CreateUsers(ctx context.Context, users []domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Insert one by one so that rows of the same batch conflict with each
+	// other, and roll back on the first error.
+	var added []domain.UserID
+	for _, u := range users {
+		if err := r.conflict(u, false); err != nil {
+			for _, id := range added {
+				delete(r.users, id)
+			}
+			return err
+		}
+		if u.TenantID == "" {
+			u.TenantID = domain.DefaultTenantID
+		}
+		r.users[u.ID] = u
+		added = append(added, u.ID)
+	}
+	return nil
+}
+
+func (r *memoryRepository) find(match func(domain.User) bool) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return domain.User{}, ErrUserNotFound
+}
+
+func (r *memoryRepository) GetUserByEmail(ctx context.Context, tenantID domain.TenantID, email string) (domain.User, error) {
+	return r.find(func(u domain.User) bool {
+		return u.TenantID == tenantID && u.Email == email
+	})
+}
+
+func (r *memoryRepository) GetUserByID(ctx context.Context, id domain.UserID) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return domain.User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *memoryRepository) GetUsersByIDs(ctx context.Context, ids []domain.UserID) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var users []domain.User
+	seen := map[domain.UserID]bool{}
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok && !seen[id] {
+			seen[id] = true
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryRepository) GetUserByUsername(ctx context.Context, tenantID domain.TenantID, canonical string) (domain.User, error) {
+	return r.find(func(u domain.User) bool {
+		return u.TenantID == tenantID && u.UsernameCanonical == canonical
+	})
+}
+
+func (r *memoryRepository) UsernameExists(ctx context.Context, tenantID domain.TenantID, name domain.Username, except domain.UserID) (bool, error) {
+	_, err := r.find(func(u domain.User) bool {
+		return u.TenantID == tenantID && u.ID != except &&
+			(u.UsernameCanonical == name.Canonical || u.UsernameSkeleton == name.Skeleton)
+	})
+	return err == nil, nil
+}
+
+func (r *memoryRepository) EmailCanonicalExists(ctx context.Context, tenantID domain.TenantID, canonical string) (bool, error) {
+	_, err := r.find(func(u domain.User) bool {
+		return u.TenantID == tenantID && u.EmailCanonical == canonical
+	})
+	return err == nil, nil
+}
+
+func (r *memoryRepository) UpdatePassword(ctx context.Context, id domain.UserID, change PasswordChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updatePassword(id, change)
+}
+
+// updatePassword is called with r.mu held.
+func (r *memoryRepository) updatePassword(id domain.UserID, change PasswordChange) error {
+	u, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if u.Password != change.Previous {
+		return ErrPasswordChanged
+	}
+	if change.HistorySize > 0 {
+		history := append([]string{u.Password}, r.history[id]...)
+		r.history[id] = history[:min(len(history), change.HistorySize)]
+	}
+
+	u.Password = change.Hash
+	u.PasswordChangedAt = change.ChangedAt
+	u.UpdatedAt = change.ChangedAt
+	r.users[id] = u
+	return nil
+}
+
+func (r *memoryRepository) PasswordHistory(ctx context.Context, id domain.UserID, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	history := r.history[id]
+	return slices.Clone(history[:min(len(history), limit)]), nil
+}
+
+func (r *memoryRepository) ListUsers(ctx context.Context, tenantID domain.TenantID, filter UserFilter, offset, limit int) ([]domain.User, int64, error) {
+	r.mu.RLock()
+	var matched []domain.User
+	for _, u := range r.users {
+		if u.TenantID == tenantID && filter.matches(u) {
+			matched = append(matched, u)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(matched, func(a, b domain.User) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	total := int64(len(matched))
+	start := min(max(offset, 0), len(matched))
+	end := len(matched)
+	if limit >= 0 {
+		end = min(start+limit, len(matched))
+	}
+	return matched[start:end], total, nil
+}
+
+func (r *memoryRepository) ListUsersChanged(ctx context.Context, tenantID domain.TenantID, after ChangeCursor, until time.Time, limit int) ([]domain.User, error) {
+	r.mu.RLock()
+	var changed []domain.User
+	for _, u := range r.users {
+		if u.TenantID == tenantID && u.UpdatedAt.Before(until) && compareCursor(u, after) > 0 {
+			changed = append(changed, u)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(changed, func(a, b domain.User) int {
+		return compareCursor(a, ChangeCursor{UpdatedAt: b.UpdatedAt, ID: b.ID})
+	})
+	return changed[:min(max(limit, 0), len(changed))], nil
+}
+
+// compareCursor orders u against a cursor by update time, then ID.
+func compareCursor(u domain.User, c ChangeCursor) int {
+	if n := u.UpdatedAt.Compare(c.UpdatedAt); n != 0 {
+		return n
+	}
+	return cmp.Compare(u.ID, c.ID)
+}
+
+// matches applies the filter the way the SQL implementations do.
+func (f UserFilter) matches(u domain.User) bool {
+	switch {
+	case f.Email != "" && u.Email != f.Email,
+		f.UsernameCanonical != "" && u.UsernameCanonical != f.UsernameCanonical,
+		f.ExternalID != "" && u.ExternalID != f.ExternalID,
+		f.SCIMUserName != "" && !f.matchesSCIMUserName(u),
+		len(f.Roles) > 0 && !slices.Contains(f.Roles, u.Role),
+		f.Suspended != nil && *f.Suspended != u.Suspended(),
+		!f.CreatedFrom.IsZero() && u.CreatedAt.Before(f.CreatedFrom),
+		!f.CreatedBefore.IsZero() && !u.CreatedAt.Before(f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func (f UserFilter) matchesSCIMUserName(u domain.User) bool {
+	if u.SCIMUserName != "" {
+		return strings.EqualFold(u.SCIMUserName, f.SCIMUserName)
+	}
+	email, err := domain.ParseEmail(f.SCIMUserName)
+	return u.UsernameCanonical == domain.CanonicalUsername(f.SCIMUserName) || (err == nil && u.Email == email)
+}
+
+func (r *memoryRepository) UpdateUser(ctx context.Context, u domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updateUser(u)
+}
+
+func (r *memoryRepository) UpdateUserAndPassword(ctx context.Context, u domain.User, change PasswordChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Check both before changing anything.
+	current, ok := r.users[u.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if current.Password != change.Previous {
+		return ErrPasswordChanged
+	}
+	u.TenantID = current.TenantID
+	if err := r.conflict(u, true); err != nil {
+		return err
+	}
+	if err := r.updateUser(u); err != nil {
+		return err
+	}
+	return r.updatePassword(u.ID, change)
+}
+
+// updateUser is called with r.mu held.
+func (r *memoryRepository) updateUser(u domain.User) error {
+	current, ok := r.users[u.ID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.TenantID = current.TenantID
+	if err := r.conflict(u, true); err != nil {
+		return err
+	}
+
+	// Only the columns the SQL implementations update.
+	current.Email = u.Email
+	current.EmailCanonical = u.EmailCanonical
+	current.Username = u.Username
+	current.UsernameCanonical = u.UsernameCanonical
+	current.UsernameSkeleton = u.UsernameSkeleton
+	current.ProviderID = u.ProviderID
+	current.Role = u.Role
+	current.ExternalID = u.ExternalID
+	current.SCIMUserName = u.SCIMUserName
+	current.SuspendedAt = u.SuspendedAt
+	current.SessionVersion = u.SessionVersion
+	current.UpdatedAt = u.UpdatedAt
+	r.users[u.ID] = current
+	return nil
+}
+
+func (r *memoryRepository) RevokeSessions(ctx context.Context, id domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.SessionVersion++
+	u.UpdatedAt = r.now()
+	r.users[id] = u
+	return nil
+}
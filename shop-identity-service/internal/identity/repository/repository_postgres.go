@@ -3,13 +3,46 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 
 	"github.com/hawful70/shop-identity-service/internal/identity/domain"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrEmailTaken    = errors.New("email is already registered")
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrPasswordChanged is returned when the password changed since it was
+	// read, so a reuse check may have missed the new hash.
+	ErrPasswordChanged = errors.New("password was changed concurrently")
+)
+
+// createUsersBatchSize keeps each INSERT well below Postgres' limit of 65535
+// bind parameters.
+const createUsersBatchSize = 500
+
+// pgUniqueViolation is the SQLSTATE for unique_violation.
+const pgUniqueViolation = "23505"
+
+// translateUniqueViolation maps unique index violations on users to the
+// matching sentinel error, so a lost registration race is reported the same
+// way as a failed pre-check.
+func translateUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != pgUniqueViolation {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "idx_users_tenant_username_skeleton", "idx_users_tenant_username_canonical":
+		return ErrUsernameTaken
+	case "idx_users_tenant_email", "idx_users_tenant_email_canonical":
+		return ErrEmailTaken
+	}
+	return err
+}
 
 type postgresRepository struct {
 	db *gorm.DB
@@ -21,12 +54,25 @@ func NewPostgresRepository(db *gorm.DB) Repository {
 
 func (r *postgresRepository) CreateUser(ctx context.Context, u domain.User) error {
 	model := domain.ToUserModel(u)
-	return r.db.WithContext(ctx).Create(&model).Error
+	return translateUniqueViolation(r.db.WithContext(ctx).Create(&model).Error)
+}
+
+func (r *postgresRepository) CreateUsers(ctx context.Context, users []domain.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	models := make([]domain.UserModel, 0, len(users))
+	for _, u := range users {
+		models = append(models, domain.ToUserModel(u))
+	}
+	return translateUniqueViolation(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(&models, createUsersBatchSize).Error
+	}))
 }
 
-func (r *postgresRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+func (r *postgresRepository) GetUserByEmail(ctx context.Context, tenantID domain.TenantID, email string) (domain.User, error) {
 	var model domain.UserModel
-	err := r.db.WithContext(ctx).Where("email = ?", email).First(&model).Error
+	err := r.db.WithContext(ctx).Where("tenant_id = ? AND email = ?", tenantID, email).First(&model).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.User{}, ErrUserNotFound
@@ -48,3 +94,238 @@ func (r *postgresRepository) GetUserByID(ctx context.Context, id domain.UserID)
 	}
 	return model.ToDomain(), nil
 }
+
+func (r *postgresRepository) GetUsersByIDs(ctx context.Context, ids []domain.UserID) ([]domain.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var models []domain.UserModel
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&models).Error; err != nil {
+		return nil, err
+	}
+	users := make([]domain.User, 0, len(models))
+	for _, m := range models {
+		users = append(users, m.ToDomain())
+	}
+	return users, nil
+}
+
+func (r *postgresRepository) GetUserByUsername(ctx context.Context, tenantID domain.TenantID, canonical string) (domain.User, error) {
+	var model domain.UserModel
+	err := r.db.WithContext(ctx).Where("tenant_id = ? AND username_canonical = ?", tenantID, canonical).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresRepository) UsernameExists(ctx context.Context, tenantID domain.TenantID, name domain.Username, except domain.UserID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&domain.UserModel{}).
+		Where("tenant_id = ? AND id <> ? AND (username_canonical = ? OR username_skeleton = ?)", tenantID, except, name.Canonical, name.Skeleton).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *postgresRepository) EmailCanonicalExists(ctx context.Context, tenantID domain.TenantID, canonical string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&domain.UserModel{}).
+		Where("tenant_id = ? AND email_canonical = ?", tenantID, canonical).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *postgresRepository) UpdatePassword(ctx context.Context, id domain.UserID, change PasswordChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updatePassword(tx, id, change)
+	})
+}
+
+// updatePassword runs in a transaction. The conditional update is the
+// compare and swap: it only matches while the hash is still the previous
+// one, and it holds the row until the history is written.
+func updatePassword(tx *gorm.DB, id domain.UserID, change PasswordChange) error {
+	res := tx.Model(&domain.UserModel{}).
+		Where("id = ? AND password = ?", id, change.Previous).
+		Updates(map[string]any{
+			"password":            change.Hash,
+			"password_changed_at": change.ChangedAt,
+			"updated_at":          change.ChangedAt,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var n int64
+		if err := tx.Model(&domain.UserModel{}).Where("id = ?", id).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		return ErrPasswordChanged
+	}
+	if change.HistorySize <= 0 {
+		return nil
+	}
+
+	entry := domain.PasswordHistoryModel{
+		UserID:       string(id),
+		PasswordHash: change.Previous,
+		CreatedAt:    change.ChangedAt,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	keep := tx.Model(&domain.PasswordHistoryModel{}).
+		Select("id").
+		Where("user_id = ?", id).
+		Order("created_at DESC, id DESC").
+		Limit(change.HistorySize)
+	return tx.Where("user_id = ? AND id NOT IN (?)", id, keep).
+		Delete(&domain.PasswordHistoryModel{}).Error
+}
+
+func (r *postgresRepository) PasswordHistory(ctx context.Context, id domain.UserID, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var hashes []string
+	err := r.db.WithContext(ctx).
+		Model(&domain.PasswordHistoryModel{}).
+		Where("user_id = ?", id).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (r *postgresRepository) ListUsers(ctx context.Context, tenantID domain.TenantID, filter UserFilter, offset, limit int) ([]domain.User, int64, error) {
+	q := r.db.WithContext(ctx).Model(&domain.UserModel{}).Where("tenant_id = ?", tenantID)
+	if filter.Email != "" {
+		q = q.Where("email = ?", filter.Email)
+	}
+	if filter.UsernameCanonical != "" {
+		q = q.Where("username_canonical = ?", filter.UsernameCanonical)
+	}
+	if filter.ExternalID != "" {
+		q = q.Where("external_id = ?", filter.ExternalID)
+	}
+	if filter.SCIMUserName != "" {
+		email, _ := domain.ParseEmail(filter.SCIMUserName)
+		q = q.Where("(scim_user_name <> '' AND LOWER(scim_user_name) = LOWER(?)) OR (scim_user_name = '' AND (username_canonical = ? OR email = ?))",
+			filter.SCIMUserName, domain.CanonicalUsername(filter.SCIMUserName), email)
+	}
+	if len(filter.Roles) > 0 {
+		q = q.Where("role IN ?", filter.Roles)
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			q = q.Where("suspended_at IS NOT NULL")
+		} else {
+			q = q.Where("suspended_at IS NULL")
+		}
+	}
+	if !filter.CreatedFrom.IsZero() {
+		q = q.Where("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		q = q.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var models []domain.UserModel
+	if err := q.Order("created_at, id").Offset(offset).Limit(limit).Find(&models).Error; err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]domain.User, 0, len(models))
+	for _, m := range models {
+		users = append(users, m.ToDomain())
+	}
+	return users, total, nil
+}
+
+func (r *postgresRepository) ListUsersChanged(ctx context.Context, tenantID domain.TenantID, after ChangeCursor, until time.Time, limit int) ([]domain.User, error) {
+	var models []domain.UserModel
+	err := r.db.WithContext(ctx).
+		Where("tenant_id = ? AND updated_at < ?", tenantID, until).
+		Where("updated_at > ? OR (updated_at = ? AND id > ?)", after.UpdatedAt, after.UpdatedAt, after.ID).
+		Order("updated_at, id").
+		Limit(limit).
+		Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]domain.User, 0, len(models))
+	for _, m := range models {
+		users = append(users, m.ToDomain())
+	}
+	return users, nil
+}
+
+func (r *postgresRepository) UpdateUser(ctx context.Context, u domain.User) error {
+	return updateUser(r.db.WithContext(ctx), u)
+}
+
+func (r *postgresRepository) UpdateUserAndPassword(ctx context.Context, u domain.User, change PasswordChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updatePassword(tx, u.ID, change); err != nil {
+			return err
+		}
+		return updateUser(tx, u)
+	})
+}
+
+func updateUser(db *gorm.DB, u domain.User) error {
+	model := domain.ToUserModel(u)
+	res := db.
+		Model(&domain.UserModel{ID: model.ID}).
+		Select("email", "email_canonical", "username", "username_canonical", "username_skeleton",
+			"provider_id", "role", "external_id", "scim_user_name", "suspended_at", "session_version", "updated_at").
+		Updates(&model)
+	if res.Error != nil {
+		return translateUniqueViolation(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) RevokeSessions(ctx context.Context, id domain.UserID) error {
+	res := r.db.WithContext(ctx).
+		Model(&domain.UserModel{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"session_version": gorm.Expr("session_version + 1"),
+			"updated_at":      time.Now().UTC(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// OpenSQLite opens a SQLite database, pure Go and without cgo, and creates
+// the schema if needed. SQLite is meant for tests and local development;
+// production runs on Postgres with versioned migrations.
+//
+// Transactions take the write lock when they begin unless the DSN sets
+// _txlock, so that concurrent transactions that read before they write
+// wait for each other instead of failing with SQLITE_BUSY.
+func OpenSQLite(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	if !strings.Contains(dsn, "_txlock=") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_txlock=immediate"
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Exec(sqliteSchema).Error; err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// translateSQLiteUniqueViolation is translateUniqueViolation for SQLite,
+// which names the columns of the violated index rather than the index.
+func translateSQLiteUniqueViolation(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "UNIQUE constraint failed") {
+		return err
+	}
+	switch {
+	case strings.Contains(msg, "users.username_skeleton"), strings.Contains(msg, "users.username_canonical"):
+		return ErrUsernameTaken
+	case strings.Contains(msg, "users.email"):
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// sqliteRepository runs the GORM queries of the Postgres repository, which
+// are portable, and only translates errors differently.
+type sqliteRepository struct {
+	*postgresRepository
+}
+
+// NewSQLiteRepository expects a database opened with OpenSQLite.
+func NewSQLiteRepository(db *gorm.DB) Repository {
+	return &sqliteRepository{postgresRepository: &postgresRepository{db: db}}
+}
+
+func (r *sqliteRepository) CreateUser(ctx context.Context, u domain.User) error {
+	return translateSQLiteUniqueViolation(r.postgresRepository.CreateUser(ctx, u))
+}
+
+func (r *sqliteRepository) CreateUsers(ctx context.Context, users []domain.User) error {
+	return translateSQLiteUniqueViolation(r.postgresRepository.CreateUsers(ctx, users))
+}
+
+func (r *sqliteRepository) UpdateUser(ctx context.Context, u domain.User) error {
+	err := r.postgresRepository.UpdateUser(ctx, u)
+	if errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	return translateSQLiteUniqueViolation(err)
+}
+
+func (r *sqliteRepository) UpdateUserAndPassword(ctx context.Context, u domain.User, change PasswordChange) error {
+	err := r.postgresRepository.UpdateUserAndPassword(ctx, u, change)
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrPasswordChanged) {
+		return err
+	}
+	return translateSQLiteUniqueViolation(err)
+}
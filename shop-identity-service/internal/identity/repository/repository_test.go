@@ -0,0 +1,83 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository/repositorytest"
+	"github.com/hawful70/shop-identity-service/internal/migrate"
+	"github.com/hawful70/shop-identity-service/migrations"
+)
+
+var quiet = &gorm.Config{Logger: logger.Discard}
+
+func TestMemoryRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+// The cache is tiny so that the suite exercises evictions too.
+func TestCachedRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewCachedRepository(repository.NewMemoryRepository(), repository.NewLRUUserCache(2))
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		db, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "identity.db"), quiet)
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		return repository.NewSQLiteRepository(db)
+	})
+}
+
+// TestPostgresRepository runs against IDENTITY_TEST_POSTGRES_DSN, which must
+// point at a disposable database: every subtest starts by emptying users.
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("IDENTITY_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("IDENTITY_TEST_POSTGRES_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), quiet)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrate.New(sqlDB, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		for _, table := range []string{"password_history", "users"} {
+			if err := db.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+				t.Fatalf("empty %s: %v", table, err)
+			}
+		}
+		return repository.NewPostgresRepository(db)
+	})
+}
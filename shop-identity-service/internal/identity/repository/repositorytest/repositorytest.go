@@ -0,0 +1,708 @@
+// Package repositorytest is the conformance suite for implementations of
+// repository.Repository. Every implementation runs it from its tests:
+//
+//	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+//		return repository.NewMemoryRepository()
+//	})
+package repositorytest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// Factory returns an empty repository. It is called once per subtest.
+type Factory func(t *testing.T) repository.Repository
+
+// Run runs every conformance test against repositories from newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.Repository)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"NotFound", testNotFound},
+		{"UniqueEmail", testUniqueEmail},
+		{"UniqueCanonicalEmail", testUniqueCanonicalEmail},
+		{"UniqueUsername", testUniqueUsername},
+		{"CreateUsersIsAtomic", testCreateUsersIsAtomic},
+		{"ExistenceChecks", testExistenceChecks},
+		{"UsernameExists", testUsernameExists},
+		{"PasswordHistory", testPasswordHistory},
+		{"PasswordChangeIsConditional", testPasswordChangeIsConditional},
+		{"ListUsers", testListUsers},
+		{"UpdateUser", testUpdateUser},
+		{"UpdateUserAndPassword", testUpdateUserAndPassword},
+		{"RevokeSessions", testRevokeSessions},
+		{"GetUsersByIDs", testGetUsersByIDs},
+		{"ListUsersChanged", testListUsersChanged},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepo(t))
+		})
+	}
+}
+
+// baseTime is truncated to milliseconds, which every backend stores exactly.
+var baseTime = time.Date(2026, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
+
+// newUser builds a valid user named name in tenant, created n seconds after
+// baseTime.
+func newUser(t *testing.T, tenant domain.TenantID, name string, n int) domain.User {
+	t.Helper()
+	u, err := domain.NewUser(name+"@example.com", name, "$2a$10$hash-"+name)
+	if err != nil {
+		t.Fatalf("NewUser(%q): %v", name, err)
+	}
+	at := baseTime.Add(time.Duration(n) * time.Second)
+	u.ID = domain.UserID(fmt.Sprintf("%s-%s", tenant, name))
+	u.TenantID = tenant
+	u.EmailCanonical = u.Email
+	u.CreatedAt, u.UpdatedAt, u.PasswordChangedAt = at, at, at
+	return u
+}
+
+func mustCreate(t *testing.T, repo repository.Repository, users ...domain.User) {
+	t.Helper()
+	for _, u := range users {
+		if err := repo.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("CreateUser(%s): %v", u.ID, err)
+		}
+	}
+}
+
+func assertUser(t *testing.T, got, want domain.User) {
+	t.Helper()
+	switch {
+	case got.ID != want.ID,
+		got.TenantID != want.TenantID,
+		got.Email != want.Email,
+		got.EmailCanonical != want.EmailCanonical,
+		got.Username != want.Username,
+		got.UsernameCanonical != want.UsernameCanonical,
+		got.UsernameSkeleton != want.UsernameSkeleton,
+		got.Password != want.Password,
+		got.Provider != want.Provider,
+		got.ProviderID != want.ProviderID,
+		got.Role != want.Role,
+		got.ExternalID != want.ExternalID,
+		got.SCIMUserName != want.SCIMUserName,
+		got.SessionVersion != want.SessionVersion,
+		got.Suspended() != want.Suspended(),
+		!got.CreatedAt.Equal(want.CreatedAt),
+		!got.PasswordChangedAt.Equal(want.PasswordChangedAt):
+		t.Fatalf("user mismatch\n got: %+v\nwant: %+v", got, want)
+	}
+	if want.SuspendedAt != nil && !got.SuspendedAt.Equal(*want.SuspendedAt) {
+		t.Fatalf("SuspendedAt = %v, want %v", got.SuspendedAt, want.SuspendedAt)
+	}
+}
+
+func assertErr(t *testing.T, op string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("%s: got error %v, want %v", op, err, want)
+	}
+}
+
+func testCreateAndGet(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	u.Role = domain.RoleSeller
+	u.ExternalID = "ext-1"
+	suspendedAt := baseTime.Add(time.Hour)
+	u.SuspendedAt = &suspendedAt
+	mustCreate(t, repo, u)
+
+	got, err := repo.GetUserByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	assertUser(t, got, u)
+
+	got, err = repo.GetUserByEmail(ctx, u.TenantID, u.Email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	assertUser(t, got, u)
+
+	got, err = repo.GetUserByUsername(ctx, u.TenantID, u.UsernameCanonical)
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	assertUser(t, got, u)
+}
+
+func testNotFound(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+
+	_, err := repo.GetUserByID(ctx, "missing")
+	assertErr(t, "GetUserByID", err, repository.ErrUserNotFound)
+	_, err = repo.GetUserByEmail(ctx, u.TenantID, "missing@example.com")
+	assertErr(t, "GetUserByEmail", err, repository.ErrUserNotFound)
+	_, err = repo.GetUserByUsername(ctx, u.TenantID, "missing")
+	assertErr(t, "GetUserByUsername", err, repository.ErrUserNotFound)
+
+	// Lookups by email and username do not cross tenants.
+	_, err = repo.GetUserByEmail(ctx, "other", u.Email)
+	assertErr(t, "GetUserByEmail in other tenant", err, repository.ErrUserNotFound)
+	_, err = repo.GetUserByUsername(ctx, "other", u.UsernameCanonical)
+	assertErr(t, "GetUserByUsername in other tenant", err, repository.ErrUserNotFound)
+
+	err = repo.UpdatePassword(ctx, "missing", repository.PasswordChange{Hash: "hash", ChangedAt: baseTime, HistorySize: 3})
+	assertErr(t, "UpdatePassword", err, repository.ErrUserNotFound)
+	err = repo.UpdateUser(ctx, newUser(t, domain.DefaultTenantID, "missing", 0))
+	assertErr(t, "UpdateUser", err, repository.ErrUserNotFound)
+	err = repo.RevokeSessions(ctx, "missing")
+	assertErr(t, "RevokeSessions", err, repository.ErrUserNotFound)
+}
+
+func testUniqueEmail(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser(t, domain.DefaultTenantID, "alice", 0))
+
+	dup := newUser(t, domain.DefaultTenantID, "bob", 1)
+	dup.Email = "alice@example.com"
+	dup.EmailCanonical = ""
+	assertErr(t, "CreateUser with taken email", repo.CreateUser(ctx, dup), repository.ErrEmailTaken)
+
+	// The same email is free in another tenant.
+	mustCreate(t, repo, newUser(t, "other", "alice", 2))
+}
+
+func testUniqueCanonicalEmail(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser(t, domain.DefaultTenantID, "alice", 0))
+
+	alias := newUser(t, domain.DefaultTenantID, "bob", 1)
+	alias.Email = "alice+shop@example.com"
+	alias.EmailCanonical = "alice@example.com"
+	assertErr(t, "CreateUser with taken canonical email", repo.CreateUser(ctx, alias), repository.ErrEmailTaken)
+
+	// Legacy rows without a canonical email do not conflict with each other.
+	legacy1 := newUser(t, domain.DefaultTenantID, "carol", 2)
+	legacy1.EmailCanonical = ""
+	legacy2 := newUser(t, domain.DefaultTenantID, "dave", 3)
+	legacy2.EmailCanonical = ""
+	mustCreate(t, repo, legacy1, legacy2)
+}
+
+func testUniqueUsername(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser(t, domain.DefaultTenantID, "alice", 0))
+
+	dup := newUser(t, domain.DefaultTenantID, "bob", 1)
+	dup.Username, dup.UsernameCanonical, dup.UsernameSkeleton = "Alice", "alice", "alice"
+	assertErr(t, "CreateUser with taken username", repo.CreateUser(ctx, dup), repository.ErrUsernameTaken)
+
+	// Either form on its own is taken.
+	dup.UsernameSkeleton = "other"
+	assertErr(t, "CreateUser with taken canonical username", repo.CreateUser(ctx, dup), repository.ErrUsernameTaken)
+	dup.UsernameCanonical, dup.UsernameSkeleton = "other", "alice"
+	assertErr(t, "CreateUser with taken username skeleton", repo.CreateUser(ctx, dup), repository.ErrUsernameTaken)
+
+	mustCreate(t, repo, newUser(t, "other", "alice", 2))
+}
+
+func testCreateUsersIsAtomic(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	mustCreate(t, repo, newUser(t, domain.DefaultTenantID, "alice", 0))
+
+	if err := repo.CreateUsers(ctx, nil); err != nil {
+		t.Fatalf("CreateUsers(nil): %v", err)
+	}
+
+	dup := newUser(t, domain.DefaultTenantID, "carol", 3)
+	dup.Email = "alice@example.com"
+	dup.EmailCanonical = "alice@example.com"
+	batch := []domain.User{
+		newUser(t, domain.DefaultTenantID, "bob", 1),
+		dup,
+	}
+	assertErr(t, "CreateUsers with a taken email", repo.CreateUsers(ctx, batch), repository.ErrEmailTaken)
+	if _, err := repo.GetUserByID(ctx, batch[0].ID); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("first user of a failed batch was stored: %v", err)
+	}
+
+	// Rows of one batch conflict with each other too.
+	twin := newUser(t, domain.DefaultTenantID, "frank", 5)
+	twin.Email, twin.EmailCanonical = "erin@example.com", "erin@example.com"
+	err := repo.CreateUsers(ctx, []domain.User{newUser(t, domain.DefaultTenantID, "erin", 4), twin})
+	assertErr(t, "CreateUsers with duplicate rows", err, repository.ErrEmailTaken)
+
+	batch = []domain.User{
+		newUser(t, domain.DefaultTenantID, "bob", 1),
+		newUser(t, domain.DefaultTenantID, "carol", 2),
+	}
+	if err := repo.CreateUsers(ctx, batch); err != nil {
+		t.Fatalf("CreateUsers: %v", err)
+	}
+	for _, u := range batch {
+		got, err := repo.GetUserByID(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID(%s): %v", u.ID, err)
+		}
+		assertUser(t, got, u)
+	}
+}
+
+func testExistenceChecks(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+
+	checks := []struct {
+		name string
+		fn   func(domain.TenantID, string) (bool, error)
+		arg  string
+	}{
+		{"EmailCanonicalExists", func(id domain.TenantID, s string) (bool, error) {
+			return repo.EmailCanonicalExists(ctx, id, s)
+		}, u.EmailCanonical},
+	}
+	for _, c := range checks {
+		for _, tc := range []struct {
+			tenant domain.TenantID
+			arg    string
+			want   bool
+		}{
+			{u.TenantID, c.arg, true},
+			{u.TenantID, "nobody", false},
+			{"other", c.arg, false},
+		} {
+			got, err := c.fn(tc.tenant, tc.arg)
+			if err != nil {
+				t.Fatalf("%s(%s, %s): %v", c.name, tc.tenant, tc.arg, err)
+			}
+			if got != tc.want {
+				t.Fatalf("%s(%s, %s) = %v, want %v", c.name, tc.tenant, tc.arg, got, tc.want)
+			}
+		}
+	}
+}
+
+func testUsernameExists(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+
+	tests := []struct {
+		name   string
+		tenant domain.TenantID
+		lookup domain.Username
+		except domain.UserID
+		want   bool
+	}{
+		{"both forms", u.TenantID, domain.Username{Canonical: "alice", Skeleton: "alice"}, "", true},
+		{"canonical form", u.TenantID, domain.Username{Canonical: "alice", Skeleton: "other"}, "", true},
+		{"skeleton", u.TenantID, domain.Username{Canonical: "other", Skeleton: "alice"}, "", true},
+		{"nobody", u.TenantID, domain.Username{Canonical: "nobody", Skeleton: "nobody"}, "", false},
+		{"other tenant", "other", domain.Username{Canonical: "alice", Skeleton: "alice"}, "", false},
+		{"own username", u.TenantID, domain.Username{Canonical: "alice", Skeleton: "alice"}, u.ID, false},
+	}
+	for _, tc := range tests {
+		got, err := repo.UsernameExists(ctx, tc.tenant, tc.lookup, tc.except)
+		if err != nil {
+			t.Fatalf("UsernameExists (%s): %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("UsernameExists (%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func testPasswordHistory(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+
+	// Without history nothing is remembered.
+	change := repository.PasswordChange{Previous: u.Password, Hash: "hash-1", ChangedAt: baseTime.Add(time.Minute)}
+	if err := repo.UpdatePassword(ctx, u.ID, change); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if h, err := repo.PasswordHistory(ctx, u.ID, 5); err != nil || len(h) != 0 {
+		t.Fatalf("PasswordHistory = %v, %v; want empty", h, err)
+	}
+
+	for i := 2; i <= 5; i++ {
+		changedAt := baseTime.Add(time.Duration(i) * time.Minute)
+		change := repository.PasswordChange{Previous: fmt.Sprintf("hash-%d", i-1), Hash: fmt.Sprintf("hash-%d", i), ChangedAt: changedAt, HistorySize: 3}
+		if err := repo.UpdatePassword(ctx, u.ID, change); err != nil {
+			t.Fatalf("UpdatePassword: %v", err)
+		}
+	}
+
+	got, err := repo.GetUserByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.Password != "hash-5" || !got.PasswordChangedAt.Equal(baseTime.Add(5*time.Minute)) {
+		t.Fatalf("password = %q changed at %v, want hash-5 at %v", got.Password, got.PasswordChangedAt, baseTime.Add(5*time.Minute))
+	}
+
+	history, err := repo.PasswordHistory(ctx, u.ID, 10)
+	if err != nil {
+		t.Fatalf("PasswordHistory: %v", err)
+	}
+	want := []string{"hash-4", "hash-3", "hash-2"}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Fatalf("PasswordHistory = %v, want %v (newest first, trimmed to 3)", history, want)
+	}
+
+	history, err = repo.PasswordHistory(ctx, u.ID, 1)
+	if err != nil || fmt.Sprint(history) != "[hash-4]" {
+		t.Fatalf("PasswordHistory(limit 1) = %v, %v; want [hash-4]", history, err)
+	}
+	if history, err := repo.PasswordHistory(ctx, u.ID, 0); err != nil || len(history) != 0 {
+		t.Fatalf("PasswordHistory(limit 0) = %v, %v; want empty", history, err)
+	}
+}
+
+func testPasswordChangeIsConditional(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+	change := repository.PasswordChange{Previous: u.Password, Hash: "hash-1", ChangedAt: baseTime.Add(time.Minute), HistorySize: 2}
+	if err := repo.UpdatePassword(ctx, u.ID, change); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+
+	// A change based on a hash that is no longer current writes nothing.
+	stale := repository.PasswordChange{Previous: u.Password, Hash: "hash-2", ChangedAt: baseTime.Add(2 * time.Minute), HistorySize: 2}
+	if err := repo.UpdatePassword(ctx, u.ID, stale); !errors.Is(err, repository.ErrPasswordChanged) {
+		t.Fatalf("UpdatePassword from a stale hash: err = %v, want ErrPasswordChanged", err)
+	}
+	got, err := repo.GetUserByID(ctx, u.ID)
+	if err != nil || got.Password != "hash-1" {
+		t.Fatalf("password after a stale change = %q, %v; want hash-1", got.Password, err)
+	}
+	if history, err := repo.PasswordHistory(ctx, u.ID, 10); err != nil || fmt.Sprint(history) != fmt.Sprint([]string{u.Password}) {
+		t.Fatalf("PasswordHistory after a stale change = %v, %v; want only the first hash", history, err)
+	}
+
+	// Of concurrent changes from the same hash exactly one applies.
+	const changes = 8
+	errs := make([]error, changes)
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = repo.UpdatePassword(ctx, u.ID, repository.PasswordChange{
+				Previous:    "hash-1",
+				Hash:        fmt.Sprintf("concurrent-%d", i),
+				ChangedAt:   baseTime.Add(time.Hour),
+				HistorySize: 2,
+			})
+		}()
+	}
+	wg.Wait()
+	applied := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			applied++
+		case !errors.Is(err, repository.ErrPasswordChanged):
+			t.Fatalf("concurrent UpdatePassword: %v", err)
+		}
+	}
+	if applied != 1 {
+		t.Fatalf("%d of %d concurrent changes applied, want 1", applied, changes)
+	}
+}
+
+func testListUsers(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	tenant := domain.TenantID("acme")
+
+	var all []domain.User
+	for i, name := range []string{"erin", "dave", "carol", "bob", "alice"} {
+		u := newUser(t, tenant, name, i)
+		if i%2 == 0 {
+			u.Role = domain.RoleSeller
+		}
+		all = append(all, u)
+	}
+	suspendedAt := baseTime
+	all[1].SuspendedAt = &suspendedAt
+	all[2].ExternalID = "ext-carol"
+	all[3].SCIMUserName = "Bob.Smith@Example.com"
+	mustCreate(t, repo, all...)
+	mustCreate(t, repo, newUser(t, "other", "zed", 0))
+
+	ids := func(users []domain.User) string {
+		var out []domain.UserID
+		for _, u := range users {
+			out = append(out, u.ID)
+		}
+		return fmt.Sprint(out)
+	}
+	suspended, active := true, false
+
+	tests := []struct {
+		name          string
+		filter        repository.UserFilter
+		offset, limit int
+		want          []domain.User
+		total         int64
+	}{
+		{"all in creation order", repository.UserFilter{}, 0, 10, all, 5},
+		{"page", repository.UserFilter{}, 1, 2, all[1:3], 5},
+		{"past the end", repository.UserFilter{}, 10, 2, nil, 5},
+		{"email", repository.UserFilter{Email: "bob@example.com"}, 0, 10, all[3:4], 1},
+		{"username", repository.UserFilter{UsernameCanonical: "alice"}, 0, 10, all[4:5], 1},
+		{"external id", repository.UserFilter{ExternalID: "ext-carol"}, 0, 10, all[2:3], 1},
+		{"scim userName", repository.UserFilter{SCIMUserName: "bob.smith@example.com"}, 0, 10, all[3:4], 1},
+		{"scim userName not a username", repository.UserFilter{SCIMUserName: "bob"}, 0, 10, nil, 0},
+		{"scim userName falls back to username", repository.UserFilter{SCIMUserName: "Alice"}, 0, 10, all[4:5], 1},
+		{"scim userName falls back to email", repository.UserFilter{SCIMUserName: "carol@example.com"}, 0, 10, all[2:3], 1},
+		{"roles", repository.UserFilter{Roles: []domain.Role{domain.RoleSeller}}, 0, 10, []domain.User{all[0], all[2], all[4]}, 3},
+		{"suspended", repository.UserFilter{Suspended: &suspended}, 0, 10, all[1:2], 1},
+		{"active", repository.UserFilter{Suspended: &active}, 0, 1, all[0:1], 4},
+		{"created range", repository.UserFilter{CreatedFrom: all[1].CreatedAt, CreatedBefore: all[3].CreatedAt}, 0, 10, all[1:3], 2},
+		{"combined", repository.UserFilter{Roles: []domain.Role{domain.RoleCustomer}, Suspended: &active}, 0, 10, all[3:4], 1},
+	}
+	for _, tc := range tests {
+		got, total, err := repo.ListUsers(ctx, tenant, tc.filter, tc.offset, tc.limit)
+		if err != nil {
+			t.Fatalf("%s: ListUsers: %v", tc.name, err)
+		}
+		if ids(got) != ids(tc.want) || total != tc.total {
+			t.Fatalf("%s: ListUsers = %s (total %d), want %s (total %d)", tc.name, ids(got), total, ids(tc.want), tc.total)
+		}
+	}
+}
+
+func testUpdateUser(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := newUser(t, domain.DefaultTenantID, "alice", 0)
+	bob := newUser(t, domain.DefaultTenantID, "bob", 1)
+	mustCreate(t, repo, alice, bob)
+
+	updated := alice
+	updated.Email, updated.EmailCanonical = "alicia@example.com", "alicia@example.com"
+	updated.Username, updated.UsernameCanonical, updated.UsernameSkeleton = "alicia", "alicia", "alicia"
+	updated.Role = domain.RoleSeller
+	updated.ExternalID = "ext-alicia"
+	updated.SCIMUserName = "alicia@example.com"
+	suspendedAt := baseTime.Add(time.Hour)
+	updated.SuspendedAt = &suspendedAt
+	updated.SessionVersion = 3
+	updated.UpdatedAt = baseTime.Add(time.Hour)
+	// UpdateUser leaves the password alone.
+	updated.Password = "ignored"
+	if err := repo.UpdateUser(ctx, updated); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	got, err := repo.GetUserByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	updated.Password = alice.Password
+	assertUser(t, got, updated)
+
+	// Clearing the suspension is saved as well.
+	updated.SuspendedAt = nil
+	if err := repo.UpdateUser(ctx, updated); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if got, _ := repo.GetUserByID(ctx, alice.ID); got.Suspended() {
+		t.Fatalf("user is still suspended after clearing SuspendedAt")
+	}
+
+	taken := bob
+	taken.Email, taken.EmailCanonical = updated.Email, updated.EmailCanonical
+	assertErr(t, "UpdateUser to a taken email", repo.UpdateUser(ctx, taken), repository.ErrEmailTaken)
+
+	taken = bob
+	taken.Username, taken.UsernameCanonical, taken.UsernameSkeleton = "Alicia", "alicia", "alicia"
+	assertErr(t, "UpdateUser to a taken username", repo.UpdateUser(ctx, taken), repository.ErrUsernameTaken)
+}
+
+func testUpdateUserAndPassword(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := newUser(t, domain.DefaultTenantID, "alice", 0)
+	bob := newUser(t, domain.DefaultTenantID, "bob", 1)
+	mustCreate(t, repo, alice, bob)
+	changedAt := baseTime.Add(time.Hour)
+
+	// Neither write applies when the other fails.
+	taken := alice
+	taken.Email, taken.EmailCanonical = bob.Email, bob.EmailCanonical
+	change := repository.PasswordChange{Previous: alice.Password, Hash: "hash-1", ChangedAt: changedAt, HistorySize: 2}
+	assertErr(t, "UpdateUserAndPassword to a taken email", repo.UpdateUserAndPassword(ctx, taken, change), repository.ErrEmailTaken)
+	stale := alice
+	stale.Role = domain.RoleSeller
+	staleChange := repository.PasswordChange{Previous: "other", Hash: "hash-1", ChangedAt: changedAt, HistorySize: 2}
+	assertErr(t, "UpdateUserAndPassword from a stale hash", repo.UpdateUserAndPassword(ctx, stale, staleChange), repository.ErrPasswordChanged)
+	got, err := repo.GetUserByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	assertUser(t, got, alice)
+	if history, err := repo.PasswordHistory(ctx, alice.ID, 10); err != nil || len(history) != 0 {
+		t.Fatalf("PasswordHistory after failed updates = %v, %v; want none", history, err)
+	}
+
+	updated := alice
+	updated.Role = domain.RoleSeller
+	updated.ExternalID = "ext-alice"
+	updated.UpdatedAt = changedAt
+	if err := repo.UpdateUserAndPassword(ctx, updated, change); err != nil {
+		t.Fatalf("UpdateUserAndPassword: %v", err)
+	}
+	if got, err = repo.GetUserByID(ctx, alice.ID); err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	updated.Password, updated.PasswordChangedAt = "hash-1", changedAt
+	assertUser(t, got, updated)
+	if history, err := repo.PasswordHistory(ctx, alice.ID, 10); err != nil || fmt.Sprint(history) != fmt.Sprint([]string{alice.Password}) {
+		t.Fatalf("PasswordHistory = %v, %v; want the previous hash", history, err)
+	}
+
+	assertErr(t, "UpdateUserAndPassword of an unknown user", repo.UpdateUserAndPassword(ctx, newUser(t, domain.DefaultTenantID, "nobody", 2), change), repository.ErrUserNotFound)
+}
+
+func testRevokeSessions(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	u := newUser(t, domain.DefaultTenantID, "alice", 0)
+	mustCreate(t, repo, u)
+
+	for i := 1; i <= 2; i++ {
+		if err := repo.RevokeSessions(ctx, u.ID); err != nil {
+			t.Fatalf("RevokeSessions: %v", err)
+		}
+		got, err := repo.GetUserByID(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		if got.SessionVersion != i {
+			t.Fatalf("SessionVersion = %d, want %d", got.SessionVersion, i)
+		}
+	}
+}
+
+func sortedIDs(users []domain.User) string {
+	ids := make([]domain.UserID, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	slices.SortFunc(ids, cmp.Compare)
+	return fmt.Sprint(ids)
+}
+
+func testGetUsersByIDs(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	alice := newUser(t, domain.DefaultTenantID, "alice", 0)
+	bob := newUser(t, "other", "bob", 1)
+	mustCreate(t, repo, alice, bob)
+
+	if users, err := repo.GetUsersByIDs(ctx, nil); err != nil || len(users) != 0 {
+		t.Fatalf("GetUsersByIDs(nil) = %v, %v; want empty", users, err)
+	}
+
+	// Lookups by ID are global, skip unknown IDs and collapse duplicates.
+	// The second round is served by caches where there are any.
+	for range 2 {
+		users, err := repo.GetUsersByIDs(ctx, []domain.UserID{bob.ID, "missing", alice.ID, bob.ID})
+		if err != nil {
+			t.Fatalf("GetUsersByIDs: %v", err)
+		}
+		if got, want := sortedIDs(users), sortedIDs([]domain.User{alice, bob}); got != want {
+			t.Fatalf("GetUsersByIDs = %s, want %s", got, want)
+		}
+		for _, u := range users {
+			if u.ID == alice.ID {
+				assertUser(t, u, alice)
+			}
+		}
+	}
+
+	// Writes are visible to later batch lookups.
+	if err := repo.RevokeSessions(ctx, alice.ID); err != nil {
+		t.Fatalf("RevokeSessions: %v", err)
+	}
+	users, err := repo.GetUsersByIDs(ctx, []domain.UserID{alice.ID})
+	if err != nil || len(users) != 1 || users[0].SessionVersion != 1 {
+		t.Fatalf("GetUsersByIDs after RevokeSessions = %+v, %v; want session version 1", users, err)
+	}
+}
+
+func testListUsersChanged(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	tenant := domain.TenantID("acme")
+
+	// carol and dave share an update time, so the cursor's ID breaks the tie.
+	var all []domain.User
+	for i, name := range []string{"alice", "bob", "carol", "dave"} {
+		all = append(all, newUser(t, tenant, name, min(i, 2)))
+	}
+	mustCreate(t, repo, all...)
+	mustCreate(t, repo, newUser(t, "other", "zed", 0))
+	until := baseTime.Add(time.Hour)
+
+	ids := func(users []domain.User) string {
+		var out []domain.UserID
+		for _, u := range users {
+			out = append(out, u.ID)
+		}
+		return fmt.Sprint(out)
+	}
+	cursor := func(u domain.User) repository.ChangeCursor {
+		return repository.ChangeCursor{UpdatedAt: u.UpdatedAt, ID: u.ID}
+	}
+
+	tests := []struct {
+		name  string
+		after repository.ChangeCursor
+		until time.Time
+		limit int
+		want  []domain.User
+	}{
+		{"from the start", repository.ChangeCursor{}, until, 10, all},
+		{"limited", repository.ChangeCursor{}, until, 2, all[:2]},
+		{"after a cursor", cursor(all[1]), until, 10, all[2:]},
+		{"tie on update time", cursor(all[2]), until, 10, all[3:]},
+		{"until is exclusive", repository.ChangeCursor{}, all[2].UpdatedAt, 10, all[:2]},
+		{"at the end", cursor(all[3]), until, 10, nil},
+	}
+	for _, tc := range tests {
+		got, err := repo.ListUsersChanged(ctx, tenant, tc.after, tc.until, tc.limit)
+		if err != nil {
+			t.Fatalf("%s: ListUsersChanged: %v", tc.name, err)
+		}
+		if ids(got) != ids(tc.want) {
+			t.Fatalf("%s: ListUsersChanged = %s, want %s", tc.name, ids(got), ids(tc.want))
+		}
+	}
+
+	// An update moves the user after everyone else. SQL backends stamp
+	// updated_at with the wall clock, hence the later bound.
+	updated := all[0]
+	updated.Role = domain.RoleSeller
+	updated.UpdatedAt = time.Now().UTC()
+	if err := repo.UpdateUser(ctx, updated); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	got, err := repo.ListUsersChanged(ctx, tenant, cursor(all[3]), time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ListUsersChanged: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != updated.ID || got[0].Role != domain.RoleSeller {
+		t.Fatalf("ListUsersChanged after UpdateUser = %s, want [%s]", ids(got), updated.ID)
+	}
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+var ErrSCIMTokenNotFound = errors.New("scim token not found")
+
+type SCIMTokenRepository interface {
+	CreateSCIMToken(ctx context.Context, t domain.SCIMToken) error
+	GetSCIMTokenByHash(ctx context.Context, tokenHash string) (domain.SCIMToken, error)
+	ListSCIMTokens(ctx context.Context, tenantID domain.TenantID) ([]domain.SCIMToken, error)
+	RevokeSCIMToken(ctx context.Context, tenantID domain.TenantID, id string, revokedAt time.Time) error
+	TouchSCIMToken(ctx context.Context, id string, usedAt time.Time) error
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresSCIMTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresSCIMTokenRepository(db *gorm.DB) SCIMTokenRepository {
+	return &postgresSCIMTokenRepository{db: db}
+}
+
+func (r *postgresSCIMTokenRepository) CreateSCIMToken(ctx context.Context, t domain.SCIMToken) error {
+	model := domain.ToSCIMTokenModel(t)
+	return r.db.WithContext(ctx).Create(&model).Error
+}
+
+func (r *postgresSCIMTokenRepository) GetSCIMTokenByHash(ctx context.Context, tokenHash string) (domain.SCIMToken, error) {
+	var model domain.SCIMTokenModel
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.SCIMToken{}, ErrSCIMTokenNotFound
+		}
+		return domain.SCIMToken{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresSCIMTokenRepository) ListSCIMTokens(ctx context.Context, tenantID domain.TenantID) ([]domain.SCIMToken, error) {
+	var models []domain.SCIMTokenModel
+	if err := r.db.WithContext(ctx).Where("tenant_id = ?", tenantID).Order("created_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	tokens := make([]domain.SCIMToken, 0, len(models))
+	for _, m := range models {
+		tokens = append(tokens, m.ToDomain())
+	}
+	return tokens, nil
+}
+
+func (r *postgresSCIMTokenRepository) RevokeSCIMToken(ctx context.Context, tenantID domain.TenantID, id string, revokedAt time.Time) error {
+	res := r.db.WithContext(ctx).
+		Model(&domain.SCIMTokenModel{}).
+		Where("id = ? AND tenant_id = ? AND revoked_at IS NULL", id, tenantID).
+		Update("revoked_at", revokedAt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSCIMTokenNotFound
+	}
+	return nil
+}
+
+func (r *postgresSCIMTokenRepository) TouchSCIMToken(ctx context.Context, id string, usedAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.SCIMTokenModel{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type SigningKeyRepository interface {
+	ListSigningKeys(ctx context.Context) ([]domain.SigningKey, error)
+	// RotateSigningKey inserts k and retires every other unretired key when k
+	// activates, in one transaction.
+	RotateSigningKey(ctx context.Context, k domain.SigningKey) error
+	// UpdateSigningKeySecret replaces key id's secret if it is still old.
+	UpdateSigningKeySecret(ctx context.Context, id, old, secret string) error
+}
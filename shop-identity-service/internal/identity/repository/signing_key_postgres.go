@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresSigningKeyRepository(db *gorm.DB) SigningKeyRepository {
+	return &postgresSigningKeyRepository{db: db}
+}
+
+func (r *postgresSigningKeyRepository) ListSigningKeys(ctx context.Context) ([]domain.SigningKey, error) {
+	var models []domain.SigningKeyModel
+	if err := r.db.WithContext(ctx).Order("activates_at").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]domain.SigningKey, 0, len(models))
+	for _, m := range models {
+		keys = append(keys, m.ToDomain())
+	}
+	return keys, nil
+}
+
+func (r *postgresSigningKeyRepository) RotateSigningKey(ctx context.Context, k domain.SigningKey) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.SigningKeyModel{}).
+			Where("retired_at IS NULL").
+			Update("retired_at", k.ActivatesAt).Error; err != nil {
+			return err
+		}
+		model := domain.ToSigningKeyModel(k)
+		return tx.Create(&model).Error
+	})
+}
+
+func (r *postgresSigningKeyRepository) UpdateSigningKeySecret(ctx context.Context, id, old, secret string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.SigningKeyModel{}).
+		Where("id = ? AND secret = ?", id, old).
+		Update("secret", secret).Error
+}
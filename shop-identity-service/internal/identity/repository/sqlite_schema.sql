@@ -0,0 +1,143 @@
+-- SQLite schema for tests and local development. It mirrors the Postgres
+-- migrations in /migrations; keep the two in step.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    email TEXT NOT NULL,
+    email_canonical TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL,
+    username_canonical TEXT NOT NULL DEFAULT '',
+    username_skeleton TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL,
+    provider TEXT NOT NULL DEFAULT 'local',
+    provider_id TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT 'customer',
+    password_changed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    external_id TEXT NOT NULL DEFAULT '',
+    scim_user_name TEXT NOT NULL DEFAULT '',
+    suspended_at DATETIME,
+    session_version INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users (tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_canonical ON users (tenant_id, email_canonical) WHERE email_canonical <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username_skeleton ON users (tenant_id, username_skeleton) WHERE username_skeleton <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username_canonical ON users (tenant_id, username_canonical) WHERE username_canonical <> '';
+CREATE INDEX IF NOT EXISTS idx_users_tenant_external_id ON users (tenant_id, external_id);
+CREATE INDEX IF NOT EXISTS idx_users_tenant_scim_user_name ON users (tenant_id, LOWER(scim_user_name)) WHERE scim_user_name <> '';
+CREATE INDEX IF NOT EXISTS idx_users_tenant_updated_at ON users (tenant_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id TEXT PRIMARY KEY,
+    actor_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    started_at DATETIME,
+    expires_at DATETIME,
+    ended_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_actor_id ON impersonation_sessions (actor_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_target_id ON impersonation_sessions (target_id);
+
+CREATE TABLE IF NOT EXISTS impersonation_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    action TEXT NOT NULL DEFAULT '',
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_events_session_id ON impersonation_events (session_id);
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    hosts TEXT,
+    jwt_issuer TEXT NOT NULL DEFAULT '',
+    jwt_audience TEXT NOT NULL DEFAULT '',
+    settings TEXT,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_organizations_tenant_id ON organizations (tenant_id);
+
+CREATE TABLE IF NOT EXISTS organization_memberships (
+    organization_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at DATETIME,
+    PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_organization_memberships_user_id ON organization_memberships (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    expires_at DATETIME,
+    accepted_at DATETIME,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_organization_id ON organization_invitations (organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_token_hash ON organization_invitations (token_hash);
+
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME,
+    last_used_at DATETIME,
+    revoked_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_scim_tokens_tenant_id ON scim_tokens (tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_tokens_token_hash ON scim_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    activates_at DATETIME NOT NULL,
+    retired_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS revoked_refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    expires_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_refresh_tokens_expires_at ON revoked_refresh_tokens (expires_at);
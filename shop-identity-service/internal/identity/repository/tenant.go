@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+var ErrTenantNotFound = errors.New("tenant not found")
+
+type TenantRepository interface {
+	ListTenants(ctx context.Context) ([]domain.Tenant, error)
+	GetTenant(ctx context.Context, id domain.TenantID) (domain.Tenant, error)
+	// CreateTenantIfMissing inserts t unless a tenant with its ID exists.
+	CreateTenantIfMissing(ctx context.Context, t domain.Tenant) error
+}
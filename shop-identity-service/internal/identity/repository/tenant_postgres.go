@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type postgresTenantRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresTenantRepository(db *gorm.DB) TenantRepository {
+	return &postgresTenantRepository{db: db}
+}
+
+func (r *postgresTenantRepository) ListTenants(ctx context.Context) ([]domain.Tenant, error) {
+	var models []domain.TenantModel
+	if err := r.db.WithContext(ctx).Order("id").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	tenants := make([]domain.Tenant, 0, len(models))
+	for _, m := range models {
+		tenants = append(tenants, m.ToDomain())
+	}
+	return tenants, nil
+}
+
+func (r *postgresTenantRepository) GetTenant(ctx context.Context, id domain.TenantID) (domain.Tenant, error) {
+	var model domain.TenantModel
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&model).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Tenant{}, ErrTenantNotFound
+		}
+		return domain.Tenant{}, err
+	}
+	return model.ToDomain(), nil
+}
+
+func (r *postgresTenantRepository) CreateTenantIfMissing(ctx context.Context, t domain.Tenant) error {
+	model := domain.ToTenantModel(t)
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model).Error
+}
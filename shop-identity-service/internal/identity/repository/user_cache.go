@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// CachedUser is a UserCache entry. NotFound entries remember that an ID does
+// not exist, so unknown IDs in forged or stale tokens do not reach the
+// database either.
+type CachedUser struct {
+	User     domain.User
+	NotFound bool
+}
+
+// UserCache stores users by ID for CachedRepository. Implementations bound
+// their own size and drop entries once ttl has passed.
+type UserCache interface {
+	Get(ctx context.Context, id domain.UserID) (CachedUser, bool, error)
+	Set(ctx context.Context, id domain.UserID, entry CachedUser, ttl time.Duration) error
+	Delete(ctx context.Context, id domain.UserID) error
+}
+
+// CacheStats counts CachedRepository lookups since it was created.
+type CacheStats struct {
+	Hits int64 `json:"hits"`
+	// NegativeHits are the hits that answered ErrUserNotFound.
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	// Errors counts cache failures. Lookups fall back to the repository and
+	// failed invalidations are only logged.
+	Errors int64 `json:"errors"`
+}
+
+type CacheOption func(*CachedRepository)
+
+// WithCacheTTL sets how long a user is cached. Writes through this process
+// invalidate right away; writes elsewhere are seen after at most ttl.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(r *CachedRepository) {
+		r.ttl = ttl
+	}
+}
+
+// WithNegativeCacheTTL sets how long an unknown ID is remembered. Zero
+// disables negative caching.
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return func(r *CachedRepository) {
+		r.negativeTTL = ttl
+	}
+}
+
+// CachedRepository reads GetUserByID through a UserCache, which is what
+// ValidateToken and CheckSession call on every request. Every write to a
+// user invalidates its entry. Lookups by email and username always go to
+// the repository, so sign-in sees the current password.
+type CachedRepository struct {
+	Repository
+	cache       UserCache
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// writes is bumped by every invalidation. A lookup that raced with one
+	// does not cache what it read, since that may predate the write.
+	writes                           atomic.Uint64
+	hits, negativeHits, misses, errs atomic.Int64
+}
+
+func NewCachedRepository(repo Repository, cache UserCache, opts ...CacheOption) *CachedRepository {
+	r := &CachedRepository{
+		Repository:  repo,
+		cache:       cache,
+		ttl:         15 * time.Second,
+		negativeTTL: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Stats returns the lookup counters.
+func (r *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:         r.hits.Load(),
+		NegativeHits: r.negativeHits.Load(),
+		Misses:       r.misses.Load(),
+		Errors:       r.errs.Load(),
+	}
+}
+
+func (r *CachedRepository) GetUserByID(ctx context.Context, id domain.UserID) (domain.User, error) {
+	entry, ok, err := r.cache.Get(ctx, id)
+	if err != nil {
+		r.errs.Add(1)
+		slog.WarnContext(ctx, "user cache get failed", "user_id", id, "error", err)
+	}
+	if ok {
+		r.hits.Add(1)
+		if entry.NotFound {
+			r.negativeHits.Add(1)
+			return domain.User{}, ErrUserNotFound
+		}
+		return entry.User, nil
+	}
+	r.misses.Add(1)
+
+	writes := r.writes.Load()
+	u, err := r.Repository.GetUserByID(ctx, id)
+	switch {
+	case err == nil:
+		r.store(ctx, id, writes, CachedUser{User: u}, r.ttl)
+	case errors.Is(err, ErrUserNotFound) && r.negativeTTL > 0:
+		r.store(ctx, id, writes, CachedUser{NotFound: true}, r.negativeTTL)
+	}
+	return u, err
+}
+
+// GetUsersByIDs serves what it can from the cache and loads the rest with
+// one repository call.
+func (r *CachedRepository) GetUsersByIDs(ctx context.Context, ids []domain.UserID) ([]domain.User, error) {
+	var (
+		users   []domain.User
+		missing []domain.UserID
+	)
+	seen := map[domain.UserID]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		entry, ok, err := r.cache.Get(ctx, id)
+		if err != nil {
+			r.errs.Add(1)
+			slog.WarnContext(ctx, "user cache get failed", "user_id", id, "error", err)
+		}
+		switch {
+		case !ok:
+			r.misses.Add(1)
+			missing = append(missing, id)
+		case entry.NotFound:
+			r.hits.Add(1)
+			r.negativeHits.Add(1)
+		default:
+			r.hits.Add(1)
+			users = append(users, entry.User)
+		}
+	}
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	writes := r.writes.Load()
+	loaded, err := r.Repository.GetUsersByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	found := map[domain.UserID]bool{}
+	for _, u := range loaded {
+		found[u.ID] = true
+		r.store(ctx, u.ID, writes, CachedUser{User: u}, r.ttl)
+	}
+	if r.negativeTTL > 0 {
+		for _, id := range missing {
+			if !found[id] {
+				r.store(ctx, id, writes, CachedUser{NotFound: true}, r.negativeTTL)
+			}
+		}
+	}
+	return append(users, loaded...), nil
+}
+
+func (r *CachedRepository) store(ctx context.Context, id domain.UserID, writes uint64, entry CachedUser, ttl time.Duration) {
+	if r.writes.Load() != writes {
+		return
+	}
+	if err := r.cache.Set(ctx, id, entry, ttl); err != nil {
+		r.errs.Add(1)
+		slog.WarnContext(ctx, "user cache set failed", "user_id", id, "error", err)
+	}
+}
+
+// Invalidate drops the cached entry for id. The repository's own writes call
+// it; callers that change users behind its back call it too.
+func (r *CachedRepository) Invalidate(ctx context.Context, id domain.UserID) {
+	r.writes.Add(1)
+	// The write already happened, so a failed delete is not the caller's
+	// error; the entry expires with its TTL.
+	if err := r.cache.Delete(ctx, id); err != nil {
+		r.errs.Add(1)
+		slog.WarnContext(ctx, "user cache invalidate failed", "user_id", id, "error", err)
+	}
+}
+
+// CreateUser invalidates as well, dropping a negative entry for the new ID.
+func (r *CachedRepository) CreateUser(ctx context.Context, u domain.User) error {
+	if err := r.Repository.CreateUser(ctx, u); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, u.ID)
+	return nil
+}
+
+func (r *CachedRepository) CreateUsers(ctx context.Context, users []domain.User) error {
+	if err := r.Repository.CreateUsers(ctx, users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		r.Invalidate(ctx, u.ID)
+	}
+	return nil
+}
+
+func (r *CachedRepository) UpdatePassword(ctx context.Context, id domain.UserID, change PasswordChange) error {
+	if err := r.Repository.UpdatePassword(ctx, id, change); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+// UpdateUser covers profile, role and suspension changes.
+func (r *CachedRepository) UpdateUser(ctx context.Context, u domain.User) error {
+	if err := r.Repository.UpdateUser(ctx, u); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, u.ID)
+	return nil
+}
+
+func (r *CachedRepository) UpdateUserAndPassword(ctx context.Context, u domain.User, change PasswordChange) error {
+	if err := r.Repository.UpdateUserAndPassword(ctx, u, change); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, u.ID)
+	return nil
+}
+
+func (r *CachedRepository) RevokeSessions(ctx context.Context, id domain.UserID) error {
+	if err := r.Repository.RevokeSessions(ctx, id); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+type lruEntry struct {
+	id        domain.UserID
+	value     CachedUser
+	expiresAt time.Time
+}
+
+// lruUserCache is an in-process UserCache holding at most size entries and
+// evicting the least recently used one when full.
+type lruUserCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is the most recently used
+	entries map[domain.UserID]*list.Element
+	now     func() time.Time
+}
+
+func NewLRUUserCache(size int) UserCache {
+	return &lruUserCache{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: make(map[domain.UserID]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (c *lruUserCache) Get(_ context.Context, id domain.UserID) (CachedUser, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return CachedUser{}, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		return CachedUser{}, false, nil
+	}
+	c.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (c *lruUserCache) Set(_ context.Context, id domain.UserID, entry CachedUser, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if el, ok := c.entries[id]; ok {
+		el.Value = &lruEntry{id: id, value: entry, expiresAt: expiresAt}
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[id] = c.order.PushFront(&lruEntry{id: id, value: entry, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *lruUserCache) Delete(_ context.Context, id domain.UserID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+func (c *lruUserCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).id)
+}
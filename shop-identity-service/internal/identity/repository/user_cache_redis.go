@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// RedisUserCachePrefix is the key prefix every identity process shares, so
+// that the service and identity-admin invalidate the same entries.
+const RedisUserCachePrefix = "identity:user:"
+
+// redisUserCache is a UserCache shared by every replica, so an invalidation
+// on one replica is seen by all of them. Entries hold password hashes; the
+// Redis instance must be as private as the database. Redis' maxmemory
+// policy bounds its size.
+type redisUserCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisUserCache stores entries under prefix followed by the user ID.
+func NewRedisUserCache(client redis.UniversalClient, prefix string) UserCache {
+	return &redisUserCache{client: client, prefix: prefix}
+}
+
+func (c *redisUserCache) key(id domain.UserID) string {
+	return c.prefix + string(id)
+}
+
+func (c *redisUserCache) Get(ctx context.Context, id domain.UserID) (CachedUser, bool, error) {
+	data, err := c.client.Get(ctx, c.key(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return CachedUser{}, false, nil
+		}
+		return CachedUser{}, false, err
+	}
+	var entry CachedUser
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CachedUser{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (c *redisUserCache) Set(ctx context.Context, id domain.UserID, entry CachedUser, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.key(id), data, ttl).Err()
+}
+
+func (c *redisUserCache) Delete(ctx context.Context, id domain.UserID) error {
+	return c.client.Del(ctx, c.key(id)).Err()
+}
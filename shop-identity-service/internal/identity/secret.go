@@ -0,0 +1,26 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const secretTokenByteCount = 32
+
+// newSecretToken returns a random bearer token with the given prefix and the
+// hash to store in its place.
+func newSecretToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, secretTokenByteCount)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,52 +3,212 @@ package identity
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
 	"github.com/hawful70/shop-identity-service/internal/identity/repository"
 )
 
 var (
-	ErrEmailTaken      = errors.New("email is already registered")
-	ErrInvalidLogin    = errors.New("invalid email or password")
-	ErrPasswordTooWeak = errors.New("password must be at least 8 characters")
-	ErrInvalidToken    = errors.New("invalid token")
+	ErrEmailTaken       = repository.ErrEmailTaken
+	ErrUsernameTaken    = repository.ErrUsernameTaken
+	ErrEmailBlocked     = errors.New("email domain is not allowed")
+	ErrProviderDisabled = errors.New("sign-in method is not enabled for this shop")
+	ErrInvalidLogin     = errors.New("invalid email, username or password")
+	ErrPasswordTooWeak  = errors.New("password must be at least 8 characters")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrUserSuspended    = errors.New("account is suspended")
+	ErrInvalidRole      = errors.New("role must be customer, seller or admin")
+
+	ErrPasswordReused         = errors.New("password was used recently")
+	ErrPasswordChangeRequired = errors.New("password change required")
 )
 
 type Service interface {
 	Register(ctx context.Context, email, username, password string) (User, error)
-	Login(ctx context.Context, email, password string) (User, string, error)
+	// CreateAccount creates an account with any role, for operators. Unlike
+	// Register it works whatever sign-in methods the tenant enables.
+	CreateAccount(ctx context.Context, email, username, password string, role Role) (User, error)
+	// Login accepts either an email address or a username as the login.
+	Login(ctx context.Context, login, password string) (User, string, error)
 	GetUserByID(ctx context.Context, id UserID) (User, error)
+	GetUsersByIDs(ctx context.Context, ids []UserID) ([]User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	SearchUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]User, int64, error)
+	// UserChanges pages through the tenant's users in update order, which
+	// WatchUsers polls.
+	UserChanges(ctx context.Context, after ChangeCursor, limit int) ([]User, error)
 	ValidateToken(ctx context.Context, token string) (User, Claims, error)
+	// ChangePassword verifies the current password, applies the role's reuse
+	// policy and returns a fresh access token.
+	ChangePassword(ctx context.Context, id UserID, currentPassword, newPassword string) (string, error)
+	// ResetPassword sets a new password without the current one, for operators.
+	ResetPassword(ctx context.Context, id UserID, newPassword string) error
+	// CheckUsername returns nil when the username is valid and free, or the
+	// reason it cannot be registered.
+	CheckUsername(ctx context.Context, username string) error
+	// StartImpersonation lets an admin act as a non-admin user. It returns a
+	// short-lived token whose "act" claim names the admin.
+	StartImpersonation(ctx context.Context, actor Claims, targetID UserID, reason string) (string, ImpersonationSession, error)
+	EndImpersonation(ctx context.Context, claims Claims) error
+	// TrackImpersonation records a use of an impersonation token and fails if
+	// its session has ended. It is a no-op for ordinary tokens.
+	TrackImpersonation(ctx context.Context, claims Claims, action string) error
+	// CheckSession returns ErrInvalidToken when the token's user has been
+	// suspended or their sessions revoked since it was issued.
+	CheckSession(ctx context.Context, claims Claims) error
+	// Refresh exchanges a refresh token for an access token, as Login would
+	// issue one, including a password change challenge. With WithRefreshTokens
+	// the refresh token is revoked by the exchange.
+	Refresh(ctx context.Context, refreshToken string) (User, string, error)
+	// Logout revokes a refresh token. Invalid tokens are ignored: there is no
+	// session left to end.
+	Logout(ctx context.Context, refreshToken string) error
+	// SuspendUser blocks sign-in and revokes the user's sessions.
+	SuspendUser(ctx context.Context, id UserID) error
+	// RevokeSessions invalidates every token issued to the user so far.
+	RevokeSessions(ctx context.Context, id UserID) error
 }
 
 type service struct {
 	repo       repository.Repository
 	jwtManager *JWTManager
 	notifier   UserNotifier
+	policies   PasswordPolicies
+	emails     EmailPolicy
+	now        func() time.Time
+
+	impersonation    repository.ImpersonationRepository
+	impersonationTTL time.Duration
+
+	tenants *TenantRegistry
+
+	scimTokens repository.SCIMTokenRepository
+
+	refreshTokens repository.RefreshTokenRepository
+}
+
+type ServiceOption func(*service)
+
+// WithPasswordPolicies sets the per-role password history and expiry rules.
+func WithPasswordPolicies(policies PasswordPolicies) ServiceOption {
+	return func(s *service) {
+		s.policies = policies
+	}
+}
+
+// WithEmailPolicy enables email canonicalization and domain blocking.
+func WithEmailPolicy(policy EmailPolicy) ServiceOption {
+	return func(s *service) {
+		s.emails = policy
+	}
+}
+
+// WithImpersonation enables support staff impersonation. Sessions last ttl.
+func WithImpersonation(repo repository.ImpersonationRepository, ttl time.Duration) ServiceOption {
+	return func(s *service) {
+		s.impersonation = repo
+		s.impersonationTTL = ttl
+	}
+}
+
+// WithTenants supplies per-tenant settings. Without it every request is
+// served by a bare default tenant.
+func WithTenants(tenants *TenantRegistry) ServiceOption {
+	return func(s *service) {
+		s.tenants = tenants
+	}
+}
+
+// WithRefreshTokens makes refresh tokens single use: Refresh and Logout
+// revoke them. Without it a refresh token stays valid until it expires.
+func WithRefreshTokens(repo repository.RefreshTokenRepository) ServiceOption {
+	return func(s *service) {
+		s.refreshTokens = repo
+	}
 }
 
-func NewService(repo repository.Repository, jwtManager *JWTManager, notifier UserNotifier) Service {
+func NewService(repo repository.Repository, jwtManager *JWTManager, notifier UserNotifier, opts ...ServiceOption) Service {
+	return newService(repo, jwtManager, notifier, opts...)
+}
+
+func newService(repo repository.Repository, jwtManager *JWTManager, notifier UserNotifier, opts ...ServiceOption) *service {
 	if notifier == nil {
 		notifier = NoopNotifier()
 	}
-	return &service{repo: repo, jwtManager: jwtManager, notifier: notifier}
+	s := &service{
+		repo:       repo,
+		jwtManager: jwtManager,
+		notifier:   notifier,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// tenant returns the tenant resolved by the transport, or the default one.
+func (s *service) tenant(ctx context.Context) Tenant {
+	if t, ok := TenantFromContext(ctx); ok {
+		return t
+	}
+	if s.tenants != nil {
+		return s.tenants.Default()
+	}
+	return Tenant{ID: DefaultTenantID}
+}
+
+// passwordPolicy prefers the user's tenant override for their role.
+func (s *service) passwordPolicy(user User) PasswordPolicy {
+	if s.tenants != nil {
+		if t, ok := s.tenants.Tenant(user.TenantID); ok {
+			if p, ok := t.Settings.PasswordPolicies[user.Role]; ok {
+				return p
+			}
+		}
+	}
+	return s.policies.For(user.Role)
 }
 
 func (s *service) Register(ctx context.Context, email, username, password string) (User, error) {
-	email = strings.TrimSpace(strings.ToLower(email))
-	username = strings.TrimSpace(username)
+	if !s.tenant(ctx).ProviderEnabled(domain.ProviderLocal) {
+		return User{}, ErrProviderDisabled
+	}
+	return s.createUser(ctx, email, username, password, RoleCustomer)
+}
+
+func (s *service) CreateAccount(ctx context.Context, email, username, password string, role Role) (User, error) {
+	switch role {
+	case RoleCustomer, RoleSeller, RoleAdmin:
+	default:
+		return User{}, ErrInvalidRole
+	}
+	return s.createUser(ctx, email, username, password, role)
+}
+
+func (s *service) createUser(ctx context.Context, email, username, password string, role Role) (User, error) {
+	tenant := s.tenant(ctx)
+	email, err := domain.ParseEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+	if s.emails.blocked(email) {
+		return User{}, ErrEmailBlocked
+	}
 
 	if len(password) < 8 {
 		return User{}, ErrPasswordTooWeak
 	}
 
-	_, err := s.repo.GetUserByEmail(ctx, email)
-	if err == nil {
-		return User{}, ErrEmailTaken
+	if err := s.CheckUsername(ctx, username); err != nil {
+		return User{}, err
 	}
-	if !errors.Is(err, repository.ErrUserNotFound) {
+
+	canonical, err := s.checkEmail(ctx, tenant.ID, email)
+	if err != nil {
 		return User{}, err
 	}
 
@@ -61,23 +221,60 @@ func (s *service) Register(ctx context.Context, email, username, password string
 	if err != nil {
 		return User{}, err
 	}
+	user.TenantID = tenant.ID
+	user.EmailCanonical = canonical
+	user.Role = role
 
 	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return User{}, err
 	}
 
 	if err := s.notifier.UserCreated(ctx, user); err != nil {
-		fmt.Println("err", err)
+		slog.ErrorContext(ctx, "failed to publish user_created", "user_id", user.ID, "error", err)
 		return User{}, err
 	}
 
 	return user, nil
 }
 
-func (s *service) Login(ctx context.Context, email, password string) (User, string, error) {
-	email = strings.TrimSpace(strings.ToLower(email))
+// checkEmail fails with ErrEmailTaken when email, or another alias of the
+// same inbox, is registered in the tenant. It returns the canonical email.
+func (s *service) checkEmail(ctx context.Context, tenantID TenantID, email string) (string, error) {
+	_, err := s.repo.GetUserByEmail(ctx, tenantID, email)
+	if err == nil {
+		return "", ErrEmailTaken
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return "", err
+	}
 
-	user, err := s.repo.GetUserByEmail(ctx, email)
+	canonical := s.emails.Canonical(email)
+	taken, err := s.repo.EmailCanonicalExists(ctx, tenantID, canonical)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrEmailTaken
+	}
+	return canonical, nil
+}
+
+func (s *service) Login(ctx context.Context, login, password string) (User, string, error) {
+	tenant := s.tenant(ctx)
+	if !tenant.ProviderEnabled(domain.ProviderLocal) {
+		return User{}, "", ErrProviderDisabled
+	}
+	login = strings.TrimSpace(login)
+
+	var (
+		user User
+		err  error
+	)
+	if strings.Contains(login, "@") {
+		user, err = s.repo.GetUserByEmail(ctx, tenant.ID, strings.ToLower(login))
+	} else {
+		user, err = s.repo.GetUserByUsername(ctx, tenant.ID, domain.CanonicalUsername(login))
+	}
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return User{}, "", ErrInvalidLogin
@@ -88,6 +285,23 @@ func (s *service) Login(ctx context.Context, email, password string) (User, stri
 	if !CheckPassword(user.Password, password) {
 		return User{}, "", ErrInvalidLogin
 	}
+	if user.Suspended() {
+		return User{}, "", ErrUserSuspended
+	}
+
+	return s.accessToken(user)
+}
+
+// accessToken issues an access token for user, or a challenge token and
+// ErrPasswordChangeRequired when the user's password has expired.
+func (s *service) accessToken(user User) (User, string, error) {
+	if s.passwordPolicy(user).Expired(user.PasswordChangedAt, s.now()) {
+		challenge, err := s.jwtManager.GeneratePasswordChangeToken(user)
+		if err != nil {
+			return User{}, "", err
+		}
+		return user, challenge, ErrPasswordChangeRequired
+	}
 
 	token, err := s.jwtManager.GenerateToken(user)
 	if err != nil {
@@ -97,8 +311,88 @@ func (s *service) Login(ctx context.Context, email, password string) (User, stri
 	return user, token, nil
 }
 
+// Refresh fails with ErrInvalidToken once the user is suspended or signed
+// out everywhere, like the access tokens issued alongside.
+func (s *service) Refresh(ctx context.Context, refreshToken string) (User, string, error) {
+	claims, err := s.jwtManager.VerifyPurposeToken(refreshToken, PurposeRefresh)
+	if err != nil || claims.Tenant() != s.tenant(ctx).ID {
+		return User{}, "", ErrInvalidToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, UserID(claims.UserID))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return User{}, "", ErrInvalidToken
+		}
+		return User{}, "", err
+	}
+	if !sessionValid(user, claims) {
+		return User{}, "", ErrInvalidToken
+	}
+	if err := s.revokeRefreshToken(ctx, claims); err != nil {
+		return User{}, "", err
+	}
+
+	return s.accessToken(user)
+}
+
+func (s *service) Logout(ctx context.Context, refreshToken string) error {
+	claims, err := s.jwtManager.VerifyPurposeToken(refreshToken, PurposeRefresh)
+	if err != nil || claims.Tenant() != s.tenant(ctx).ID {
+		return nil
+	}
+	err = s.revokeRefreshToken(ctx, claims)
+	if errors.Is(err, ErrInvalidToken) {
+		return nil
+	}
+	return err
+}
+
+// revokeRefreshToken fails with ErrInvalidToken when the token was already
+// used, or predates token IDs and so cannot be revoked.
+func (s *service) revokeRefreshToken(ctx context.Context, claims Claims) error {
+	if s.refreshTokens == nil {
+		return nil
+	}
+	if claims.ID == "" {
+		return ErrInvalidToken
+	}
+	revoked, err := s.refreshTokens.RevokeRefreshToken(ctx, claims.ID, UserID(claims.UserID), claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *service) CheckUsername(ctx context.Context, username string) error {
+	name, err := domain.ParseUsername(username)
+	if err != nil {
+		return err
+	}
+
+	taken, err := s.repo.UsernameExists(ctx, s.tenant(ctx).ID, name, "")
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// GetUserByID hides users that belong to another tenant than the caller's.
 func (s *service) GetUserByID(ctx context.Context, id UserID) (User, error) {
-	return s.repo.GetUserByID(ctx, id)
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if user.TenantID != s.tenant(ctx).ID {
+		return User{}, repository.ErrUserNotFound
+	}
+	return user, nil
 }
 
 func (s *service) ValidateToken(ctx context.Context, token string) (User, Claims, error) {
@@ -106,6 +400,9 @@ func (s *service) ValidateToken(ctx context.Context, token string) (User, Claims
 	if err != nil {
 		return User{}, Claims{}, ErrInvalidToken
 	}
+	if claims.Tenant() != s.tenant(ctx).ID {
+		return User{}, Claims{}, ErrInvalidToken
+	}
 
 	user, err := s.repo.GetUserByID(ctx, UserID(claims.UserID))
 	if err != nil {
@@ -114,6 +411,149 @@ func (s *service) ValidateToken(ctx context.Context, token string) (User, Claims
 		}
 		return User{}, claims, err
 	}
+	if !sessionValid(user, claims) {
+		return User{}, claims, ErrInvalidToken
+	}
+
+	if err := s.TrackImpersonation(ctx, claims, "ValidateToken"); err != nil {
+		if errors.Is(err, ErrImpersonationNotActive) || errors.Is(err, ErrImpersonationDisabled) {
+			return User{}, claims, ErrInvalidToken
+		}
+		return User{}, claims, err
+	}
 
 	return user, claims, nil
 }
+
+func (s *service) CheckSession(ctx context.Context, claims Claims) error {
+	user, err := s.repo.GetUserByID(ctx, UserID(claims.UserID))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	if !sessionValid(user, claims) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func sessionValid(user User, claims Claims) bool {
+	return !user.Suspended() && claims.SessionVersion == user.SessionVersion
+}
+
+func (s *service) SuspendUser(ctx context.Context, id UserID) error {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Suspended() {
+		return nil
+	}
+
+	now := s.now()
+	user.SuspendedAt = &now
+	user.SessionVersion++
+	user.UpdatedAt = now
+	if err := s.repo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "user suspended", "user_id", user.ID, "tenant_id", user.TenantID)
+	return nil
+}
+
+func (s *service) RevokeSessions(ctx context.Context, id UserID) error {
+	if _, err := s.GetUserByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.RevokeSessions(ctx, id)
+}
+
+func (s *service) ChangePassword(ctx context.Context, id UserID, currentPassword, newPassword string) (string, error) {
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if !CheckPassword(user.Password, currentPassword) {
+		return "", ErrInvalidLogin
+	}
+
+	user, err = s.setPassword(ctx, user, newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	return s.jwtManager.GenerateToken(user)
+}
+
+func (s *service) ResetPassword(ctx context.Context, id UserID, newPassword string) error {
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.setPassword(ctx, user, newPassword)
+	return err
+}
+
+// maxPasswordChangeAttempts bounds how often setPassword checks again after
+// another change landed between its reuse check and its update.
+const maxPasswordChangeAttempts = 3
+
+func (s *service) setPassword(ctx context.Context, user User, newPassword string) (User, error) {
+	for attempt := 1; ; attempt++ {
+		change, err := s.passwordChange(ctx, user, newPassword)
+		if err != nil {
+			return User{}, err
+		}
+		err = s.repo.UpdatePassword(ctx, user.ID, change)
+		if errors.Is(err, repository.ErrPasswordChanged) && attempt < maxPasswordChangeAttempts {
+			if user, err = s.repo.GetUserByID(ctx, user.ID); err != nil {
+				return User{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return User{}, err
+		}
+
+		user.Password = change.Hash
+		user.PasswordChangedAt = change.ChangedAt
+		user.UpdatedAt = change.ChangedAt
+		return user, nil
+	}
+}
+
+// passwordChange checks newPassword against the user's policy, current
+// password and history, and hashes it. The bcrypt comparisons run before
+// anything is locked; the change only applies if the password is still the
+// one checked against.
+func (s *service) passwordChange(ctx context.Context, user User, newPassword string) (repository.PasswordChange, error) {
+	if len(newPassword) < 8 {
+		return repository.PasswordChange{}, ErrPasswordTooWeak
+	}
+
+	policy := s.passwordPolicy(user)
+	history, err := s.repo.PasswordHistory(ctx, user.ID, policy.HistorySize)
+	if err != nil {
+		return repository.PasswordChange{}, err
+	}
+	for _, hash := range append([]string{user.Password}, history...) {
+		if CheckPassword(hash, newPassword) {
+			return repository.PasswordChange{}, ErrPasswordReused
+		}
+	}
+
+	hashed, err := HashPassword(newPassword)
+	if err != nil {
+		return repository.PasswordChange{}, err
+	}
+	return repository.PasswordChange{
+		Previous:    user.Password,
+		Hash:        hashed,
+		ChangedAt:   s.now(),
+		HistorySize: policy.HistorySize,
+	}, nil
+}
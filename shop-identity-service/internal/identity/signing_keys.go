@@ -0,0 +1,187 @@
+package identity
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// sealedSecretPrefix marks signing key secrets encrypted with the ring's
+// key-encryption key. Rows without it predate encryption.
+const sealedSecretPrefix = "v1:"
+
+// SigningKeyRing keeps the token signing keys in memory. Call Reload to pick
+// up rotations. While the database holds no key, tokens are signed with the
+// configured JWT secret and carry no kid.
+//
+// Secrets are stored encrypted with AES-GCM under a key derived from the
+// key-encryption key, so that a copy of the database cannot forge tokens.
+type SigningKeyRing struct {
+	repo repository.SigningKeyRepository
+	aead cipher.AEAD
+	// retention is how long a retired key keeps verifying tokens. It also
+	// bounds how long the JWT secret is accepted once keys are in use, so it
+	// must cover the longest token lifetime.
+	retention time.Duration
+	now       func() time.Time
+
+	mu   sync.RWMutex
+	keys []SigningKey
+}
+
+func NewSigningKeyRing(repo repository.SigningKeyRepository, kek string, retention time.Duration) *SigningKeyRing {
+	mac := hmac.New(sha256.New, []byte(kek))
+	mac.Write([]byte("signing key encryption"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		panic(err) // unreachable: the key is always 32 bytes
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &SigningKeyRing{
+		repo:      repo,
+		aead:      aead,
+		retention: retention,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Reload reads the keys and decrypts their secrets. Secrets stored before
+// encryption are encrypted in place.
+func (r *SigningKeyRing) Reload(ctx context.Context) error {
+	keys, err := r.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if !strings.HasPrefix(k.Secret, sealedSecretPrefix) {
+			if err := r.repo.UpdateSigningKeySecret(ctx, k.ID, k.Secret, r.seal(k)); err != nil {
+				slog.ErrorContext(ctx, "failed to encrypt signing key", "key_id", k.ID, "error", err)
+			}
+			continue
+		}
+		secret, err := r.open(k)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		keys[i].Secret = secret
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
+
+// seal encrypts k's secret, bound to its ID so that it cannot be moved to
+// another row.
+func (r *SigningKeyRing) seal(k SigningKey) string {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand does not fail
+	}
+	sealed := r.aead.Seal(nonce, nonce, []byte(k.Secret), []byte(k.ID))
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+func (r *SigningKeyRing) open(k SigningKey) (string, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(k.Secret, sealedSecretPrefix))
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	secret, err := r.aead.Open(nil, nonce, ciphertext, []byte(k.ID))
+	if err != nil {
+		return "", errors.New("cannot decrypt secret; was the key-encryption key changed?")
+	}
+	return string(secret), nil
+}
+
+// signingKey returns the most recently activated key that may sign now.
+func (r *SigningKeyRing) signingKey() (SigningKey, bool) {
+	now := r.now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].Signs(now) {
+			return r.keys[i], true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// verificationKey returns key id unless it was retired too long ago. Keys
+// that are not active yet verify already, so that instances that reloaded
+// late still accept tokens from those that switched first.
+func (r *SigningKeyRing) verificationKey(id string) (SigningKey, bool) {
+	now := r.now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.ID != id {
+			continue
+		}
+		if k.RetiredAt != nil && now.After(k.RetiredAt.Add(r.retention)) {
+			return SigningKey{}, false
+		}
+		return k, true
+	}
+	return SigningKey{}, false
+}
+
+// legacyAccepted reports whether tokens without a kid, signed with the JWT
+// secret, may still be valid: no key has been signing for longer than the
+// retention period.
+func (r *SigningKeyRing) legacyAccepted() bool {
+	now := r.now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if now.After(k.ActivatesAt.Add(r.retention)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rotate stores a new random signing key that takes over at activatesAt and
+// retires the current keys at the same time. activatesAt should leave every
+// instance time to reload the key first.
+func (r *SigningKeyRing) Rotate(ctx context.Context, activatesAt time.Time) (SigningKey, error) {
+	secret, _, err := newSecretToken("")
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	key := SigningKey{
+		ID:          uuid.NewString(),
+		Secret:      secret,
+		CreatedAt:   time.Now().UTC(),
+		ActivatesAt: activatesAt.UTC(),
+	}
+	stored := key
+	stored.Secret = r.seal(key)
+	if err := r.repo.RotateSigningKey(ctx, stored); err != nil {
+		return SigningKey{}, err
+	}
+	return key, nil
+}
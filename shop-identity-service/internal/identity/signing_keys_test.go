@@ -0,0 +1,89 @@
+package identity
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+)
+
+// memorySigningKeys stores signing keys as the database would see them.
+type memorySigningKeys struct {
+	keys []domain.SigningKey
+}
+
+func (m *memorySigningKeys) ListSigningKeys(context.Context) ([]domain.SigningKey, error) {
+	return append([]domain.SigningKey(nil), m.keys...), nil
+}
+
+func (m *memorySigningKeys) RotateSigningKey(_ context.Context, k domain.SigningKey) error {
+	m.keys = append(m.keys, k)
+	return nil
+}
+
+func (m *memorySigningKeys) UpdateSigningKeySecret(_ context.Context, id, old, secret string) error {
+	for i, k := range m.keys {
+		if k.ID == id && k.Secret == old {
+			m.keys[i].Secret = secret
+		}
+	}
+	return nil
+}
+
+func TestSigningKeySecretsAreEncrypted(t *testing.T) {
+	ctx := context.Background()
+	repo := &memorySigningKeys{}
+	ring := NewSigningKeyRing(repo, "kek-0123456789abcdef0123456789ab", time.Hour)
+
+	key, err := ring.Rotate(ctx, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	stored := repo.keys[0].Secret
+	if stored == key.Secret || strings.Contains(stored, key.Secret) || !strings.HasPrefix(stored, sealedSecretPrefix) {
+		t.Fatalf("stored secret %q is not encrypted", stored)
+	}
+
+	if err := ring.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got, ok := ring.signingKey(); !ok || got.Secret != key.Secret {
+		t.Fatalf("signing key after Reload = %+v, want the decrypted secret", got)
+	}
+
+	other := NewSigningKeyRing(repo, "another-kek-0123456789abcdef0123", time.Hour)
+	if err := other.Reload(ctx); err == nil {
+		t.Fatal("Reload with another key-encryption key succeeded")
+	}
+
+	// A secret moved to another key's row does not decrypt.
+	repo.keys = append(repo.keys, domain.SigningKey{ID: "moved", Secret: stored, ActivatesAt: time.Now()})
+	if err := ring.Reload(ctx); err == nil {
+		t.Fatal("Reload accepted a secret bound to another key")
+	}
+}
+
+func TestReloadEncryptsPlaintextSecrets(t *testing.T) {
+	ctx := context.Background()
+	repo := &memorySigningKeys{keys: []domain.SigningKey{{ID: "legacy", Secret: "plaintext-secret", ActivatesAt: time.Now().Add(-time.Minute)}}}
+	ring := NewSigningKeyRing(repo, "kek-0123456789abcdef0123456789ab", time.Hour)
+
+	if err := ring.Reload(ctx); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got, ok := ring.signingKey(); !ok || got.Secret != "plaintext-secret" {
+		t.Fatalf("signing key = %+v, want the legacy secret", got)
+	}
+	if stored := repo.keys[0].Secret; !strings.HasPrefix(stored, sealedSecretPrefix) {
+		t.Fatalf("stored secret %q was not encrypted in place", stored)
+	}
+
+	if err := ring.Reload(ctx); err != nil {
+		t.Fatalf("second Reload: %v", err)
+	}
+	if got, _ := ring.signingKey(); got.Secret != "plaintext-secret" {
+		t.Fatalf("signing key after re-encryption = %q", got.Secret)
+	}
+}
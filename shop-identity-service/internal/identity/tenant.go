@@ -0,0 +1,105 @@
+package identity
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+const tenantContextKey contextKey = "identityTenant"
+
+func ContextWithTenant(ctx context.Context, tenant Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenant)
+}
+
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	tenant, ok := ctx.Value(tenantContextKey).(Tenant)
+	return tenant, ok
+}
+
+// TenantRegistry keeps all tenants in memory so that every request can be
+// resolved by ID or host without a database round trip. Call Reload to pick
+// up changes.
+type TenantRegistry struct {
+	repo     repository.TenantRepository
+	fallback Tenant
+
+	mu     sync.RWMutex
+	byID   map[TenantID]Tenant
+	byHost map[string]TenantID
+}
+
+// NewTenantRegistry returns an empty registry; fallback is served as the
+// default tenant until Reload finds one in the database.
+func NewTenantRegistry(repo repository.TenantRepository, fallback Tenant) *TenantRegistry {
+	return &TenantRegistry{
+		repo:     repo,
+		fallback: fallback,
+		byID:     map[TenantID]Tenant{},
+		byHost:   map[string]TenantID{},
+	}
+}
+
+func (r *TenantRegistry) Reload(ctx context.Context) error {
+	tenants, err := r.repo.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[TenantID]Tenant, len(tenants))
+	byHost := make(map[string]TenantID)
+	for _, t := range tenants {
+		byID[t.ID] = t
+		for _, host := range t.Hosts {
+			byHost[strings.ToLower(host)] = t.ID
+		}
+	}
+
+	r.mu.Lock()
+	r.byID, r.byHost = byID, byHost
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *TenantRegistry) Tenant(id TenantID) (Tenant, bool) {
+	if id == "" {
+		return r.Default(), true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.byID[id]; ok {
+		return t, true
+	}
+	if id == r.fallback.ID {
+		return r.fallback, true
+	}
+	return Tenant{}, false
+}
+
+// TenantByHost matches a Host header, ignoring case and any port.
+func (r *TenantRegistry) TenantByHost(host string) (Tenant, bool) {
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+
+	r.mu.RLock()
+	id, ok := r.byHost[host]
+	r.mu.RUnlock()
+	if !ok {
+		return Tenant{}, false
+	}
+	return r.Tenant(id)
+}
+
+func (r *TenantRegistry) Default() Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.byID[r.fallback.ID]; ok {
+		return t
+	}
+	return r.fallback
+}
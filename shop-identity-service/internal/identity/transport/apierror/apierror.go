@@ -0,0 +1,74 @@
+// Package apierror renders identity errors for clients: as RFC 7807
+// application/problem+json over HTTP and as a status with details over
+// gRPC. Both take the kind and code from identity.AsError and carry the
+// request ID.
+package apierror
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// Domain is the ErrorInfo domain of gRPC errors.
+const Domain = "identity.shop"
+
+type mapping struct {
+	status int
+	code   codes.Code
+}
+
+// kinds is where the HTTP status and gRPC code of each kind are decided.
+var kinds = map[identity.Kind]mapping{
+	identity.KindInvalidArgument:    {http.StatusBadRequest, codes.InvalidArgument},
+	identity.KindFailedPrecondition: {http.StatusBadRequest, codes.FailedPrecondition},
+	identity.KindUnauthenticated:    {http.StatusUnauthorized, codes.Unauthenticated},
+	identity.KindPermissionDenied:   {http.StatusForbidden, codes.PermissionDenied},
+	identity.KindNotFound:           {http.StatusNotFound, codes.NotFound},
+	identity.KindAlreadyExists:      {http.StatusConflict, codes.AlreadyExists},
+	identity.KindConflict:           {http.StatusConflict, codes.FailedPrecondition},
+	identity.KindUnimplemented:      {http.StatusNotImplemented, codes.Unimplemented},
+	// 499 is the de facto status for requests the client gave up on.
+	identity.KindCanceled:         {499, codes.Canceled},
+	identity.KindDeadlineExceeded: {http.StatusGatewayTimeout, codes.DeadlineExceeded},
+	identity.KindInternal:         {http.StatusInternalServerError, codes.Internal},
+}
+
+func mappingOf(kind identity.Kind) mapping {
+	if m, ok := kinds[kind]; ok {
+		return m
+	}
+	return kinds[identity.KindInternal]
+}
+
+// kindOf is the inverse of kinds for errors coming back from gRPC.
+func kindOf(code codes.Code) identity.Kind {
+	switch code {
+	case codes.FailedPrecondition:
+		return identity.KindFailedPrecondition
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return identity.KindInternal
+	}
+	for kind, m := range kinds {
+		if m.code == code {
+			return kind
+		}
+	}
+	return identity.KindInternal
+}
+
+// logInternal records the cause of an internal error, which clients only
+// see as "internal error".
+func logInternal(ctx context.Context, op string, e *identity.Error) {
+	if e.Kind != identity.KindInternal {
+		return
+	}
+	if op == "" {
+		op = "request failed"
+	}
+	slog.ErrorContext(ctx, op, "error", e.Unwrap())
+}
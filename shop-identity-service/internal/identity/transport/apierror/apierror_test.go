@@ -0,0 +1,209 @@
+package apierror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// catalogTests pins what clients see for every error in the catalog. The
+// statuses and codes are part of the API.
+var catalogTests = []struct {
+	err    error
+	status int
+	code   codes.Code
+	reason identity.Code
+}{
+	{identity.ErrEmailRequired, http.StatusBadRequest, codes.InvalidArgument, "email_required"},
+	{identity.ErrEmailInvalid, http.StatusBadRequest, codes.InvalidArgument, "email_invalid"},
+	{identity.ErrEmailBlocked, http.StatusBadRequest, codes.InvalidArgument, "email_blocked"},
+	{identity.ErrUsernameRequired, http.StatusBadRequest, codes.InvalidArgument, "username_required"},
+	{identity.ErrUsernameLength, http.StatusBadRequest, codes.InvalidArgument, "username_length"},
+	{identity.ErrUsernameInvalid, http.StatusBadRequest, codes.InvalidArgument, "username_invalid"},
+	{identity.ErrUsernameReserved, http.StatusBadRequest, codes.InvalidArgument, "username_reserved"},
+	{identity.ErrPasswordTooWeak, http.StatusBadRequest, codes.InvalidArgument, "password_too_weak"},
+	{identity.ErrPasswordShort, http.StatusBadRequest, codes.InvalidArgument, "password_too_weak"},
+	{identity.ErrPasswordReused, http.StatusBadRequest, codes.InvalidArgument, "password_reused"},
+	{identity.ErrInvalidRole, http.StatusBadRequest, codes.InvalidArgument, "role_invalid"},
+	{identity.ErrRoleNotProvisionable, http.StatusBadRequest, codes.InvalidArgument, "role_not_provisionable"},
+	{identity.ErrReasonRequired, http.StatusBadRequest, codes.InvalidArgument, "reason_required"},
+	{identity.ErrOrgNameRequired, http.StatusBadRequest, codes.InvalidArgument, "organization_name_required"},
+	{identity.ErrInvalidOrgRole, http.StatusBadRequest, codes.InvalidArgument, "organization_role_invalid"},
+	{identity.ErrSCIMTokenNameRequired, http.StatusBadRequest, codes.InvalidArgument, "scim_token_name_required"},
+	{identity.ErrInvitationInvalid, http.StatusBadRequest, codes.InvalidArgument, "invitation_invalid"},
+	{identity.ErrInvalidUser, http.StatusBadRequest, codes.InvalidArgument, "user_invalid"},
+
+	{identity.ErrImpersonationNotActive, http.StatusBadRequest, codes.FailedPrecondition, "impersonation_not_active"},
+
+	{identity.ErrAuthenticationRequired, http.StatusUnauthorized, codes.Unauthenticated, "authentication_required"},
+	{identity.ErrInvalidLogin, http.StatusUnauthorized, codes.Unauthenticated, "invalid_credentials"},
+	{identity.ErrInvalidToken, http.StatusUnauthorized, codes.Unauthenticated, "invalid_token"},
+	{identity.ErrSCIMTokenInvalid, http.StatusUnauthorized, codes.Unauthenticated, "invalid_token"},
+
+	{identity.ErrForbidden, http.StatusForbidden, codes.PermissionDenied, "forbidden"},
+	{identity.ErrUserSuspended, http.StatusForbidden, codes.PermissionDenied, "user_suspended"},
+	{identity.ErrPasswordChangeRequired, http.StatusForbidden, codes.PermissionDenied, "password_change_required"},
+	{identity.ErrImpersonationNotAllowed, http.StatusForbidden, codes.PermissionDenied, "impersonation_not_allowed"},
+	{identity.ErrInvitationEmail, http.StatusForbidden, codes.PermissionDenied, "invitation_email_mismatch"},
+	{identity.ErrProviderDisabled, http.StatusForbidden, codes.PermissionDenied, "provider_disabled"},
+
+	{repository.ErrUserNotFound, http.StatusNotFound, codes.NotFound, "user_not_found"},
+	{repository.ErrTenantNotFound, http.StatusNotFound, codes.NotFound, "tenant_not_found"},
+	{repository.ErrOrganizationNotFound, http.StatusNotFound, codes.NotFound, "organization_not_found"},
+	{repository.ErrMembershipNotFound, http.StatusNotFound, codes.NotFound, "membership_not_found"},
+	{repository.ErrInvitationNotFound, http.StatusNotFound, codes.NotFound, "invitation_not_found"},
+	{repository.ErrSCIMTokenNotFound, http.StatusNotFound, codes.NotFound, "scim_token_not_found"},
+	{repository.ErrImpersonationNotFound, http.StatusNotFound, codes.NotFound, "impersonation_not_found"},
+
+	{identity.ErrEmailTaken, http.StatusConflict, codes.AlreadyExists, "email_taken"},
+	{identity.ErrUsernameTaken, http.StatusConflict, codes.AlreadyExists, "username_taken"},
+	{identity.ErrAlreadyMember, http.StatusConflict, codes.AlreadyExists, "already_member"},
+
+	{identity.ErrLastOwner, http.StatusConflict, codes.FailedPrecondition, "last_owner"},
+	{repository.ErrPasswordChanged, http.StatusConflict, codes.FailedPrecondition, "password_changed"},
+
+	{identity.ErrImpersonationDisabled, http.StatusNotImplemented, codes.Unimplemented, "impersonation_disabled"},
+
+	{context.Canceled, 499, codes.Canceled, "canceled"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, codes.DeadlineExceeded, "deadline_exceeded"},
+
+	{errors.New("connection refused"), http.StatusInternalServerError, codes.Internal, "internal"},
+}
+
+func TestCatalogHTTP(t *testing.T) {
+	for _, tc := range catalogTests {
+		for _, err := range []error{tc.err, fmt.Errorf("handler: %w", tc.err)} {
+			rec := httptest.NewRecorder()
+			Write(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users", nil), err)
+
+			var p Problem
+			if jsonErr := json.Unmarshal(rec.Body.Bytes(), &p); jsonErr != nil {
+				t.Fatalf("%v: decode problem: %v", err, jsonErr)
+			}
+			if rec.Code != tc.status || p.Status != tc.status || p.Code != tc.reason || p.Type != TypeURI(tc.reason) {
+				t.Errorf("%v: HTTP %d %s, want %d %s", err, rec.Code, p.Code, tc.status, tc.reason)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("%v: Content-Type = %q", err, ct)
+			}
+		}
+	}
+}
+
+func TestCatalogGRPC(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range catalogTests {
+		for _, err := range []error{tc.err, fmt.Errorf("handler: %w", tc.err)} {
+			st := status.Convert(Status(ctx, err, "/identity.v1.Identity/GetUser"))
+			if st.Code() != tc.code || Code(err) != tc.code {
+				t.Errorf("%v: gRPC %s (Code %s), want %s", err, st.Code(), Code(err), tc.code)
+			}
+			if reason := errorInfoReason(st); reason != string(tc.reason) {
+				t.Errorf("%v: ErrorInfo reason %q, want %q", err, reason, tc.reason)
+			}
+			// The gateway turns the status back into the same code and
+			// status, except that conflicts share FAILED_PRECONDITION and
+			// come back as 400.
+			wantStatus := tc.status
+			if tc.code == codes.FailedPrecondition {
+				wantStatus = http.StatusBadRequest
+			}
+			if back := FromStatus(st.Err()); back.Code != tc.reason || mappingOf(back.Kind).status != wantStatus {
+				t.Errorf("%v: FromStatus = %s/%s, want %s with HTTP %d", err, back.Kind, back.Code, tc.reason, wantStatus)
+			}
+		}
+	}
+}
+
+func errorInfoReason(st *status.Status) string {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
+func TestKindsMapped(t *testing.T) {
+	for _, kind := range []identity.Kind{
+		identity.KindInvalidArgument, identity.KindFailedPrecondition, identity.KindUnauthenticated,
+		identity.KindPermissionDenied, identity.KindNotFound, identity.KindAlreadyExists,
+		identity.KindConflict, identity.KindUnimplemented, identity.KindCanceled,
+		identity.KindDeadlineExceeded, identity.KindInternal,
+	} {
+		if _, ok := kinds[kind]; !ok {
+			t.Errorf("kind %s has no HTTP status or gRPC code", kind)
+		}
+	}
+	if got := mappingOf("made_up"); got != kinds[identity.KindInternal] {
+		t.Errorf("unknown kind maps to %+v, want internal", got)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	err := identity.NewError(identity.KindInvalidArgument, "invalid_request", "email is required",
+		identity.FieldError{Field: "email", Message: "email is required"})
+
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodPost, "/auth/register", nil), err)
+	var p Problem
+	if jsonErr := json.Unmarshal(rec.Body.Bytes(), &p); jsonErr != nil || len(p.Errors) != 1 || p.Errors[0].Field != "email" {
+		t.Fatalf("problem errors = %+v, %v", p.Errors, jsonErr)
+	}
+
+	st := status.Convert(Status(context.Background(), err, ""))
+	back := FromStatus(st.Err())
+	if len(back.Fields) != 1 || back.Fields[0] != err.Fields[0] {
+		t.Fatalf("fields after a gRPC round trip = %+v, want %+v", back.Fields, err.Fields)
+	}
+}
+
+func TestInternalErrorsHideTheCause(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	secret := `pq: password authentication failed for user "shop" at 10.0.0.5`
+	err := fmt.Errorf("get user: %w", errors.New(secret))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/u1", nil)
+	req = req.WithContext(identity.ContextWithRequestID(req.Context(), "req-1"))
+	Write(rec, req, err)
+	var p Problem
+	if jsonErr := json.Unmarshal(rec.Body.Bytes(), &p); jsonErr != nil {
+		t.Fatalf("decode problem: %v", jsonErr)
+	}
+	if strings.Contains(rec.Body.String(), "pq:") || p.Detail != "internal error" || p.Code != "internal" || p.RequestID != "req-1" {
+		t.Errorf("HTTP problem = %s, want a bare internal error with the request ID", rec.Body)
+	}
+
+	st := status.Convert(Status(context.Background(), err, "/identity.v1.Identity/GetUser"))
+	if strings.Contains(st.Message(), "pq:") || st.Message() != "internal error" {
+		t.Errorf("gRPC message = %q, want a bare internal error", st.Message())
+	}
+	for _, d := range st.Details() {
+		if strings.Contains(fmt.Sprint(d), "pq:") {
+			t.Errorf("gRPC detail %v exposes the cause", d)
+		}
+	}
+
+	// The cause is only logged.
+	if !strings.Contains(logs.String(), "pq: password authentication failed") {
+		t.Errorf("log = %q, want the cause", logs.String())
+	}
+}
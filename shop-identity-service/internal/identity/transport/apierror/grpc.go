@@ -0,0 +1,138 @@
+package apierror
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// RequestIDMetadataKey is the gRPC counterpart of RequestIDHeader.
+const RequestIDMetadataKey = "x-request-id"
+
+// Status converts err to a gRPC status error with ErrorInfo and, for
+// invalid fields, BadRequest details. op names the failed operation in the
+// log of internal errors. Status errors pass through unchanged.
+func Status(ctx context.Context, err error, op string) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	e := identity.AsError(err)
+	logInternal(ctx, op, e)
+
+	st := status.New(mappingOf(e.Kind).code, e.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: string(e.Code), Domain: Domain}}
+	if len(e.Fields) > 0 {
+		bad := &errdetails.BadRequest{}
+		for _, f := range e.Fields {
+			bad.FieldViolations = append(bad.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Message,
+			})
+		}
+		details = append(details, bad)
+	}
+	return withDetails(st, details...).Err()
+}
+
+// Code is the gRPC code err is sent with, for interceptors that run inside
+// UnaryServerInterceptor and see errors before they are converted.
+func Code(err error) codes.Code {
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+	return mappingOf(identity.AsError(err).Kind).code
+}
+
+// FromStatus turns a gRPC error back into an identity error, for callers
+// such as the HTTP gateway.
+func FromStatus(err error) *identity.Error {
+	st := status.Convert(err)
+	e := identity.NewError(kindOf(st.Code()), identity.Code(kindOf(st.Code())), st.Message())
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			e.Code = identity.Code(d.GetReason())
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				e.Fields = append(e.Fields, identity.FieldError{Field: v.GetField(), Message: v.GetDescription()})
+			}
+		}
+	}
+	return e
+}
+
+// UnaryServerInterceptor assigns the request ID, from the call's
+// x-request-id metadata or a new one, returns it in the response header,
+// and gives every error a status with a RequestInfo detail. It goes first
+// in the chain so the other interceptors see the final error.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, id := requestContext(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+		resp, err := handler(ctx, req)
+		return resp, finish(ctx, err, info.FullMethod)
+	}
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := requestContext(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIDMetadataKey, id))
+		err := handler(srv, &requestStream{ServerStream: ss, ctx: ctx})
+		return finish(ctx, err, info.FullMethod)
+	}
+}
+
+func requestContext(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDMetadataKey); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	return identity.ContextWithRequestID(ctx, id), id
+}
+
+func finish(ctx context.Context, err error, method string) error {
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(Status(ctx, err, method))
+	for _, d := range st.Details() {
+		if _, ok := d.(*errdetails.RequestInfo); ok {
+			return st.Err()
+		}
+	}
+	return withDetails(st, &errdetails.RequestInfo{RequestId: identity.RequestIDFromContext(ctx)}).Err()
+}
+
+// withDetails keeps st as it is if the details cannot be attached.
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) *status.Status {
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+type requestStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestStream) Context() context.Context {
+	return s.ctx
+}
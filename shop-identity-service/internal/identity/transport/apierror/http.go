@@ -0,0 +1,107 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// RequestIDHeader carries the request ID both ways. A client-supplied ID is
+// kept so calls can be traced across services.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// Problem is an RFC 7807 problem detail. Code and Errors are the identity
+// error's code and field details.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      identity.Code         `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []identity.FieldError `json:"errors,omitempty"`
+}
+
+// TypeURI identifies a problem type by its code.
+func TypeURI(code identity.Code) string {
+	return "urn:shop:identity:error:" + string(code)
+}
+
+// RequestID takes the request ID from the X-Request-ID header, or makes one,
+// and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(identity.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts printable ASCII, so IDs are safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	errRouteNotFound    = identity.NewError(identity.KindNotFound, "route_not_found", "no such route")
+	errMethodNotAllowed = identity.NewError(identity.KindInvalidArgument, "method_not_allowed", "method not allowed")
+)
+
+// NotFound and MethodNotAllowed replace the router's plain-text responses.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, errRouteNotFound)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteStatus(w, r, http.StatusMethodNotAllowed, errMethodNotAllowed)
+}
+
+// Write responds with err as a problem document.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	WriteStatus(w, r, 0, err)
+}
+
+// WriteStatus is Write with the HTTP status chosen by the caller; 0 uses the
+// status of the error's kind.
+func WriteStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	e := identity.AsError(err)
+	requestID := identity.RequestIDFromContext(r.Context())
+	logInternal(r.Context(), r.Method+" "+r.URL.Path, e)
+	if status == 0 {
+		status = mappingOf(e.Kind).status
+	}
+
+	title := http.StatusText(status)
+	if title == "" {
+		title = string(e.Kind)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Problem{
+		Type:      TypeURI(e.Code),
+		Title:     title,
+		Status:    status,
+		Detail:    e.Message,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	})
+}
@@ -0,0 +1,74 @@
+// Package gateway serves the identity gRPC API over HTTP/JSON at the routes
+// annotated in identity.proto.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+	identitygrpc "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+// New returns a handler that forwards requests to the gRPC server at
+// grpcAddr, dialed with creds. Going through the server rather than calling it in process
+// keeps streaming and the server's interceptors the same for both.
+//
+// The tenant resolved by the HTTP middleware is passed on as
+// x-tenant-id, the request ID as x-request-id, and the Authorization header
+// as authorization, which the server checks again. Errors are written as
+// problem documents, like the rest of the HTTP API.
+func New(ctx context.Context, grpcAddr string, creds credentials.TransportCredentials) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+			md := metadata.MD{}
+			if tenant, ok := identity.TenantFromContext(r.Context()); ok {
+				md.Set(identitygrpc.TenantMetadataKey, string(tenant.ID))
+			}
+			if id := identity.RequestIDFromContext(r.Context()); id != "" {
+				md.Set(apierror.RequestIDMetadataKey, id)
+			}
+			return md
+		}),
+		// The request ID is already in the response's X-Request-ID header.
+		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			if key == apierror.RequestIDMetadataKey {
+				return "", false
+			}
+			return runtime.MetadataHeaderPrefix + key, true
+		}),
+		runtime.WithErrorHandler(writeError),
+	)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// Continues the HTTP request's trace into the gRPC server.
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	if err := pb.RegisterIdentityServiceHandlerFromEndpoint(ctx, mux, grpcAddr, opts); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+func writeError(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		apierror.WriteStatus(w, r, httpErr.HTTPStatus, apierror.FromStatus(httpErr.Err))
+		return
+	}
+	apierror.Write(w, r, apierror.FromStatus(err))
+}
@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// healthMethodPrefix is left open so probes need no credentials.
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+var errAdminRequired = identity.NewError(identity.KindPermissionDenied, "admin_required", "admin token required")
+
+// Authenticator admits callers with a client certificate from the trusted
+// CA, or with an access token of an admin of the call's tenant. Tokens are
+// how the HTTP gateway calls through; services should use certificates.
+type Authenticator struct {
+	jwtManager *identity.JWTManager
+	svc        identity.Service
+	// allowedClients is empty when any trusted certificate is accepted.
+	allowedClients map[string]bool
+}
+
+// NewAuthenticator limits certificate callers to allowedClients, matched
+// against ClientIdentity. An empty list accepts every trusted certificate.
+func NewAuthenticator(jwtManager *identity.JWTManager, svc identity.Service, allowedClients []string) *Authenticator {
+	a := &Authenticator{jwtManager: jwtManager, svc: svc, allowedClients: map[string]bool{}}
+	for _, c := range allowedClients {
+		a.allowedClients[c] = true
+	}
+	return a
+}
+
+// AuthUnaryInterceptor must run after TenantUnaryInterceptor.
+func AuthUnaryInterceptor(a *Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := a.authenticate(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor must run after TenantStreamInterceptor.
+func AuthStreamInterceptor(a *Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.authenticate(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, method string) error {
+	if strings.HasPrefix(method, healthMethodPrefix) {
+		return nil
+	}
+
+	if client, ok := ClientIdentity(ctx); ok {
+		if len(a.allowedClients) > 0 && !a.allowedClients[client] {
+			return identity.NewError(identity.KindPermissionDenied, "client_not_allowed", fmt.Sprintf("client %q is not allowed", client))
+		}
+		return nil
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return identity.NewError(identity.KindUnauthenticated, "authentication_required", "client certificate or bearer token required")
+	}
+	claims, err := a.jwtManager.VerifyToken(token)
+	if err != nil {
+		return identity.ErrInvalidToken
+	}
+	if tenant, ok := identity.TenantFromContext(ctx); ok && claims.Tenant() != tenant.ID {
+		return identity.ErrInvalidToken
+	}
+	if err := a.svc.CheckSession(ctx, claims); err != nil {
+		if errors.Is(err, identity.ErrInvalidToken) {
+			return identity.ErrInvalidToken
+		}
+		return toStatus(ctx, err, "failed to check session")
+	}
+	if identity.Role(claims.Role) != identity.RoleAdmin || claims.Impersonated() {
+		return errAdminRequired
+	}
+	return nil
+}
+
+// ClientIdentity names the caller by its verified client certificate: the
+// first URI SAN (such as a SPIFFE ID), else the first DNS SAN, else the
+// subject common name.
+func ClientIdentity(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return certIdentity(info.State.VerifiedChains[0][0]), true
+}
+
+func certIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,150 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// withClientCert makes ctx look like a call over mTLS from cert. Without
+// verified chains the certificate was not checked against the CA.
+func withClientCert(ctx context.Context, cert *x509.Certificate, verified bool) context.Context {
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthenticate(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	jwtManager := identity.NewJWTManager("test-secret", "identity-test", time.Hour)
+	auth := NewAuthenticator(jwtManager, identity.NewService(repo, jwtManager, nil), []string{"spiffe://shop/orders", "catalog.shop.internal"})
+
+	users := map[string]domain.User{
+		"admin":    {ID: "u-admin", Email: "admin@example.com", Username: "admin", Role: domain.RoleAdmin},
+		"customer": {ID: "u-customer", Email: "customer@example.com", Username: "customer", Role: domain.RoleCustomer},
+		"revoked":  {ID: "u-revoked", Email: "revoked@example.com", Username: "revoked", Role: domain.RoleAdmin},
+		"acme":     {ID: "u-acme", Email: "admin@acme.example", Username: "acmeadmin", Role: domain.RoleAdmin, TenantID: "acme"},
+	}
+	tokens := map[string]string{}
+	for name, u := range users {
+		u.EmailCanonical, u.UsernameCanonical = u.Email, u.Username
+		if err := repo.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("CreateUser %s: %v", name, err)
+		}
+		if u.TenantID == "" {
+			u.TenantID = domain.DefaultTenantID
+		}
+		token, err := jwtManager.GenerateToken(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[name] = token
+	}
+	if err := repo.RevokeSessions(context.Background(), "u-revoked"); err != nil {
+		t.Fatal(err)
+	}
+	impersonation, err := jwtManager.GenerateImpersonationToken(users["customer"], users["admin"], "session-1", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spiffe, _ := url.Parse("spiffe://shop/orders")
+	orders := &x509.Certificate{URIs: []*url.URL{spiffe}, DNSNames: []string{"orders.shop.internal"}, Subject: pkix.Name{CommonName: "orders"}}
+	catalog := &x509.Certificate{DNSNames: []string{"catalog.shop.internal"}, Subject: pkix.Name{CommonName: "catalog"}}
+	reports := &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}
+
+	tenantCtx := identity.ContextWithTenant(context.Background(), identity.Tenant{ID: domain.DefaultTenantID})
+	const method = "/identity.v1.IdentityService/GetUser"
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		wantCode identity.Code // empty when the call is let through
+		wantErr  error
+	}{
+		{"health check", context.Background(), "/grpc.health.v1.Health/Check", "", nil},
+		{"health watch", context.Background(), "/grpc.health.v1.Health/Watch", "", nil},
+		{"no credentials", tenantCtx, method, "authentication_required", nil},
+		{"allowed client by URI SAN", withClientCert(tenantCtx, orders, true), method, "", nil},
+		{"allowed client by DNS SAN", withClientCert(tenantCtx, catalog, true), method, "", nil},
+		{"client not allowed", withClientCert(tenantCtx, reports, true), method, "client_not_allowed", nil},
+		{"unverified certificate", withClientCert(tenantCtx, orders, false), method, "authentication_required", nil},
+		{"admin token", withToken(tenantCtx, tokens["admin"]), method, "", nil},
+		{"malformed token", withToken(tenantCtx, "forged"), method, "", identity.ErrInvalidToken},
+		{"non-admin token", withToken(tenantCtx, tokens["customer"]), method, "admin_required", nil},
+		{"impersonation token", withToken(tenantCtx, impersonation), method, "admin_required", nil},
+		{"token of another tenant", withToken(tenantCtx, tokens["acme"]), method, "", identity.ErrInvalidToken},
+		{"revoked session", withToken(tenantCtx, tokens["revoked"]), method, "", identity.ErrInvalidToken},
+	}
+	for _, tc := range tests {
+		called := false
+		_, err := AuthUnaryInterceptor(auth)(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(context.Context, any) (any, error) {
+			called = true
+			return nil, nil
+		})
+		switch {
+		case tc.wantErr != nil:
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s: err = %v, want %v", tc.name, err, tc.wantErr)
+			}
+		case tc.wantCode != "":
+			if err == nil || identity.AsError(err).Code != tc.wantCode {
+				t.Errorf("%s: err = %v, want %s", tc.name, err, tc.wantCode)
+			}
+		case err != nil:
+			t.Errorf("%s: err = %v, want the call let through", tc.name, err)
+		}
+		if called != (err == nil) {
+			t.Errorf("%s: handler called = %v with err %v", tc.name, called, err)
+		}
+	}
+
+	// The token of the other tenant is fine on that tenant's calls.
+	acmeCtx := identity.ContextWithTenant(context.Background(), identity.Tenant{ID: "acme"})
+	if err := auth.authenticate(withToken(acmeCtx, tokens["acme"]), method); err != nil {
+		t.Errorf("acme admin on acme: %v", err)
+	}
+}
+
+func TestAuthenticateAnyTrustedClient(t *testing.T) {
+	auth := NewAuthenticator(nil, nil, nil)
+	reports := &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}
+	if err := auth.authenticate(withClientCert(context.Background(), reports, true), "/identity.v1.IdentityService/GetUser"); err != nil {
+		t.Fatalf("without an allow list: %v", err)
+	}
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	auth := NewAuthenticator(nil, nil, nil)
+	called := false
+	handler := func(any, grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+	stream := newWatchStream(1)
+	defer stream.cancel()
+	err := AuthStreamInterceptor(auth)(nil, stream, &grpc.StreamServerInfo{FullMethod: "/identity.v1.IdentityService/WatchUsers"}, handler)
+	if err == nil || called {
+		t.Fatalf("stream without credentials: err = %v, handler called %v", err, called)
+	}
+}
@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+// readMask keeps the User fields named by a request's read_mask. The zero
+// value keeps every field.
+type readMask map[protoreflect.Name]bool
+
+// parseReadMask fails with INVALID_ARGUMENT when a path is not a User field.
+// Users are flat, so nested paths are rejected too.
+func parseReadMask(m *fieldmaskpb.FieldMask) (readMask, error) {
+	if len(m.GetPaths()) == 0 {
+		return nil, nil
+	}
+	fields := (&pb.User{}).ProtoReflect().Descriptor().Fields()
+	mask := readMask{"id": true}
+	for _, path := range m.GetPaths() {
+		if fields.ByName(protoreflect.Name(path)) == nil {
+			return nil, identity.InvalidField("read_mask", fmt.Sprintf("read_mask: unknown user field %q", path))
+		}
+		mask[protoreflect.Name(path)] = true
+	}
+	return mask, nil
+}
+
+// apply clears the fields of u outside the mask and returns u.
+func (m readMask) apply(u *pb.User) *pb.User {
+	if m == nil {
+		return u
+	}
+	msg := u.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+	for i := range fields.Len() {
+		if f := fields.Get(i); !m[f.Name()] {
+			msg.Clear(f)
+		}
+	}
+	return u
+}
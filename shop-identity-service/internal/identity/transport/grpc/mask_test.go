@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+func TestReadMask(t *testing.T) {
+	now := timestamppb.New(time.Now())
+	full := func() *pb.User {
+		return &pb.User{
+			Id: "u1", Email: "a@example.com", Username: "alice", Role: "seller",
+			TenantId: "default", Suspended: true, CreatedAt: now, UpdatedAt: now,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  *pb.User
+	}{
+		{"no mask", nil, full()},
+		{"empty mask", []string{}, full()},
+		{"some fields", []string{"email", "role"}, &pb.User{Id: "u1", Email: "a@example.com", Role: "seller"}},
+		{"id is always kept", []string{"suspended"}, &pb.User{Id: "u1", Suspended: true}},
+		{"message fields", []string{"created_at"}, &pb.User{Id: "u1", CreatedAt: now}},
+		{"repeated path", []string{"email", "email"}, &pb.User{Id: "u1", Email: "a@example.com"}},
+	}
+	for _, tc := range tests {
+		var m *fieldmaskpb.FieldMask
+		if tc.paths != nil {
+			m = &fieldmaskpb.FieldMask{Paths: tc.paths}
+		}
+		mask, err := parseReadMask(m)
+		if err != nil {
+			t.Errorf("%s: parseReadMask: %v", tc.name, err)
+			continue
+		}
+		if got := mask.apply(full()); !proto.Equal(got, tc.want) {
+			t.Errorf("%s: apply = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Paths name User fields by their proto names; users are flat.
+	for _, path := range []string{"password", "Email", "createdAt", "user.email", "created_at.seconds", ""} {
+		if _, err := parseReadMask(&fieldmaskpb.FieldMask{Paths: []string{"email", path}}); invalidField(err) != "read_mask" {
+			t.Errorf("parseReadMask(%q): err = %v, want invalid read_mask", path, err)
+		}
+	}
+}
@@ -3,35 +3,51 @@ package grpc
 import (
 	"context"
 	"errors"
+	"time"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/hawful70/shop-identity-service/internal/identity"
-	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
 	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
 )
 
 type Server struct {
 	pb.UnimplementedIdentityServiceServer
-	svc identity.Service
+	svc           identity.Service
+	watchInterval time.Duration
 }
 
-func NewServer(svc identity.Service) *Server {
-	return &Server{svc: svc}
+type ServerOption func(*Server)
+
+// WithWatchInterval sets how often WatchUsers polls for changes.
+func WithWatchInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.watchInterval = d
+	}
 }
 
-func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
-	if req.GetUserId() == "" {
-		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+func NewServer(svc identity.Service, opts ...ServerOption) *Server {
+	s := &Server{svc: svc, watchInterval: time.Second}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
 
+// toStatus maps service errors to gRPC statuses through the identity error
+// catalog, the same way for every method. msg describes the failed
+// operation in the log of INTERNAL errors, whose details are not sent to
+// callers. Request validation errors are returned as identity errors and
+// converted by apierror.UnaryServerInterceptor.
+func toStatus(ctx context.Context, err error, msg string) error {
+	return apierror.Status(ctx, err, msg)
+}
+
+func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
 	user, err := s.svc.GetUserByID(ctx, identity.UserID(req.GetUserId()))
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			return nil, status.Error(codes.NotFound, "user not found")
-		}
-		return nil, status.Error(codes.Internal, "failed to get user")
+		return nil, toStatus(ctx, err, "failed to get user")
 	}
 
 	return &pb.GetUserResponse{
@@ -40,10 +56,6 @@ func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUs
 }
 
 func (s *Server) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
-	if req.GetToken() == "" {
-		return nil, status.Error(codes.InvalidArgument, "token is required")
-	}
-
 	user, claims, err := s.svc.ValidateToken(ctx, req.GetToken())
 	if err != nil {
 		if errors.Is(err, identity.ErrInvalidToken) {
@@ -52,16 +64,40 @@ func (s *Server) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest
 				Error: err.Error(),
 			}, nil
 		}
-		return nil, status.Error(codes.Internal, "failed to validate token")
+		return nil, toStatus(ctx, err, "failed to validate token")
 	}
 
 	return &pb.ValidateTokenResponse{
-		Valid:  true,
-		User:   toProtoUser(user),
-		Claims: &pb.TokenClaims{UserId: claims.UserID, Email: claims.Email, Username: claims.Username},
+		Valid:        true,
+		User:         toProtoUser(user),
+		Claims:       toProtoClaims(claims),
+		Impersonated: claims.Impersonated(),
 	}, nil
 }
 
+func toProtoClaims(c identity.Claims) *pb.TokenClaims {
+	claims := &pb.TokenClaims{
+		UserId:   c.UserID,
+		Email:    c.Email,
+		Username: c.Username,
+		Role:     c.Role,
+		TenantId: string(c.Tenant()),
+		OrgId:    c.OrgID,
+		OrgRole:  c.OrgRole,
+	}
+	if c.ExpiresAt != nil {
+		claims.ExpiresAt = timestamppb.New(c.ExpiresAt.Time)
+	}
+	if c.Actor != nil {
+		claims.Actor = &pb.TokenActor{
+			UserId:    c.Actor.UserID,
+			Email:     c.Actor.Email,
+			SessionId: c.ID,
+		}
+	}
+	return claims
+}
+
 func toProtoUser(u identity.User) *pb.User {
 	return &pb.User{
 		Id:         string(u.ID),
@@ -69,5 +105,10 @@ func toProtoUser(u identity.User) *pb.User {
 		Username:   u.Username,
 		Provider:   string(u.Provider),
 		ProviderId: u.ProviderID,
+		Role:       string(u.Role),
+		TenantId:   string(u.TenantID),
+		Suspended:  u.Suspended(),
+		CreatedAt:  timestamppb.New(u.CreatedAt),
+		UpdatedAt:  timestamppb.New(u.UpdatedAt),
 	}
 }
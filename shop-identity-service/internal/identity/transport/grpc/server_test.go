@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+type tokenService struct {
+	identity.Service
+	tokens map[string]identity.Claims
+}
+
+func (s tokenService) ValidateToken(ctx context.Context, token string) (identity.User, identity.Claims, error) {
+	claims, ok := s.tokens[token]
+	if !ok {
+		return identity.User{}, identity.Claims{}, identity.ErrInvalidToken
+	}
+	return identity.User{ID: identity.UserID(claims.UserID)}, claims, nil
+}
+
+func TestValidateTokenReturnsExpiry(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := NewServer(tokenService{tokens: map[string]identity.Claims{
+		"token-1": {UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)}},
+	}})
+
+	resp, err := srv.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: "token-1"})
+	if err != nil || !resp.GetValid() {
+		t.Fatalf("ValidateToken = %v, %v", resp, err)
+	}
+	if got := resp.GetClaims().GetExpiresAt().AsTime(); !got.Equal(exp) {
+		t.Fatalf("expires_at = %v, want %v", got, exp)
+	}
+
+	resp, err = srv.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: "forged"})
+	if err != nil || resp.GetValid() || resp.GetClaims() != nil {
+		t.Fatalf("ValidateToken(forged) = %v, %v; want invalid without claims", resp, err)
+	}
+}
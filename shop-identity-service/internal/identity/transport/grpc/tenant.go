@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// TenantMetadataKey names the tenant on incoming calls. Calls without it
+// are served by the default tenant.
+const TenantMetadataKey = "x-tenant-id"
+
+var errUnknownTenant = identity.NewError(identity.KindInvalidArgument, "tenant_unknown", "unknown tenant")
+
+func TenantUnaryInterceptor(tenants *identity.TenantRegistry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := tenantContext(ctx, tenants)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TenantStreamInterceptor is TenantUnaryInterceptor for streaming calls.
+func TenantStreamInterceptor(tenants *identity.TenantRegistry) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := tenantContext(ss.Context(), tenants)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func tenantContext(ctx context.Context, tenants *identity.TenantRegistry) (context.Context, error) {
+	tenant := tenants.Default()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(TenantMetadataKey); len(ids) > 0 && ids[0] != "" {
+			t, ok := tenants.Tenant(identity.TenantID(ids[0]))
+			if !ok {
+				return nil, errUnknownTenant
+			}
+			tenant = t
+		}
+	}
+	return identity.ContextWithTenant(ctx, tenant), nil
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,131 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+const (
+	maxBatchGetUsers    = 100
+	defaultListPageSize = 50
+	maxListPageSize     = 500
+)
+
+var errInvalidPageToken = identity.InvalidField("page_token", "invalid page_token")
+
+func (s *Server) BatchGetUsers(ctx context.Context, req *pb.BatchGetUsersRequest) (*pb.BatchGetUsersResponse, error) {
+	mask, err := parseReadMask(req.GetReadMask())
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []identity.UserID
+	seen := map[string]bool{}
+	for _, id := range req.GetUserIds() {
+		if id == "" {
+			return nil, identity.InvalidField("user_ids", "user_ids must not be empty")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, identity.UserID(id))
+		}
+	}
+
+	users, err := s.svc.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, toStatus(ctx, err, "failed to get users")
+	}
+	byID := make(map[identity.UserID]identity.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	resp := &pb.BatchGetUsersResponse{}
+	for _, id := range ids {
+		if u, ok := byID[id]; ok {
+			resp.Users = append(resp.Users, mask.apply(toProtoUser(u)))
+		} else {
+			resp.MissingUserIds = append(resp.MissingUserIds, string(id))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.GetUserByEmailResponse, error) {
+	user, err := s.svc.GetUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		return nil, toStatus(ctx, err, "failed to get user")
+	}
+	return &pb.GetUserByEmailResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *Server) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize == 0:
+		pageSize = defaultListPageSize
+	case pageSize > maxListPageSize:
+		pageSize = maxListPageSize
+	}
+	offset, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	mask, err := parseReadMask(req.GetReadMask())
+	if err != nil {
+		return nil, err
+	}
+
+	var filter identity.UserFilter
+	for _, role := range req.GetRoles() {
+		filter.Roles = append(filter.Roles, identity.Role(role))
+	}
+	if req.Suspended != nil {
+		suspended := req.GetSuspended()
+		filter.Suspended = &suspended
+	}
+	if t := req.GetCreatedAfter(); t != nil {
+		filter.CreatedFrom = t.AsTime()
+	}
+	if t := req.GetCreatedBefore(); t != nil {
+		filter.CreatedBefore = t.AsTime()
+	}
+
+	users, total, err := s.svc.SearchUsers(ctx, filter, offset, pageSize)
+	if err != nil {
+		return nil, toStatus(ctx, err, "failed to list users")
+	}
+
+	resp := &pb.ListUsersResponse{TotalSize: total}
+	for _, u := range users {
+		resp.Users = append(resp.Users, mask.apply(toProtoUser(u)))
+	}
+	if next := offset + len(users); len(users) > 0 && int64(next) < total {
+		resp.NextPageToken = encodePageToken(next)
+	}
+	return resp, nil
+}
+
+// Page tokens are opaque to callers; they hold the offset of the next page.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidPageToken
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errInvalidPageToken
+	}
+	return offset, nil
+}
@@ -0,0 +1,159 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+// usersSince is when the test users were created, well before the watch's
+// settle time.
+var usersSince = time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+// newUserServer serves alice, created; bob, updated since; and carol,
+// suspended last.
+func newUserServer(t *testing.T, opts ...ServerOption) *Server {
+	t.Helper()
+	suspendedAt := usersSince.Add(2 * time.Minute)
+	users := []domain.User{
+		{ID: "u1", Email: "alice@example.com", Username: "alice", Role: domain.RoleCustomer,
+			CreatedAt: usersSince, UpdatedAt: usersSince},
+		{ID: "u2", Email: "bob@example.com", Username: "bob", Role: domain.RoleSeller,
+			CreatedAt: usersSince, UpdatedAt: usersSince.Add(time.Minute)},
+		{ID: "u3", Email: "carol@example.com", Username: "carol", Role: domain.RoleCustomer,
+			CreatedAt: usersSince, UpdatedAt: suspendedAt, SuspendedAt: &suspendedAt},
+	}
+	repo := repository.NewMemoryRepository()
+	for _, u := range users {
+		u.EmailCanonical, u.UsernameCanonical = u.Email, u.Username
+		if err := repo.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("CreateUser %s: %v", u.ID, err)
+		}
+	}
+	return NewServer(identity.NewService(repo, nil, nil), opts...)
+}
+
+func userIDs(users []*pb.User) []string {
+	ids := []string{}
+	for _, u := range users {
+		ids = append(ids, u.GetId())
+	}
+	return ids
+}
+
+// invalidField returns the request field err blames, if it is an invalid
+// argument.
+func invalidField(err error) string {
+	e := identity.AsError(err)
+	if e.Kind != identity.KindInvalidArgument || len(e.Fields) == 0 {
+		return ""
+	}
+	return e.Fields[0].Field
+}
+
+func TestPageToken(t *testing.T) {
+	for _, offset := range []int{0, 1, 50, 123456} {
+		got, err := decodePageToken(encodePageToken(offset))
+		if err != nil || got != offset {
+			t.Errorf("decodePageToken(encodePageToken(%d)) = %d, %v", offset, got, err)
+		}
+	}
+	if got, err := decodePageToken(""); err != nil || got != 0 {
+		t.Errorf("decodePageToken(\"\") = %d, %v; want the first page", got, err)
+	}
+
+	for _, token := range []string{"not base64!", base64Token("ten"), base64Token("-1"), base64Token("1.5"), base64Token("1 ")} {
+		if _, err := decodePageToken(token); invalidField(err) != "page_token" {
+			t.Errorf("decodePageToken(%q): err = %v, want invalid page_token", token, err)
+		}
+	}
+}
+
+func base64Token(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	ctx := context.Background()
+	srv := newUserServer(t)
+
+	resp, err := srv.BatchGetUsers(ctx, &pb.BatchGetUsersRequest{
+		UserIds:  []string{"u3", "missing", "u1", "u3", "gone"},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetUsers: %v", err)
+	}
+	// Users come back in request order, once each.
+	if got, want := userIDs(resp.GetUsers()), []string{"u3", "u1"}; !slices.Equal(got, want) {
+		t.Errorf("users = %v, want %v", got, want)
+	}
+	if got, want := resp.GetMissingUserIds(), []string{"missing", "gone"}; !slices.Equal(got, want) {
+		t.Errorf("missing_user_ids = %v, want %v", got, want)
+	}
+	if u := resp.GetUsers()[0]; u.GetEmail() != "carol@example.com" || u.GetUsername() != "" || u.GetSuspended() {
+		t.Errorf("masked user = %v, want only id and email", u)
+	}
+
+	if _, err := srv.BatchGetUsers(ctx, &pb.BatchGetUsersRequest{UserIds: []string{"u1", ""}}); invalidField(err) != "user_ids" {
+		t.Errorf("BatchGetUsers with an empty ID: err = %v, want invalid user_ids", err)
+	}
+	if _, err := srv.BatchGetUsers(ctx, &pb.BatchGetUsersRequest{
+		UserIds:  []string{"u1"},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"password"}},
+	}); invalidField(err) != "read_mask" {
+		t.Errorf("BatchGetUsers with an unknown field: err = %v, want invalid read_mask", err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+	srv := newUserServer(t)
+
+	var ids []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("ListUsers did not stop after %v", ids)
+		}
+		resp, err := srv.ListUsers(ctx, &pb.ListUsersRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		if resp.GetTotalSize() != 3 {
+			t.Fatalf("total_size = %d, want 3", resp.GetTotalSize())
+		}
+		ids = append(ids, userIDs(resp.GetUsers())...)
+		if token = resp.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	slices.Sort(ids)
+	if want := []string{"u1", "u2", "u3"}; !slices.Equal(ids, want) {
+		t.Fatalf("pages listed %v, want %v", ids, want)
+	}
+
+	suspended := true
+	resp, err := srv.ListUsers(ctx, &pb.ListUsersRequest{Suspended: &suspended})
+	if err != nil || !slices.Equal(userIDs(resp.GetUsers()), []string{"u3"}) || resp.GetNextPageToken() != "" {
+		t.Fatalf("ListUsers(suspended) = %v, %v; want u3 alone", resp, err)
+	}
+
+	// A token past the end is an empty last page.
+	resp, err = srv.ListUsers(ctx, &pb.ListUsersRequest{PageToken: encodePageToken(10)})
+	if err != nil || len(resp.GetUsers()) != 0 || resp.GetNextPageToken() != "" {
+		t.Fatalf("ListUsers past the end = %v, %v", resp, err)
+	}
+	if _, err := srv.ListUsers(ctx, &pb.ListUsersRequest{PageToken: "bogus!"}); invalidField(err) != "page_token" {
+		t.Fatalf("ListUsers with a bad token: err = %v, want invalid page_token", err)
+	}
+}
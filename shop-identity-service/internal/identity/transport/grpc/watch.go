@@ -0,0 +1,100 @@
+package grpc
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+// watchBatchSize is how many changes one poll reads. A backlog is drained
+// in batches before waiting for the next tick.
+const watchBatchSize = 100
+
+// WatchUsers polls the tenant's users in update order, so it sees changes
+// made by every replica and by identity-admin, not only by this process.
+func (s *Server) WatchUsers(req *pb.WatchUsersRequest, stream pb.IdentityService_WatchUsersServer) error {
+	ctx := stream.Context()
+	mask, err := parseReadMask(req.GetReadMask())
+	if err != nil {
+		return err
+	}
+
+	cursor := identity.ChangeCursor{UpdatedAt: time.Now().UTC()}
+	switch {
+	case req.GetResumeToken() != "":
+		cursor, err = decodeResumeToken(req.GetResumeToken())
+		if err != nil {
+			return err
+		}
+	case req.GetStartTime() != nil:
+		cursor = identity.ChangeCursor{UpdatedAt: req.GetStartTime().AsTime()}
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			users, err := s.svc.UserChanges(ctx, cursor, watchBatchSize)
+			if err != nil {
+				return toStatus(ctx, err, "failed to watch users")
+			}
+			for _, u := range users {
+				cursor = identity.ChangeCursor{UpdatedAt: u.UpdatedAt, ID: u.ID}
+				change := &pb.UserChange{
+					Type:        changeType(u),
+					User:        mask.apply(toProtoUser(u)),
+					ResumeToken: encodeResumeToken(cursor),
+				}
+				if err := stream.Send(change); err != nil {
+					return err
+				}
+			}
+			if len(users) < watchBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx, ctx.Err(), "")
+		case <-ticker.C:
+		}
+	}
+}
+
+// changeType infers the change from the user's state: polling sees where a
+// user ended up, not each step on the way.
+func changeType(u identity.User) pb.UserChange_Type {
+	switch {
+	case u.Suspended():
+		return pb.UserChange_TYPE_SUSPENDED
+	case u.UpdatedAt.Equal(u.CreatedAt):
+		return pb.UserChange_TYPE_CREATED
+	}
+	return pb.UserChange_TYPE_UPDATED
+}
+
+func encodeResumeToken(c identity.ChangeCursor) string {
+	raw := c.UpdatedAt.UTC().Format(time.RFC3339Nano) + " " + string(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeResumeToken(token string) (identity.ChangeCursor, error) {
+	invalid := identity.InvalidField("resume_token", "invalid resume_token")
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return identity.ChangeCursor{}, invalid
+	}
+	at, id, ok := strings.Cut(string(raw), " ")
+	if !ok {
+		return identity.ChangeCursor{}, invalid
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return identity.ChangeCursor{}, invalid
+	}
+	return identity.ChangeCursor{UpdatedAt: updatedAt, ID: identity.UserID(id)}, nil
+}
@@ -0,0 +1,160 @@
+package grpc
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+// watchStream collects changes and ends the call once it has want of them.
+type watchStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	cancel  context.CancelFunc
+	want    int
+	changes []*pb.UserChange
+}
+
+func newWatchStream(want int) *watchStream {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return &watchStream{ctx: ctx, cancel: cancel, want: want}
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(c *pb.UserChange) error {
+	s.changes = append(s.changes, c)
+	if len(s.changes) == s.want {
+		s.cancel()
+	}
+	return nil
+}
+
+// watch returns the changes WatchUsers sent for req until it had want.
+func watch(t *testing.T, srv *Server, req *pb.WatchUsersRequest, want int) []*pb.UserChange {
+	t.Helper()
+	stream := newWatchStream(want)
+	defer stream.cancel()
+	err := srv.WatchUsers(req, stream)
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("WatchUsers: err = %v, want CANCELLED after %d changes; got %d", err, want, len(stream.changes))
+	}
+	return stream.changes
+}
+
+type change struct {
+	id  string
+	typ pb.UserChange_Type
+}
+
+func changes(cs []*pb.UserChange) []change {
+	var out []change
+	for _, c := range cs {
+		out = append(out, change{c.GetUser().GetId(), c.GetType()})
+	}
+	return out
+}
+
+func TestWatchUsers(t *testing.T) {
+	srv := newUserServer(t, WithWatchInterval(10*time.Millisecond))
+
+	got := watch(t, srv, &pb.WatchUsersRequest{
+		StartTime: timestamppb.New(usersSince.Add(-time.Second)),
+		ReadMask:  &fieldmaskpb.FieldMask{Paths: []string{"suspended"}},
+	}, 3)
+	want := []change{
+		{"u1", pb.UserChange_TYPE_CREATED},
+		{"u2", pb.UserChange_TYPE_UPDATED},
+		{"u3", pb.UserChange_TYPE_SUSPENDED},
+	}
+	if !slices.Equal(changes(got), want) {
+		t.Fatalf("changes = %v, want %v", changes(got), want)
+	}
+	if u := got[2].GetUser(); !u.GetSuspended() || u.GetEmail() != "" {
+		t.Fatalf("masked user = %v, want only id and suspended", u)
+	}
+
+	// Resuming after the first change picks up with the second.
+	resumed := watch(t, srv, &pb.WatchUsersRequest{
+		ResumeToken: got[0].GetResumeToken(),
+		// The token takes precedence.
+		StartTime: timestamppb.New(usersSince.Add(time.Hour)),
+	}, 2)
+	if !slices.Equal(changes(resumed), want[1:]) {
+		t.Fatalf("changes after resuming = %v, want %v", changes(resumed), want[1:])
+	}
+	if resumed[1].GetResumeToken() != got[2].GetResumeToken() {
+		t.Fatalf("resume tokens differ for the same change: %q and %q", resumed[1].GetResumeToken(), got[2].GetResumeToken())
+	}
+}
+
+func TestWatchUsersRejectsBadRequests(t *testing.T) {
+	srv := newUserServer(t)
+	for name, req := range map[string]*pb.WatchUsersRequest{
+		"resume_token": {ResumeToken: "not a token"},
+		"read_mask":    {ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"password"}}},
+	} {
+		stream := newWatchStream(1)
+		if err := srv.WatchUsers(req, stream); invalidField(err) != name {
+			t.Errorf("WatchUsers with a bad %s: err = %v", name, err)
+		}
+		stream.cancel()
+	}
+}
+
+func TestResumeToken(t *testing.T) {
+	cursors := []identity.ChangeCursor{
+		{UpdatedAt: time.Date(2026, 10, 19, 11, 27, 54, 123456789, time.UTC), ID: "2c3e0d4f-9f7a-4c83-a1b2-5d6e7f809a1b"},
+		{UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), ID: ""},
+		{UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CEST", 2*3600)), ID: "id with spaces"},
+	}
+	for _, c := range cursors {
+		got, err := decodeResumeToken(encodeResumeToken(c))
+		if err != nil || !got.UpdatedAt.Equal(c.UpdatedAt) || got.ID != c.ID {
+			t.Errorf("decodeResumeToken(encodeResumeToken(%v)) = %v, %v", c, got, err)
+		}
+	}
+
+	for _, token := range []string{
+		"",
+		"not base64!",
+		base64Token("2026-10-19T11:27:54Z"),
+		base64Token("yesterday u1"),
+		base64Token(" u1"),
+	} {
+		if _, err := decodeResumeToken(token); invalidField(err) != "resume_token" {
+			t.Errorf("decodeResumeToken(%q): err = %v, want invalid resume_token", token, err)
+		}
+	}
+}
+
+func TestChangeType(t *testing.T) {
+	created := time.Now().UTC()
+	later := created.Add(time.Second)
+	tests := []struct {
+		name string
+		user identity.User
+		want pb.UserChange_Type
+	}{
+		{"new user", identity.User{CreatedAt: created, UpdatedAt: created}, pb.UserChange_TYPE_CREATED},
+		{"updated user", identity.User{CreatedAt: created, UpdatedAt: later}, pb.UserChange_TYPE_UPDATED},
+		{"suspended user", identity.User{CreatedAt: created, UpdatedAt: later, SuspendedAt: &later}, pb.UserChange_TYPE_SUSPENDED},
+	}
+	for _, tc := range tests {
+		if got := changeType(tc.user); got != tc.want {
+			t.Errorf("%s: changeType = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+const (
+	accessCookieName  = "identity_access"
+	refreshCookieName = "identity_refresh"
+	// csrfCookieName is readable by scripts, which send its value back in
+	// csrfHeader. Another site can make the browser send the cookie but
+	// cannot read it, so it cannot forge the header. The token is also
+	// bound to the user by an HMAC, so a cookie planted by a sibling
+	// subdomain or over plain HTTP is not accepted for someone else.
+	csrfCookieName = "identity_csrf"
+	csrfHeader     = "X-CSRF-Token"
+
+	sessionModeCookie = "cookie"
+)
+
+var (
+	errCSRFTokenInvalid      = identity.NewError(identity.KindPermissionDenied, "csrf_token_invalid", "missing or invalid CSRF token")
+	errCookieSessionDisabled = identity.InvalidField("session", "cookie sessions are not enabled")
+)
+
+// CookieConfig sets up browser sessions kept in HttpOnly cookies instead of
+// tokens handed to scripts.
+type CookieConfig struct {
+	// Domain is left empty to scope cookies to the host that set them.
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	// AccessTTL should match the access token lifetime.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Secret keys the HMAC that binds CSRF tokens to a user.
+	Secret []byte
+}
+
+// WithCookieSessions lets clients log in with "session": "cookie". The
+// access and refresh tokens are then set as cookies, together with a CSRF
+// token that state-changing requests must echo in X-CSRF-Token.
+func WithCookieSessions(c CookieConfig) HandlerOption {
+	return func(h *Handler) {
+		h.cookies = &c
+		mac := hmac.New(sha256.New, c.Secret)
+		mac.Write([]byte("csrf token"))
+		h.csrfKey = mac.Sum(nil)
+	}
+}
+
+type cookieAuthContextKey struct{}
+
+// authenticatedByCookie reports whether the request's access token came
+// from the session cookie rather than the Authorization header.
+func authenticatedByCookie(ctx context.Context) bool {
+	v, _ := ctx.Value(cookieAuthContextKey{}).(bool)
+	return v
+}
+
+// requestToken returns the bearer token, or the access cookie's token when
+// cookie sessions are on. ok is false when the request carries neither.
+func (h *Handler) requestToken(r *http.Request) (token string, fromCookie, ok bool) {
+	if token, ok := bearerToken(r); ok {
+		return token, false, true
+	}
+	if h.cookies == nil {
+		return "", false, false
+	}
+	c, err := r.Cookie(accessCookieName)
+	if err != nil || c.Value == "" {
+		return "", false, false
+	}
+	return c.Value, true, true
+}
+
+// withCookieAuth marks r as cookie-authenticated and gives it the token as
+// an Authorization header, which the gateway forwards to the gRPC server.
+func withCookieAuth(r *http.Request, token string) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), cookieAuthContextKey{}, true))
+	r.Header = r.Header.Clone()
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// checkCSRF writes an error and returns false when an unsafe request lacks
+// the double-submitted CSRF token, or the token is not bound to the user of
+// claims.
+func (h *Handler) checkCSRF(w http.ResponseWriter, r *http.Request, claims identity.Claims) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	c, err := r.Cookie(csrfCookieName)
+	header := r.Header.Get(csrfHeader)
+	if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(header)) != 1 || !h.csrfBound(c.Value, claims) {
+		apierror.Write(w, r, errCSRFTokenInvalid)
+		return false
+	}
+	return true
+}
+
+// newCSRFToken returns a random nonce with its HMAC for the user of claims.
+func (h *Handler) newCSRFToken(claims identity.Claims) string {
+	nonce := rand.Text()
+	return nonce + "." + h.csrfMAC(nonce, claims)
+}
+
+func (h *Handler) csrfBound(token string, claims identity.Claims) bool {
+	nonce, mac, ok := strings.Cut(token, ".")
+	return ok && hmac.Equal([]byte(mac), []byte(h.csrfMAC(nonce, claims)))
+}
+
+func (h *Handler) csrfMAC(nonce string, claims identity.Claims) string {
+	mac := hmac.New(sha256.New, h.csrfKey)
+	mac.Write([]byte(nonce + "\x00" + string(claims.Tenant()) + "\x00" + claims.UserID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionResponse replaces loginResponse in cookie mode; the tokens are only
+// in HttpOnly cookies.
+type sessionResponse struct {
+	TokenType string    `json:"token_type"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// writeToken answers with a new access token: as JSON, or as session
+// cookies when the client uses cookies. Requests authenticated by cookie
+// have passed the CSRF check and keep their CSRF token; logins get a new
+// one.
+func (h *Handler) writeToken(w http.ResponseWriter, r *http.Request, token string, cookies bool) {
+	if !cookies {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(loginResponse{AccessToken: token, TokenType: "Bearer"})
+		return
+	}
+	h.writeSession(w, r, token, authenticatedByCookie(r.Context()))
+}
+
+// writeSession sets the session cookies for token. keepCSRF keeps the
+// request's CSRF token, which must have been checked, so that other tabs
+// holding it keep working.
+func (h *Handler) writeSession(w http.ResponseWriter, r *http.Request, token string, keepCSRF bool) {
+	res, err := h.setSessionCookies(w, r, token, keepCSRF)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) setSessionCookies(w http.ResponseWriter, r *http.Request, token string, keepCSRF bool) (sessionResponse, error) {
+	claims, err := h.jwtManager.VerifyToken(token)
+	if err != nil {
+		return sessionResponse{}, err
+	}
+	refresh, err := h.jwtManager.GenerateRefreshToken(claims, h.cookies.RefreshTTL)
+	if err != nil {
+		return sessionResponse{}, err
+	}
+	// Never adopt a token the browser brought to a login: whoever planted
+	// it would know the new session's token.
+	csrf := h.newCSRFToken(claims)
+	if c, err := r.Cookie(csrfCookieName); keepCSRF && err == nil && h.csrfBound(c.Value, claims) {
+		csrf = c.Value
+	}
+
+	h.setCookie(w, accessCookieName, token, "/", h.cookies.AccessTTL, true)
+	h.setCookie(w, refreshCookieName, refresh, authPath(r), h.cookies.RefreshTTL, true)
+	h.setCookie(w, csrfCookieName, csrf, "/", h.cookies.RefreshTTL, false)
+	return sessionResponse{
+		TokenType: "Cookie",
+		CSRFToken: csrf,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (h *Handler) clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	h.setCookie(w, accessCookieName, "", "/", -1, true)
+	h.setCookie(w, refreshCookieName, "", authPath(r), -1, true)
+	h.setCookie(w, csrfCookieName, "", "/", -1, false)
+}
+
+// setCookie deletes the cookie when ttl is negative.
+func (h *Handler) setCookie(w http.ResponseWriter, name, value, path string, ttl time.Duration, httpOnly bool) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.cookies.Domain,
+		Secure:   h.cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: h.cookies.SameSite,
+		MaxAge:   int(ttl.Seconds()),
+	}
+	if ttl < 0 {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// authPath is where RegisterRoutes mounted the /auth routes, such as
+// /api/v1/auth or /t/acme/api/v1/auth, so the refresh cookie is only sent
+// to /auth/refresh and /auth/logout.
+func authPath(r *http.Request) string {
+	mount := ""
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		mount = strings.TrimSuffix(r.URL.Path, rctx.RoutePath)
+	}
+	return mount + "/auth"
+}
+
+// handleRefresh exchanges the refresh cookie for new session cookies. The
+// refresh token is rotated each time, and the service revokes the old one.
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(refreshCookieName)
+	if err != nil || c.Value == "" {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+	claims, err := h.jwtManager.VerifyPurposeToken(c.Value, identity.PurposeRefresh)
+	if err != nil {
+		h.clearSessionCookies(w, r)
+		apierror.Write(w, r, identity.ErrInvalidToken)
+		return
+	}
+	if !h.checkCSRF(w, r, claims) {
+		return
+	}
+
+	_, token, err := h.svc.Refresh(r.Context(), c.Value)
+	if err != nil {
+		if errors.Is(err, identity.ErrPasswordChangeRequired) {
+			h.clearSessionCookies(w, r)
+			writeChallenge(w, token)
+			return
+		}
+		if errors.Is(err, identity.ErrInvalidToken) {
+			h.clearSessionCookies(w, r)
+		}
+		apierror.Write(w, r, err)
+		return
+	}
+	h.writeSession(w, r, token, true)
+}
+
+// handleLogout ends a cookie session by revoking its refresh token and
+// clearing its cookies. The access token stays valid until it expires;
+// signing out everywhere is "identity-admin revoke-sessions". Cookies that
+// no longer hold a valid session are cleared without a CSRF check, since
+// there is no session left to protect.
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if claims, ok := h.cookieSession(r); ok && !h.checkCSRF(w, r, claims) {
+		return
+	}
+	if c, err := r.Cookie(refreshCookieName); err == nil && c.Value != "" {
+		if err := h.svc.Logout(r.Context(), c.Value); err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+	}
+	h.clearSessionCookies(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cookieSession returns the claims of the session cookies, from the access
+// token or, once that has expired, the refresh token.
+func (h *Handler) cookieSession(r *http.Request) (identity.Claims, bool) {
+	if c, err := r.Cookie(accessCookieName); err == nil {
+		if claims, err := h.jwtManager.VerifyToken(c.Value); err == nil {
+			return claims, true
+		}
+	}
+	if c, err := r.Cookie(refreshCookieName); err == nil {
+		if claims, err := h.jwtManager.VerifyPurposeToken(c.Value, identity.PurposeRefresh); err == nil {
+			return claims, true
+		}
+	}
+	return identity.Claims{}, false
+}
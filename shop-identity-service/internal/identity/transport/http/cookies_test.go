@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// newCookieRouter serves the handler under /api/v1 with cookie sessions and
+// single-use refresh tokens, and registers alice and bob.
+func newCookieRouter(t *testing.T) http.Handler {
+	t.Helper()
+	db, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "identity.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	jwtManager := identity.NewJWTManager("test-secret", "identity-test", 15*time.Minute)
+	svc := identity.NewService(repository.NewMemoryRepository(), jwtManager, nil,
+		identity.WithRefreshTokens(repository.NewPostgresRefreshTokenRepository(db)))
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := svc.Register(context.Background(), name+"@example.com", name, "correct-horse"); err != nil {
+			t.Fatalf("Register %s: %v", name, err)
+		}
+	}
+
+	h := NewHandler(svc, jwtManager, WithCookieSessions(CookieConfig{
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+		Secret:     []byte("cookie-secret"),
+	}))
+	r := chi.NewRouter()
+	r.Route("/api/v1", h.RegisterRoutes)
+	return r
+}
+
+// browser keeps the cookies the handler sets, like a browser would.
+type browser struct {
+	t       *testing.T
+	handler http.Handler
+	cookies map[string]string
+}
+
+func newBrowser(t *testing.T, handler http.Handler) *browser {
+	return &browser{t: t, handler: handler, cookies: map[string]string{}}
+}
+
+// post sends body with the browser's cookies and the given CSRF header,
+// if any, and stores the cookies of the response.
+func (b *browser) post(path, body, csrf string) *httptest.ResponseRecorder {
+	b.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if csrf != "" {
+		req.Header.Set(csrfHeader, csrf)
+	}
+	for name, value := range b.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	rec := httptest.NewRecorder()
+	b.handler.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 {
+			delete(b.cookies, c.Name)
+		} else {
+			b.cookies[c.Name] = c.Value
+		}
+	}
+	return rec
+}
+
+func (b *browser) login(name string) {
+	b.t.Helper()
+	rec := b.post("/api/v1/auth/login", `{"username":"`+name+`","password":"correct-horse","session":"cookie"}`, "")
+	if rec.Code != http.StatusOK {
+		b.t.Fatalf("login %s: status %d: %s", name, rec.Code, rec.Body)
+	}
+	var res sessionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || res.CSRFToken != b.cookies[csrfCookieName] {
+		b.t.Fatalf("login %s: response %+v, %v; want the CSRF cookie's token", name, res, err)
+	}
+}
+
+func TestCookieSessionCSRF(t *testing.T) {
+	router := newCookieRouter(t)
+	alice := newBrowser(t, router)
+	alice.login("alice")
+	bob := newBrowser(t, router)
+	bob.login("bob")
+
+	tests := []struct {
+		name string
+		// csrf is sent in the header; cookie, when set, replaces alice's
+		// CSRF cookie.
+		csrf, cookie string
+	}{
+		{"missing token", "", ""},
+		{"header differs from cookie", "forged", ""},
+		{"another user's token", bob.cookies[csrfCookieName], bob.cookies[csrfCookieName]},
+	}
+	own := alice.cookies[csrfCookieName]
+	for _, tc := range tests {
+		for _, path := range []string{"/api/v1/auth/refresh", "/api/v1/auth/logout"} {
+			if tc.cookie != "" {
+				alice.cookies[csrfCookieName] = tc.cookie
+			}
+			rec := alice.post(path, "", tc.csrf)
+			if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "csrf_token_invalid") {
+				t.Errorf("%s: %s: status %d: %s; want 403 csrf_token_invalid", tc.name, path, rec.Code, rec.Body)
+			}
+			alice.cookies[csrfCookieName] = own
+		}
+	}
+
+	// None of the rejected requests touched the session.
+	if rec := alice.post("/api/v1/auth/refresh", "", own); rec.Code != http.StatusOK {
+		t.Fatalf("refresh with the session's token: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCookieSessionRefreshRotates(t *testing.T) {
+	alice := newBrowser(t, newCookieRouter(t))
+	alice.login("alice")
+	csrf := alice.cookies[csrfCookieName]
+	old := alice.cookies[refreshCookieName]
+
+	rec := alice.post("/api/v1/auth/refresh", "", csrf)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d: %s", rec.Code, rec.Body)
+	}
+	if alice.cookies[refreshCookieName] == old || alice.cookies[csrfCookieName] != csrf {
+		t.Fatalf("refresh kept the refresh token or replaced the CSRF token: %v", alice.cookies)
+	}
+
+	// The replaced token cannot be exchanged again, say by whoever stole it.
+	thief := newBrowser(t, alice.handler)
+	thief.cookies = map[string]string{refreshCookieName: old, csrfCookieName: csrf}
+	if rec := thief.post("/api/v1/auth/refresh", "", csrf); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh with the rotated token: status %d: %s; want 401", rec.Code, rec.Body)
+	}
+	if _, ok := thief.cookies[refreshCookieName]; ok {
+		t.Fatal("a rejected refresh did not clear the refresh cookie")
+	}
+
+	if rec := alice.post("/api/v1/auth/refresh", "", csrf); rec.Code != http.StatusOK {
+		t.Fatalf("refresh with the new token: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCookieSessionLogout(t *testing.T) {
+	alice := newBrowser(t, newCookieRouter(t))
+	alice.login("alice")
+	csrf := alice.cookies[csrfCookieName]
+	refresh := alice.cookies[refreshCookieName]
+
+	if rec := alice.post("/api/v1/auth/logout", "", csrf); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: status %d: %s", rec.Code, rec.Body)
+	}
+	if len(alice.cookies) != 0 {
+		t.Fatalf("cookies left after logout: %v", alice.cookies)
+	}
+
+	// A copy of the refresh cookie is worthless once signed out.
+	alice.cookies = map[string]string{refreshCookieName: refresh, csrfCookieName: csrf}
+	if rec := alice.post("/api/v1/auth/refresh", "", csrf); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: status %d: %s; want 401", rec.Code, rec.Body)
+	}
+
+	// Signing out again, or without a session, just clears the cookies.
+	alice.cookies = map[string]string{refreshCookieName: refresh, csrfCookieName: csrf}
+	if rec := alice.post("/api/v1/auth/logout", "", csrf); rec.Code != http.StatusNoContent {
+		t.Fatalf("second logout: status %d: %s", rec.Code, rec.Body)
+	}
+	alice.cookies = map[string]string{refreshCookieName: "garbage"}
+	if rec := alice.post("/api/v1/auth/logout", "", ""); rec.Code != http.StatusNoContent || len(alice.cookies) != 0 {
+		t.Fatalf("logout without a session: status %d, cookies %v", rec.Code, alice.cookies)
+	}
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig lists the browser origins allowed to call the API.
+type CORSConfig struct {
+	// AllowedOrigins are full origins such as https://shop.example.com. "*"
+	// allows any origin but cannot be combined with AllowCredentials.
+	AllowedOrigins []string
+	// AllowCredentials lets allowed origins send cookies, which cookie
+	// sessions on another origin need.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer.
+	MaxAge time.Duration
+}
+
+var (
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	corsAllowedHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key", "X-Request-ID", csrfHeader}
+	corsExposedHeaders = []string{"X-Request-ID"}
+)
+
+// CORS applies the policy in c. It answers preflight requests itself, so it
+// must be used on the root router before any route is registered. Requests
+// from other origins pass through without CORS headers and the browser
+// withholds the response.
+func CORS(c CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(c.AllowedOrigins, "*") && !c.AllowCredentials
+	allowed := func(origin string) bool {
+		return anyOrigin || slices.Contains(c.AllowedOrigins, origin)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if c.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			if c.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
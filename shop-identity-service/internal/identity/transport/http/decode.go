@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/jsonbody"
+	"github.com/hawful70/shop-identity-service/internal/identity/validate"
+)
+
+// maxJSONBodyBytes bounds request bodies; the largest real one is a few
+// hundred bytes.
+const maxJSONBodyBytes = 64 << 10
+
+var (
+	// errInvalidJSON is returned for request bodies that do not decode.
+	errInvalidJSON          = identity.NewError(identity.KindInvalidArgument, "invalid_json", "invalid JSON")
+	errEmptyBody            = identity.NewError(identity.KindInvalidArgument, "invalid_json", "request body is empty")
+	errNotAnObject          = identity.NewError(identity.KindInvalidArgument, "invalid_json", "request body must be a single JSON object")
+	errBodyTooLarge         = identity.NewError(identity.KindInvalidArgument, "body_too_large", fmt.Sprintf("request body is larger than %d bytes", maxJSONBodyBytes))
+	errUnsupportedMediaType = identity.NewError(identity.KindInvalidArgument, "unsupported_media_type", "Content-Type must be application/json")
+)
+
+// requestBodies are the types readJSON decodes. Their validate tags are
+// checked when the package loads, as the gRPC rules are, so that a bad tag
+// fails at startup rather than on the first request.
+var requestBodies = mustValidate(
+	registerRequest{},
+	loginRequest{},
+	changePasswordRequest{},
+	startImpersonationRequest{},
+	createOrganizationRequest{},
+	inviteRequest{},
+	acceptInvitationRequest{},
+	switchOrganizationRequest{},
+	createSCIMTokenRequest{},
+)
+
+func mustValidate(bodies ...any) []any {
+	for _, body := range bodies {
+		validate.MustStruct(body)
+	}
+	return bodies
+}
+
+// readJSON decodes the request body into dst and checks its validate tags.
+// Bodies must be application/json, at most maxJSONBodyBytes, a single
+// object, and use only the fields dst declares. It writes a problem and
+// returns false when any of that fails.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := jsonbody.Decode(w, r, dst, jsonbody.Options{
+		MediaTypes:            []string{"application/json"},
+		MaxBytes:              maxJSONBodyBytes,
+		DisallowUnknownFields: true,
+	})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, jsonbody.ErrUnsupportedMediaType):
+			apierror.WriteStatus(w, r, http.StatusUnsupportedMediaType, errUnsupportedMediaType)
+		case errors.As(err, &tooLarge):
+			apierror.WriteStatus(w, r, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+		default:
+			apierror.Write(w, r, decodeError(err))
+		}
+		return false
+	}
+
+	if err := validate.Struct(dst); err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	return true
+}
+
+// decodeError points at the offending field where encoding/json says which
+// one it is.
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return errEmptyBody
+	case errors.Is(err, jsonbody.ErrTrailingData):
+		return errNotAnObject
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return errNotAnObject
+		}
+		return identity.InvalidField(typeErr.Field, fmt.Sprintf("%s must be %s", typeErr.Field, jsonType(typeErr.Type)))
+	}
+	// encoding/json has no error type for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return identity.NewError(identity.KindInvalidArgument, "unknown_field", "unknown field "+field,
+			identity.FieldError{Field: field, Message: field + " is not a known field"})
+	}
+	return errInvalidJSON
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return "a number"
+}
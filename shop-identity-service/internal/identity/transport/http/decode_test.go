@@ -0,0 +1,81 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+func TestReadJSON(t *testing.T) {
+	valid := `{"email":"a@example.com","username":"alice","password":"secret"}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    identity.Code
+		wantField   string
+	}{
+		{"valid", "application/json", valid, http.StatusOK, "", ""},
+		{"content type parameters", "application/json; charset=utf-8", valid, http.StatusOK, "", ""},
+		{"missing content type", "", valid, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"wrong content type", "text/plain", valid, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"form content type", "application/x-www-form-urlencoded", "email=a%40example.com", http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"empty body", "application/json", "", http.StatusBadRequest, "invalid_json", ""},
+		{"malformed", "application/json", `{"email":`, http.StatusBadRequest, "invalid_json", ""},
+		{"not an object", "application/json", `["a@example.com"]`, http.StatusBadRequest, "invalid_json", ""},
+		{"unknown field", "application/json", `{"email":"a@example.com","username":"alice","password":"secret","role":"admin"}`, http.StatusBadRequest, "unknown_field", "role"},
+		{"trailing object", "application/json", valid + valid, http.StatusBadRequest, "invalid_json", ""},
+		{"trailing garbage", "application/json", valid + ` x`, http.StatusBadRequest, "invalid_json", ""},
+		{"trailing whitespace", "application/json", valid + "\n\t ", http.StatusOK, "", ""},
+		{"wrong field type", "application/json", `{"email":"a@example.com","username":42,"password":"secret"}`, http.StatusBadRequest, "invalid_field", "username"},
+		{"fails validation", "application/json", `{"email":"a@example.com","password":"secret"}`, http.StatusBadRequest, "invalid_request", "username"},
+		{"too large", "application/json", `{"email":"` + strings.Repeat("a", maxJSONBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", ""},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+
+		var dst registerRequest
+		ok := readJSON(rec, req, &dst)
+		if tc.wantStatus == http.StatusOK {
+			if !ok || dst.Username != "alice" {
+				t.Errorf("%s: readJSON = %v, %+v; body %s", tc.name, ok, dst, rec.Body)
+			}
+			continue
+		}
+
+		var problem apierror.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("%s: decode problem %q: %v", tc.name, rec.Body, err)
+		}
+		if ok || rec.Code != tc.wantStatus || problem.Code != tc.wantCode {
+			t.Errorf("%s: readJSON = %v, %d %s; want false, %d %s", tc.name, ok, rec.Code, problem.Code, tc.wantStatus, tc.wantCode)
+		}
+		if tc.wantField != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tc.wantField) {
+			t.Errorf("%s: field errors = %+v, want one for %s", tc.name, problem.Errors, tc.wantField)
+		}
+	}
+}
+
+func TestReadJSONUncheckedBody(t *testing.T) {
+	// A body type missing from requestBodies with a broken tag fails the
+	// request rather than the process.
+	var dst struct {
+		Name string `json:"name" validate:"requird"`
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if readJSON(rec, req, &dst) || rec.Code != http.StatusInternalServerError {
+		t.Fatalf("readJSON with a broken tag = %d, want 500", rec.Code)
+	}
+}
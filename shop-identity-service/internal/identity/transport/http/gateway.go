@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// registerGatewayRoutes mounts the routes annotated in identity.proto. Over
+// HTTP they are for tenant admins; services call the gRPC port with client
+// certificates.
+func (h *Handler) registerGatewayRoutes(r chi.Router) {
+	gateway := stripTenantPrefix(h.gateway)
+	r.Get("/users", gateway.ServeHTTP)
+	r.Get("/users/{userID}", gateway.ServeHTTP)
+	r.Get("/users:batchGet", gateway.ServeHTTP)
+	r.Get("/users:lookup", gateway.ServeHTTP)
+	r.Get("/users:watch", withoutWriteDeadline(gateway).ServeHTTP)
+	r.Post("/tokens:validate", gateway.ServeHTTP)
+}
+
+// stripTenantPrefix removes /t/{tenant} from the path: the gateway matches
+// /api/v1/... and the tenant is already in the request context.
+func stripTenantPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := chi.URLParam(r, TenantURLParam)
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		prefix := "/t/" + tenant
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// withoutWriteDeadline lets a stream outlive the server's write timeout; it
+// ends when the client leaves or the server shuts down.
+func withoutWriteDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
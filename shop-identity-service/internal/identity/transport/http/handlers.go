@@ -1,39 +1,132 @@
 package http
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
 )
 
 type Handler struct {
-	svc        identity.Service
-	jwtManager *identity.JWTManager
+	svc            identity.Service
+	jwtManager     *identity.JWTManager
+	idempotency    repository.IdempotencyRepository
+	idempotencyTTL time.Duration
+	idempotencyKey []byte
+	tenants        *identity.TenantRegistry
+	orgs           identity.OrganizationService
+	provisioning   identity.ProvisioningService
+	gateway        http.Handler
+	cookies        *CookieConfig
+	csrfKey        []byte
 }
 
-func NewHandler(svc identity.Service, jwtManager *identity.JWTManager) *Handler {
-	return &Handler{svc: svc, jwtManager: jwtManager}
+type HandlerOption func(*Handler)
+
+// WithIdempotency enables Idempotency-Key support on registration. Stored
+// responses are replayed for ttl. Request fingerprints are HMACs keyed by
+// secret, since registration bodies carry passwords.
+func WithIdempotency(store repository.IdempotencyRepository, ttl time.Duration, secret []byte) HandlerOption {
+	return func(h *Handler) {
+		h.idempotency = store
+		h.idempotencyTTL = ttl
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("idempotency fingerprint"))
+		h.idempotencyKey = mac.Sum(nil)
+	}
+}
+
+// WithTenants enables host and path based tenant resolution.
+func WithTenants(tenants *identity.TenantRegistry) HandlerOption {
+	return func(h *Handler) {
+		h.tenants = tenants
+	}
+}
+
+// WithOrganizations enables the organization and membership endpoints.
+func WithOrganizations(orgs identity.OrganizationService) HandlerOption {
+	return func(h *Handler) {
+		h.orgs = orgs
+	}
+}
+
+// WithProvisioning lets tenant admins manage SCIM tokens.
+func WithProvisioning(provisioning identity.ProvisioningService) HandlerOption {
+	return func(h *Handler) {
+		h.provisioning = provisioning
+	}
+}
+
+// WithGateway serves the gRPC API's HTTP/JSON routes to tenant admins.
+func WithGateway(gateway http.Handler) HandlerOption {
+	return func(h *Handler) {
+		h.gateway = gateway
+	}
 }
 
+func NewHandler(svc identity.Service, jwtManager *identity.JWTManager, opts ...HandlerOption) *Handler {
+	h := &Handler{svc: svc, jwtManager: jwtManager}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// RegisterRoutes may be mounted under a pattern containing {tenant} to
+// select the tenant by path.
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	// Route registration logic goes here
-	r.Post("/auth/register", h.handleRegister)
+	r.Use(h.tenantMiddleware)
+
+	r.Post("/auth/register", h.idempotent(h.handleRegister))
 	r.Post("/auth/login", h.handleLogin)
+	r.Get("/auth/username/availability", h.handleUsernameAvailability)
+	if h.cookies != nil {
+		r.Post("/auth/refresh", h.handleRefresh)
+		r.Post("/auth/logout", h.handleLogout)
+	}
 
 	r.Group(func(protected chi.Router) {
 		protected.Use(h.jwtAuthMiddleware)
 		protected.Get("/auth/me", h.handleMe)
+		protected.Post("/auth/impersonation/end", h.handleEndImpersonation)
+		if h.orgs != nil {
+			h.registerOrganizationRoutes(protected)
+		}
+	})
+
+	r.Group(func(admin chi.Router) {
+		admin.Use(h.jwtAuthMiddleware, h.requireRole(identity.RoleAdmin))
+		admin.Post("/admin/impersonations", h.handleStartImpersonation)
+		if h.provisioning != nil {
+			admin.Post("/admin/scim/tokens", h.handleCreateSCIMToken)
+			admin.Get("/admin/scim/tokens", h.handleListSCIMTokens)
+			admin.Delete("/admin/scim/tokens/{tokenID}", h.handleRevokeSCIMToken)
+		}
+		if h.gateway != nil {
+			h.registerGatewayRoutes(admin)
+		}
+	})
+
+	// Also reachable with a password change challenge token from login.
+	r.Group(func(challenged chi.Router) {
+		challenged.Use(h.passwordChangeAuthMiddleware)
+		challenged.Post("/auth/password/change", h.handleChangePassword)
 	})
 }
 
 type registerRequest struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=254"`
+	Username string `json:"username" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
 }
 
 type registerResponse struct {
@@ -44,21 +137,13 @@ type registerResponse struct {
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	var req registerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if !readJSON(w, r, &req) {
 		return
 	}
 
 	user, err := h.svc.Register(r.Context(), req.Email, req.Username, req.Password)
 	if err != nil {
-		switch err {
-		case identity.ErrEmailTaken:
-			http.Error(w, err.Error(), http.StatusConflict)
-		case identity.ErrPasswordTooWeak, identity.ErrEmailRequired:
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		default:
-			http.Error(w, "internal error", http.StatusInternalServerError)
-		}
+		apierror.Write(w, r, err)
 		return
 	}
 
@@ -73,9 +158,13 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(res)
 }
 
+// loginRequest takes either email or username. Session "cookie" asks for
+// a browser session instead of a token in the body.
 type loginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"max=254"`
+	Username string `json:"username" validate:"max=64"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
+	Session  string `json:"session" validate:"oneof=token cookie"`
 }
 
 type loginResponse struct {
@@ -83,26 +172,82 @@ type loginResponse struct {
 	TokenType   string `json:"token_type"`
 }
 
+type loginChallengeResponse struct {
+	Challenge      string `json:"challenge"`
+	ChallengeToken string `json:"challenge_token"`
+	TokenType      string `json:"token_type"`
+}
+
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	login := req.Email
+	if login == "" {
+		login = req.Username
+	}
+	if login == "" {
+		apierror.Write(w, r, identity.InvalidField("email", "email or username is required"))
+		return
+	}
+	cookies := req.Session == sessionModeCookie
+	if cookies && h.cookies == nil {
+		apierror.Write(w, r, errCookieSessionDisabled)
 		return
 	}
 
-	_, token, err := h.svc.Login(r.Context(), req.Email, req.Password)
+	_, token, err := h.svc.Login(r.Context(), login, req.Password)
 	if err != nil {
-		if err == identity.ErrInvalidLogin {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		if errors.Is(err, identity.ErrPasswordChangeRequired) {
+			writeChallenge(w, token)
 			return
 		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	res := loginResponse{
-		AccessToken: token,
-		TokenType:   "Bearer",
+	h.writeToken(w, r, token, cookies)
+}
+
+// writeChallenge answers with a password change challenge token. It is
+// always returned in the body, also to cookie sessions.
+func writeChallenge(w http.ResponseWriter, token string) {
+	res := loginChallengeResponse{
+		Challenge:      identity.PurposePasswordChange,
+		ChallengeToken: token,
+		TokenType:      "Bearer",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+type usernameAvailabilityResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func (h *Handler) handleUsernameAvailability(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		apierror.Write(w, r, identity.InvalidField("username", "username query parameter is required"))
+		return
+	}
+
+	res := usernameAvailabilityResponse{Username: username, Available: true}
+	if err := h.svc.CheckUsername(r.Context(), username); err != nil {
+		switch {
+		case errors.Is(err, identity.ErrUsernameTaken), errors.Is(err, identity.ErrUsernameLength),
+			errors.Is(err, identity.ErrUsernameInvalid), errors.Is(err, identity.ErrUsernameReserved):
+			res.Available = false
+			res.Reason = err.Error()
+		default:
+			apierror.Write(w, r, err)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -118,7 +263,7 @@ type meResponse struct {
 func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
 	claims, ok := identity.ClaimsFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
 		return
 	}
 
@@ -132,18 +277,114 @@ func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(res)
 }
 
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required,maxbytes=72"`
+	NewPassword     string `json:"new_password" validate:"required,maxbytes=72"`
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	if claims.Impersonated() {
+		apierror.Write(w, r, identity.ErrImpersonationNotAllowed)
+		return
+	}
+
+	var req changePasswordRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.svc.ChangePassword(r.Context(), identity.UserID(claims.UserID), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	h.writeToken(w, r, token, authenticatedByCookie(r.Context()))
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// passwordChangeAuthMiddleware accepts either an access token or a password
+// change challenge token.
+func (h *Handler) passwordChangeAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, fromCookie, ok := h.requestToken(r)
+		if !ok {
+			apierror.Write(w, r, identity.ErrAuthenticationRequired)
+			return
+		}
+
+		claims, err := h.jwtManager.VerifyToken(token)
+		if err != nil {
+			claims, err = h.jwtManager.VerifyPurposeToken(token, identity.PurposePasswordChange)
+		}
+		if err != nil || !h.sameTenant(r, claims) {
+			apierror.Write(w, r, identity.ErrInvalidToken)
+			return
+		}
+		if !h.checkSession(w, r, claims) {
+			return
+		}
+		if fromCookie {
+			if !h.checkCSRF(w, r, claims) {
+				return
+			}
+			r = withCookieAuth(r, token)
+		}
+
+		ctx := identity.ContextWithClaims(r.Context(), claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// jwtAuthMiddleware takes the access token from the Authorization header or,
+// with cookie sessions, from the access cookie. Unsafe requests authenticated
+// by cookie must also pass the CSRF check.
 func (h *Handler) jwtAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
-			http.Error(w, "missing or invalid authorization header", http.StatusUnauthorized)
+		token, fromCookie, ok := h.requestToken(r)
+		if !ok {
+			apierror.Write(w, r, identity.ErrAuthenticationRequired)
 			return
 		}
 
-		claims, err := h.jwtManager.VerifyToken(parts[1])
+		claims, err := h.jwtManager.VerifyToken(token)
 		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			apierror.Write(w, r, identity.ErrInvalidToken)
+			return
+		}
+		if !h.sameTenant(r, claims) {
+			apierror.Write(w, r, identity.ErrInvalidToken)
+			return
+		}
+		if !h.checkSession(w, r, claims) {
+			return
+		}
+		if fromCookie {
+			if !h.checkCSRF(w, r, claims) {
+				return
+			}
+			r = withCookieAuth(r, token)
+		}
+
+		if err := h.svc.TrackImpersonation(r.Context(), claims, r.Method+" "+r.URL.Path); err != nil {
+			if errors.Is(err, identity.ErrImpersonationNotActive) || errors.Is(err, identity.ErrImpersonationDisabled) {
+				apierror.Write(w, r, identity.ErrInvalidToken)
+				return
+			}
+			apierror.Write(w, r, err)
 			return
 		}
 
@@ -151,3 +392,33 @@ func (h *Handler) jwtAuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// checkSession writes an error and returns false when the user behind claims
+// was suspended or signed out everywhere.
+func (h *Handler) checkSession(w http.ResponseWriter, r *http.Request, claims identity.Claims) bool {
+	if err := h.svc.CheckSession(r.Context(), claims); err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	return true
+}
+
+// sameTenant rejects tokens issued by another storefront.
+func (h *Handler) sameTenant(r *http.Request, claims identity.Claims) bool {
+	tenant, ok := identity.TenantFromContext(r.Context())
+	return !ok || claims.Tenant() == tenant.ID
+}
+
+// requireRole must run after jwtAuthMiddleware.
+func (h *Handler) requireRole(role identity.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := identity.ClaimsFromContext(r.Context())
+			if !ok || identity.Role(claims.Role) != role {
+				apierror.Write(w, r, identity.ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	errIdempotencyKeyTooLong = identity.NewError(identity.KindInvalidArgument, "idempotency_key_too_long", "Idempotency-Key is too long")
+	errIdempotencyKeyReused  = identity.NewError(identity.KindInvalidArgument, "idempotency_key_reused", "Idempotency-Key was used with a different request")
+	errIdempotencyInProgress = identity.NewError(identity.KindConflict, "idempotency_request_in_progress", "a request with this Idempotency-Key is still in progress")
+	errInvalidBody           = identity.NewError(identity.KindInvalidArgument, "invalid_body", "invalid request body")
+)
+
+// idempotent replays the stored response when a request is retried with the
+// same Idempotency-Key. Requests without the header pass straight through.
+// Server errors and panics are not stored so that the client can retry them.
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || h.idempotency == nil {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			apierror.Write(w, r, errIdempotencyKeyTooLong)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.WriteStatus(w, r, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+				return
+			}
+			apierror.Write(w, r, errInvalidBody)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The body holds a plaintext password, so the stored fingerprint is
+		// keyed: without the key it cannot be used to test guesses.
+		sum := hmac.New(sha256.New, h.idempotencyKey)
+		sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		sum.Write(body)
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		// Keys are chosen by clients, so keep tenants from colliding.
+		if tenant, ok := identity.TenantFromContext(r.Context()); ok {
+			key = string(tenant.ID) + ":" + key
+		}
+
+		rec, reserved, err := h.idempotency.Reserve(r.Context(), key, fingerprint, h.idempotencyTTL)
+		if err != nil {
+			apierror.Write(w, r, fmt.Errorf("idempotency reserve: %w", err))
+			return
+		}
+
+		if !reserved {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				apierror.WriteStatus(w, r, http.StatusUnprocessableEntity, errIdempotencyKeyReused)
+			case !rec.Completed():
+				apierror.Write(w, r, errIdempotencyInProgress)
+			default:
+				if rec.ContentType != "" {
+					w.Header().Set("Content-Type", rec.ContentType)
+				}
+				w.Header().Set(idempotentReplayHeader, "true")
+				w.WriteHeader(rec.StatusCode)
+				_, _ = w.Write(rec.Body)
+			}
+			return
+		}
+
+		// Release the key unless a response is stored, including when next
+		// panics, so that the client can retry instead of getting 409s.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			ctx, cancel := detachedContext(r.Context())
+			defer cancel()
+			if err := h.idempotency.Release(ctx, key); err != nil {
+				slog.ErrorContext(ctx, "idempotency release failed", "error", err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		ctx, cancel := detachedContext(r.Context())
+		defer cancel()
+		if err := h.idempotency.Complete(ctx, key, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			slog.ErrorContext(ctx, "idempotency complete failed", "error", err)
+			return
+		}
+		stored = true
+	}
+}
+
+// detachedContext outlives the request: the client may already have gone
+// away, which is exactly the case the stored response is for.
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+}
+
+// responseRecorder passes the response through while keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+type startImpersonationRequest struct {
+	UserID string `json:"user_id" validate:"required,max=128"`
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
+
+type startImpersonationResponse struct {
+	SessionID   string    `json:"session_id"`
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (h *Handler) handleStartImpersonation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req startImpersonationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, session, err := h.svc.StartImpersonation(r.Context(), claims, identity.UserID(req.UserID), req.Reason)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := startImpersonationResponse{
+		SessionID:   session.ID,
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresAt:   session.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) handleEndImpersonation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	if err := h.svc.EndImpersonation(r.Context(), claims); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
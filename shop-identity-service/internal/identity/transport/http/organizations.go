@@ -0,0 +1,250 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+func (h *Handler) registerOrganizationRoutes(r chi.Router) {
+	r.Post("/orgs", h.handleCreateOrganization)
+	r.Get("/orgs", h.handleListOrganizations)
+	r.Post("/orgs/invitations/accept", h.handleAcceptInvitation)
+	r.Get("/orgs/{orgID}/members", h.handleListMembers)
+	r.Delete("/orgs/{orgID}/members/{userID}", h.handleRemoveMember)
+	r.Post("/orgs/{orgID}/invitations", h.handleInvite)
+	r.Post("/auth/org/switch", h.handleSwitchOrganization)
+}
+
+type createOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+type organizationResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *Handler) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req createOrganizationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	org, err := h.orgs.CreateOrganization(r.Context(), claims, req.Name)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := organizationResponse{
+		ID:        string(org.ID),
+		Name:      org.Name,
+		Role:      string(identity.OrgRoleOwner),
+		CreatedAt: org.CreatedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) handleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	orgs, err := h.orgs.ListOrganizations(r.Context(), claims)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := make([]organizationResponse, 0, len(orgs))
+	for _, o := range orgs {
+		res = append(res, organizationResponse{
+			ID:        string(o.Organization.ID),
+			Name:      o.Organization.Name,
+			Role:      string(o.Role),
+			CreatedAt: o.Organization.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+type memberResponse struct {
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func (h *Handler) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	orgID := identity.OrganizationID(chi.URLParam(r, "orgID"))
+	members, err := h.orgs.ListMembers(r.Context(), claims, orgID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := make([]memberResponse, 0, len(members))
+	for _, m := range members {
+		res = append(res, memberResponse{
+			UserID:   string(m.User.ID),
+			Email:    m.User.Email,
+			Username: m.User.Username,
+			Role:     string(m.Role),
+			JoinedAt: m.JoinedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	orgID := identity.OrganizationID(chi.URLParam(r, "orgID"))
+	userID := identity.UserID(chi.URLParam(r, "userID"))
+	if err := h.orgs.RemoveMember(r.Context(), claims, orgID, userID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type inviteRequest struct {
+	Email string `json:"email" validate:"required,max=254"`
+	Role  string `json:"role" validate:"required,oneof=owner buyer approver"`
+}
+
+type invitationResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (h *Handler) handleInvite(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req inviteRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	orgID := identity.OrganizationID(chi.URLParam(r, "orgID"))
+	inv, err := h.orgs.Invite(r.Context(), claims, orgID, req.Email, identity.OrgRole(req.Role))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := invitationResponse{
+		ID:        inv.ID,
+		Email:     inv.Email,
+		Role:      string(inv.Role),
+		ExpiresAt: inv.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" validate:"required,max=512"`
+}
+
+type membershipResponse struct {
+	OrganizationID string `json:"organization_id"`
+	Role           string `json:"role"`
+}
+
+func (h *Handler) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req acceptInvitationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	member, err := h.orgs.AcceptInvitation(r.Context(), claims, req.Token)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := membershipResponse{
+		OrganizationID: string(member.OrganizationID),
+		Role:           string(member.Role),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// switchOrganizationRequest with an empty organization_id switches back to
+// the personal account.
+type switchOrganizationRequest struct {
+	OrganizationID string `json:"organization_id" validate:"max=128"`
+}
+
+func (h *Handler) handleSwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req switchOrganizationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.orgs.SwitchOrganization(r.Context(), claims, identity.OrganizationID(req.OrganizationID))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	h.writeToken(w, r, token, authenticatedByCookie(r.Context()))
+}
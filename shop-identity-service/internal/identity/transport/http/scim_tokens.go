@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+type createSCIMTokenRequest struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+type scimTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func toSCIMTokenResponse(t identity.SCIMToken) scimTokenResponse {
+	return scimTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+// handleCreateSCIMToken returns the plain token once; only its hash is kept.
+func (h *Handler) handleCreateSCIMToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	var req createSCIMTokenRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, t, err := h.provisioning.CreateSCIMToken(r.Context(), claims, req.Name)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := toSCIMTokenResponse(t)
+	res.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) handleListSCIMTokens(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	tokens, err := h.provisioning.ListSCIMTokens(r.Context(), claims)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	res := make([]scimTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		res = append(res, toSCIMTokenResponse(t))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (h *Handler) handleRevokeSCIMToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := identity.ClaimsFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, identity.ErrAuthenticationRequired)
+		return
+	}
+
+	if err := h.provisioning.RevokeSCIMToken(r.Context(), claims, chi.URLParam(r, "tokenID")); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/apierror"
+)
+
+// TenantURLParam is the chi URL parameter for path-based tenant routing,
+// e.g. /t/{tenant}/api/v1/auth/login.
+const TenantURLParam = "tenant"
+
+// tenantMiddleware resolves the tenant from the {tenant} path parameter,
+// then the Host header, and falls back to the default tenant.
+func (h *Handler) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.tenants == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var tenant identity.Tenant
+		if id := chi.URLParam(r, TenantURLParam); id != "" {
+			t, ok := h.tenants.Tenant(identity.TenantID(id))
+			if !ok {
+				apierror.Write(w, r, repository.ErrTenantNotFound)
+				return
+			}
+			tenant = t
+		} else if t, ok := h.tenants.TenantByHost(r.Host); ok {
+			tenant = t
+		} else {
+			tenant = h.tenants.Default()
+		}
+
+		ctx := identity.ContextWithTenant(r.Context(), tenant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,56 @@
+// Package jsonbody decodes JSON request bodies the same way for the REST and
+// SCIM APIs. Each API reports the errors in its own format.
+package jsonbody
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+)
+
+var (
+	// ErrUnsupportedMediaType is returned when the Content-Type is missing or
+	// not one of Options.MediaTypes.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// ErrTrailingData is returned when the body holds more than one value.
+	ErrTrailingData = errors.New("request body must be a single JSON value")
+)
+
+type Options struct {
+	// MediaTypes are the accepted Content-Types, without parameters.
+	MediaTypes []string
+	// MaxBytes bounds the body. Reading past it fails with
+	// *http.MaxBytesError and makes the server close the connection.
+	MaxBytes int64
+	// DisallowUnknownFields rejects object keys dst does not declare.
+	DisallowUnknownFields bool
+}
+
+// Decode reads the request body into dst. Besides ErrUnsupportedMediaType,
+// ErrTrailingData and *http.MaxBytesError it returns io.EOF for an empty
+// body and encoding/json's errors.
+func Decode(w http.ResponseWriter, r *http.Request, dst any, opts Options) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(opts.MediaTypes, mediaType) {
+		return ErrUnsupportedMediaType
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.MaxBytes))
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return ErrTrailingData
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package scim
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidFilter = errors.New(`only "attribute op value" comparisons with eq, co or sw, joined by "and" or "or", are supported`)
+
+// comparison is one "attribute op value" term of a filter. Attribute names
+// and operators are lower-cased since SCIM treats them case-insensitively.
+type comparison struct {
+	Attr  string
+	Op    string
+	Value string
+}
+
+// matches compares an attribute value with the term. caseExact attributes,
+// such as id and externalId, compare byte for byte.
+func (c comparison) matches(value string, caseExact bool) bool {
+	want := c.Value
+	if !caseExact {
+		value, want = strings.ToLower(value), strings.ToLower(want)
+	}
+	switch c.Op {
+	case "co":
+		return strings.Contains(value, want)
+	case "sw":
+		return strings.HasPrefix(value, want)
+	}
+	return value == want
+}
+
+// parseFilter parses the subset of the RFC 7644 filter grammar that
+// directories use to look up resources: eq, co and sw comparisons joined by
+// "and" and "or", without grouping. "and" binds tighter than "or", so the
+// result is a list of alternatives, each a list of terms that must all hold.
+func parseFilter(filter string) ([][]comparison, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		alternatives [][]comparison
+		terms        []comparison
+	)
+	for {
+		if len(tokens) < 3 || tokens[0].quoted || tokens[1].quoted {
+			return nil, errInvalidFilter
+		}
+		op := strings.ToLower(tokens[1].text)
+		if op != "eq" && op != "co" && op != "sw" {
+			return nil, errInvalidFilter
+		}
+		terms = append(terms, comparison{
+			Attr:  strings.ToLower(strings.TrimPrefix(tokens[0].text, schemaUser+":")),
+			Op:    op,
+			Value: tokens[2].text,
+		})
+		tokens = tokens[3:]
+
+		if len(tokens) == 0 {
+			break
+		}
+		if len(tokens) == 1 || tokens[0].quoted {
+			return nil, errInvalidFilter
+		}
+		switch strings.ToLower(tokens[0].text) {
+		case "and":
+		case "or":
+			alternatives = append(alternatives, terms)
+			terms = nil
+		default:
+			return nil, errInvalidFilter
+		}
+		tokens = tokens[1:]
+	}
+	return append(alternatives, terms), nil
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			// Find the closing quote, skipping escaped characters.
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, errInvalidFilter
+			}
+			text, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, errInvalidFilter
+			}
+			tokens = append(tokens, filterToken{text: text, quoted: true})
+			i = j + 1
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, errInvalidFilter
+		default:
+			j := i
+			for j < len(s) && s[j] != ' ' && s[j] != '\t' && s[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
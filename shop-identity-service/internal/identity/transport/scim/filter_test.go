@@ -0,0 +1,278 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   [][]comparison
+	}{
+		{`userName eq "alice@example.com"`, [][]comparison{{{"username", "eq", "alice@example.com"}}}},
+		{`USERNAME EQ "Alice"`, [][]comparison{{{"username", "eq", "Alice"}}}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "alice"`, [][]comparison{{{"username", "eq", "alice"}}}},
+		{`emails.value co "@example.com"`, [][]comparison{{{"emails.value", "co", "@example.com"}}}},
+		{`userName sw "al"`, [][]comparison{{{"username", "sw", "al"}}}},
+		{`active eq true`, [][]comparison{{{"active", "eq", "true"}}}},
+		{`externalId eq "00u1" and active eq "true"`, [][]comparison{{{"externalid", "eq", "00u1"}, {"active", "eq", "true"}}}},
+		{`userName eq "a" or userName eq "b"`, [][]comparison{{{"username", "eq", "a"}}, {{"username", "eq", "b"}}}},
+		// "and" binds tighter than "or".
+		{`userName sw "a" and active eq true or externalId eq "x"`, [][]comparison{
+			{{"username", "sw", "a"}, {"active", "eq", "true"}},
+			{{"externalid", "eq", "x"}},
+		}},
+		{`userName eq "a" OR userName eq "b" AND roles eq "seller"`, [][]comparison{
+			{{"username", "eq", "a"}},
+			{{"username", "eq", "b"}, {"roles", "eq", "seller"}},
+		}},
+
+		// Quoting: operators, spaces and escapes inside values are literal.
+		{`userName eq "john and jane"`, [][]comparison{{{"username", "eq", "john and jane"}}}},
+		{`displayName eq "Sales or Support"`, [][]comparison{{{"displayname", "eq", "Sales or Support"}}}},
+		{`userName eq "say \"hi\""`, [][]comparison{{{"username", "eq", `say "hi"`}}}},
+		{`userName eq "back\\slash"`, [][]comparison{{{"username", "eq", `back\slash`}}}},
+		{`userName eq ""`, [][]comparison{{{"username", "eq", ""}}}},
+		{"userName\teq\t\"tab\"", [][]comparison{{{"username", "eq", "tab"}}}},
+	}
+	for _, tc := range tests {
+		got, err := parseFilter(tc.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tc.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseFilter(%q) = %+v, want %+v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`   `,
+		`userName`,
+		`userName eq`,
+		`userName pr`,
+		`userName ne "alice"`,
+		`userName gt "alice"`,
+		`userName ew "alice"`,
+		`"userName" eq "alice"`,
+		`userName "eq" "alice"`,
+		`userName eq "alice`,
+		`userName eq "bad \q escape"`,
+		`userName eq "a" and`,
+		`userName eq "a" or`,
+		`userName eq "a" userName eq "b"`,
+		`userName eq "a" "and" userName eq "b"`,
+		`userName eq "a" xor userName eq "b"`,
+		`and userName eq "a"`,
+		`(userName eq "a")`,
+		`not (userName eq "a")`,
+		`emails[type eq "work"]`,
+		`userName eq "a" and (active eq true or active eq false)`,
+	} {
+		if got, err := parseFilter(filter); err == nil {
+			t.Errorf("parseFilter(%q) = %+v, want an error", filter, got)
+		}
+	}
+}
+
+func TestComparisonMatches(t *testing.T) {
+	tests := []struct {
+		term      comparison
+		value     string
+		caseExact bool
+		want      bool
+	}{
+		{comparison{"username", "eq", "Alice"}, "alice", false, true},
+		{comparison{"externalid", "eq", "00U1"}, "00u1", true, false},
+		{comparison{"username", "co", "LIC"}, "alice", false, true},
+		{comparison{"username", "co", "bob"}, "alice", false, false},
+		{comparison{"username", "sw", "Al"}, "alice", false, true},
+		{comparison{"username", "sw", "ice"}, "alice", false, false},
+		{comparison{"externalid", "sw", "00u"}, "00U1", true, false},
+		{comparison{"username", "co", ""}, "alice", false, true},
+	}
+	for _, tc := range tests {
+		if got := tc.term.matches(tc.value, tc.caseExact); got != tc.want {
+			t.Errorf("%+v matches %q (caseExact %v) = %v, want %v", tc.term, tc.value, tc.caseExact, got, tc.want)
+		}
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`displayName eq "sellers"`, []string{"seller"}},
+		{`displayName sw "c"`, []string{"customer"}},
+		{`displayName co "ER"`, []string{"customer", "seller"}},
+		{`displayName eq "Customers" or id eq "seller"`, []string{"customer", "seller"}},
+		{`displayName co "s" and id eq "seller"`, []string{"seller"}},
+		{`members eq "u1"`, nil},
+	}
+	for _, tc := range tests {
+		alternatives, err := parseFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("parseFilter(%q): %v", tc.filter, err)
+		}
+		var got []string
+		for _, g := range roleGroups {
+			if groupMatches(g, alternatives) {
+				got = append(got, g.ID)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("groups matching %q = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+// listService serves ListUsers and GetUser from a slice, applying the
+// repository filter fields the way the repository does.
+type listService struct {
+	identity.ProvisioningService
+	users []identity.User
+	reads int
+}
+
+func (s *listService) GetUser(_ context.Context, id identity.UserID) (identity.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return identity.User{}, repository.ErrUserNotFound
+}
+
+func (s *listService) ListUsers(_ context.Context, f identity.UserFilter, offset, limit int) ([]identity.User, int64, error) {
+	var matched []identity.User
+	for _, u := range s.users {
+		switch {
+		case f.Email != "" && f.Email != u.Email,
+			f.SCIMUserName != "" && !strings.EqualFold(f.SCIMUserName, scimUserName(u)) &&
+				(u.SCIMUserName != "" || !strings.EqualFold(f.SCIMUserName, u.Email)),
+			f.ExternalID != "" && f.ExternalID != u.ExternalID,
+			f.Suspended != nil && *f.Suspended != u.Suspended(),
+			len(f.Roles) > 0 && !slices.Contains(f.Roles, u.Role):
+			continue
+		}
+		matched = append(matched, u)
+	}
+	page := matched[min(offset, len(matched)):min(offset+limit, len(matched))]
+	s.reads += len(page)
+	return page, int64(len(matched)), nil
+}
+
+func TestListUsersFilter(t *testing.T) {
+	svc := &listService{users: []identity.User{
+		{ID: "u1", Email: "alice@example.com", Username: "alice", SCIMUserName: "alice@example.com", ExternalID: "00u1", Role: "customer"},
+		{ID: "u2", Email: "albert@example.com", Username: "albert", ExternalID: "00u2", Role: "seller"},
+		{ID: "u3", Email: "bob@corp.example", Username: "bob", SCIMUserName: "Bob@Corp.Example", Role: "seller"},
+	}}
+	h := NewHandler(svc)
+
+	tests := []struct {
+		query     string
+		wantIDs   []string
+		wantTotal int64
+	}{
+		{"", []string{"u1", "u2", "u3"}, 3},
+		{`filter=userName eq "ALICE@example.com"`, []string{"u1"}, 1},
+		{`filter=userName eq "albert@example.com"`, []string{"u2"}, 1},
+		{`filter=id eq "u2" and roles eq "seller"`, []string{"u2"}, 1},
+		{`filter=id eq "u2" and roles eq "customer"`, nil, 0},
+		{`filter=emails.value eq "not an email"`, nil, 0},
+		{`filter=userName sw "al"`, []string{"u1", "u2"}, 2},
+		{`filter=emails.value co "corp"`, []string{"u3"}, 1},
+		{`filter=externalId sw "00U"`, nil, 0},
+		{`filter=roles eq "seller" and userName co "bert"`, []string{"u2"}, 1},
+		{`filter=userName eq "bob@corp.example" or externalId eq "00u1"`, []string{"u3", "u1"}, 2},
+		{`filter=userName sw "a" or roles eq "seller"`, []string{"u1", "u2", "u3"}, 3},
+		{`filter=id eq "u3" or id eq "nobody"`, []string{"u3"}, 1},
+		{`filter=userName sw "a" or roles eq "seller"&startIndex=2&count=1`, []string{"u2"}, 3},
+		{`filter=userName sw "a"&startIndex=5`, nil, 2},
+	}
+	for _, tc := range tests {
+		got, total, status := listUsers(t, h, tc.query)
+		if status != http.StatusOK || total != tc.wantTotal || !slices.Equal(got, tc.wantIDs) {
+			t.Errorf("GET /Users?%s = %d %v (total %d), want %v (total %d)", tc.query, status, got, total, tc.wantIDs, tc.wantTotal)
+		}
+	}
+
+	for _, query := range []string{
+		`filter=userName ne "alice"`,
+		`filter=nickName eq "al"`,
+		`filter=active eq "maybe"`,
+		`filter=active sw "t"`,
+	} {
+		if _, _, status := listUsers(t, h, query); status != http.StatusBadRequest {
+			t.Errorf("GET /Users?%s = %d, want 400", query, status)
+		}
+	}
+}
+
+func TestListUsersFilterTooMany(t *testing.T) {
+	svc := &listService{}
+	for i := range maxFilterScan + 1 {
+		svc.users = append(svc.users, identity.User{ID: identity.UserID("u" + strconv.Itoa(i)), Role: "customer"})
+	}
+	h := NewHandler(svc)
+
+	if _, _, status := listUsers(t, h, `filter=userName sw "a"`); status != http.StatusBadRequest {
+		t.Fatalf("scan of %d users = %d, want 400", len(svc.users), status)
+	}
+	if svc.reads > maxFilterScan+maxPageSize {
+		t.Fatalf("read %d users before refusing, want at most %d", svc.reads, maxFilterScan+maxPageSize)
+	}
+	// eq filters stay with the repository and are not capped.
+	if _, total, status := listUsers(t, h, `filter=roles eq "customer"`); status != http.StatusOK || total != int64(len(svc.users)) {
+		t.Fatalf("eq filter = %d (total %d), want 200", status, total)
+	}
+}
+
+func listUsers(t *testing.T, h *Handler, query string) (ids []string, total int64, status int) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/Users?"+escapeQuery(query), nil)
+	rec := httptest.NewRecorder()
+	h.handleListUsers(rec, req)
+	if rec.Code != http.StatusOK {
+		return nil, 0, rec.Code
+	}
+	var resp struct {
+		TotalResults int64          `json:"totalResults"`
+		Resources    []userResource `json:"Resources"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	for _, res := range resp.Resources {
+		ids = append(ids, res.ID)
+	}
+	return ids, resp.TotalResults, rec.Code
+}
+
+func escapeQuery(query string) string {
+	var parts []string
+	for _, part := range strings.Split(query, "&") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			parts = append(parts, k+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
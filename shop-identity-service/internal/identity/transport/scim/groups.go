@@ -0,0 +1,271 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// roleGroup exposes a provisionable role as a SCIM group, so that directory
+// group assignments drive roles. Every user is in exactly one of them.
+type roleGroup struct {
+	ID          string
+	DisplayName string
+	Role        identity.Role
+}
+
+var roleGroups = []roleGroup{
+	{ID: "customer", DisplayName: "Customers", Role: identity.RoleCustomer},
+	{ID: "seller", DisplayName: "Sellers", Role: identity.RoleSeller},
+}
+
+func groupForRole(role identity.Role) roleGroup {
+	for _, g := range roleGroups {
+		if g.Role == role {
+			return g
+		}
+	}
+	return roleGroups[0]
+}
+
+func findGroup(id string) (roleGroup, bool) {
+	for _, g := range roleGroups {
+		if strings.EqualFold(g.ID, id) {
+			return g, true
+		}
+	}
+	return roleGroup{}, false
+}
+
+type groupResource struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id"`
+	DisplayName string        `json:"displayName"`
+	Members     []multiValued `json:"members,omitempty"`
+	Meta        *meta         `json:"meta,omitempty"`
+}
+
+// groupResource lists the group with its members unless excludeMembers is
+// set, as directories request with excludedAttributes=members.
+func (h *Handler) groupResource(r *http.Request, g roleGroup, excludeMembers bool) (groupResource, error) {
+	base := baseURL(r)
+	res := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID,
+		DisplayName: g.DisplayName,
+		Meta: &meta{
+			ResourceType: "Group",
+			Location:     base + "/Groups/" + g.ID,
+		},
+	}
+	if excludeMembers {
+		return res, nil
+	}
+
+	filter := identity.UserFilter{Roles: []identity.Role{g.Role}}
+	for offset := 0; ; offset += maxPageSize {
+		users, total, err := h.svc.ListUsers(r.Context(), filter, offset, maxPageSize)
+		if err != nil {
+			return groupResource{}, err
+		}
+		for _, u := range users {
+			res.Members = append(res.Members, multiValued{
+				Value:   string(u.ID),
+				Display: scimUserName(u),
+				Ref:     base + "/Users/" + string(u.ID),
+			})
+		}
+		if int64(offset+len(users)) >= total || len(users) == 0 {
+			break
+		}
+	}
+	return res, nil
+}
+
+func excludesMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groups := roleGroups
+	if raw := r.URL.Query().Get("filter"); raw != "" {
+		alternatives, err := parseFilter(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		groups = nil
+		for _, g := range roleGroups {
+			if groupMatches(g, alternatives) {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	resources := make([]groupResource, 0, len(groups))
+	for _, g := range groups {
+		res, err := h.groupResource(r, g, excludesMembers(r))
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+		resources = append(resources, res)
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// groupMatches reports whether g satisfies any of the alternatives.
+func groupMatches(g roleGroup, alternatives [][]comparison) bool {
+	for _, terms := range alternatives {
+		if groupMatchesAll(g, terms) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupMatchesAll(g roleGroup, terms []comparison) bool {
+	for _, t := range terms {
+		switch strings.TrimPrefix(t.Attr, strings.ToLower(schemaGroup)+":") {
+		case "id":
+			if !t.matches(g.ID, false) {
+				return false
+			}
+		case "displayname":
+			if !t.matches(g.DisplayName, false) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := findGroup(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+
+	res, err := h.groupResource(r, g, excludesMembers(r))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handlePatchGroup changes the role of added and removed members. Users
+// removed from a group fall back to the customer role.
+func (h *Handler) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := findGroup(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+
+	var req patchRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	for _, op := range req.Operations {
+		ids, err := memberIDs(op)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, patchErrorType(err), err.Error())
+			return
+		}
+
+		remove := strings.EqualFold(op.Op, "remove")
+		for _, id := range ids {
+			if err := h.setGroup(r, identity.UserID(id), g, remove); err != nil {
+				writeServiceError(w, r, err)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// memberIDs returns the user IDs a group PATCH operation adds or removes.
+// Members are given either in the value or, for removals, in a
+// members[value eq "id"] path.
+func memberIDs(op patchOperation) ([]string, error) {
+	name := strings.ToLower(op.Op)
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+
+	switch {
+	case name != "add" && name != "remove":
+		// Replacing the member list or renaming a role group is not supported.
+		return nil, errReadOnly
+	case path == "members":
+	case name == "remove" && strings.HasPrefix(path, "members["):
+		inner := strings.TrimSuffix(strings.TrimSpace(op.Path)[len("members["):], "]")
+		alternatives, err := parseFilter(inner)
+		if err != nil || len(alternatives) != 1 || len(alternatives[0]) != 1 {
+			return nil, errInvalidValue
+		}
+		if t := alternatives[0][0]; t.Attr == "value" && t.Op == "eq" {
+			return []string{t.Value}, nil
+		}
+		return nil, errInvalidValue
+	default:
+		return nil, errReadOnly
+	}
+
+	var members []multiValued
+	if err := json.Unmarshal(op.Value, &members); err != nil {
+		return nil, errInvalidValue
+	}
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.Value)
+	}
+	return ids, nil
+}
+
+// setGroup moves the user into g, or out of it back to the customer role.
+func (h *Handler) setGroup(r *http.Request, id identity.UserID, g roleGroup, remove bool) error {
+	user, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	role := g.Role
+	if remove {
+		if user.Role != g.Role {
+			return nil
+		}
+		role = identity.RoleCustomer
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	p := provisionedFromUser(user)
+	p.Role = role
+	_, err = h.svc.UpdateUser(r.Context(), id, p)
+	return err
+}
+
+func (h *Handler) handleGroupsReadOnly(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotImplemented, "", "groups mirror roles and cannot be created, replaced or deleted")
+}
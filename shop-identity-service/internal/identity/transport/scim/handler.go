@@ -0,0 +1,239 @@
+// Package scim exposes a SCIM 2.0 (RFC 7643/7644) API so that customer
+// directories can provision and deprovision users of their tenant.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+	"github.com/hawful70/shop-identity-service/internal/identity/transport/jsonbody"
+)
+
+const (
+	schemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	contentType = "application/scim+json"
+	// maxBodyBytes bounds request bodies. Group patches list their members,
+	// so they can be much larger than a user.
+	maxBodyBytes = 1 << 20
+
+	defaultPageSize = 100
+	maxPageSize     = 200
+)
+
+type Handler struct {
+	svc identity.ProvisioningService
+}
+
+func NewHandler(svc identity.ProvisioningService) *Handler {
+	return &Handler{svc: svc}
+}
+
+// RegisterRoutes is meant to be mounted at /scim/v2. The tenant is the one the
+// bearer token was issued for.
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Use(h.authMiddleware)
+
+	r.Get("/ServiceProviderConfig", h.handleServiceProviderConfig)
+
+	r.Get("/Users", h.handleListUsers)
+	r.Post("/Users", h.handleCreateUser)
+	r.Get("/Users/{id}", h.handleGetUser)
+	r.Put("/Users/{id}", h.handleReplaceUser)
+	r.Patch("/Users/{id}", h.handlePatchUser)
+	r.Delete("/Users/{id}", h.handleDeleteUser)
+
+	r.Get("/Groups", h.handleListGroups)
+	r.Get("/Groups/{id}", h.handleGetGroup)
+	r.Patch("/Groups/{id}", h.handlePatchGroup)
+	r.Post("/Groups", h.handleGroupsReadOnly)
+	r.Put("/Groups/{id}", h.handleGroupsReadOnly)
+	r.Delete("/Groups/{id}", h.handleGroupsReadOnly)
+}
+
+func (h *Handler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeError(w, http.StatusUnauthorized, "", "missing or invalid authorization header")
+			return
+		}
+
+		tenant, err := h.svc.AuthenticateSCIMToken(r.Context(), parts[1])
+		if err != nil {
+			if errors.Is(err, identity.ErrSCIMTokenInvalid) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "", "invalid token")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "", "internal error")
+			return
+		}
+
+		ctx := identity.ContextWithTenant(r.Context(), tenant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type serviceProviderConfig struct {
+	Schemas               []string   `json:"schemas"`
+	Patch                 supported  `json:"patch"`
+	Bulk                  bulkConfig `json:"bulk"`
+	Filter                filterInfo `json:"filter"`
+	ChangePassword        supported  `json:"changePassword"`
+	Sort                  supported  `json:"sort"`
+	ETag                  supported  `json:"etag"`
+	AuthenticationSchemes []authInfo `json:"authenticationSchemes"`
+}
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type bulkConfig struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type filterInfo struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type authInfo struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (h *Handler) handleServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, serviceProviderConfig{
+		Schemas:        []string{schemaServiceProviderConfig},
+		Patch:          supported{Supported: true},
+		Filter:         filterInfo{Supported: true, MaxResults: maxPageSize},
+		ChangePassword: supported{Supported: true},
+		AuthenticationSchemes: []authInfo{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "SCIM token issued by a tenant admin",
+		}},
+	})
+}
+
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+// pagination reads the 1-based startIndex and count query parameters.
+func pagination(r *http.Request) (startIndex, count int) {
+	startIndex, count = 1, defaultPageSize
+	if v, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && v > 1 {
+		startIndex = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && v >= 0 {
+		count = min(v, maxPageSize)
+	}
+	return startIndex, count
+}
+
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(w, status, errorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// writeServiceError maps provisioning errors onto SCIM error responses.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "", "user not found")
+	case errors.Is(err, identity.ErrEmailTaken), errors.Is(err, identity.ErrUsernameTaken):
+		writeError(w, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, identity.ErrEmailRequired), errors.Is(err, identity.ErrEmailInvalid),
+		errors.Is(err, identity.ErrEmailBlocked), errors.Is(err, identity.ErrUsernameRequired),
+		errors.Is(err, identity.ErrUsernameLength), errors.Is(err, identity.ErrUsernameInvalid),
+		errors.Is(err, identity.ErrUsernameReserved), errors.Is(err, identity.ErrPasswordTooWeak),
+		errors.Is(err, identity.ErrPasswordReused), errors.Is(err, identity.ErrRoleNotProvisionable):
+		writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+	default:
+		slog.ErrorContext(r.Context(), "scim request failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+// readJSON decodes a SCIM request body into dst. RFC 7644 has clients send
+// application/scim+json; plain application/json is accepted too. Attributes
+// dst does not know, such as schema extensions, are ignored. It writes an
+// error and returns false when the body cannot be read.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := jsonbody.Decode(w, r, dst, jsonbody.Options{
+		MediaTypes: []string{contentType, "application/json"},
+		MaxBytes:   maxBodyBytes,
+	})
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, jsonbody.ErrUnsupportedMediaType):
+		writeError(w, http.StatusUnsupportedMediaType, "", "Content-Type must be "+contentType)
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "", fmt.Sprintf("request body is larger than %d bytes", maxBodyBytes))
+	default:
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// baseURL returns the absolute URL the SCIM API is mounted at, for resource
+// locations.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	path := r.URL.Path
+	for _, resource := range []string{"/Users", "/Groups"} {
+		if i := strings.LastIndex(path, resource); i >= 0 {
+			path = path[:i]
+			break
+		}
+	}
+	return scheme + "://" + r.Host + path
+}
@@ -0,0 +1,94 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// provisioning accepts any token and creates the users it is sent.
+type provisioning struct {
+	identity.ProvisioningService
+	created []identity.ProvisionedUser
+}
+
+func (p *provisioning) AuthenticateSCIMToken(ctx context.Context, token string) (identity.Tenant, error) {
+	return identity.Tenant{ID: identity.DefaultTenantID}, nil
+}
+
+func (p *provisioning) CreateUser(ctx context.Context, u identity.ProvisionedUser) (identity.User, error) {
+	p.created = append(p.created, u)
+	return identity.User{ID: "u1", Email: u.Email, Username: u.Username, Role: identity.RoleCustomer}, nil
+}
+
+func TestRequestBodies(t *testing.T) {
+	const user = `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"alice@example.com","emails":[{"value":"alice@example.com","primary":true}]}`
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantType    string
+	}{
+		{"scim+json", http.MethodPost, "/Users", "application/scim+json", user, http.StatusCreated, ""},
+		{"json with charset", http.MethodPost, "/Users", "application/json; charset=utf-8", user, http.StatusCreated, ""},
+		{"extension attributes", http.MethodPost, "/Users", "application/scim+json",
+			strings.TrimSuffix(user, "}") + `,"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User":{"department":"Sales"}}`,
+			http.StatusCreated, ""},
+		{"missing content type", http.MethodPost, "/Users", "", user, http.StatusUnsupportedMediaType, ""},
+		{"form content type", http.MethodPost, "/Users", "application/x-www-form-urlencoded", "userName=alice", http.StatusUnsupportedMediaType, ""},
+		{"empty body", http.MethodPost, "/Users", "application/scim+json", "", http.StatusBadRequest, "invalidSyntax"},
+		{"malformed", http.MethodPost, "/Users", "application/scim+json", `{"userName":`, http.StatusBadRequest, "invalidSyntax"},
+		{"trailing data", http.MethodPost, "/Users", "application/scim+json", user + user, http.StatusBadRequest, "invalidSyntax"},
+		{"too large", http.MethodPost, "/Users", "application/scim+json",
+			`{"userName":"` + strings.Repeat("a", maxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, ""},
+		{"replace with text", http.MethodPut, "/Users/u1", "text/plain", user, http.StatusUnsupportedMediaType, ""},
+		{"patch user with text", http.MethodPatch, "/Users/u1", "text/plain", `{}`, http.StatusUnsupportedMediaType, ""},
+		{"patch group with text", http.MethodPatch, "/Groups/seller", "text/plain", `{}`, http.StatusUnsupportedMediaType, ""},
+	}
+
+	for _, tc := range tests {
+		svc := &provisioning{}
+		r := chi.NewRouter()
+		NewHandler(svc).RegisterRoutes(r)
+
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer scim-token")
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, rec.Code, tc.wantStatus, rec.Body)
+			continue
+		}
+		if tc.wantStatus == http.StatusCreated {
+			if len(svc.created) != 1 || svc.created[0].Email != "alice@example.com" {
+				t.Errorf("%s: created %+v", tc.name, svc.created)
+			}
+			continue
+		}
+		var res errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Status != strconv.Itoa(rec.Code) {
+			t.Errorf("%s: error response %s: %v", tc.name, rec.Body, err)
+		}
+		if res.ScimType != tc.wantType || len(svc.created) != 0 {
+			t.Errorf("%s: scimType %q, created %v; want %q and nothing created", tc.name, res.ScimType, svc.created, tc.wantType)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != contentType {
+			t.Errorf("%s: Content-Type %q, want %q", tc.name, ct, contentType)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidValue = errors.New("invalid value for path")
+	errNoTarget     = errors.New("attribute cannot be removed")
+	errReadOnly     = errors.New("attribute is read-only")
+)
+
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func patchErrorType(err error) string {
+	switch {
+	case errors.Is(err, errReadOnly):
+		return "mutability"
+	case errors.Is(err, errNoTarget):
+		return "noTarget"
+	}
+	return "invalidValue"
+}
+
+// applyUserPatch applies PATCH operations to res. Paths are case-insensitive
+// and may carry the core User schema URN. Attributes this service does not
+// store, such as name or title, are accepted and ignored.
+func applyUserPatch(res *userResource, ops []patchOperation) error {
+	for _, op := range ops {
+		name := strings.ToLower(op.Op)
+		if name != "add" && name != "replace" && name != "remove" {
+			return errors.New("unsupported op " + strconv.Quote(op.Op))
+		}
+
+		if op.Path != "" {
+			if err := applyUserAttr(res, name, normalizePath(op.Path), op.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Without a path the value is an object of attributes to set.
+		if name == "remove" {
+			return errNoTarget
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return errInvalidValue
+		}
+		for attr, value := range attrs {
+			if err := applyUserAttr(res, name, normalizePath(attr), value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func normalizePath(path string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(path), schemaUser+":"))
+}
+
+func applyUserAttr(res *userResource, op, path string, value json.RawMessage) error {
+	switch {
+	case path == "active":
+		if op == "remove" {
+			return errNoTarget
+		}
+		active, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		res.Active = &active
+
+	case path == "username":
+		if op == "remove" {
+			return errNoTarget
+		}
+		return json.Unmarshal(value, &res.UserName)
+
+	case path == "externalid":
+		if op == "remove" {
+			res.ExternalID = ""
+			return nil
+		}
+		return json.Unmarshal(value, &res.ExternalID)
+
+	case path == "password":
+		if op == "remove" {
+			return errNoTarget
+		}
+		return json.Unmarshal(value, &res.Password)
+
+	case path == "emails":
+		if op == "remove" {
+			return errNoTarget
+		}
+		var emails []multiValued
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return errInvalidValue
+		}
+		res.Emails = emails
+
+	// emails.value, emails[type eq "work"].value and similar select the one
+	// email this service keeps.
+	case strings.HasPrefix(path, "emails[") || path == "emails.value":
+		if op == "remove" {
+			return errNoTarget
+		}
+		var email string
+		if err := json.Unmarshal(value, &email); err != nil {
+			return errInvalidValue
+		}
+		res.Emails = []multiValued{{Value: email, Type: "work", Primary: true}}
+
+	case path == "roles":
+		if op == "remove" {
+			res.Roles = nil
+			return nil
+		}
+		var roles []multiValued
+		if err := json.Unmarshal(value, &roles); err != nil {
+			return errInvalidValue
+		}
+		res.Roles = roles
+
+	case strings.HasPrefix(path, "roles[") || path == "roles.value":
+		if op == "remove" {
+			res.Roles = nil
+			return nil
+		}
+		var role string
+		if err := json.Unmarshal(value, &role); err != nil {
+			return errInvalidValue
+		}
+		res.Roles = []multiValued{{Value: role, Primary: true}}
+
+	case path == "id" || path == "groups" || strings.HasPrefix(path, "meta"):
+		return fmt.Errorf("%w: %s", errReadOnly, path)
+
+	case strings.HasPrefix(path, "urn:"):
+		// Extension schemas are not stored.
+
+	default:
+		// name, displayName, title and other attributes are not stored.
+	}
+	return nil
+}
+
+// parseBool accepts JSON booleans and the "True"/"False" strings some
+// directories send.
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, errInvalidValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errInvalidValue
+	}
+	return b, nil
+}
@@ -0,0 +1,181 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func patchOps(t *testing.T, raw string) []patchOperation {
+	t.Helper()
+	var req patchRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+	return req.Operations
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	active, inactive := true, false
+	base := func() userResource {
+		return userResource{
+			ExternalID: "00u1",
+			UserName:   "alice@example.com",
+			Active:     &active,
+			Emails:     []multiValued{{Value: "alice@example.com", Type: "work", Primary: true}},
+			Roles:      []multiValued{{Value: "customer", Primary: true}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		ops  string
+		want func(*userResource)
+	}{
+		{
+			"okta deactivate",
+			`{"Operations":[{"op":"replace","value":{"active":false}}]}`,
+			func(r *userResource) { r.Active = &inactive },
+		},
+		{
+			"okta replace without a path",
+			`{"Operations":[{"op":"replace","value":{"userName":"alice.smith@example.com","emails":[{"value":"alice.smith@example.com","type":"work","primary":true}],"name":{"givenName":"Alice"}}}]}`,
+			func(r *userResource) {
+				r.UserName = "alice.smith@example.com"
+				r.Emails = []multiValued{{Value: "alice.smith@example.com", Type: "work", Primary: true}}
+			},
+		},
+		{
+			"okta password",
+			`{"Operations":[{"op":"replace","value":{"password":"n3w-Passw0rd!"}}]}`,
+			func(r *userResource) { r.Password = "n3w-Passw0rd!" },
+		},
+		{
+			"entra deactivate with a string",
+			`{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			func(r *userResource) { r.Active = &inactive },
+		},
+		{
+			"entra reactivate",
+			`{"Operations":[{"op":"Replace","path":"active","value":"True"}]}`,
+			func(*userResource) {},
+		},
+		{
+			"entra email by filter path",
+			`{"Operations":[{"op":"Replace","path":"emails[type eq \"work\"].value","value":"alice@corp.example"}]}`,
+			func(r *userResource) {
+				r.Emails = []multiValued{{Value: "alice@corp.example", Type: "work", Primary: true}}
+			},
+		},
+		{
+			"entra add attributes",
+			`{"Operations":[
+				{"op":"Add","path":"externalId","value":"e-42"},
+				{"op":"Add","path":"name.givenName","value":"Alice"},
+				{"op":"Add","path":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department","value":"Sales"},
+				{"op":"Add","path":"roles[primary eq \"True\"].value","value":"seller"}
+			]}`,
+			func(r *userResource) {
+				r.ExternalID = "e-42"
+				r.Roles = []multiValued{{Value: "seller", Primary: true}}
+			},
+		},
+		{
+			"schema-qualified and upper-case paths",
+			`{"Operations":[{"op":"replace","path":"urn:ietf:params:scim:schemas:core:2.0:User:USERNAME","value":"alice2@example.com"}]}`,
+			func(r *userResource) { r.UserName = "alice2@example.com" },
+		},
+		{
+			"remove optional attributes",
+			`{"Operations":[{"op":"Remove","path":"externalId"},{"op":"remove","path":"roles"},{"op":"remove","path":"title"}]}`,
+			func(r *userResource) {
+				r.ExternalID = ""
+				r.Roles = nil
+			},
+		},
+		{
+			"operations apply in order",
+			`{"Operations":[{"op":"replace","path":"active","value":false},{"op":"replace","path":"active","value":true}]}`,
+			func(*userResource) {},
+		},
+	}
+	for _, tc := range tests {
+		got, want := base(), base()
+		if err := applyUserPatch(&got, patchOps(t, tc.ops)); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		tc.want(&want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, want)
+		}
+	}
+}
+
+func TestApplyUserPatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		ops      string
+		wantType string
+		wantErr  error
+	}{
+		{"unsupported op", `{"Operations":[{"op":"move","path":"active","value":true}]}`, "invalidValue", nil},
+		{"remove without a path", `{"Operations":[{"op":"remove"}]}`, "noTarget", errNoTarget},
+		{"remove userName", `{"Operations":[{"op":"remove","path":"userName"}]}`, "noTarget", errNoTarget},
+		{"remove active", `{"Operations":[{"op":"Remove","path":"active"}]}`, "noTarget", errNoTarget},
+		{"remove emails", `{"Operations":[{"op":"Remove","path":"emails[type eq \"work\"].value"}]}`, "noTarget", errNoTarget},
+		{"replace id", `{"Operations":[{"op":"replace","path":"id","value":"u2"}]}`, "mutability", errReadOnly},
+		{"add groups", `{"Operations":[{"op":"add","path":"groups","value":[{"value":"seller"}]}]}`, "mutability", errReadOnly},
+		{"replace meta", `{"Operations":[{"op":"replace","path":"meta.created","value":"2020-01-01T00:00:00Z"}]}`, "mutability", errReadOnly},
+		{"invalid active", `{"Operations":[{"op":"replace","path":"active","value":"maybe"}]}`, "invalidValue", errInvalidValue},
+		{"value not an object", `{"Operations":[{"op":"replace","value":"active"}]}`, "invalidValue", errInvalidValue},
+		{"emails not a list", `{"Operations":[{"op":"replace","path":"emails","value":"a@example.com"}]}`, "invalidValue", errInvalidValue},
+	}
+	for _, tc := range tests {
+		var res userResource
+		err := applyUserPatch(&res, patchOps(t, tc.ops))
+		if err == nil {
+			t.Errorf("%s: no error", tc.name)
+			continue
+		}
+		if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.wantErr)
+		}
+		if got := patchErrorType(err); got != tc.wantType {
+			t.Errorf("%s: scimType = %q, want %q", tc.name, got, tc.wantType)
+		}
+	}
+}
+
+func TestMemberIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      string
+		want    []string
+		wantErr error
+	}{
+		{"okta add", `{"op":"add","path":"members","value":[{"value":"u1","display":"alice"},{"value":"u2"}]}`, []string{"u1", "u2"}, nil},
+		{"okta remove", `{"op":"remove","path":"members","value":[{"value":"u1"}]}`, []string{"u1"}, nil},
+		{"entra add", `{"op":"Add","path":"members","value":[{"value":"u3"}]}`, []string{"u3"}, nil},
+		{"entra remove by filter", `{"op":"Remove","path":"members[value eq \"u3\"]"}`, []string{"u3"}, nil},
+		{"replace members", `{"op":"replace","path":"members","value":[{"value":"u1"}]}`, nil, errReadOnly},
+		{"rename group", `{"op":"replace","path":"displayName","value":"Vendors"}`, nil, errReadOnly},
+		{"add by filter", `{"op":"add","path":"members[value eq \"u1\"]"}`, nil, errReadOnly},
+		{"remove by other attribute", `{"op":"remove","path":"members[display eq \"alice\"]"}`, nil, errInvalidValue},
+		{"remove by co", `{"op":"remove","path":"members[value co \"u\"]"}`, nil, errInvalidValue},
+		{"remove by or", `{"op":"remove","path":"members[value eq \"u1\" or value eq \"u2\"]"}`, nil, errInvalidValue},
+		{"members not a list", `{"op":"add","path":"members","value":{"value":"u1"}}`, nil, errInvalidValue},
+	}
+	for _, tc := range tests {
+		var op patchOperation
+		if err := json.Unmarshal([]byte(tc.op), &op); err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		got, err := memberIDs(op)
+		if !errors.Is(err, tc.wantErr) || !slices.Equal(got, tc.want) {
+			t.Errorf("%s: memberIDs = %v, %v; want %v, %v", tc.name, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
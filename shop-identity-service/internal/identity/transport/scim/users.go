@@ -0,0 +1,478 @@
+package scim
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/domain"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+type userResource struct {
+	Schemas    []string      `json:"schemas"`
+	ID         string        `json:"id,omitempty"`
+	ExternalID string        `json:"externalId,omitempty"`
+	UserName   string        `json:"userName"`
+	Active     *bool         `json:"active,omitempty"`
+	Emails     []multiValued `json:"emails,omitempty"`
+	Roles      []multiValued `json:"roles,omitempty"`
+	// Groups is read-only and derived from the role.
+	Groups []multiValued `json:"groups,omitempty"`
+	// Password is write-only.
+	Password string `json:"password,omitempty"`
+	Meta     *meta  `json:"meta,omitempty"`
+}
+
+type multiValued struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version,omitempty"`
+}
+
+func toUserResource(u identity.User, base string) userResource {
+	active := !u.Suspended()
+	group := groupForRole(u.Role)
+	return userResource{
+		Schemas:    []string{schemaUser},
+		ID:         string(u.ID),
+		ExternalID: u.ExternalID,
+		UserName:   scimUserName(u),
+		Active:     &active,
+		Emails:     []multiValued{{Value: u.Email, Type: "work", Primary: true}},
+		Roles:      []multiValued{{Value: string(u.Role), Primary: true}},
+		Groups:     []multiValued{{Value: group.ID, Display: group.DisplayName, Ref: base + "/Groups/" + group.ID}},
+		Meta: &meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     base + "/Users/" + string(u.ID),
+			Version:      `W/"` + strconv.FormatInt(u.UpdatedAt.UnixNano(), 10) + `"`,
+		},
+	}
+}
+
+// scimUserName is the userName the directory sent for u, or the username of
+// users created before it was stored.
+func scimUserName(u identity.User) string {
+	if u.SCIMUserName != "" {
+		return u.SCIMUserName
+	}
+	return u.Username
+}
+
+// provisionedUser maps a resource onto the user fields a directory manages.
+// The userName is kept as sent. Directories often send the email address as
+// userName; the email is then taken from it and the username derived from its
+// local part.
+func (res userResource) provisionedUser() identity.ProvisionedUser {
+	p := identity.ProvisionedUser{
+		Username:     res.UserName,
+		SCIMUserName: res.UserName,
+		ExternalID:   res.ExternalID,
+		Active:       res.Active == nil || *res.Active,
+		Password:     res.Password,
+	}
+
+	if email, ok := primary(res.Emails); ok {
+		p.Email = email
+	}
+	if strings.Contains(res.UserName, "@") {
+		if p.Email == "" {
+			p.Email = res.UserName
+		}
+		p.Username = usernameFromEmail(res.UserName)
+		p.DeriveUsername = true
+	}
+	if role, ok := primary(res.Roles); ok {
+		p.Role = identity.Role(strings.ToLower(role))
+	}
+	return p
+}
+
+// primary returns the primary value of a multi-valued attribute, or the
+// first one when none is marked primary.
+func primary(values []multiValued) (string, bool) {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value, true
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value, true
+	}
+	return "", false
+}
+
+// usernameFromEmail turns the local part of an email address into a
+// username by replacing unsupported characters with dots.
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+
+	var b strings.Builder
+	sep := true
+	for _, r := range local {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			sep = false
+			continue
+		}
+		if !sep {
+			if r == '_' || r == '-' {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune('.')
+			}
+			sep = true
+		}
+	}
+	return strings.TrimRight(b.String(), "._-")
+}
+
+func provisionedFromUser(u identity.User) identity.ProvisionedUser {
+	return identity.ProvisionedUser{
+		Email:        u.Email,
+		Username:     u.Username,
+		SCIMUserName: u.SCIMUserName,
+		ExternalID:   u.ExternalID,
+		Role:         u.Role,
+		Active:       !u.Suspended(),
+	}
+}
+
+// maxFilterScan bounds the users read to answer a filter the repository
+// cannot evaluate, such as one with co, sw or or. RFC 7644 lets a server
+// refuse such filters with tooMany.
+const maxFilterScan = 10000
+
+var errTooMany = errors.New("filter needs too many users to be read; narrow it down")
+
+func (h *Handler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := pagination(r)
+	base := baseURL(r)
+
+	var alternatives [][]comparison
+	if raw := r.URL.Query().Get("filter"); raw != "" {
+		var err error
+		alternatives, err = parseFilter(raw)
+		if err == nil {
+			err = checkUserTerms(alternatives)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+	}
+
+	var (
+		users []identity.User
+		total int64
+		err   error
+	)
+	switch {
+	case len(alternatives) == 0:
+		users, total, err = h.listUsers(r, nil, startIndex, count)
+	case len(alternatives) == 1 && onlyEq(alternatives[0]):
+		users, total, err = h.listUsers(r, alternatives[0], startIndex, count)
+	default:
+		users, total, err = h.scanUsers(r, alternatives, startIndex, count)
+	}
+	if errors.Is(err, errTooMany) {
+		writeError(w, http.StatusBadRequest, "tooMany", err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	resources := make([]userResource, 0, len(users))
+	for _, u := range users {
+		resources = append(resources, toUserResource(u, base))
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// checkUserTerms rejects attributes users cannot be filtered by.
+func checkUserTerms(alternatives [][]comparison) error {
+	for _, terms := range alternatives {
+		for _, t := range terms {
+			switch t.Attr {
+			case "id", "username", "emails", "emails.value", "externalid", "roles", "roles.value":
+			case "active":
+				if _, err := strconv.ParseBool(t.Value); err != nil || t.Op != "eq" {
+					return errors.New(`active only supports eq "true" or "false"`)
+				}
+			default:
+				return errors.New("unsupported filter attribute " + strconv.Quote(t.Attr))
+			}
+		}
+	}
+	return nil
+}
+
+func onlyEq(terms []comparison) bool {
+	for _, t := range terms {
+		if t.Op != "eq" {
+			return false
+		}
+	}
+	return true
+}
+
+// userFilter maps the eq terms onto a repository filter. An id term is
+// returned separately since it matches at most one user, and none reports
+// terms that no user can match.
+func userFilter(terms []comparison) (filter identity.UserFilter, id string, none bool) {
+	for _, t := range terms {
+		if t.Op != "eq" {
+			continue
+		}
+		switch t.Attr {
+		case "id":
+			id = t.Value
+		case "username":
+			filter.SCIMUserName = t.Value
+		case "emails", "emails.value":
+			email, err := domain.ParseEmail(t.Value)
+			if err != nil {
+				none = true
+			}
+			filter.Email = email
+		case "externalid":
+			filter.ExternalID = t.Value
+		case "active":
+			active, _ := strconv.ParseBool(t.Value)
+			suspended := !active
+			filter.Suspended = &suspended
+		case "roles", "roles.value":
+			filter.Roles = []identity.Role{identity.Role(strings.ToLower(t.Value))}
+		}
+	}
+	return filter, id, none
+}
+
+// listUsers returns a page of the users matching terms. The repository
+// evaluates eq terms; an id term is looked up directly and the other terms
+// are checked against the user found.
+func (h *Handler) listUsers(r *http.Request, terms []comparison, startIndex, count int) ([]identity.User, int64, error) {
+	filter, id, none := userFilter(terms)
+	switch {
+	case none:
+		return nil, 0, nil
+	case id != "":
+		user, err := h.svc.GetUser(r.Context(), identity.UserID(id))
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, 0, nil
+		}
+		if err != nil || !matchesAll(user, terms) {
+			return nil, 0, err
+		}
+		return []identity.User{user}, 1, nil
+	}
+	return h.svc.ListUsers(r.Context(), filter, startIndex-1, count)
+}
+
+// scanUsers answers filters the repository cannot: each alternative's eq
+// terms narrow the users read, the remaining terms are checked here, and
+// the matches are paged in memory.
+func (h *Handler) scanUsers(r *http.Request, alternatives [][]comparison, startIndex, count int) ([]identity.User, int64, error) {
+	var (
+		matched []identity.User
+		seen    = map[identity.UserID]bool{}
+		scanned int
+	)
+	add := func(users []identity.User, terms []comparison) {
+		for _, u := range users {
+			if !seen[u.ID] && matchesAll(u, terms) {
+				seen[u.ID] = true
+				matched = append(matched, u)
+			}
+		}
+	}
+
+	for _, terms := range alternatives {
+		filter, id, none := userFilter(terms)
+		switch {
+		case none:
+			continue
+		case id != "":
+			users, _, err := h.listUsers(r, terms, 1, 1)
+			if err != nil {
+				return nil, 0, err
+			}
+			add(users, terms)
+			continue
+		}
+
+		for offset := 0; ; offset += maxPageSize {
+			users, total, err := h.svc.ListUsers(r.Context(), filter, offset, maxPageSize)
+			if err != nil {
+				return nil, 0, err
+			}
+			if scanned += len(users); scanned > maxFilterScan {
+				return nil, 0, errTooMany
+			}
+			add(users, terms)
+			if int64(offset+len(users)) >= total || len(users) == 0 {
+				break
+			}
+		}
+	}
+
+	from := min(startIndex-1, len(matched))
+	to := min(from+count, len(matched))
+	return matched[from:to], int64(len(matched)), nil
+}
+
+// matchesAll reports whether u satisfies every term.
+func matchesAll(u identity.User, terms []comparison) bool {
+	for _, t := range terms {
+		if !matchesTerm(u, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesTerm(u identity.User, t comparison) bool {
+	switch t.Attr {
+	case "id":
+		return t.matches(string(u.ID), true)
+	case "externalid":
+		return t.matches(u.ExternalID, true)
+	case "username":
+		// As in the repository, users provisioned without a userName also
+		// match on their email address.
+		return t.matches(scimUserName(u), false) || u.SCIMUserName == "" && t.matches(u.Email, false)
+	case "emails", "emails.value":
+		return t.matches(u.Email, false)
+	case "roles", "roles.value":
+		return t.matches(string(u.Role), false)
+	case "active":
+		active, _ := strconv.ParseBool(t.Value)
+		return active != u.Suspended()
+	}
+	return false
+}
+
+func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.svc.GetUser(r.Context(), identity.UserID(chi.URLParam(r, "id")))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserResource(user, baseURL(r)))
+}
+
+func (h *Handler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var res userResource
+	if !readJSON(w, r, &res) {
+		return
+	}
+
+	user, err := h.svc.CreateUser(r.Context(), res.provisionedUser())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	out := toUserResource(user, baseURL(r))
+	w.Header().Set("Location", out.Meta.Location)
+	writeJSON(w, http.StatusCreated, out)
+}
+
+func (h *Handler) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id := identity.UserID(chi.URLParam(r, "id"))
+
+	var res userResource
+	if !readJSON(w, r, &res) {
+		return
+	}
+
+	current, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	p := res.provisionedUser()
+	// Directories that do not manage roles leave them out; keep the current one.
+	if p.Role == "" {
+		p.Role = current.Role
+	}
+
+	user, err := h.svc.UpdateUser(r.Context(), id, p)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserResource(user, baseURL(r)))
+}
+
+func (h *Handler) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	id := identity.UserID(chi.URLParam(r, "id"))
+
+	var req patchRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	current, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	res := toUserResource(current, baseURL(r))
+	if err := applyUserPatch(&res, req.Operations); err != nil {
+		writeError(w, http.StatusBadRequest, patchErrorType(err), err.Error())
+		return
+	}
+
+	user, err := h.svc.UpdateUser(r.Context(), id, res.provisionedUser())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserResource(user, baseURL(r)))
+}
+
+// handleDeleteUser deprovisions the user. Accounts are suspended rather than
+// deleted so that orders and audit records keep their owner.
+func (h *Handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := identity.UserID(chi.URLParam(r, "id"))
+
+	if _, err := h.svc.GetUser(r.Context(), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if err := h.svc.SuspendUser(r.Context(), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
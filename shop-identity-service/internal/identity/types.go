@@ -4,11 +4,44 @@ import domain "github.com/hawful70/shop-identity-service/internal/identity/domai
 
 type User = domain.User
 type UserID = domain.UserID
+type Role = domain.Role
+type PasswordPolicy = domain.PasswordPolicy
+type PasswordPolicies = domain.PasswordPolicies
+type Tenant = domain.Tenant
+type TenantID = domain.TenantID
+type TenantSettings = domain.TenantSettings
+type AuthProvider = domain.AuthProvider
+type Organization = domain.Organization
+type OrganizationID = domain.OrganizationID
+type OrgRole = domain.OrgRole
+type Membership = domain.Membership
+type Invitation = domain.Invitation
+type SigningKey = domain.SigningKey
+
+const DefaultTenantID = domain.DefaultTenantID
+
+const (
+	OrgRoleOwner    = domain.OrgRoleOwner
+	OrgRoleBuyer    = domain.OrgRoleBuyer
+	OrgRoleApprover = domain.OrgRoleApprover
+)
+
+const (
+	RoleCustomer = domain.RoleCustomer
+	RoleSeller   = domain.RoleSeller
+	RoleAdmin    = domain.RoleAdmin
+)
 
 var (
 	ErrInvalidUser   = domain.ErrInvalidUser
 	ErrEmailRequired = domain.ErrEmailRequired
+	ErrEmailInvalid  = domain.ErrEmailInvalid
 	ErrPasswordShort = domain.ErrPasswordShort
+
+	ErrUsernameRequired = domain.ErrUsernameRequired
+	ErrUsernameLength   = domain.ErrUsernameLength
+	ErrUsernameInvalid  = domain.ErrUsernameInvalid
+	ErrUsernameReserved = domain.ErrUsernameReserved
 )
 
 func NewUser(email, username, hashedPassword string) (User, error) {
@@ -0,0 +1,347 @@
+// Package validate checks the shape of requests before they reach the
+// service: required fields, sizes and enumerations. Rules are declared once
+// per request, as `validate` struct tags on HTTP request bodies and as
+// Rules tables for gRPC messages, and both produce the same per-field
+// errors. What a value means, such as whether an email is deliverable or a
+// username is reserved, is still up to the service.
+//
+// Rules are separated by commas:
+//
+//	required      the field is set: a non-blank string, a non-empty list
+//	min=N, max=N  characters of a string, items of a list, or a number's value
+//	maxbytes=N    bytes of a string
+//	oneof=a b c   a string is one of the listed values
+//
+// Rules other than required pass empty values. maxbytes and oneof only
+// apply to strings. MustStruct and MustMatch check rules when the request
+// types are registered; Struct and Message return an error, rather than
+// checking anything, for rules that do not apply.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+// CodeInvalidRequest is the code of errors returned by Struct and Message.
+const CodeInvalidRequest identity.Code = "invalid_request"
+
+// Rules maps proto field names of a message to their rules.
+type Rules map[protoreflect.Name]string
+
+// Struct checks the `validate` tags of the struct v points to. Fields are
+// named by their json tags in errors.
+func Struct(v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return fmt.Errorf("validate: cannot check %T", v)
+	}
+	rules, err := structRules(rv.Type())
+	if err != nil {
+		return err
+	}
+	var fields []identity.FieldError
+	for _, f := range rules {
+		if msg := check(f.name, structValue(rv.Field(f.index)), f.rules); msg != "" {
+			fields = append(fields, identity.FieldError{Field: f.name, Message: msg})
+		}
+	}
+	return invalid(fields)
+}
+
+// MustStruct panics if the `validate` tags of v's type name unknown rules
+// or rules its fields cannot be checked with, so that a typo fails at
+// startup rather than on the first request.
+func MustStruct(v any) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		panic("validate: cannot check nil")
+	}
+	if _, err := structRules(t); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Message checks m against rules. Fields without rules are not checked.
+func Message(m proto.Message, rules Rules) error {
+	msg := m.ProtoReflect()
+	checks, err := messageRules(msg.Descriptor(), rules)
+	if err != nil {
+		return err
+	}
+	var fields []identity.FieldError
+	for _, f := range checks {
+		if text := check(string(f.fd.Name()), messageValue(msg, f.fd), f.rules); text != "" {
+			fields = append(fields, identity.FieldError{Field: string(f.fd.Name()), Message: text})
+		}
+	}
+	return invalid(fields)
+}
+
+// MustMatch panics if rules name a field m does not have, or break the
+// rules' own syntax, so a typo in a table fails at startup rather than
+// skipping the check.
+func MustMatch(m proto.Message, rules Rules) {
+	desc := m.ProtoReflect().Descriptor()
+	for name := range rules {
+		if desc.Fields().ByName(name) == nil {
+			panic(fmt.Sprintf("validate: %s has no field %q", desc.FullName(), name))
+		}
+	}
+	if _, err := messageRules(desc, rules); err != nil {
+		panic(err.Error())
+	}
+}
+
+// rule is one parsed rule of a tag.
+type rule struct {
+	name    string
+	limit   int64
+	options []string
+}
+
+type structField struct {
+	index int
+	name  string
+	rules []rule
+}
+
+// structCache holds the parsed tags of each struct type Struct has seen.
+var structCache sync.Map
+
+func structRules(t reflect.Type) ([]structField, error) {
+	if cached, ok := structCache.Load(t); ok {
+		return cached.([]structField), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validate: %s is not a struct", t)
+	}
+	var fields []structField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		kind, ok := structKind(f.Type)
+		if !ok {
+			return nil, fmt.Errorf("validate: %s.%s: cannot check %s fields", t, f.Name, f.Type.Kind())
+		}
+		rules, err := parseRules(tag, kind)
+		if err != nil {
+			return nil, fmt.Errorf("validate: %s.%s: %w", t, f.Name, err)
+		}
+		fields = append(fields, structField{index: i, name: name, rules: rules})
+	}
+	structCache.Store(t, fields)
+	return fields, nil
+}
+
+type messageField struct {
+	fd    protoreflect.FieldDescriptor
+	rules []rule
+}
+
+// messageRules parses rules in field declaration order so errors come out
+// the same way every time.
+func messageRules(desc protoreflect.MessageDescriptor, rules Rules) ([]messageField, error) {
+	var fields []messageField
+	for i := range desc.Fields().Len() {
+		fd := desc.Fields().Get(i)
+		tag, ok := rules[fd.Name()]
+		if !ok {
+			continue
+		}
+		kind, ok := messageKind(fd)
+		if !ok {
+			return nil, fmt.Errorf("validate: %s: cannot check %s fields", fd.FullName(), fd.Kind())
+		}
+		parsed, err := parseRules(tag, kind)
+		if err != nil {
+			return nil, fmt.Errorf("validate: %s: %w", fd.FullName(), err)
+		}
+		fields = append(fields, messageField{fd: fd, rules: parsed})
+	}
+	return fields, nil
+}
+
+func parseRules(tag string, kind valueKind) ([]rule, error) {
+	var rules []rule
+	for _, text := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(text, "=")
+		r := rule{name: name}
+		switch name {
+		case "required":
+		case "min", "max", "maxbytes":
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s needs a number, got %q", name, arg)
+			}
+			r.limit = n
+		case "oneof":
+			if r.options = strings.Fields(arg); len(r.options) == 0 {
+				return nil, errors.New("oneof needs at least one value")
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		if (name == "maxbytes" || name == "oneof") && kind != kindString {
+			return nil, fmt.Errorf("%s only applies to strings", name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func invalid(fields []identity.FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	return identity.NewError(identity.KindInvalidArgument, CodeInvalidRequest, strings.Join(msgs, "; "), fields...)
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindList
+)
+
+// value is what rules see of a field: a string, a number, or the length of
+// a list.
+type value struct {
+	kind valueKind
+	s    string
+	n    int64
+}
+
+func structKind(t reflect.Type) (valueKind, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return kindString, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return kindNumber, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return kindList, true
+	}
+	return 0, false
+}
+
+// structValue reads a field of a kind structKind accepts.
+func structValue(v reflect.Value) value {
+	switch v.Kind() {
+	case reflect.String:
+		return value{kind: kindString, s: v.String()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value{kind: kindNumber, n: v.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return value{kind: kindNumber, n: int64(v.Uint())}
+	}
+	return value{kind: kindList, n: int64(v.Len())}
+}
+
+func messageKind(fd protoreflect.FieldDescriptor) (valueKind, bool) {
+	if fd.IsList() || fd.IsMap() {
+		return kindList, true
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return kindString, true
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind,
+		protoreflect.Sint64Kind, protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return kindNumber, true
+	}
+	return 0, false
+}
+
+// messageValue reads a field of a kind messageKind accepts.
+func messageValue(m protoreflect.Message, fd protoreflect.FieldDescriptor) value {
+	v := m.Get(fd)
+	switch {
+	case fd.IsList():
+		return value{kind: kindList, n: int64(v.List().Len())}
+	case fd.IsMap():
+		return value{kind: kindList, n: int64(v.Map().Len())}
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return value{kind: kindString, s: v.String()}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return value{kind: kindNumber, n: int64(v.Uint())}
+	}
+	return value{kind: kindNumber, n: v.Int()}
+}
+
+// check returns the message of the first rule v breaks, or "".
+func check(name string, v value, rules []rule) string {
+	empty := v.kind == kindString && strings.TrimSpace(v.s) == "" || v.kind == kindList && v.n == 0
+	for _, r := range rules {
+		if r.name == "required" {
+			if empty {
+				return name + " is required"
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+
+		switch r.name {
+		case "min", "max":
+			n := v.n
+			if v.kind == kindString {
+				n = int64(utf8.RuneCountInString(v.s))
+			}
+			if r.name == "min" && n < r.limit {
+				return fmt.Sprintf("%s must be at least %d%s", name, r.limit, unit(v.kind))
+			}
+			if r.name == "max" && n > r.limit {
+				return fmt.Sprintf("%s must be at most %d%s", name, r.limit, unit(v.kind))
+			}
+		case "maxbytes":
+			if int64(len(v.s)) > r.limit {
+				return fmt.Sprintf("%s must be at most %d bytes", name, r.limit)
+			}
+		case "oneof":
+			if !slices.Contains(r.options, v.s) {
+				return fmt.Sprintf("%s must be one of %s", name, strings.Join(r.options, ", "))
+			}
+		}
+	}
+	return ""
+}
+
+func unit(kind valueKind) string {
+	switch kind {
+	case kindString:
+		return " characters"
+	case kindList:
+		return " items"
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package validate_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+	"github.com/hawful70/shop-identity-service/internal/identity/validate"
+)
+
+type signup struct {
+	Email    string   `json:"email" validate:"required,max=254"`
+	Username string   `json:"username,omitempty" validate:"min=3,max=5"`
+	Password string   `json:"password" validate:"required,maxbytes=8"`
+	Role     string   `json:"role" validate:"oneof=customer seller"`
+	Age      int      `json:"age" validate:"min=18"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Note     string   `validate:"max=3"`
+	Ignored  bool     `json:"ignored"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := signup{Email: "a@example.com", Password: "secret", Age: 18}
+	tests := []struct {
+		name   string
+		edit   func(*signup)
+		fields []identity.FieldError
+	}{
+		{"valid", func(*signup) {}, nil},
+		{"optional fields set", func(s *signup) { s.Username, s.Role, s.Tags = "bob", "seller", []string{"a", "b"} }, nil},
+		{"required blank", func(s *signup) { s.Email = "   " }, []identity.FieldError{{Field: "email", Message: "email is required"}}},
+		{"runes not bytes", func(s *signup) { s.Username = "ééééé" }, nil},
+		{"too short", func(s *signup) { s.Username = "bo" }, []identity.FieldError{{Field: "username", Message: "username must be at least 3 characters"}}},
+		{"too long", func(s *signup) { s.Username = "bobbie" }, []identity.FieldError{{Field: "username", Message: "username must be at most 5 characters"}}},
+		{"maxbytes", func(s *signup) { s.Password = "pässwörd" }, []identity.FieldError{{Field: "password", Message: "password must be at most 8 bytes"}}},
+		{"oneof", func(s *signup) { s.Role = "admin" }, []identity.FieldError{{Field: "role", Message: "role must be one of customer, seller"}}},
+		{"number", func(s *signup) { s.Age = 17 }, []identity.FieldError{{Field: "age", Message: "age must be at least 18"}}},
+		{"list", func(s *signup) { s.Tags = []string{"a", "b", "c"} }, []identity.FieldError{{Field: "tags", Message: "tags must be at most 2 items"}}},
+		{"field name without json tag", func(s *signup) { s.Note = "long" }, []identity.FieldError{{Field: "Note", Message: "Note must be at most 3 characters"}}},
+		{"errors in field order", func(s *signup) { s.Email, s.Role = "", "x" }, []identity.FieldError{
+			{Field: "email", Message: "email is required"},
+			{Field: "role", Message: "role must be one of customer, seller"},
+		}},
+	}
+	for _, tc := range tests {
+		s := valid
+		tc.edit(&s)
+		err := validate.Struct(&s)
+		if tc.fields == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+			continue
+		}
+		var e *identity.Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: err = %v, want an identity error", tc.name, err)
+			continue
+		}
+		if e.Kind != identity.KindInvalidArgument || e.Code != validate.CodeInvalidRequest || !reflect.DeepEqual(e.Fields, tc.fields) {
+			t.Errorf("%s: err = %+v, want invalid_request with %+v", tc.name, e, tc.fields)
+		}
+	}
+}
+
+type badRule struct {
+	Name string `validate:"requried"`
+}
+
+type badLimit struct {
+	Name string `validate:"max=ten"`
+}
+
+type badKind struct {
+	Enabled bool `validate:"required"`
+}
+
+type oneofNumber struct {
+	Count int `validate:"oneof=1 2"`
+}
+
+type maxbytesList struct {
+	Items []string `validate:"maxbytes=10"`
+}
+
+type emptyOneof struct {
+	Role string `validate:"oneof="`
+}
+
+func TestMustStruct(t *testing.T) {
+	validate.MustStruct(signup{})
+	validate.MustStruct(&signup{})
+
+	for _, v := range []any{badRule{}, badLimit{}, badKind{}, oneofNumber{}, maxbytesList{}, emptyOneof{}, "not a struct", nil} {
+		if !panics(func() { validate.MustStruct(v) }) {
+			t.Errorf("MustStruct(%T) did not panic", v)
+		}
+		// Unchecked types fail the request instead of the process.
+		var err error
+		if panics(func() { err = validate.Struct(v) }) || err == nil {
+			t.Errorf("Struct(%T) = %v, want an error and no panic", v, err)
+			continue
+		}
+		var e *identity.Error
+		if errors.As(err, &e) {
+			t.Errorf("Struct(%T) = %v, want an internal error", v, err)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	rules := validate.Rules{
+		"page_size":  "min=0,max=500",
+		"page_token": "required,max=4",
+		"roles":      "max=2",
+	}
+	validate.MustMatch(&pb.ListUsersRequest{}, rules)
+
+	tests := []struct {
+		name   string
+		req    *pb.ListUsersRequest
+		fields []string
+	}{
+		{"valid", &pb.ListUsersRequest{PageToken: "abc", Roles: []string{"seller"}}, nil},
+		{"required", &pb.ListUsersRequest{}, []string{"page_token is required"}},
+		{"number", &pb.ListUsersRequest{PageSize: -1, PageToken: "a"}, []string{"page_size must be at least 0"}},
+		{"list", &pb.ListUsersRequest{PageToken: "a", Roles: []string{"a", "b", "c"}}, []string{"roles must be at most 2 items"}},
+		{"declaration order", &pb.ListUsersRequest{PageSize: 501, PageToken: "abcde"}, []string{
+			"page_size must be at most 500",
+			"page_token must be at most 4 characters",
+		}},
+	}
+	for _, tc := range tests {
+		err := validate.Message(tc.req, rules)
+		var got []string
+		if e := (*identity.Error)(nil); errors.As(err, &e) {
+			for _, f := range e.Fields {
+				got = append(got, f.Message)
+			}
+		} else if err != nil {
+			t.Errorf("%s: err = %v, want an identity error", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.fields) {
+			t.Errorf("%s: field errors = %q, want %q", tc.name, got, tc.fields)
+		}
+	}
+}
+
+func TestMustMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules validate.Rules
+		want  string
+	}{
+		{"unknown field", validate.Rules{"page_sise": "min=0"}, "no field"},
+		{"unknown rule", validate.Rules{"page_token": "requird"}, "unknown rule"},
+		{"bad limit", validate.Rules{"page_size": "max=lots"}, "needs a number"},
+		{"unsupported kind", validate.Rules{"suspended": "required"}, "cannot check"},
+		{"message field", validate.Rules{"read_mask": "required"}, "cannot check"},
+		{"oneof on a number", validate.Rules{"page_size": "oneof=10 50"}, "only applies to strings"},
+	}
+	for _, tc := range tests {
+		var msg string
+		func() {
+			defer func() { msg, _ = recover().(string) }()
+			validate.MustMatch(&pb.ListUsersRequest{}, tc.rules)
+		}()
+		if !strings.Contains(msg, tc.want) {
+			t.Errorf("%s: MustMatch panicked with %q, want %q", tc.name, msg, tc.want)
+		}
+		if err := validate.Message(&pb.ListUsersRequest{}, tc.rules); tc.name != "unknown field" && err == nil {
+			t.Errorf("%s: Message accepted the rules", tc.name)
+		}
+	}
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() { panicked = recover() != nil }()
+	f()
+	return false
+}
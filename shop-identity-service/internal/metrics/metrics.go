@@ -0,0 +1,139 @@
+// Package metrics defines the identity service's Prometheus metrics: HTTP
+// requests by route, and business events recorded by decorating the
+// service and its notifiers. gRPC calls are counted by the interceptors in
+// transport/grpc.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+	"github.com/hawful70/shop-identity-service/internal/identity/repository"
+)
+
+// outcomeSuccess labels calls that returned no error. Failures are labelled
+// with their error catalog code, such as invalid_credentials.
+const outcomeSuccess = "success"
+
+// unmatchedRoute labels requests that matched no route, so that scanners
+// probing random paths cannot create new series.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	registrations    *prometheus.CounterVec
+	logins           *prometheus.CounterVec
+	tokenValidations *prometheus.CounterVec
+	kafkaPublished   *prometheus.CounterVec
+}
+
+// NewRegistry returns a registry with the Go runtime and process metrics.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler serves the metrics gathered by reg in the Prometheus text format.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// New registers the HTTP and business metrics with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "identity_http_requests_total",
+			Help: "HTTP requests handled, by method, route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "identity_http_request_duration_seconds",
+			Help:    "Time to handle HTTP requests, by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "identity_registrations_total",
+			Help: "Self-service registrations, by outcome.",
+		}, []string{"outcome"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "identity_logins_total",
+			Help: "Login attempts, by outcome.",
+		}, []string{"outcome"}),
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "identity_token_validations_total",
+			Help: "ValidateToken calls, by outcome.",
+		}, []string{"outcome"}),
+		kafkaPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "identity_kafka_publish_total",
+			Help: "Events published to Kafka, by event type and result.",
+		}, []string{"event", "result"}),
+	}
+	reg.MustRegister(m.httpRequests, m.httpDuration, m.registrations, m.logins, m.tokenValidations, m.kafkaPublished)
+	return m
+}
+
+// Middleware records every request under the chi route pattern it matched,
+// such as /api/v1/orgs/{orgID}/members. It must be used on the root router.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		// A path that misses inside a mounted router keeps the mount's
+		// wildcard pattern.
+		if strings.HasSuffix(route, "/*") && (status == http.StatusNotFound || status == http.StatusMethodNotAllowed) {
+			route = unmatchedRoute
+		}
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterUserCache exposes the counters of a user cache.
+func RegisterUserCache(reg prometheus.Registerer, stats func() repository.CacheStats) {
+	lookups := func(result string, count func(repository.CacheStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "identity_user_cache_lookups_total",
+			Help:        "User cache lookups, by result.",
+			ConstLabels: prometheus.Labels{"result": result},
+		}, func() float64 { return float64(count(stats())) })
+	}
+	reg.MustRegister(
+		lookups("hit", func(s repository.CacheStats) int64 { return s.Hits - s.NegativeHits }),
+		lookups("negative_hit", func(s repository.CacheStats) int64 { return s.NegativeHits }),
+		lookups("miss", func(s repository.CacheStats) int64 { return s.Misses }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "identity_user_cache_errors_total",
+			Help: "User cache failures; lookups fall back to the database.",
+		}, func() float64 { return float64(stats().Errors) }),
+	)
+}
+
+func outcome(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	return string(identity.AsError(err).Code)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMiddlewareRouteLabel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Route("/api/v1", func(api chi.Router) {
+		api.Get("/orgs/{orgID}/members", func(w http.ResponseWriter, r *http.Request) {})
+		api.Post("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	})
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/orgs/o-1/members"},
+		{http.MethodGet, "/api/v1/orgs/o-2/members"},
+		{http.MethodPost, "/api/v1/auth/login"},
+		{http.MethodGet, "/wp-login.php"},
+		// Misses inside the /api/v1 router.
+		{http.MethodGet, "/api/v1/orgs/o-1/secrets"},
+		// Matches a pattern, but not its method.
+		{http.MethodDelete, "/api/v1/auth/login"},
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scraped := rec.Body.String()
+	for _, want := range []string{
+		// Requests are labelled by pattern, not by path.
+		`identity_http_requests_total{code="200",method="GET",route="/api/v1/orgs/{orgID}/members"} 2`,
+		`identity_http_requests_total{code="401",method="POST",route="/api/v1/auth/login"} 1`,
+		`identity_http_request_duration_seconds_count{method="GET",route="/api/v1/orgs/{orgID}/members"} 2`,
+		// Paths that match no route share one series.
+		`identity_http_requests_total{code="404",method="GET",route="unmatched"} 2`,
+		`identity_http_requests_total{code="405",method="DELETE",route="unmatched"} 1`,
+	} {
+		if !strings.Contains(scraped, want+"\n") {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(scraped, "o-1") || strings.Contains(scraped, "wp-login") {
+		t.Errorf("request paths leaked into labels:\n%s", scraped)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/hawful70/platform-events/pkg/events"
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+type instrumentedService struct {
+	identity.Service
+	m *Metrics
+}
+
+// InstrumentService counts registrations, logins and token validations made
+// through svc.
+func (m *Metrics) InstrumentService(svc identity.Service) identity.Service {
+	return instrumentedService{Service: svc, m: m}
+}
+
+func (s instrumentedService) Register(ctx context.Context, email, username, password string) (identity.User, error) {
+	user, err := s.Service.Register(ctx, email, username, password)
+	s.m.registrations.WithLabelValues(outcome(err)).Inc()
+	return user, err
+}
+
+// Login counts expired passwords as password_change_required, although they
+// return a challenge token.
+func (s instrumentedService) Login(ctx context.Context, login, password string) (identity.User, string, error) {
+	user, token, err := s.Service.Login(ctx, login, password)
+	s.m.logins.WithLabelValues(outcome(err)).Inc()
+	return user, token, err
+}
+
+func (s instrumentedService) ValidateToken(ctx context.Context, token string) (identity.User, identity.Claims, error) {
+	user, claims, err := s.Service.ValidateToken(ctx, token)
+	s.m.tokenValidations.WithLabelValues(outcome(err)).Inc()
+	return user, claims, err
+}
+
+type instrumentedNotifier struct {
+	identity.UserNotifier
+	m *Metrics
+}
+
+// InstrumentNotifier counts the user_created events n publishes.
+func (m *Metrics) InstrumentNotifier(n identity.UserNotifier) identity.UserNotifier {
+	return instrumentedNotifier{UserNotifier: n, m: m}
+}
+
+func (n instrumentedNotifier) UserCreated(ctx context.Context, user identity.User) error {
+	err := n.UserNotifier.UserCreated(ctx, user)
+	n.m.published(events.UserCreatedType, err)
+	return err
+}
+
+type instrumentedInvitationNotifier struct {
+	identity.InvitationNotifier
+	m *Metrics
+}
+
+// InstrumentInvitationNotifier counts the invitation events n publishes.
+func (m *Metrics) InstrumentInvitationNotifier(n identity.InvitationNotifier) identity.InvitationNotifier {
+	return instrumentedInvitationNotifier{InvitationNotifier: n, m: m}
+}
+
+func (n instrumentedInvitationNotifier) InvitationCreated(ctx context.Context, inv identity.Invitation, org identity.Organization, inviter identity.User, token string) error {
+	err := n.InvitationNotifier.InvitationCreated(ctx, inv, org, inviter, token)
+	n.m.published(events.OrganizationInvitationCreatedType, err)
+	return err
+}
+
+func (m *Metrics) published(event string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.kafkaPublished.WithLabelValues(event, result).Inc()
+}
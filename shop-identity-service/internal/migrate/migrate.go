@@ -0,0 +1,306 @@
+// Package migrate applies versioned SQL migrations to PostgreSQL. Applied
+// versions are recorded in the schema_migrations table, and a session
+// advisory lock keeps concurrent replicas from migrating at the same time.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrSchemaBehind is returned by Check when migrations are pending.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// lockKey names the advisory lock held while migrating. Any constant works as
+// long as every replica uses the same one.
+const lockKey int64 = 0x6964656e74697479 // "identity"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is a known migration and when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// dialect holds the statements that depend on the database. Only
+// PostgreSQL is supported; the tests swap in SQLite.
+type dialect struct {
+	lock, unlock string
+	createTable  string
+	tableExists  string
+	insert       string
+	delete       string
+}
+
+var postgres = dialect{
+	lock:   `SELECT pg_advisory_lock($1)`,
+	unlock: `SELECT pg_advisory_unlock($1)`,
+	createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	tableExists: `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+	insert:      `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+	delete:      `DELETE FROM schema_migrations WHERE version = $1`,
+}
+
+// New reads the migrations in the root of fsys. Every version needs an up
+// file; down files are optional, but without one the version cannot be
+// reverted.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(body)
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return &Migrator{db: db, dialect: postgres, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, mig.up, m.dialect.insert, mig.Version, mig.Name)
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the steps most recently applied migrations, newest first, and
+// returns the ones it reverted. It stops at the first one that cannot be
+// reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 0 {
+		return nil, fmt.Errorf("cannot revert %d migrations", steps)
+	}
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(done))
+		for v := range done {
+			versions = append(versions, v)
+		}
+		slices.Sort(versions)
+		slices.Reverse(versions)
+
+		for _, v := range versions[:min(steps, len(versions))] {
+			mig, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("migration %d is applied but unknown to this binary", v)
+			}
+			if mig.down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", mig.Version, mig.Name)
+			}
+			err := inTx(ctx, conn, mig.down, m.dialect.delete, mig.Version)
+			if err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists the known migrations in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	done, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if at, ok := done[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Check returns ErrSchemaBehind when a known migration has not been applied.
+// Versions applied by a newer binary are fine, so that older replicas keep
+// running during a rollout.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations %v", ErrSchemaBehind, len(pending), pending)
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn on one connection holding the migration lock. Other
+// replicas block on the lock until fn returns, and then see its migrations
+// as applied.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.lock, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Closing the connection would release the lock as well, but it goes
+		// back to the pool instead.
+		_, _ = conn.ExecContext(context.Background(), m.dialect.unlock, lockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// appliedVersions maps applied versions to when they were applied. A missing
+// schema_migrations table means nothing has been applied.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists); err != nil {
+		return nil, err
+	}
+	done := map[int64]time.Time{}
+	if !exists {
+		return done, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+// inTx runs script and then the bookkeeping statement in one transaction.
+func inTx(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
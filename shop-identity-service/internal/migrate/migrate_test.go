@@ -0,0 +1,267 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// sqlite stands in for PostgreSQL. Each test has its own database, so the
+// lock is a no-op.
+var sqlite = dialect{
+	lock:   `SELECT $1`,
+	unlock: `SELECT $1`,
+	createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	tableExists: `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`,
+	insert:      `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+	delete:      `DELETE FROM schema_migrations WHERE version = $1`,
+}
+
+func file(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+// testMigrations has a version without a down file, a gap in the numbering
+// and files that are not migrations.
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_users.up.sql":         file(`CREATE TABLE users (id TEXT PRIMARY KEY);`),
+		"0001_users.down.sql":       file(`DROP TABLE users;`),
+		"0002_users_email.up.sql":   file(`ALTER TABLE users ADD COLUMN email TEXT; CREATE INDEX idx_users_email ON users (email);`),
+		"0002_users_email.down.sql": file(`DROP INDEX idx_users_email; ALTER TABLE users DROP COLUMN email;`),
+		"0010_orders.up.sql":        file(`CREATE TABLE orders (id TEXT PRIMARY KEY);`),
+		"README.md":                 file(`Migrations for the tests.`),
+		"seeds/0001_demo.up.sql":    file(`INSERT INTO users (id) VALUES ('demo');`),
+	}
+}
+
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := New(db, fsys)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	m.dialect = sqlite
+	return m
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func versions(migrations []Migration) []int64 {
+	vs := []int64{}
+	for _, mig := range migrations {
+		vs = append(vs, mig.Version)
+	}
+	return vs
+}
+
+func TestNew(t *testing.T) {
+	m := newMigrator(t, nil, testMigrations())
+	if got, want := versions(m.migrations), []int64{1, 2, 10}; !slices.Equal(got, want) {
+		t.Fatalf("versions = %v, want %v", got, want)
+	}
+	users := m.migrations[0]
+	if users.Name != "users" || !strings.HasPrefix(users.up, "CREATE TABLE users") || users.down != "DROP TABLE users;" {
+		t.Fatalf("migration 1 = %+v", users)
+	}
+	if orders := m.migrations[2]; orders.Name != "orders" || orders.down != "" {
+		t.Fatalf("migration 10 = %+v, want no down script", orders)
+	}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{
+			"version used twice",
+			fstest.MapFS{
+				"0001_users.up.sql":  file(`SELECT 1;`),
+				"0001_orders.up.sql": file(`SELECT 1;`),
+			},
+			"migration version 1 is used by",
+		},
+		{
+			"down file without an up file",
+			fstest.MapFS{
+				"0001_users.up.sql":    file(`SELECT 1;`),
+				"0002_orders.down.sql": file(`SELECT 1;`),
+			},
+			"migration 2_orders has no up file",
+		},
+		{
+			"empty up file",
+			fstest.MapFS{"0001_users.up.sql": file(``)},
+			"migration 1_users has no up file",
+		},
+		{
+			"version out of range",
+			fstest.MapFS{"99999999999999999999_users.up.sql": file(`SELECT 1;`)},
+			"migration 99999999999999999999_users.up.sql",
+		},
+	}
+	for _, tc := range tests {
+		_, err := New(nil, tc.files)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestUpAndCheck(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m := newMigrator(t, db, testMigrations())
+
+	// A fresh database has no schema_migrations table yet.
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaBehind) || !strings.Contains(err.Error(), "3 pending migrations [1_users 2_users_email 10_orders]") {
+		t.Fatalf("Check before Up: err = %v, want all three pending", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if got, want := versions(applied), []int64{1, 2, 10}; !slices.Equal(got, want) {
+		t.Fatalf("Up applied %v, want %v", got, want)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check after Up: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, email) VALUES ('u1', 'a@example.com')`); err != nil {
+		t.Fatalf("schema was not applied: %v", err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("Status: migration %d has no applied time", s.Version)
+		}
+	}
+
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %v, %v; want nothing applied", versions(applied), err)
+	}
+
+	// A binary that knows a migration more reports it as pending...
+	newer := testMigrations()
+	newer["0011_orders_total.up.sql"] = file(`ALTER TABLE orders ADD COLUMN total INTEGER;`)
+	next := newMigrator(t, db, newer)
+	if err := next.Check(ctx); !errors.Is(err, ErrSchemaBehind) || !strings.Contains(err.Error(), "[11_orders_total]") {
+		t.Fatalf("Check with a new migration: err = %v, want 11_orders_total pending", err)
+	}
+	if applied, err := next.Up(ctx); err != nil || !slices.Equal(versions(applied), []int64{11}) {
+		t.Fatalf("Up of the new migration = %v, %v", versions(applied), err)
+	}
+	// ...while the older binary accepts a schema ahead of it.
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check of a newer schema: %v", err)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	files := testMigrations()
+	files["0002_users_email.up.sql"] = file(`ALTER TABLE users ADD COLUMN email TEXT; ALTER TABLE missing ADD COLUMN x TEXT;`)
+	m := newMigrator(t, db, files)
+
+	applied, err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "apply migration 2_users_email") {
+		t.Fatalf("Up: err = %v, want migration 2 to fail", err)
+	}
+	if !slices.Equal(versions(applied), []int64{1}) {
+		t.Fatalf("Up applied %v, want [1]", versions(applied))
+	}
+	// The failed migration was rolled back as a whole.
+	if _, err := db.Exec(`SELECT email FROM users`); err == nil {
+		t.Fatal("the failed migration's first statement was kept")
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("Check: err = %v, want ErrSchemaBehind", err)
+	}
+}
+
+func TestDown(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		steps   int
+		want    []int64
+		wantErr string
+	}{
+		{"negative steps", -1, []int64{}, "cannot revert -1 migrations"},
+		{"no steps", 0, []int64{}, ""},
+		{"stops at a migration without down file", 1, []int64{}, "migration 10_orders cannot be reverted"},
+		{"more steps than applied", 5, []int64{}, "migration 10_orders cannot be reverted"},
+	}
+	for _, tc := range tests {
+		m := newMigrator(t, openDB(t), testMigrations())
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatalf("%s: Up: %v", tc.name, err)
+		}
+		reverted, err := m.Down(ctx, tc.steps)
+		if (err == nil) != (tc.wantErr == "") || err != nil && !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.wantErr)
+		}
+		if got := versions(reverted); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: reverted %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Without the irreversible migration, Down reverts newest first and
+	// never more than was applied.
+	files := testMigrations()
+	delete(files, "0010_orders.up.sql")
+	db := openDB(t)
+	m := newMigrator(t, db, files)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	reverted, err := m.Down(ctx, 1)
+	if err != nil || !slices.Equal(versions(reverted), []int64{2}) {
+		t.Fatalf("Down(1) = %v, %v; want [2]", versions(reverted), err)
+	}
+	if _, err := db.Exec(`SELECT email FROM users`); err == nil {
+		t.Fatal("Down(1) left the email column")
+	}
+	reverted, err = m.Down(ctx, 5)
+	if err != nil || !slices.Equal(versions(reverted), []int64{1}) {
+		t.Fatalf("Down(5) = %v, %v; want [1]", versions(reverted), err)
+	}
+	if reverted, err := m.Down(ctx, 1); err != nil || len(reverted) != 0 {
+		t.Fatalf("Down with nothing applied = %v, %v", versions(reverted), err)
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("Check after reverting everything: err = %v, want ErrSchemaBehind", err)
+	}
+
+	// A version applied by a newer binary cannot be reverted by this one.
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (12, 'newer')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "migration 12 is applied but unknown") {
+		t.Fatalf("Down of an unknown version: err = %v", err)
+	}
+}
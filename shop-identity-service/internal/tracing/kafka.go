@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KafkaHeaders carries trace context in the headers of a Kafka message, for
+// the consumer to continue the trace.
+type KafkaHeaders struct {
+	Headers *[]kafka.Header
+}
+
+func (c KafkaHeaders) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c KafkaHeaders) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c KafkaHeaders) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// StartPublish starts a producer span for publishing msg to topic and
+// injects its context into msg's headers. The message key is left out of
+// the span: it is the user's email. Pass the error of the write to the
+// returned function to end the span.
+func StartPublish(ctx context.Context, topic string, msg *kafka.Message) func(error) {
+	ctx, span := tracer().Start(ctx, "send "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(topic),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, KafkaHeaders{Headers: &msg.Headers})
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
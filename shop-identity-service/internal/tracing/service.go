@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/hawful70/shop-identity-service/internal/identity"
+)
+
+type tracedService struct {
+	identity.Service
+}
+
+// InstrumentService wraps registrations, logins and token validations in
+// spans. Their database queries and events become child spans.
+func InstrumentService(svc identity.Service) identity.Service {
+	return tracedService{Service: svc}
+}
+
+func (s tracedService) Register(ctx context.Context, email, username, password string) (identity.User, error) {
+	ctx, span := tracer().Start(ctx, "identity.Register")
+	defer span.End()
+	user, err := s.Service.Register(ctx, email, username, password)
+	if err == nil {
+		span.SetAttributes(attribute.String("identity.user_id", string(user.ID)))
+	}
+	endSpan(span, err)
+	return user, err
+}
+
+func (s tracedService) Login(ctx context.Context, login, password string) (identity.User, string, error) {
+	ctx, span := tracer().Start(ctx, "identity.Login")
+	defer span.End()
+	user, token, err := s.Service.Login(ctx, login, password)
+	if user.ID != "" {
+		span.SetAttributes(attribute.String("identity.user_id", string(user.ID)))
+	}
+	endSpan(span, err)
+	return user, token, err
+}
+
+func (s tracedService) ValidateToken(ctx context.Context, token string) (identity.User, identity.Claims, error) {
+	ctx, span := tracer().Start(ctx, "identity.ValidateToken")
+	defer span.End()
+	user, claims, err := s.Service.ValidateToken(ctx, token)
+	endSpan(span, err)
+	return user, claims, err
+}
+
+// endSpan records err's catalog code. Only internal errors mark the span as
+// failed: a wrong password is the caller's mistake, not ours.
+func endSpan(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	e := identity.AsError(err)
+	span.SetAttributes(attribute.String("identity.error_code", string(e.Code)))
+	if e.Kind == identity.KindInternal {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, e.Message)
+	}
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS signing_keys;
+DROP TABLE IF EXISTS scim_tokens;
+DROP TABLE IF EXISTS organization_invitations;
+DROP TABLE IF EXISTS organization_memberships;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS tenants;
+DROP TABLE IF EXISTS impersonation_events;
+DROP TABLE IF EXISTS impersonation_sessions;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS users;
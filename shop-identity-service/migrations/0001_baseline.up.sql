@@ -0,0 +1,174 @@
+-- Baseline schema, matching what AutoMigrate produced before migrations were
+-- introduced. Every statement tolerates existing objects so that databases
+-- created by AutoMigrate or the old seed script can be adopted.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'default',
+    email TEXT NOT NULL,
+    email_canonical TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL,
+    username_canonical TEXT NOT NULL DEFAULT '',
+    username_skeleton TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL,
+    provider TEXT NOT NULL DEFAULT 'local',
+    provider_id TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT 'customer',
+    password_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    external_id TEXT NOT NULL DEFAULT '',
+    suspended_at TIMESTAMPTZ,
+    session_version BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Columns added after the seed script's version of the table.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_canonical TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_skeleton TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'customer';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version BIGINT NOT NULL DEFAULT 0;
+
+-- AutoMigrate left these columns nullable; the service always writes them.
+UPDATE users SET
+    provider = COALESCE(provider, 'local'),
+    provider_id = COALESCE(provider_id, ''),
+    created_at = COALESCE(created_at, NOW()),
+    updated_at = COALESCE(updated_at, NOW())
+WHERE provider IS NULL OR provider_id IS NULL OR created_at IS NULL OR updated_at IS NULL;
+ALTER TABLE users
+    ALTER COLUMN email SET NOT NULL,
+    ALTER COLUMN username SET NOT NULL,
+    ALTER COLUMN password SET NOT NULL,
+    ALTER COLUMN provider SET NOT NULL,
+    ALTER COLUMN provider SET DEFAULT 'local',
+    ALTER COLUMN provider_id SET NOT NULL,
+    ALTER COLUMN provider_id SET DEFAULT '',
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET NOT NULL,
+    ALTER COLUMN updated_at SET DEFAULT NOW();
+
+-- Emails used to be unique across all tenants.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+DROP INDEX IF EXISTS idx_users_email;
+DROP INDEX IF EXISTS idx_users_email_canonical;
+DROP INDEX IF EXISTS idx_users_username_skeleton;
+
+-- Legacy rows keep an empty canonical email or skeleton and are excluded
+-- from the unique indexes.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users (tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_canonical ON users (tenant_id, email_canonical) WHERE email_canonical <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username_skeleton ON users (tenant_id, username_skeleton) WHERE username_skeleton <> '';
+CREATE INDEX IF NOT EXISTS idx_users_tenant_username_canonical ON users (tenant_id, username_canonical);
+CREATE INDEX IF NOT EXISTS idx_users_tenant_external_id ON users (tenant_id, external_id);
+
+CREATE TABLE IF NOT EXISTS password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status_code BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BYTEA,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id TEXT PRIMARY KEY,
+    actor_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    started_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_actor_id ON impersonation_sessions (actor_id);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_target_id ON impersonation_sessions (target_id);
+
+CREATE TABLE IF NOT EXISTS impersonation_events (
+    id BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    action TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_impersonation_events_session_id ON impersonation_events (session_id);
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    hosts TEXT,
+    jwt_issuer TEXT NOT NULL DEFAULT '',
+    jwt_audience TEXT NOT NULL DEFAULT '',
+    settings TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_organizations_tenant_id ON organizations (tenant_id);
+
+CREATE TABLE IF NOT EXISTS organization_memberships (
+    organization_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_organization_memberships_user_id ON organization_memberships (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    expires_at TIMESTAMPTZ,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_organization_id ON organization_invitations (organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_token_hash ON organization_invitations (token_hash);
+
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_scim_tokens_tenant_id ON scim_tokens (tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_tokens_token_hash ON scim_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL,
+    retired_at TIMESTAMPTZ
+);
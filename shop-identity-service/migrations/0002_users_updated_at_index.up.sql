@@ -0,0 +1,2 @@
+-- WatchUsers polls each tenant's users in update order.
+CREATE INDEX IF NOT EXISTS idx_users_tenant_updated_at ON users (tenant_id, updated_at);
@@ -0,0 +1,2 @@
+-- The purged rows cannot be restored.
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Fingerprints were unkeyed SHA-256 hashes of registration bodies, which hold
+-- plaintext passwords. They are now HMACs; drop the old rows rather than
+-- keep them for the rest of their TTL. Clients retrying across this change
+-- are treated as new requests.
+DELETE FROM idempotency_keys;
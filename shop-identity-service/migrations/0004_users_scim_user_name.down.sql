@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_tenant_scim_user_name;
+ALTER TABLE users DROP COLUMN IF EXISTS scim_user_name;
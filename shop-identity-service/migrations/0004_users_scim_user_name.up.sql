@@ -0,0 +1,3 @@
+-- The userName a SCIM directory provisioned the user with, kept as sent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scim_user_name TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_users_tenant_scim_user_name ON users (tenant_id, LOWER(scim_user_name)) WHERE scim_user_name <> '';
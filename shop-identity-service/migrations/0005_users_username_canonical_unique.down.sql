@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_tenant_username_canonical;
+CREATE INDEX IF NOT EXISTS idx_users_tenant_username_canonical ON users (tenant_id, username_canonical);
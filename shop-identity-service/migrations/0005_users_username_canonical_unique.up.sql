@@ -0,0 +1,4 @@
+-- Usernames that differ only in case are the same login. The skeleton no
+-- longer implies it, since it keeps "I" apart from "i".
+DROP INDEX IF EXISTS idx_users_tenant_username_canonical;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username_canonical ON users (tenant_id, username_canonical) WHERE username_canonical <> '';
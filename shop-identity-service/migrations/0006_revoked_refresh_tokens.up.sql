@@ -0,0 +1,8 @@
+-- Refresh tokens are single use: rotation and logout record their jti here
+-- until they expire.
+CREATE TABLE IF NOT EXISTS revoked_refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_refresh_tokens_expires_at ON revoked_refresh_tokens (expires_at);
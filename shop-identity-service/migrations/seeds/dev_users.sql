@@ -1,21 +1,15 @@
-CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+-- Local development data. The schema comes from the versioned migrations;
+-- run this after "identity-admin migrate up" (or a service start).
 
-CREATE TABLE IF NOT EXISTS users (
-    id TEXT PRIMARY KEY,
-    email TEXT UNIQUE NOT NULL,
-    username TEXT NOT NULL,
-    password TEXT NOT NULL,
-    provider TEXT NOT NULL DEFAULT 'local',
-    provider_id TEXT NOT NULL DEFAULT '',
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-);
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
 -- Seed initial user for local development (password: password123)
-INSERT INTO users (id, email, username, password, provider, provider_id, created_at, updated_at)
+INSERT INTO users (id, email, email_canonical, username, username_canonical, password, provider, provider_id, created_at, updated_at)
 VALUES (
     '00000000-0000-0000-0000-000000000001',
     'demo@example.com',
+    'demo@example.com',
+    'demo',
     'demo',
     '$2a$10$VsJaYdoUmPU2LBY.oLcZCeI.UuIkshR9OCdE3s9SXD5w8JVh2wQfa',
     'local',
@@ -23,13 +17,15 @@ VALUES (
     NOW(),
     NOW()
 )
-ON CONFLICT (email) DO NOTHING;
+ON CONFLICT (tenant_id, email) DO NOTHING;
 
 -- Bulk seed 100 local users (password: password123)
-INSERT INTO users (id, email, username, password, provider, provider_id, created_at, updated_at)
+INSERT INTO users (id, email, email_canonical, username, username_canonical, password, provider, provider_id, created_at, updated_at)
 SELECT
     uuid_generate_v4(),
     format('user%03s@example.com', lpad(gs.i::text, 3, '0')),
+    format('user%03s@example.com', lpad(gs.i::text, 3, '0')),
+    format('user%03s', lpad(gs.i::text, 3, '0')),
     format('user%03s', lpad(gs.i::text, 3, '0')),
     '$2a$10$VsJaYdoUmPU2LBY.oLcZCeI.UuIkshR9OCdE3s9SXD5w8JVh2wQfa',
     'local',
@@ -37,4 +33,4 @@ SELECT
     NOW(),
     NOW()
 FROM generate_series(1, 100) AS gs(i)
-ON CONFLICT (email) DO NOTHING;
+ON CONFLICT (tenant_id, email) DO NOTHING;
@@ -0,0 +1,79 @@
+package identityclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// claimsCache is an LRU of validated tokens. Tokens are keyed by hash so the
+// cache does not hold credentials.
+type claimsCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type claimsEntry struct {
+	key       [sha256.Size]byte
+	claims    Claims
+	expiresAt time.Time
+}
+
+func newClaimsCache(size int, ttl time.Duration) *claimsCache {
+	return &claimsCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[[sha256.Size]byte]*list.Element{},
+	}
+}
+
+func cacheKey(tenant, token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(tenant + "\x00" + token))
+}
+
+func (c *claimsCache) get(tenant, token string) (Claims, bool) {
+	key := cacheKey(tenant, token)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Claims{}, false
+	}
+	entry := el.Value.(*claimsEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return Claims{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.claims, true
+}
+
+// set keeps claims for the cache TTL, or until the token expires if that is
+// sooner. A zero claims.ExpiresAt is unknown.
+func (c *claimsCache) set(tenant, token string, claims Claims) {
+	expiresAt := time.Now().Add(c.ttl)
+	if !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt
+	}
+	key := cacheKey(tenant, token)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = &claimsEntry{key: key, claims: claims, expiresAt: expiresAt}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&claimsEntry{key: key, claims: claims, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*claimsEntry).key)
+	}
+}
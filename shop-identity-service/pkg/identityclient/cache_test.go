@@ -0,0 +1,60 @@
+package identityclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimsCache(t *testing.T) {
+	c := newClaimsCache(2, time.Minute)
+	c.set("", "a", Claims{UserID: "a"})
+	c.set("", "b", Claims{UserID: "b"})
+
+	// Reading a keeps it; adding c evicts b, the least recently used.
+	if got, ok := c.get("", "a"); !ok || got.UserID != "a" {
+		t.Fatalf("get(a) = %+v, %v", got, ok)
+	}
+	c.set("", "c", Claims{UserID: "c"})
+	if _, ok := c.get("", "b"); ok {
+		t.Fatal("b was not evicted")
+	}
+	for _, token := range []string{"a", "c"} {
+		if _, ok := c.get("", token); !ok {
+			t.Fatalf("%s was evicted", token)
+		}
+	}
+
+	if _, ok := c.get("globex", "a"); ok {
+		t.Fatal("an entry of the default tenant matched another tenant")
+	}
+
+	c.set("", "a", Claims{UserID: "a2"})
+	if got, _ := c.get("", "a"); got.UserID != "a2" {
+		t.Fatalf("get(a) after an update = %+v", got)
+	}
+}
+
+func TestClaimsCacheExpiry(t *testing.T) {
+	c := newClaimsCache(10, time.Millisecond)
+	c.set("", "a", Claims{UserID: "a"})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get("", "a"); ok {
+		t.Fatal("expired entry was returned")
+	}
+	if c.order.Len() != 0 || len(c.entries) != 0 {
+		t.Fatalf("expired entry was kept: %d in order, %d entries", c.order.Len(), len(c.entries))
+	}
+}
+
+func TestClaimsCacheStopsAtTokenExpiry(t *testing.T) {
+	c := newClaimsCache(10, time.Minute)
+	c.set("", "a", Claims{UserID: "a", ExpiresAt: time.Now().Add(time.Millisecond)})
+	c.set("", "b", Claims{UserID: "b", ExpiresAt: time.Now().Add(time.Hour)})
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.get("", "a"); ok {
+		t.Fatal("entry was returned after its token expired")
+	}
+	if _, ok := c.get("", "b"); !ok {
+		t.Fatal("entry of a token valid for longer than the TTL was dropped")
+	}
+}
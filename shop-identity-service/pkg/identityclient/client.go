@@ -0,0 +1,283 @@
+// Package identityclient is the Go client for the identity gRPC service.
+//
+// A Client keeps one connection, retries calls the server could not take,
+// and validates access tokens locally when the service's signing keys are
+// published as a JWKS, falling back to the ValidateToken RPC. Middleware and
+// the gRPC interceptors authenticate incoming requests with it.
+package identityclient
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/hawful70/platform-logging/pkg/logging"
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, expired,
+	// revoked or issued for another tenant.
+	ErrInvalidToken = errors.New("identityclient: invalid token")
+	ErrNotFound     = errors.New("identityclient: user not found")
+)
+
+// tenantMetadataKey and requestIDMetadataKey must match the server's
+// TenantMetadataKey and RequestIDMetadataKey.
+const (
+	tenantMetadataKey    = "x-tenant-id"
+	requestIDMetadataKey = "x-request-id"
+)
+
+type User struct {
+	ID         string
+	Email      string
+	Username   string
+	Provider   string
+	ProviderID string
+	Role       string
+	TenantID   string
+	Suspended  bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Claims describe the subject of a valid access token.
+type Claims struct {
+	UserID   string
+	Email    string
+	Username string
+	Role     string
+	TenantID string
+	OrgID    string
+	OrgRole  string
+	// Actor is set when a support agent is impersonating the subject.
+	Actor *Actor
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time
+}
+
+type Actor struct {
+	UserID string
+	Email  string
+}
+
+func (c Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+type Client struct {
+	conn   *grpc.ClientConn
+	rpc    pb.IdentityServiceClient
+	tenant string
+	cache  *claimsCache
+	jwks   *jwksVerifier
+}
+
+// New connects to the identity service at target, e.g.
+// "dns:///identity:9091". Transport credentials must be chosen with
+// WithMTLS, WithTransportCredentials or WithInsecure. The connection is
+// made on first use.
+func New(target string, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.err != nil {
+		return nil, fmt.Errorf("identityclient: %w", o.err)
+	}
+	if o.creds == nil {
+		return nil, errors.New("identityclient: transport credentials required (WithMTLS or WithInsecure)")
+	}
+
+	conn, err := grpc.NewClient(target, o.dialOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("identityclient: %w", err)
+	}
+	c := &Client{
+		conn:   conn,
+		rpc:    pb.NewIdentityServiceClient(conn),
+		tenant: o.tenant,
+	}
+	if o.cacheSize > 0 && o.cacheTTL > 0 {
+		c.cache = newClaimsCache(o.cacheSize, o.cacheTTL)
+	}
+	if o.jwksURL != "" {
+		c.jwks = newJWKSVerifier(o)
+	}
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant makes calls with ctx act for tenant instead of the
+// client's default tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func (c *Client) tenantOf(ctx context.Context) string {
+	if t, ok := ctx.Value(tenantKey{}).(string); ok && t != "" {
+		return t
+	}
+	return c.tenant
+}
+
+// outgoing adds the tenant and, when the caller's ctx carries one (see
+// logging.ContextWithRequestID), the request ID to the call's metadata, so
+// the server's logs and errors can be matched with the caller's.
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	var kv []string
+	if t := c.tenantOf(ctx); t != "" {
+		kv = append(kv, tenantMetadataKey, t)
+	}
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		kv = append(kv, requestIDMetadataKey, id)
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func (c *Client) GetUser(ctx context.Context, id string) (User, error) {
+	resp, err := c.rpc.GetUser(c.outgoing(ctx), &pb.GetUserRequest{UserId: id})
+	if err != nil {
+		return User{}, fromStatus(err)
+	}
+	return fromProtoUser(resp.GetUser()), nil
+}
+
+// BatchGetUsers returns the users found among ids, in order, and the IDs
+// that were not found. The server takes at most 100 IDs per call.
+func (c *Client) BatchGetUsers(ctx context.Context, ids []string) ([]User, []string, error) {
+	resp, err := c.rpc.BatchGetUsers(c.outgoing(ctx), &pb.BatchGetUsersRequest{UserIds: ids})
+	if err != nil {
+		return nil, nil, fromStatus(err)
+	}
+	users := make([]User, 0, len(resp.GetUsers()))
+	for _, u := range resp.GetUsers() {
+		users = append(users, fromProtoUser(u))
+	}
+	return users, resp.GetMissingUserIds(), nil
+}
+
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	resp, err := c.rpc.GetUserByEmail(c.outgoing(ctx), &pb.GetUserByEmailRequest{Email: email})
+	if err != nil {
+		return User{}, fromStatus(err)
+	}
+	return fromProtoUser(resp.GetUser()), nil
+}
+
+// ValidateToken returns the claims of a valid access token, or
+// ErrInvalidToken. Any other error means the token could not be checked.
+//
+// Valid results are cached (see WithClaimsCache), so a revoked session or
+// suspended user can be accepted until the entry expires. Tokens verified
+// against the JWKS are not checked for revoked sessions or suspended users
+// at all; only the RPC sees those.
+func (c *Client) ValidateToken(ctx context.Context, token string) (Claims, error) {
+	tenant := c.tenantOf(ctx)
+	if c.cache != nil {
+		if claims, ok := c.cache.get(tenant, token); ok {
+			return claims, nil
+		}
+	}
+
+	claims, err := c.validate(ctx, tenant, token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if c.cache != nil {
+		c.cache.set(tenant, token, claims)
+	}
+	return claims, nil
+}
+
+func (c *Client) validate(ctx context.Context, tenant, token string) (Claims, error) {
+	if c.jwks != nil {
+		claims, err := c.jwks.verify(ctx, token)
+		switch {
+		case err == nil:
+			// The server treats calls without a tenant as the default tenant's.
+			if want := cmp.Or(tenant, defaultTenant); claims.TenantID != want {
+				return Claims{}, ErrInvalidToken
+			}
+			return claims, nil
+		case !errors.Is(err, errNoLocalKey):
+			return Claims{}, err
+		}
+	}
+
+	resp, err := c.rpc.ValidateToken(c.outgoing(ctx), &pb.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return Claims{}, fromStatus(err)
+	}
+	if !resp.GetValid() {
+		return Claims{}, ErrInvalidToken
+	}
+	return fromProtoClaims(resp.GetClaims()), nil
+}
+
+func fromStatus(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.OK:
+		return nil
+	}
+	return fmt.Errorf("identityclient: %w", err)
+}
+
+func fromProtoUser(u *pb.User) User {
+	return User{
+		ID:         u.GetId(),
+		Email:      u.GetEmail(),
+		Username:   u.GetUsername(),
+		Provider:   u.GetProvider(),
+		ProviderID: u.GetProviderId(),
+		Role:       u.GetRole(),
+		TenantID:   u.GetTenantId(),
+		Suspended:  u.GetSuspended(),
+		CreatedAt:  asTime(u.GetCreatedAt()),
+		UpdatedAt:  asTime(u.GetUpdatedAt()),
+	}
+}
+
+// asTime keeps unset timestamps, e.g. left out by a read mask, zero.
+func asTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func fromProtoClaims(c *pb.TokenClaims) Claims {
+	claims := Claims{
+		UserID:    c.GetUserId(),
+		Email:     c.GetEmail(),
+		Username:  c.GetUsername(),
+		Role:      c.GetRole(),
+		TenantID:  c.GetTenantId(),
+		OrgID:     c.GetOrgId(),
+		OrgRole:   c.GetOrgRole(),
+		ExpiresAt: asTime(c.GetExpiresAt()),
+	}
+	if a := c.GetActor(); a != nil {
+		claims.Actor = &Actor{UserID: a.GetUserId(), Email: a.GetEmail()}
+	}
+	return claims
+}
@@ -0,0 +1,272 @@
+package identityclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hawful70/platform-logging/pkg/logging"
+	"github.com/hawful70/shop-identity-service/pkg/identityclient"
+	"github.com/hawful70/shop-identity-service/pkg/identityclient/identitytest"
+)
+
+func newServer(t *testing.T, opts ...identityclient.Option) (*identitytest.Server, *identityclient.Client) {
+	t.Helper()
+	srv := identitytest.NewServer()
+	t.Cleanup(srv.Close)
+	client := srv.Client(opts...)
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
+
+func TestOutgoingMetadata(t *testing.T) {
+	srv, client := newServer(t, identityclient.WithTenant("acme"))
+	srv.AddUser(identityclient.User{ID: "u1", Email: "a@example.com"})
+
+	tests := []struct {
+		name              string
+		ctx               context.Context
+		tenant, requestID string
+	}{
+		{"defaults", context.Background(), "acme", ""},
+		{"request id", logging.ContextWithRequestID(context.Background(), "req-1"), "acme", "req-1"},
+		{"tenant from context", identityclient.ContextWithTenant(logging.ContextWithRequestID(context.Background(), "req-2"), "globex"), "globex", "req-2"},
+	}
+	for _, tc := range tests {
+		if _, err := client.GetUser(tc.ctx, "u1"); err != nil {
+			t.Fatalf("%s: GetUser: %v", tc.name, err)
+		}
+		md := srv.LastMetadata()
+		if got := first(md.Get("x-tenant-id")); got != tc.tenant {
+			t.Errorf("%s: x-tenant-id = %q, want %q", tc.name, got, tc.tenant)
+		}
+		if got := first(md.Get("x-request-id")); got != tc.requestID {
+			t.Errorf("%s: x-request-id = %q, want %q", tc.name, got, tc.requestID)
+		}
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestGetUsers(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newServer(t)
+	srv.AddUser(identityclient.User{ID: "u1", Email: "a@example.com", Username: "alice", Role: "seller"})
+	srv.AddUser(identityclient.User{ID: "u2", Email: "b@example.com", Username: "bob"})
+
+	u, err := client.GetUser(ctx, "u1")
+	if err != nil || u.Username != "alice" || u.Role != "seller" {
+		t.Fatalf("GetUser = %+v, %v", u, err)
+	}
+	if _, err := client.GetUser(ctx, "nobody"); !errors.Is(err, identityclient.ErrNotFound) {
+		t.Fatalf("GetUser(unknown): err = %v, want ErrNotFound", err)
+	}
+	if u, err := client.GetUserByEmail(ctx, "B@example.com"); err != nil || u.ID != "u2" {
+		t.Fatalf("GetUserByEmail = %+v, %v", u, err)
+	}
+
+	users, missing, err := client.BatchGetUsers(ctx, []string{"u2", "nobody", "u1"})
+	if err != nil {
+		t.Fatalf("BatchGetUsers: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != "u2" || users[1].ID != "u1" || len(missing) != 1 || missing[0] != "nobody" {
+		t.Fatalf("BatchGetUsers = %+v, missing %v", users, missing)
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newServer(t)
+	srv.AddToken("token-1", identityclient.Claims{UserID: "u1", Role: "customer", TenantID: "default"})
+	srv.AddToken("token-2", identityclient.Claims{UserID: "u2", Actor: &identityclient.Actor{UserID: "agent", Email: "agent@example.com"}})
+
+	claims, err := client.ValidateToken(ctx, "token-1")
+	if err != nil || claims.UserID != "u1" || claims.Role != "customer" || claims.Impersonated() {
+		t.Fatalf("ValidateToken = %+v, %v", claims, err)
+	}
+	claims, err = client.ValidateToken(ctx, "token-2")
+	if err != nil || !claims.Impersonated() || claims.Actor.UserID != "agent" {
+		t.Fatalf("ValidateToken(impersonation) = %+v, %v", claims, err)
+	}
+	if _, err := client.ValidateToken(ctx, "forged"); !errors.Is(err, identityclient.ErrInvalidToken) {
+		t.Fatalf("ValidateToken(forged): err = %v, want ErrInvalidToken", err)
+	}
+
+	srv.FailWith(status.Error(codes.Internal, "boom"))
+	_, err = client.ValidateToken(ctx, "token-1")
+	if err == nil || errors.Is(err, identityclient.ErrInvalidToken) {
+		t.Fatalf("ValidateToken while the service fails: err = %v, want an error other than ErrInvalidToken", err)
+	}
+}
+
+func TestValidateTokenCache(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newServer(t, identityclient.WithClaimsCache(10, time.Minute))
+	srv.AddToken("token-1", identityclient.Claims{UserID: "u1"})
+
+	for range 3 {
+		if _, err := client.ValidateToken(ctx, "token-1"); err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+	}
+	if got := srv.Calls(); got != 1 {
+		t.Fatalf("calls for three validations = %d, want 1", got)
+	}
+
+	// Cached claims outlive a revocation until the entry expires.
+	srv.RevokeToken("token-1")
+	if _, err := client.ValidateToken(ctx, "token-1"); err != nil {
+		t.Fatalf("ValidateToken of a cached, revoked token: %v", err)
+	}
+
+	// Entries are per tenant, and rejections are not cached.
+	other := identityclient.ContextWithTenant(ctx, "globex")
+	if _, err := client.ValidateToken(other, "token-1"); !errors.Is(err, identityclient.ErrInvalidToken) {
+		t.Fatalf("ValidateToken for another tenant: err = %v, want ErrInvalidToken", err)
+	}
+	srv.AddToken("token-1", identityclient.Claims{UserID: "u1", TenantID: "globex"})
+	if claims, err := client.ValidateToken(other, "token-1"); err != nil || claims.TenantID != "globex" {
+		t.Fatalf("ValidateToken after the rejection = %+v, %v", claims, err)
+	}
+	if got := srv.Calls(); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+}
+
+func TestValidateTokenCacheStopsAtExpiry(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newServer(t, identityclient.WithClaimsCache(10, time.Minute))
+	exp := time.Now().Add(100 * time.Millisecond).Truncate(time.Millisecond)
+	srv.AddToken("token-1", identityclient.Claims{UserID: "u1", ExpiresAt: exp})
+
+	claims, err := client.ValidateToken(ctx, "token-1")
+	if err != nil || !claims.ExpiresAt.Equal(exp) {
+		t.Fatalf("ValidateToken = %+v, %v; want ExpiresAt %v", claims, err, exp)
+	}
+	srv.RevokeToken("token-1")
+	if _, err := client.ValidateToken(ctx, "token-1"); err != nil {
+		t.Fatalf("ValidateToken of a cached token: %v", err)
+	}
+	time.Sleep(time.Until(exp) + 10*time.Millisecond)
+	if _, err := client.ValidateToken(ctx, "token-1"); !errors.Is(err, identityclient.ErrInvalidToken) {
+		t.Fatalf("ValidateToken after the token expired: err = %v, want ErrInvalidToken", err)
+	}
+	if got := srv.Calls(); got != 2 {
+		t.Fatalf("calls = %d, want 2", got)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		attempts  int
+		err       error
+		wantCalls int
+	}{
+		{"unavailable is retried", 3, status.Error(codes.Unavailable, "restarting"), 3},
+		{"retries disabled", 1, status.Error(codes.Unavailable, "restarting"), 1},
+		{"other codes are not retried", 3, status.Error(codes.Internal, "boom"), 1},
+	}
+	for _, tc := range tests {
+		srv, client := newServer(t, identityclient.WithRetry(tc.attempts, time.Millisecond, 5*time.Millisecond))
+		srv.FailWith(tc.err)
+		_, err := client.GetUser(ctx, "u1")
+		if status.Code(errors.Unwrap(err)) != status.Code(tc.err) {
+			t.Fatalf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		if got := srv.Calls(); got != tc.wantCalls {
+			t.Fatalf("%s: calls = %d, want %d", tc.name, got, tc.wantCalls)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	srv, client := newServer(t)
+	srv.AddToken("buyer", identityclient.Claims{UserID: "u1", Role: "customer"})
+	srv.AddToken("seller", identityclient.Claims{UserID: "u2", Role: "seller"})
+
+	var seen identityclient.Claims
+	h := client.Middleware(identityclient.RequireRole("seller")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = identityclient.ClaimsFromContext(r.Context())
+	})))
+
+	tests := []struct {
+		name          string
+		authorization string
+		fail          error
+		want          int
+	}{
+		{"no header", "", nil, http.StatusUnauthorized},
+		{"not bearer", "Basic dXNlcjpwdw==", nil, http.StatusUnauthorized},
+		{"invalid token", "Bearer forged", nil, http.StatusUnauthorized},
+		{"wrong role", "Bearer buyer", nil, http.StatusForbidden},
+		{"allowed", "bearer seller", nil, http.StatusOK},
+		{"service down", "Bearer seller", status.Error(codes.Internal, "boom"), http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		srv.FailWith(tc.fail)
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+	if seen.UserID != "u2" {
+		t.Fatalf("handler saw claims %+v, want u2's", seen)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	srv, client := newServer(t)
+	srv.AddToken("token-1", identityclient.Claims{UserID: "u1"})
+	intercept := client.UnaryServerInterceptor("/shop.v1.Catalog/List")
+
+	call := func(method, authorization string) (string, error) {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+		}
+		resp, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+			claims, _ := identityclient.ClaimsFromContext(ctx)
+			return claims.UserID, nil
+		})
+		uid, _ := resp.(string)
+		return uid, err
+	}
+
+	tests := []struct {
+		name, method, authorization string
+		wantUID                     string
+		wantCode                    codes.Code
+	}{
+		{"valid token", "/shop.v1.Orders/Get", "Bearer token-1", "u1", codes.OK},
+		{"missing token", "/shop.v1.Orders/Get", "", "", codes.Unauthenticated},
+		{"invalid token", "/shop.v1.Orders/Get", "Bearer forged", "", codes.Unauthenticated},
+		{"public method", "/shop.v1.Catalog/List", "", "", codes.OK},
+		{"health check", "/grpc.health.v1.Health/Check", "", "", codes.OK},
+	}
+	for _, tc := range tests {
+		uid, err := call(tc.method, tc.authorization)
+		if status.Code(err) != tc.wantCode || uid != tc.wantUID {
+			t.Errorf("%s: uid %q, err %v; want %q, %v", tc.name, uid, err, tc.wantUID, tc.wantCode)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package identitytest runs a fake identity gRPC service for tests of code
+// using identityclient.
+//
+//	srv := identitytest.NewServer()
+//	defer srv.Close()
+//	srv.AddUser(identityclient.User{ID: "u1", Email: "a@example.com"})
+//	srv.AddToken("token-1", identityclient.Claims{UserID: "u1", Role: "customer"})
+//	client := srv.Client()
+package identitytest
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/hawful70/shop-identity-service/internal/identity/transport/grpc/pb"
+	"github.com/hawful70/shop-identity-service/pkg/identityclient"
+)
+
+// Server answers GetUser, BatchGetUsers, GetUserByEmail and ValidateToken
+// from the users and tokens added to it. It does not authenticate callers
+// and ignores tenants.
+type Server struct {
+	pb.UnimplementedIdentityServiceServer
+
+	listener net.Listener
+	grpc     *grpc.Server
+
+	mu     sync.Mutex
+	users  map[string]identityclient.User
+	tokens map[string]identityclient.Claims
+	err    error
+	calls  int
+	md     metadata.MD
+}
+
+// NewServer starts a server on a loopback port. It panics if it cannot
+// listen, like httptest.NewServer.
+func NewServer() *Server {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("identitytest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		listener: lis,
+		users:    map[string]identityclient.User{},
+		tokens:   map[string]identityclient.Claims{},
+	}
+	s.grpc = grpc.NewServer(grpc.UnaryInterceptor(s.record))
+	pb.RegisterIdentityServiceServer(s.grpc, s)
+	go func() { _ = s.grpc.Serve(lis) }()
+	return s
+}
+
+// Addr is the server's host:port.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Client returns a client for the server; opts are applied after the
+// defaults, which dial without TLS and disable the claims cache.
+func (s *Server) Client(opts ...identityclient.Option) *identityclient.Client {
+	opts = append([]identityclient.Option{
+		identityclient.WithInsecure(),
+		identityclient.WithClaimsCache(0, 0),
+	}, opts...)
+	client, err := identityclient.New("passthrough:///"+s.Addr(), opts...)
+	if err != nil {
+		panic("identitytest: " + err.Error())
+	}
+	return client
+}
+
+// record counts the call and keeps its metadata for LastMetadata.
+func (s *Server) record(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.mu.Lock()
+	s.calls++
+	s.md = md
+	s.mu.Unlock()
+	return handler(ctx, req)
+}
+
+// Calls is the number of calls the server has received.
+func (s *Server) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// LastMetadata is the metadata of the latest call, such as x-tenant-id and
+// x-request-id.
+func (s *Server) LastMetadata() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.md.Copy()
+}
+
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+func (s *Server) AddUser(u identityclient.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.ID] = u
+}
+
+// AddToken makes token valid with claims; every other token is invalid.
+func (s *Server) AddToken(token string, claims identityclient.Claims) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = claims
+}
+
+func (s *Server) RevokeToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+// FailWith makes every call fail with err, e.g. status.Error(codes.Unavailable, ...),
+// until it is called again with nil.
+func (s *Server) FailWith(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	u, ok := s.users[req.GetUserId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &pb.GetUserResponse{User: toProtoUser(u)}, nil
+}
+
+func (s *Server) BatchGetUsers(ctx context.Context, req *pb.BatchGetUsersRequest) (*pb.BatchGetUsersResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	resp := &pb.BatchGetUsersResponse{}
+	for _, id := range req.GetUserIds() {
+		if u, ok := s.users[id]; ok {
+			resp.Users = append(resp.Users, toProtoUser(u))
+		} else {
+			resp.MissingUserIds = append(resp.MissingUserIds, id)
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.GetUserByEmailResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, strings.TrimSpace(req.GetEmail())) {
+			return &pb.GetUserByEmailResponse{User: toProtoUser(u)}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "user not found")
+}
+
+func (s *Server) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	claims, ok := s.tokens[req.GetToken()]
+	if !ok {
+		return &pb.ValidateTokenResponse{Valid: false, Error: "invalid token"}, nil
+	}
+	resp := &pb.ValidateTokenResponse{Valid: true, Claims: toProtoClaims(claims), Impersonated: claims.Impersonated()}
+	if u, ok := s.users[claims.UserID]; ok {
+		resp.User = toProtoUser(u)
+	}
+	return resp, nil
+}
+
+func toProtoUser(u identityclient.User) *pb.User {
+	user := &pb.User{
+		Id:         u.ID,
+		Email:      u.Email,
+		Username:   u.Username,
+		Provider:   u.Provider,
+		ProviderId: u.ProviderID,
+		Role:       u.Role,
+		TenantId:   u.TenantID,
+		Suspended:  u.Suspended,
+	}
+	if !u.CreatedAt.IsZero() {
+		user.CreatedAt = timestamppb.New(u.CreatedAt)
+	}
+	if !u.UpdatedAt.IsZero() {
+		user.UpdatedAt = timestamppb.New(u.UpdatedAt)
+	}
+	return user
+}
+
+func toProtoClaims(c identityclient.Claims) *pb.TokenClaims {
+	claims := &pb.TokenClaims{
+		UserId:   c.UserID,
+		Email:    c.Email,
+		Username: c.Username,
+		Role:     c.Role,
+		TenantId: c.TenantID,
+		OrgId:    c.OrgID,
+		OrgRole:  c.OrgRole,
+	}
+	if !c.ExpiresAt.IsZero() {
+		claims.ExpiresAt = timestamppb.New(c.ExpiresAt)
+	}
+	if c.Actor != nil {
+		claims.Actor = &pb.TokenActor{UserId: c.Actor.UserID, Email: c.Actor.Email}
+	}
+	return claims
+}
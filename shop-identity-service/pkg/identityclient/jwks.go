@@ -0,0 +1,250 @@
+package identityclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// errNoLocalKey sends a token to the ValidateToken RPC.
+var errNoLocalKey = errors.New("no local key for token")
+
+// jwksMinRefetch limits refetches caused by unknown key IDs, so tokens
+// with made-up key IDs cannot hammer the JWKS endpoint.
+const jwksMinRefetch = 30 * time.Second
+
+// tokenClaims mirrors the identity service's JWT claims.
+type tokenClaims struct {
+	UserID   string `json:"uid"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	TenantID string `json:"tid,omitempty"`
+	OrgID    string `json:"org,omitempty"`
+	OrgRole  string `json:"org_role,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+	Actor    *struct {
+		UserID string `json:"sub"`
+		Email  string `json:"email,omitempty"`
+	} `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// defaultTenant is what the service assumes for tokens without a tenant.
+const defaultTenant = "default"
+
+type jwksVerifier struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+	parser  *jwt.Parser
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+func newJWKSVerifier(o options) *jwksVerifier {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	}
+	if o.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(o.issuer))
+	}
+	if o.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(o.audience))
+	}
+	return &jwksVerifier{
+		url:     o.jwksURL,
+		client:  o.jwksClient,
+		refresh: o.jwksRefresh,
+		parser:  jwt.NewParser(parserOpts...),
+	}
+}
+
+// verify checks token against the key set. It returns errNoLocalKey when
+// the token is not signed with a published key, and ErrInvalidToken when
+// it is but does not verify.
+func (v *jwksVerifier) verify(ctx context.Context, token string) (Claims, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, &tokenClaims{})
+	if err != nil {
+		// Not a JWT; the server has the final say.
+		return Claims{}, errNoLocalKey
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	if _, hmac := unverified.Method.(*jwt.SigningMethodHMAC); hmac || kid == "" {
+		return Claims{}, errNoLocalKey
+	}
+	key, ok := v.key(ctx, kid)
+	if !ok {
+		return Claims{}, errNoLocalKey
+	}
+
+	var claims tokenClaims
+	parsed, err := v.parser.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return key, nil })
+	if err != nil || !parsed.Valid || claims.Purpose != "" {
+		return Claims{}, ErrInvalidToken
+	}
+
+	out := Claims{
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		TenantID:  claims.TenantID,
+		OrgID:     claims.OrgID,
+		OrgRole:   claims.OrgRole,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if out.TenantID == "" {
+		out.TenantID = defaultTenant
+	}
+	if claims.Actor != nil {
+		out.Actor = &Actor{UserID: claims.Actor.UserID, Email: claims.Actor.Email}
+	}
+	return out, nil
+}
+
+// key returns the public key named kid, fetching the key set when it is
+// stale or does not have kid. Fetch failures keep the keys already known.
+func (v *jwksVerifier) key(ctx context.Context, kid string) (any, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > v.refresh
+	if (ok && !stale) || (!ok && !stale && time.Since(v.fetchedAt) < jwksMinRefetch) {
+		return key, ok
+	}
+
+	keys, err := v.fetch(ctx)
+	v.fetchedAt = time.Now()
+	if err != nil {
+		slog.WarnContext(ctx, "identityclient: failed to fetch JWKS", "url", v.url, "error", err)
+		return key, ok
+	}
+	v.keys = keys
+	key, ok = keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *jwksVerifier) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			slog.WarnContext(ctx, "identityclient: skipping JWKS key", "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,92 @@
+package identityclient_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hawful70/shop-identity-service/pkg/identityclient"
+)
+
+// newJWKS serves pub as key kid and returns the URL of the key set.
+func newJWKS(t *testing.T, kid string, pub ed25519.PublicKey) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "OKP", "crv": "Ed25519", "use": "sig", "kid": kid,
+			"x": base64.RawURLEncoding.EncodeToString(pub),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func signEdDSA(t *testing.T, kid string, key ed25519.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed
+}
+
+func TestValidateTokenWithJWKS(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	srv, client := newServer(t, identityclient.WithJWKS(newJWKS(t, "k1", pub), time.Minute), identityclient.WithClaimsCache(0, 0))
+	srv.AddToken("opaque", identityclient.Claims{UserID: "u2", TenantID: "default"})
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	claims := func(tenant string, exp time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"uid": "u1", "email": "a@example.com", "role": "seller", "tid": tenant, "exp": exp.Unix()}
+	}
+
+	// Tokens signed with a published key never reach the service.
+	got, err := client.ValidateToken(ctx, signEdDSA(t, "k1", priv, claims("default", exp)))
+	if err != nil || got.UserID != "u1" || got.Role != "seller" || !got.ExpiresAt.Equal(exp) {
+		t.Fatalf("ValidateToken(local) = %+v, %v", got, err)
+	}
+	if calls := srv.Calls(); calls != 0 {
+		t.Fatalf("local validation made %d calls", calls)
+	}
+
+	rejected := []struct {
+		name  string
+		token string
+	}{
+		{"forged", signEdDSA(t, "k1", otherKey, claims("default", exp))},
+		{"expired", signEdDSA(t, "k1", priv, claims("default", time.Now().Add(-time.Minute)))},
+		{"other tenant", signEdDSA(t, "k1", priv, claims("acme", exp))},
+	}
+	for _, tc := range rejected {
+		if _, err := client.ValidateToken(ctx, tc.token); !errors.Is(err, identityclient.ErrInvalidToken) {
+			t.Fatalf("ValidateToken(%s): err = %v, want ErrInvalidToken", tc.name, err)
+		}
+	}
+	if calls := srv.Calls(); calls != 0 {
+		t.Fatalf("rejecting tokens signed with a published key made %d calls", calls)
+	}
+
+	// Anything else goes to the RPC: HMAC or opaque tokens and unknown keys.
+	if got, err := client.ValidateToken(ctx, "opaque"); err != nil || got.UserID != "u2" {
+		t.Fatalf("ValidateToken(opaque) = %+v, %v", got, err)
+	}
+	if _, err := client.ValidateToken(ctx, signEdDSA(t, "k2", otherKey, claims("default", exp))); !errors.Is(err, identityclient.ErrInvalidToken) {
+		t.Fatalf("ValidateToken(unknown key): err = %v, want ErrInvalidToken", err)
+	}
+	if calls := srv.Calls(); calls != 2 {
+		t.Fatalf("calls = %d, want 2", calls)
+	}
+}
@@ -0,0 +1,141 @@
+package identityclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type claimsKey struct{}
+
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims put there by Middleware or the
+// server interceptors.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+// Middleware authenticates HTTP requests by their bearer token and stores
+// the claims in the request context. It fits chi's Router.Use:
+//
+//	r.Use(client.Middleware)
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			http.Error(w, "missing or invalid authorization header", http.StatusUnauthorized)
+			return
+		}
+		claims, err := c.ValidateToken(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			slog.ErrorContext(r.Context(), "identityclient: failed to validate token", "error", err)
+			http.Error(w, "identity service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// RequireRole admits requests whose claims have one of roles. It must run
+// after Middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok || !slices.Contains(roles, claims.Role) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnaryServerInterceptor authenticates calls to a service's own gRPC server
+// by the bearer token in their authorization metadata. Health checks and
+// the methods listed in public (full names, e.g. "/shop.v1.Catalog/List")
+// need no token.
+func (c *Client) UnaryServerInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if isPublic(info.FullMethod, public) {
+			return handler(ctx, req)
+		}
+		ctx, err := c.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (c *Client) StreamServerInterceptor(public ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isPublic(info.FullMethod, public) {
+			return handler(srv, ss)
+		}
+		ctx, err := c.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &claimsStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func isPublic(method string, public []string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/") || slices.Contains(public, method)
+}
+
+func (c *Client) authenticate(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	token, ok := bearerToken(header)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "bearer token required")
+	}
+	claims, err := c.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		slog.ErrorContext(ctx, "identityclient: failed to validate token", "error", err)
+		return nil, status.Error(codes.Unavailable, "identity service unavailable")
+	}
+	return ContextWithClaims(ctx, claims), nil
+}
+
+type claimsStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *claimsStream) Context() context.Context {
+	return s.ctx
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
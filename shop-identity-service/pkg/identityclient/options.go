@@ -0,0 +1,203 @@
+package identityclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+type Option func(*options)
+
+type options struct {
+	// err is reported by New, for options that load files.
+	err     error
+	creds   credentials.TransportCredentials
+	tenant  string
+	timeout time.Duration
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	cacheSize int
+	cacheTTL  time.Duration
+
+	jwksURL     string
+	jwksRefresh time.Duration
+	jwksClient  *http.Client
+	issuer      string
+	audience    string
+	dialOpts    []grpc.DialOption
+}
+
+func defaultOptions() options {
+	return options{
+		timeout:        5 * time.Second,
+		maxAttempts:    4,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     2 * time.Second,
+		cacheSize:      10000,
+		cacheTTL:       30 * time.Second,
+		jwksRefresh:    10 * time.Minute,
+		jwksClient:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// WithMTLS authenticates the client with its certificate, as the identity
+// service expects from other services, and verifies the server against
+// caFile.
+func WithMTLS(certFile, keyFile, caFile string) Option {
+	return func(o *options) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			o.err = fmt.Errorf("load key pair: %w", err)
+			return
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			o.err = fmt.Errorf("read CA: %w", err)
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			o.err = fmt.Errorf("no certificates in %s", caFile)
+			return
+		}
+		o.creds = credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+}
+
+func WithTransportCredentials(creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.creds = creds
+	}
+}
+
+// WithInsecure dials without TLS, for local development and tests.
+func WithInsecure() Option {
+	return WithTransportCredentials(insecure.NewCredentials())
+}
+
+// WithTenant sets the tenant calls act for, unless the context names one
+// with ContextWithTenant. Without it the server's default tenant is used.
+func WithTenant(tenant string) Option {
+	return func(o *options) {
+		o.tenant = tenant
+	}
+}
+
+// WithTimeout bounds each call, retries included, when the caller's context
+// has no earlier deadline. The default is 5s.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithRetry retries calls failing with UNAVAILABLE up to maxAttempts times
+// in all (gRPC caps this at 5), backing off exponentially from initial to
+// limit with jitter. The default is 4 attempts from 100ms to 2s; 1 disables
+// retries.
+func WithRetry(maxAttempts int, initial, limit time.Duration) Option {
+	return func(o *options) {
+		o.maxAttempts = maxAttempts
+		o.initialBackoff = initial
+		o.maxBackoff = limit
+	}
+}
+
+// WithClaimsCache keeps up to size validated tokens for ttl, or until they
+// expire if that is sooner. A revoked session can be accepted for up to ttl.
+// The default is 10000 tokens for 30s; a size or ttl of 0 disables it.
+func WithClaimsCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheSize = size
+		o.cacheTTL = ttl
+	}
+}
+
+// WithJWKS verifies tokens signed with RSA, ECDSA or Ed25519 keys against
+// the key set at url, refetched every refresh and when an unknown key ID
+// shows up. Tokens it has no key for, including HMAC-signed ones, are
+// validated with the RPC.
+func WithJWKS(url string, refresh time.Duration) Option {
+	return func(o *options) {
+		o.jwksURL = url
+		if refresh > 0 {
+			o.jwksRefresh = refresh
+		}
+	}
+}
+
+// WithJWKSHTTPClient replaces the client used to fetch the JWKS.
+func WithJWKSHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.jwksClient = client
+	}
+}
+
+// WithIssuer and WithAudience are checked on tokens verified locally. The
+// RPC checks them against the tenant's own settings.
+func WithIssuer(issuer string) Option {
+	return func(o *options) {
+		o.issuer = issuer
+	}
+}
+
+func WithAudience(audience string) Option {
+	return func(o *options) {
+		o.audience = audience
+	}
+}
+
+// WithDialOptions passes extra options to grpc.NewClient, e.g. client
+// interceptors.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+func (o options) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(o.creds),
+		grpc.WithDefaultServiceConfig(o.serviceConfig()),
+		// The server accepts pings every 30s at most.
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Minute,
+			Timeout:             20 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	return append(opts, o.dialOpts...)
+}
+
+// serviceConfig sets the call timeout and lets gRPC retry. Every method of
+// the service is a read, so retrying is safe.
+func (o options) serviceConfig() string {
+	config := `"name":[{"service":"identity.v1.IdentityService"}]`
+	if o.timeout > 0 {
+		config += fmt.Sprintf(`,"timeout":"%s"`, seconds(o.timeout))
+	}
+	if o.maxAttempts > 1 {
+		config += fmt.Sprintf(`,"retryPolicy":{"maxAttempts":%d,"initialBackoff":"%s","maxBackoff":"%s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}`,
+			o.maxAttempts, seconds(o.initialBackoff), seconds(o.maxBackoff))
+	}
+	return `{"methodConfig":[{` + config + `}]}`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}